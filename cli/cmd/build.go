@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"os"
+	"path/filepath"
 
 	"github.com/aynaash/nextdeploy/cli/internal/buildflow"
 	"github.com/aynaash/nextdeploy/shared"
@@ -11,7 +12,12 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var forceBuild bool
+var (
+	forceBuild         bool
+	containerizedBuild bool
+	noBuild            bool
+	buildProjectDir    string
+)
 
 var buildCmd = &cobra.Command{
 	Use:   "build",
@@ -20,17 +26,19 @@ var buildCmd = &cobra.Command{
 		log := shared.PackageLogger("build", "BUILD")
 		log.Info("Starting NextDeploy build process...")
 
-		cfg, err := config.Load()
+		cfg, err := config.LoadFrom(filepath.Join(buildProjectDir, config.ConfigFile))
 		if err != nil {
 			log.Error("Failed to load config: %v", err)
 			os.Exit(1)
 		}
 
 		result, err := buildflow.Run(context.Background(), buildflow.Opts{
-			ProjectDir: ".",
-			Cfg:        cfg,
-			Force:      forceBuild,
-			Log:        log,
+			ProjectDir:         buildProjectDir,
+			Cfg:                cfg,
+			Force:              forceBuild,
+			SkipBuild:          noBuild,
+			ContainerizedBuild: containerizedBuild,
+			Log:                log,
 		})
 		if err != nil {
 			log.Error("Build failed: %v", err)
@@ -50,5 +58,8 @@ var buildCmd = &cobra.Command{
 
 func init() {
 	buildCmd.Flags().BoolVarP(&forceBuild, "force", "f", false, "Force a full build even if git commit is unchanged")
+	buildCmd.Flags().BoolVar(&containerizedBuild, "containerized-build", false, "Run next build in a Node container (app.build_image) so the output does not depend on the host toolchain")
+	buildCmd.Flags().BoolVar(&noBuild, "no-build", false, "Generate metadata from an existing .next without running next build; fails if .next/BUILD_ID is missing")
+	buildCmd.Flags().StringVar(&buildProjectDir, "project-dir", ".", "Directory of the Next.js project to build (holds nextdeploy.yml and package.json)")
 	rootCmd.AddCommand(buildCmd)
 }
@@ -7,7 +7,10 @@ var buildExplanation = explanation{
 		"resulting output mode against the declared target (serverless " +
 		"vs vps), assembles a release directory, and produces app.tar.gz " +
 		"— the artifact `ship` uploads. Git-aware: re-running without " +
-		"code changes is a no-op unless --force is passed.",
+		"code changes is a no-op unless --force is passed. --no-build " +
+		"skips `next build` and generates metadata from the existing " +
+		".next (for CI that builds in a separate step); it fails if " +
+		".next/BUILD_ID is missing.",
 	Phases: []phase{
 		{
 			Num:       1,
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aynaash/nextdeploy/shared"
+	"github.com/aynaash/nextdeploy/shared/config"
+	"github.com/aynaash/nextdeploy/shared/nextcore"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Read, change or validate nextdeploy.yml",
+	Long: `Reads or changes one value of nextdeploy.yml by dotted path, e.g.
+app.port, app.domain, docker.registry or servers.0.host.
+
+When only nextdeploy.yml.enc is present it is decrypted in memory with the app
+master key and, after a set, re-encrypted; no plaintext copy is written.`,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get PATH",
+	Short: "Print the value at PATH",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		log := shared.PackageLogger("config", "⚙️ CONFIG")
+		doc, _ := readConfigSource(log)
+		value, err := config.GetField(doc, args[0])
+		if err != nil {
+			log.Error("%v", err)
+			os.Exit(1)
+		}
+		fmt.Println(value)
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set PATH VALUE",
+	Short: "Set the scalar at PATH to VALUE, keeping comments",
+	Long: `Sets one scalar field. The path must exist in the config schema and VALUE
+must fit the field's type, so app.port=abc or a misspelled key is rejected
+before anything is written. Missing parent blocks are created.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		log := shared.PackageLogger("config", "⚙️ CONFIG")
+		doc, encrypted := readConfigSource(log)
+		out, err := config.SetField(doc, args[0], args[1])
+		if err != nil {
+			log.Error("%v", err)
+			os.Exit(1)
+		}
+
+		if encrypted {
+			if err := newAppSecretManager(log).EncryptWithPlatformKey(out, config.ConfigFile+".enc"); err != nil {
+				log.Error("Failed to re-encrypt %s.enc: %v", config.ConfigFile, err)
+				os.Exit(1)
+			}
+			log.Success("Set %s in %s.enc", args[0], config.ConfigFile)
+			return
+		}
+
+		info, err := os.Stat(config.ConfigFile)
+		if err != nil {
+			log.Error("Failed to stat %s: %v", config.ConfigFile, err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(config.ConfigFile, out, info.Mode().Perm()); err != nil {
+			log.Error("Failed to write %s: %v", config.ConfigFile, err)
+			os.Exit(1)
+		}
+		log.Success("Set %s in %s", args[0], config.ConfigFile)
+		if _, err := os.Stat(config.ConfigFile + ".enc"); err == nil {
+			log.Warn("%s.enc still holds the old value; run `nextdeploy secrets encrypt %s` to refresh it", config.ConfigFile, config.ConfigFile)
+		}
+	},
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade nextdeploy.yml to the current schema version",
+	Long: `Detects the file's schema_version (absent means 1) and applies each newer
+migration in order, then bumps schema_version. The original file is kept next
+to it as <file>.v<N>.bak. Comments and key order are preserved.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		log := shared.PackageLogger("config", "⚙️ CONFIG")
+		doc, encrypted := readConfigSource(log)
+		out, from, err := config.Migrate(doc)
+		if err != nil {
+			log.Error("%v", err)
+			os.Exit(1)
+		}
+		if from == config.CurrentSchemaVersion {
+			log.Info("%s is already at schema_version %d", config.ConfigFile, from)
+			return
+		}
+
+		target := config.ConfigFile
+		if encrypted {
+			target += ".enc"
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			log.Error("Failed to stat %s: %v", target, err)
+			os.Exit(1)
+		}
+		backup := fmt.Sprintf("%s.v%d.bak", target, from)
+		// #nosec G304 -- target is nextdeploy.yml(.enc) in the working directory
+		original, err := os.ReadFile(target)
+		if err == nil {
+			err = os.WriteFile(backup, original, info.Mode().Perm())
+		}
+		if err != nil {
+			log.Error("Failed to back up %s: %v", target, err)
+			os.Exit(1)
+		}
+
+		if encrypted {
+			err = newAppSecretManager(log).EncryptWithPlatformKey(out, target)
+		} else {
+			err = os.WriteFile(target, out, info.Mode().Perm())
+		}
+		if err != nil {
+			log.Error("Failed to write %s: %v (original kept in %s)", target, err, backup)
+			os.Exit(1)
+		}
+		log.Success("Migrated %s from schema_version %d to %d (backup: %s)", target, from, config.CurrentSchemaVersion, backup)
+		if !encrypted {
+			if _, err := os.Stat(config.ConfigFile + ".enc"); err == nil {
+				log.Warn("%s.enc still holds the old layout; run `nextdeploy secrets encrypt %s` to refresh it", config.ConfigFile, config.ConfigFile)
+			}
+		}
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Report every problem in nextdeploy.yml with its line",
+	Long: `Checks nextdeploy.yml without deploying: YAML syntax, values of the wrong
+type, and the checks a VPS ship runs on app.start, app.domain, app.volumes,
+app.stop, app.resources and app.hooks. Every problem is listed with its field
+and line, not just the first. Exits non-zero when there are any.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		log := shared.PackageLogger("config", "⚙️ CONFIG")
+		doc, _ := readConfigSource(log)
+		if err := config.Check(doc); err != nil {
+			log.Error("%v", err)
+			os.Exit(1)
+		}
+		log.Success("%s is valid", config.ConfigFile)
+	},
+}
+
+var (
+	configLintStrict       bool
+	configLintDaemonConfig string
+)
+
+var configLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Report insecure settings in nextdeploy.yml and the project",
+	Long: `Checks for settings that are valid but unsafe, most severe first:
+
+  env-not-ignored       .env (or another .env.* file) is not in .gitignore
+  plaintext-credential  a password, secret, token or access key written into
+                        nextdeploy.yml instead of a ${secret:NAME} reference
+  docker-socket-mount   an app.volumes bind mount of the docker socket
+  powered-by-header     next.config leaves poweredByHeader at its default, true
+  daemon-socket-mode    with --daemon-config, a socket_mode looser than 0660
+
+Without --strict it only reports; with --strict it exits non-zero when any
+finding is high severity, so CI can gate on it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		log := shared.PackageLogger("config", "⚙️ CONFIG")
+		doc, _ := readConfigSource(log)
+		cwd, err := os.Getwd()
+		if err != nil {
+			log.Error("Failed to get working directory: %v", err)
+			os.Exit(1)
+		}
+
+		in := config.LintInput{ProjectDir: cwd}
+		if next, err := nextcore.ParseNextConfigFile(filepath.Join(cwd, "next.config.mjs")); err != nil {
+			log.Warn("Skipping next.config checks: %v", err)
+		} else {
+			in.PoweredByHeader = &next.PoweredByHeader
+		}
+		if configLintDaemonConfig != "" {
+			// #nosec G304 -- a path the user named
+			in.DaemonConfig, err = os.ReadFile(configLintDaemonConfig)
+			if err != nil {
+				log.Error("Failed to read daemon config: %v", err)
+				os.Exit(1)
+			}
+			in.DaemonConfigFile = configLintDaemonConfig
+		}
+
+		findings, err := config.Lint(doc, in)
+		if err != nil {
+			log.Error("%v", err)
+			os.Exit(1)
+		}
+		if len(findings) == 0 {
+			log.Success("No insecure settings found")
+			return
+		}
+		high := 0
+		for _, f := range findings {
+			fmt.Println(f)
+			if f.Severity == config.SeverityHigh {
+				high++
+			}
+		}
+		fmt.Printf("\n%d finding(s), %d high severity\n", len(findings), high)
+		if configLintStrict && high > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// readConfigSource returns the raw nextdeploy.yml, or the decrypted
+// nextdeploy.yml.enc when there is no plaintext copy, and whether it came from
+// the encrypted file.
+func readConfigSource(log *shared.Logger) ([]byte, bool) {
+	doc, err := os.ReadFile(config.ConfigFile)
+	if err == nil {
+		return doc, false
+	}
+	if !os.IsNotExist(err) {
+		log.Error("Failed to read %s: %v", config.ConfigFile, err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(config.ConfigFile + ".enc"); err != nil {
+		log.Error("No %s or %s.enc in the current directory", config.ConfigFile, config.ConfigFile)
+		os.Exit(1)
+	}
+	plain, err := newAppSecretManager(log).DecryptWithPlatformKey(config.ConfigFile + ".enc")
+	if err != nil {
+		log.Error("Failed to decrypt %s.enc: %v", config.ConfigFile, err)
+		os.Exit(1)
+	}
+	return []byte(plain), true
+}
+
+func init() {
+	configCmd.PersistentFlags().StringVar(&secretsCryptApp, "app", "", "App name whose master key decrypts nextdeploy.yml.enc (defaults to app.name in nextdeploy.yml)")
+	configLintCmd.Flags().BoolVar(&configLintStrict, "strict", false, "Exit non-zero on any high-severity finding")
+	configLintCmd.Flags().StringVar(&configLintDaemonConfig, "daemon-config", "", "Also check this nextdeployd config (config.json or YAML)")
+	configCmd.AddCommand(configGetCmd, configSetCmd, configMigrateCmd, configValidateCmd, configLintCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+var configExplanation = explanation{
+	Name:     "config",
+	Synopsis: "Read, change, validate, lint or migrate nextdeploy.yml.",
+	Summary: "`config get` prints the value at a dotted path; `config set` changes one " +
+		"scalar after checking the path against the config schema and the value " +
+		"against the field's type. Comments and key order in the file are kept, and " +
+		"an encrypted-only config is edited in memory and re-encrypted. `config " +
+		"migrate` upgrades an older schema_version in place, keeping a backup. " +
+		"`config validate` lists every syntax, type and deploy-check problem with " +
+		"its field and line; `config lint` reports insecure settings by severity " +
+		"and, with --strict, fails on any high-severity one.",
+	Phases: []phase{
+		{
+			Num:       1,
+			Title:     "Read the config",
+			Narrative: "Reads nextdeploy.yml; if only nextdeploy.yml.enc exists, decrypts it with the app master key without writing a plaintext copy.",
+			Ref:       "cli/cmd/config.go",
+			Function:  "readConfigSource",
+		},
+		{
+			Num:       2,
+			Title:     "Resolve and validate",
+			Narrative: "Maps the dotted path onto NextDeployConfig's YAML fields. For set, the value is decoded into the field's Go type first, so a wrong type or unknown key fails before anything is written.",
+			Ref:       "shared/config/path.go",
+			Function:  "config.GetField | config.SetField | config.Migrate | config.Check | config.Lint",
+		},
+		{
+			Num:       3,
+			Title:     "Write back",
+			Narrative: "Writes the edited YAML to nextdeploy.yml, or re-encrypts it to nextdeploy.yml.enc when that was the source. A migration first copies the original to <file>.v<N>.bak.",
+			Ref:       "cli/cmd/config.go",
+			Function:  "os.WriteFile | SecretManager.EncryptWithPlatformKey",
+			Output:    "updated nextdeploy.yml or nextdeploy.yml.enc",
+		},
+	},
+}
+
+func init() {
+	registerExplain(configCmd, &configExplanation)
+}
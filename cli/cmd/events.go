@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aynaash/nextdeploy/cli/internal/server"
+	"github.com/aynaash/nextdeploy/shared"
+	"github.com/aynaash/nextdeploy/shared/config"
+	"github.com/spf13/cobra"
+)
+
+var eventsJSON bool
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Stream lifecycle events (start, stop, exit, failure) of the app's releases",
+	Long: "Follows what systemd records about the app's release units — starts, stops, " +
+		"process exits, restarts and failures — and prints one line per event until " +
+		"interrupted. With --json each event is a JSON object, for dashboards.",
+	Run: func(cmd *cobra.Command, args []string) {
+		log := shared.PackageLogger("events", "📡 EVENTS")
+		cfg, err := config.Load()
+		if err != nil {
+			log.Error("Failed to load config: %v", err)
+			os.Exit(1)
+		}
+
+		srv, err := server.New(server.WithConfig(), server.WithSSH())
+		if err != nil {
+			log.Error("Failed to initialize server connection: %v", err)
+			os.Exit(1)
+		}
+		defer srv.CloseSSHConnection()
+
+		deploymentServer, err := srv.GetDeploymentServer()
+		if err != nil {
+			log.Error("Failed to get deployment server: %v", err)
+			os.Exit(1)
+		}
+
+		// Cancelling the context kills the remote journalctl, so an
+		// interrupted stream does not leave it running on the server.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if !eventsJSON {
+			fmt.Printf("\n\033[1;36mNextDeploy Events: %s\033[0m\n", cfg.App.Name)
+			fmt.Println("\033[90m──────────────────────────────────────────────────\033[0m")
+		}
+		w := &unitEventWriter{out: os.Stdout, appName: cfg.App.Name, json: eventsJSON}
+		// PID 1 logs every unit lifecycle transition; -n 0 skips history.
+		// An interrupt ends the stream as intended; anything else (no
+		// sudo, journalctl missing, a dropped connection) is a failure.
+		if _, err := srv.ExecuteCommand(ctx, deploymentServer, "sudo journalctl -f -n 0 -o json _PID=1", w); err != nil && ctx.Err() == nil {
+			log.Error("Event stream from %s ended: %v", deploymentServer, err)
+			os.Exit(1)
+		}
+	},
+}
+
+// systemd catalog IDs for the lifecycle entries that are not job results.
+const (
+	msgUnitFailed       = "be02cf6855d2428ba40df7e9d022f03d"
+	msgProcessExited    = "98e322203f7a4ed290d09fe03c09fe15"
+	msgRestartScheduled = "5eb03494b6584870a536b337290809b3"
+)
+
+// unitEvent is one lifecycle transition of a release unit.
+type unitEvent struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Release string    `json:"release"`
+	Unit    string    `json:"unit"`
+	Message string    `json:"message"`
+}
+
+var eventReleaseID = regexp.MustCompile(`^[0-9]+-[0-9A-Za-z]+(\.[0-9]+)?$`)
+
+// parseUnitEvent turns one `journalctl -o json` entry into an event for
+// appName's release units. ok is false for entries about other units and for
+// PID 1 chatter that is not a lifecycle transition.
+func parseUnitEvent(line []byte, appName string) (unitEvent, bool) {
+	var e map[string]any
+	if err := json.Unmarshal(line, &e); err != nil {
+		return unitEvent{}, false
+	}
+	field := func(k string) string {
+		s, _ := e[k].(string)
+		return s
+	}
+
+	unit := field("UNIT")
+	release, ok := strings.CutPrefix(strings.TrimSuffix(unit, ".service"), "nextdeploy-"+appName+"-")
+	if unit == "nextdeploy-"+appName+".service" {
+		release, ok = "legacy", true
+	}
+	if !ok || (release != "legacy" && !eventReleaseID.MatchString(release)) {
+		return unitEvent{}, false
+	}
+
+	var action string
+	switch field("MESSAGE_ID") {
+	case msgUnitFailed:
+		action = "failed"
+	case msgProcessExited:
+		action = "exit"
+	case msgRestartScheduled:
+		action = "restart"
+	default:
+		switch result := field("JOB_RESULT"); {
+		case result == "done" && (field("JOB_TYPE") == "start" || field("JOB_TYPE") == "stop"):
+			action = field("JOB_TYPE")
+		case result != "" && result != "done":
+			action = field("JOB_TYPE") + "-" + result
+		default:
+			return unitEvent{}, false
+		}
+	}
+
+	ev := unitEvent{Action: action, Release: release, Unit: unit, Message: field("MESSAGE")}
+	if us, err := strconv.ParseInt(field("__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		ev.Time = time.UnixMicro(us)
+	}
+	return ev, true
+}
+
+// unitEventWriter reassembles the JSON lines of a streamed journalctl and
+// prints the events that belong to appName.
+type unitEventWriter struct {
+	out     io.Writer
+	appName string
+	json    bool
+	buf     []byte
+}
+
+func (w *unitEventWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := w.buf[:i]
+		w.buf = w.buf[i+1:]
+
+		ev, ok := parseUnitEvent(line, w.appName)
+		if !ok {
+			continue
+		}
+		if w.json {
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w.out, "%s\n", data)
+			continue
+		}
+		fmt.Fprintf(w.out, "\033[90m%s\033[0m %-13s %-22s %s\n", ev.Time.Local().Format("15:04:05"), ev.Action, ev.Release, ev.Message)
+	}
+	return len(p), nil
+}
+
+func init() {
+	eventsCmd.Flags().BoolVar(&eventsJSON, "json", false, "Print each event as a JSON object")
+	rootCmd.AddCommand(eventsCmd)
+}
@@ -0,0 +1,38 @@
+package cmd
+
+var eventsExplanation = explanation{
+	Name:     "events",
+	Synopsis: "Stream lifecycle events of the app's releases.",
+	Summary: "`events` follows the systemd journal on the VPS for entries PID 1 " +
+		"writes about the app's release units — starts, stops, process exits, " +
+		"scheduled restarts and failures — and prints one line (or JSON object) " +
+		"per event until interrupted.",
+	Phases: []phase{
+		{
+			Num:       1,
+			Title:     "Load config and connect",
+			Narrative: "Reads nextdeploy.yml for the app name and opens an SSH session to the deployment server.",
+			Ref:       "cli/cmd/events.go",
+			Function:  "config.Load | server.New",
+		},
+		{
+			Num:       2,
+			Title:     "Follow the journal",
+			Narrative: "Runs `journalctl -f -n 0 -o json _PID=1` remotely. Interrupting the command cancels the session and kills the remote journalctl.",
+			Ref:       "cli/cmd/events.go",
+			Function:  "ServerStruct.ExecuteCommand",
+		},
+		{
+			Num:       3,
+			Title:     "Filter and print",
+			Narrative: "Keeps entries whose unit is one of this app's releases and that record a lifecycle transition; prints time, action, release ID and the systemd message.",
+			Ref:       "cli/cmd/events.go",
+			Function:  "parseUnitEvent",
+			Output:    "stdout lines or JSON objects (--json)",
+		},
+	},
+}
+
+func init() {
+	registerExplain(eventsCmd, &eventsExplanation)
+}
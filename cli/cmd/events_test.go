@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseUnitEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		wantOK     bool
+		wantAction string
+	}{
+		{"start", `{"UNIT":"nextdeploy-shop-1712345678-abc1234.service","JOB_TYPE":"start","JOB_RESULT":"done","MESSAGE":"Started shop"}`, true, "start"},
+		{"stop", `{"UNIT":"nextdeploy-shop-1712345678-abc1234.service","JOB_TYPE":"stop","JOB_RESULT":"done"}`, true, "stop"},
+		{"start failed", `{"UNIT":"nextdeploy-shop-1712345678-abc1234.service","JOB_TYPE":"start","JOB_RESULT":"failed"}`, true, "start-failed"},
+		{"exit", `{"UNIT":"nextdeploy-shop-1712345678-abc1234.1.service","MESSAGE_ID":"98e322203f7a4ed290d09fe03c09fe15"}`, true, "exit"},
+		{"unit failed", `{"UNIT":"nextdeploy-shop.service","MESSAGE_ID":"be02cf6855d2428ba40df7e9d022f03d"}`, true, "failed"},
+		{"other app with shared prefix", `{"UNIT":"nextdeploy-shop-api-1712345678-abc1234.service","JOB_TYPE":"start","JOB_RESULT":"done"}`, false, ""},
+		{"not a lifecycle entry", `{"UNIT":"nextdeploy-shop-1712345678-abc1234.service","MESSAGE":"Consumed 1.2s CPU time."}`, false, ""},
+		{"not json", `-- No entries --`, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, ok := parseUnitEvent([]byte(tt.line), "shop")
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && ev.Action != tt.wantAction {
+				t.Errorf("action = %q, want %q", ev.Action, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestUnitEventWriterSplitLines(t *testing.T) {
+	var out bytes.Buffer
+	w := &unitEventWriter{out: &out, appName: "shop", json: true}
+	entry := `{"UNIT":"nextdeploy-shop-1712345678-abc1234.service","JOB_TYPE":"start","JOB_RESULT":"done","__REALTIME_TIMESTAMP":"1712345678000000"}` + "\n"
+
+	// SSH delivers the stream in arbitrary chunks.
+	_, _ = w.Write([]byte(entry[:40]))
+	if out.Len() != 0 {
+		t.Fatal("a partial line must not be printed")
+	}
+	_, _ = w.Write([]byte(entry[40:]))
+	if got := out.String(); !strings.Contains(got, `"action":"start"`) || !strings.Contains(got, `"release":"1712345678-abc1234"`) {
+		t.Errorf("output = %q", got)
+	}
+}
@@ -33,6 +33,19 @@ var logsCmd = &cobra.Command{
 		showAudit, _ := cmd.Flags().GetBool("audit")
 		showDaemon, _ := cmd.Flags().GetBool("daemon")
 		showAll, _ := cmd.Flags().GetBool("all")
+		opts := appLogOpts{route: routeFilter}
+		opts.releases, _ = cmd.Flags().GetBool("releases")
+		opts.tail, _ = cmd.Flags().GetInt("tail")
+		opts.tailSet = cmd.Flags().Changed("tail")
+		opts.follow, _ = cmd.Flags().GetBool("follow")
+		opts.grep, _ = cmd.Flags().GetString("grep")
+		opts.invert, _ = cmd.Flags().GetBool("invert")
+		opts.since, _ = cmd.Flags().GetString("since")
+		// A search prints its matches and exits unless --follow is asked
+		// for explicitly; following streams through grep instead.
+		if opts.grep != "" && !cmd.Flags().Changed("follow") {
+			opts.follow = false
+		}
 
 		srv, err := server.New(server.WithConfig(), server.WithSSH())
 		if err != nil {
@@ -60,7 +73,7 @@ var logsCmd = &cobra.Command{
 			// 1. App Logs
 			go func() {
 				defer wg.Done()
-				streamAppLogs(ctx, srv, deploymentServer, appName, routeFilter, agg.GetWriter(logs.SourceApp))
+				streamAppLogs(ctx, srv, deploymentServer, appName, opts, agg.GetWriter(logs.SourceApp))
 			}()
 
 			// 2. Audit Logs
@@ -95,30 +108,109 @@ var logsCmd = &cobra.Command{
 			return
 		}
 
-		streamAppLogs(ctx, srv, deploymentServer, appName, routeFilter, agg.GetWriter(logs.SourceApp))
+		streamAppLogs(ctx, srv, deploymentServer, appName, opts, agg.GetWriter(logs.SourceApp))
 	},
 }
 
-func streamAppLogs(ctx context.Context, srv *server.ServerStruct, serverName, appName, routeFilter string, out io.Writer) {
-	daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd logs --appName=%s", shellQuote(appName))
-	serviceName, err := srv.ExecuteCommand(ctx, serverName, daemonCmd, nil)
+// appLogOpts shapes the journalctl query behind streamAppLogs.
+type appLogOpts struct {
+	route    string
+	releases bool // every release unit of the app, not just the active one
+	tail     int
+	tailSet  bool // --tail was given; a search otherwise scans the daemon's default depth
+	follow   bool
+	grep     string // regular expression lines must match
+	invert   bool   // keep the lines grep does not match
+	since    string // journalctl --since
+}
+
+func streamAppLogs(ctx context.Context, srv *server.ServerStruct, serverName, appName string, opts appLogOpts, out io.Writer) {
+	daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd logs --appName=%s", shared.ShellQuote(appName))
+	if opts.releases {
+		daemonCmd += " --all-releases"
+	}
+	if opts.grep != "" && !opts.follow {
+		searchAppLogs(ctx, srv, serverName, appName, daemonCmd, opts, out)
+		return
+	}
+	services, err := srv.ExecuteCommand(ctx, serverName, daemonCmd, nil)
 	if err != nil {
 		sensitive.Fprintf(os.Stderr, "\033[31mError querying app logs: %v\033[0m\n", err)
 		return
 	}
-	serviceName = strings.TrimSpace(serviceName)
+	services = strings.TrimSpace(services)
 
-	if serviceName == "APP_NOT_DEPLOYED" {
+	if services == "APP_NOT_DEPLOYED" {
+		fmt.Printf("\033[33mNo logs found.\033[0m The application '%s' is not currently running or has been decommissioned.\n", appName)
+		return
+	}
+
+	_, _ = srv.ExecuteCommand(ctx, serverName, "sudo "+journalCommand(strings.Fields(services), opts), out)
+}
+
+// searchAppLogs has the daemon filter the journal and prints what matched,
+// so only matching lines cross the connection.
+func searchAppLogs(ctx context.Context, srv *server.ServerStruct, serverName, appName, daemonCmd string, opts appLogOpts, out io.Writer) {
+	matches, err := srv.ExecuteCommand(ctx, serverName, logSearchCommand(daemonCmd, opts), nil)
+	if err != nil {
+		sensitive.Fprintf(os.Stderr, "\033[31mError searching app logs: %v\033[0m\n%s\n", err, strings.TrimSpace(matches))
+		return
+	}
+	matches = strings.TrimSpace(matches)
+	if matches == "APP_NOT_DEPLOYED" {
 		fmt.Printf("\033[33mNo logs found.\033[0m The application '%s' is not currently running or has been decommissioned.\n", appName)
 		return
 	}
+	_, _ = io.WriteString(out, matches+"\n")
+}
 
-	journalCmd := fmt.Sprintf("journalctl -u %s -f -n 50", serviceName)
-	if routeFilter != "" {
-		journalCmd += fmt.Sprintf(" | grep --line-buffered \"%s\"", routeFilter)
+// logSearchCommand adds the search options to the daemon's logs command.
+// --tail is how many journal lines the daemon searches, so it is only sent
+// when given: its default of 50 would cut a search to the last 50 lines.
+func logSearchCommand(daemonCmd string, opts appLogOpts) string {
+	daemonCmd += " --grep=" + shared.ShellQuote(opts.grep)
+	if opts.tailSet {
+		daemonCmd += fmt.Sprintf(" --tail=%d", opts.tail)
+	}
+	if opts.invert {
+		daemonCmd += " --invert"
 	}
+	if opts.since != "" {
+		daemonCmd += " --since=" + shared.ShellQuote(opts.since)
+	}
+	return daemonCmd
+}
 
-	_, _ = srv.ExecuteCommand(ctx, serverName, "sudo "+journalCmd, out)
+// journalCommand builds the journalctl invocation for the given units. With
+// several units journalctl interleaves them by timestamp itself; the with-unit
+// format keeps each line attributable so the aggregator can label it with its
+// release ID.
+func journalCommand(units []string, opts appLogOpts) string {
+	cmd := "journalctl"
+	for _, u := range units {
+		cmd += " -u " + shared.ShellQuote(u)
+	}
+	if len(units) > 1 {
+		cmd += " -o with-unit"
+	}
+	if opts.follow {
+		cmd += " -f"
+	}
+	cmd += fmt.Sprintf(" -n %d", opts.tail)
+	if opts.since != "" {
+		cmd += " --since=" + shared.ShellQuote(opts.since)
+	}
+	if opts.route != "" {
+		cmd += " | grep --line-buffered " + shared.ShellQuote(opts.route)
+	}
+	if opts.grep != "" {
+		cmd += " | grep --line-buffered -E"
+		if opts.invert {
+			cmd += " -v"
+		}
+		cmd += " -e " + shared.ShellQuote(opts.grep)
+	}
+	return cmd
 }
 
 func init() {
@@ -126,5 +218,11 @@ func init() {
 	logsCmd.Flags().Bool("audit", false, "Stream the daemon audit log")
 	logsCmd.Flags().Bool("daemon", false, "Stream the daemon process log")
 	logsCmd.Flags().Bool("all", false, "Stream everything (App + Audit + Daemon)")
+	logsCmd.Flags().Bool("releases", false, "Interleave logs from every release of the app (e.g. old and new during a rollout), labelled by release ID")
+	logsCmd.Flags().Int("tail", 50, "Number of recent app log lines to show; with --grep, how many recent lines to search (default 10000)")
+	logsCmd.Flags().Bool("follow", true, "Keep streaming new app log lines (--follow=false prints and exits)")
+	logsCmd.Flags().String("grep", "", "Only show app log lines matching this regular expression, filtered on the server (prints and exits unless --follow is given)")
+	logsCmd.Flags().Bool("invert", false, "With --grep, show the lines that do not match")
+	logsCmd.Flags().String("since", "", "Only show app log lines newer than this journalctl time (e.g. -1h, \"2024-05-01 10:00\")")
 	rootCmd.AddCommand(logsCmd)
 }
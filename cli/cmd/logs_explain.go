@@ -7,7 +7,9 @@ var logsExplanation = explanation{
 	Synopsis: "Stream application logs from the running deployment.",
 	Summary: "`logs` tails whatever logging surface the target provider " +
 		"exposes. VPS: connects to the nextdeploy daemon's log aggregator " +
-		"which colorizes and de-noises systemd + container output. " +
+		"which colorizes and de-noises systemd + container output; " +
+		"--grep has the daemon search the journal and send back only " +
+		"the matching lines. " +
 		"Serverless AWS: streams CloudWatch for the Lambda function. " +
 		"Serverless Cloudflare: uses `wrangler tail` under the hood when " +
 		"available.",
@@ -22,7 +24,7 @@ var logsExplanation = explanation{
 		{
 			Num:       2,
 			Title:     "Open log stream",
-			Narrative: "VPS: opens an SSH session and subscribes to the daemon's /logs/stream. AWS: starts a CloudWatch Logs tail with the Lambda log group. Cloudflare: spawns wrangler tail.",
+			Narrative: "VPS: opens an SSH session and subscribes to the daemon's /logs/stream. With --releases, every release unit of the app is passed to one journalctl, which interleaves them by timestamp. AWS: starts a CloudWatch Logs tail with the Lambda log group. Cloudflare: spawns wrangler tail.",
 			Ref:       logsGoFile,
 			Output:    "io.Reader of log events",
 		},
@@ -0,0 +1,65 @@
+package cmd
+
+import "testing"
+
+func TestJournalCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		units []string
+		opts  appLogOpts
+		want  string
+	}{
+		{
+			name:  "active release, following",
+			units: []string{"nextdeploy-shop-1-abc.service"},
+			opts:  appLogOpts{tail: 50, follow: true},
+			want:  "journalctl -u 'nextdeploy-shop-1-abc.service' -f -n 50",
+		},
+		{
+			name:  "all releases interleaved with route filter",
+			units: []string{"nextdeploy-shop-1-abc.service", "nextdeploy-shop-2-def.service"},
+			opts:  appLogOpts{route: "/api/upload", tail: 200},
+			want:  "journalctl -u 'nextdeploy-shop-1-abc.service' -u 'nextdeploy-shop-2-def.service' -o with-unit -n 200 | grep --line-buffered '/api/upload'",
+		},
+		{
+			name:  "following with an inverted grep since an hour ago",
+			units: []string{"nextdeploy-shop-1-abc.service"},
+			opts:  appLogOpts{tail: 50, follow: true, grep: "GET /healthz", invert: true, since: "-1h"},
+			want:  "journalctl -u 'nextdeploy-shop-1-abc.service' -f -n 50 --since='-1h' | grep --line-buffered -E -v -e 'GET /healthz'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := journalCommand(tt.units, tt.opts); got != tt.want {
+				t.Errorf("journalCommand =\n %q\nwant\n %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogSearchCommand(t *testing.T) {
+	const base = "sudo /usr/local/bin/nextdeployd logs --appName='shop'"
+	tests := []struct {
+		name string
+		opts appLogOpts
+		want string
+	}{
+		{
+			name: "default tail leaves the scan depth to the daemon",
+			opts: appLogOpts{grep: "timeout", tail: 50},
+			want: base + " --grep='timeout'",
+		},
+		{
+			name: "explicit tail bounds the scan",
+			opts: appLogOpts{grep: "timeout", tail: 500, tailSet: true, invert: true, since: "-1h"},
+			want: base + " --grep='timeout' --tail=500 --invert --since='-1h'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logSearchCommand(base, tt.opts); got != tt.want {
+				t.Errorf("logSearchCommand =\n %q\nwant\n %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@ import (
 var (
 	rollbackSteps    int
 	rollbackToCommit string
+	rollbackDryRun   bool
 )
 
 var rollbackCmd = &cobra.Command{
@@ -25,7 +26,9 @@ var rollbackCmd = &cobra.Command{
 By default, rolls back one step (the deployment immediately before the active one).
 Use --steps N to walk further back (up to the retention limit, currently 5).
 Use --to <commit> to roll back to a specific git commit (full or short SHA prefix);
-the commit must still be within the retention window.`,
+the commit must still be within the retention window.
+Use --dry-run to see which release and commit a VPS rollback would restore
+without changing anything.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log := shared.PackageLogger("rollback", "⏪ ROLLBACK")
 		log.Info("Starting NextDeploy rollback process...")
@@ -48,6 +51,10 @@ the commit must still be within the retention window.`,
 		switch cfg.TargetType {
 		case "serverless":
 			log.Info("Deployment Target: SERVERLESS (No VPS required)")
+			if rollbackDryRun {
+				log.Error("--dry-run is only supported for VPS targets")
+				os.Exit(1)
+			}
 			if cfg.Serverless == nil {
 				log.Error("TargetType is 'serverless' but 'serverless' config block is missing.")
 				os.Exit(1)
@@ -85,19 +92,24 @@ the commit must still be within the retention window.`,
 			}
 
 			log.Info("Triggering daemon to rollback %s on %s...", cfg.App.Name, deploymentServer)
-			daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd rollback --appName=%s", shellQuote(cfg.App.Name))
+			daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd rollback --appName=%s", shared.ShellQuote(cfg.App.Name))
 			if rollbackToCommit != "" {
-				daemonCmd += fmt.Sprintf(" --toCommit=%s", shellQuote(rollbackToCommit))
+				daemonCmd += fmt.Sprintf(" --toCommit=%s", shared.ShellQuote(rollbackToCommit))
 			} else if rollbackSteps > 0 {
 				daemonCmd += fmt.Sprintf(" --steps=%d", rollbackSteps)
 			}
+			if rollbackDryRun {
+				daemonCmd += " --dry-run"
+			}
 			output, err := srv.ExecuteCommand(context.Background(), deploymentServer, daemonCmd, os.Stdout)
 			if err != nil {
 				log.Error("Rollback failed: %v\nOutput: %s", err, output)
 				os.Exit(1)
 			}
 
-			log.Info("Rollback successful!")
+			if !rollbackDryRun {
+				log.Info("Rollback successful!")
+			}
 
 		default:
 			log.Error("Unknown or unsupported target_type: %s", cfg.TargetType)
@@ -110,5 +122,6 @@ the commit must still be within the retention window.`,
 func init() {
 	rollbackCmd.Flags().IntVar(&rollbackSteps, "steps", 1, "number of deployments to walk back from the active one (max = retention, currently 5)")
 	rollbackCmd.Flags().StringVar(&rollbackToCommit, "to", "", "git commit (full or short SHA prefix) to roll back to; must be within the retention window")
+	rollbackCmd.Flags().BoolVar(&rollbackDryRun, "dry-run", false, "report the release and commit a rollback would restore, without rolling back")
 	rootCmd.AddCommand(rollbackCmd)
 }
@@ -49,6 +49,11 @@ Deploy your Next.js app to *any* VPS — with SSL, logs, and zero downtime.
 		success("✓"),
 		warning("Tip:"), command("nextdeploy --help"),
 	),
+	// Every command may load nextdeploy.yml, whose values can be
+	// ${secret:NAME} references.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		installSecretResolver()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Printf("\n%s %s\n\n",
 			success("✨ Welcome to"), highlight("NextDeploy CLI"),
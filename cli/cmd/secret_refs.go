@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+	"github.com/aynaash/nextdeploy/shared/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// installSecretResolver lets config.Load resolve ${secret:NAME} references
+// in nextdeploy.yml through the project's SecretManager. The manager is only
+// built on the first reference, so commands and configs without any (or a
+// still-encrypted nextdeploy.yml) never touch the master key.
+func installSecretResolver() {
+	var (
+		once sync.Once
+		sm   *secrets.SecretManager
+		err  error
+	)
+	config.SetSecretResolver(func(name string) (string, error) {
+		once.Do(func() { sm, err = projectSecretManager() })
+		if err != nil {
+			return "", err
+		}
+		return sm.ConfigResolver()(name)
+	})
+}
+
+// projectSecretManager is the SecretManager of the app in the current
+// directory, loaded with its managed secrets (.nextdeploy/.env). It cannot go
+// through config.Load, which is what is asking, so the app name is read from
+// nextdeploy.yml as-is.
+func projectSecretManager() (*secrets.SecretManager, error) {
+	var doc struct {
+		App struct {
+			Name string `yaml:"name"`
+		} `yaml:"app"`
+	}
+	// #nosec G304 -- the project's own config file
+	if data, err := os.ReadFile(config.ConfigFile); err == nil {
+		_ = yaml.Unmarshal(data, &doc)
+	}
+	sm, err := secrets.NewSecretManager(secrets.WithConfig(&config.NextDeployConfig{App: config.AppConfig{Name: doc.App.Name}}))
+	if err != nil {
+		return nil, err
+	}
+	managedPath := filepath.Join(".nextdeploy", ".env")
+	if _, err := os.Stat(managedPath); err == nil {
+		if err := sm.ImportSecrets(managedPath); err != nil {
+			return nil, err
+		}
+	}
+	return sm, nil
+}
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -12,6 +14,7 @@ import (
 	"github.com/aynaash/nextdeploy/cli/internal/serverless"
 	"github.com/aynaash/nextdeploy/shared"
 	"github.com/aynaash/nextdeploy/shared/config"
+	"github.com/aynaash/nextdeploy/shared/secrets"
 	"github.com/spf13/cobra"
 )
 
@@ -39,14 +42,64 @@ var secretsGetCmd = &cobra.Command{
 	},
 }
 
+var secretsListLocal bool
+
 var secretsListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all secret names",
+	Long: `Lists the secret names stored on the deploy target. With --local, lists
+the secrets available on this machine instead: the managed store
+(.nextdeploy/.env) and every configured provider, each with its source and
+whether it is encrypted. Values are never printed.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if secretsListLocal {
+			runLocalSecretsList()
+			return
+		}
 		runSecretAction("list", args)
 	},
 }
 
+// runLocalSecretsList prints the names the local SecretManager can resolve,
+// with the source each one is read from.
+func runLocalSecretsList() {
+	log := shared.PackageLogger("secrets", "🔐 SECRETS")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Error("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+	sm, err := secrets.NewSecretManager(secrets.WithConfig(cfg))
+	if err != nil {
+		log.Error("Failed to initialize secret manager: %v", err)
+		os.Exit(1)
+	}
+	managedPath := filepath.Join(".nextdeploy", ".env")
+	if _, err := os.Stat(managedPath); err == nil {
+		if err := sm.ImportSecrets(managedPath); err != nil {
+			log.Error("Failed to load secrets from %s: %v", managedPath, err)
+			os.Exit(1)
+		}
+	}
+
+	list, err := sm.ListAllSecrets()
+	if err != nil {
+		log.Warn("Some sources could not be listed: %v", err)
+	}
+	if len(list) == 0 {
+		log.Info("No local secrets for %s", cfg.App.Name)
+		return
+	}
+	fmt.Printf("Secrets for %s (local):\n", cfg.App.Name)
+	for _, s := range list {
+		encrypted := ""
+		if s.Encrypted {
+			encrypted = "encrypted"
+		}
+		fmt.Printf("  %-32s %-10s %s\n", s.Name, s.Source, encrypted)
+	}
+}
+
 var secretsUnsetCmd = &cobra.Command{
 	Use:   "unset KEY...",
 	Short: "Remove one or more secrets",
@@ -72,8 +125,288 @@ var secretsLoadCmd = &cobra.Command{
 
 var (
 	secretsPruneApply bool
+	secretsCryptYes   bool
+	secretsEncRemove  bool
+	secretsDecClean   bool
+	secretsCryptApp   string
 )
 
+var secretsEncryptCmd = &cobra.Command{
+	Use:   "encrypt [FILE...]",
+	Short: "Encrypt nextdeploy.yml and .env files with the app master key",
+	Long: `Encrypts each file to FILE.enc with the master key stored under
+~/.nextdeploy/<app>/master.key (created on first use). Defaults to
+nextdeploy.yml plus every .env file in the current directory. The plaintext
+files are added to .gitignore so only the .enc copies get committed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runSecretsEncrypt(args, secretsEncRemove, secretsCryptYes)
+	},
+}
+
+var secretsDecryptCmd = &cobra.Command{
+	Use:   "decrypt [FILE...]",
+	Short: "Decrypt .enc files produced by 'secrets encrypt' for local use",
+	Long: `Decrypts each FILE.enc back to FILE with the app master key. Defaults to
+every .enc file for nextdeploy.yml and .env files in the current directory.
+Prompts before overwriting an existing plaintext file, and before deleting
+the .enc files with --clean, unless --yes is set.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runSecretsDecrypt(args, secretsDecClean, secretsCryptYes)
+	},
+}
+
+// defaultCryptTargets returns the plaintext files `secrets encrypt` and
+// `secrets decrypt` operate on when none are named: nextdeploy.yml plus the
+// .env files in the current directory, leaving out the .env.example and
+// .env.sample templates meant to be committed as they are. When encrypted is
+// true the candidates are discovered from their .enc counterparts instead.
+func defaultCryptTargets(encrypted bool) []string {
+	suffix := ""
+	if encrypted {
+		suffix = ".enc"
+	}
+	seen := map[string]bool{}
+	var out []string
+	add := func(name string) {
+		name = strings.TrimSuffix(name, suffix)
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	if _, err := os.Stat(config.ConfigFile + suffix); err == nil {
+		add(config.ConfigFile + suffix)
+	}
+	for _, pattern := range []string{".env" + suffix, "*.env" + suffix, ".env.*" + suffix} {
+		matches, _ := filepath.Glob(pattern)
+		for _, m := range matches {
+			if !encrypted && strings.HasSuffix(m, ".enc") {
+				continue
+			}
+			if name := strings.TrimSuffix(m, suffix); name == ".env.example" || name == ".env.sample" {
+				continue
+			}
+			add(m)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// newCryptSecretManager returns a SecretManager and the app's master key. The
+// key is scoped by app name, which normally comes from nextdeploy.yml; --app
+// supplies it when nextdeploy.yml itself is still encrypted.
+func newCryptSecretManager(log *shared.Logger) (*secrets.SecretManager, string) {
+	sm := newAppSecretManager(log)
+	key, err := sm.GeneratePlatformKey()
+	if err != nil {
+		log.Error("Failed to load master key: %v", err)
+		os.Exit(1)
+	}
+	return sm, key
+}
+
+// newAppSecretManager returns a SecretManager scoped to --app or, by default,
+// app.name from nextdeploy.yml. It does not touch the master key.
+func newAppSecretManager(log *shared.Logger) *secrets.SecretManager {
+	var opts []secrets.Option
+	if secretsCryptApp != "" {
+		opts = append(opts, secrets.WithConfig(&config.NextDeployConfig{App: config.AppConfig{Name: secretsCryptApp}}))
+	}
+	sm, err := secrets.NewSecretManager(opts...)
+	if err != nil {
+		log.Error("Failed to initialize secret manager: %v (pass --app=<name> if %s is encrypted)", err, config.ConfigFile)
+		os.Exit(1)
+	}
+	return sm
+}
+
+func runSecretsEncrypt(files []string, removePlain, yes bool) {
+	log := shared.PackageLogger("secrets", "🔐 SECRETS")
+	if len(files) == 0 {
+		files = defaultCryptTargets(false)
+	}
+	if len(files) == 0 {
+		log.Warn("Nothing to encrypt: no %s or .env files in the current directory", config.ConfigFile)
+		return
+	}
+
+	sm, key := newCryptSecretManager(log)
+	var encrypted []string
+	for _, f := range files {
+		if _, err := os.Stat(f + ".enc"); err == nil && !yes && !confirm(fmt.Sprintf("%s.enc already exists. Overwrite?", f)) {
+			log.Info("Skipped %s", f)
+			continue
+		}
+		if err := sm.EncryptFile(f, []byte(key)); err != nil {
+			log.Error("Failed to encrypt %s: %v", f, err)
+			os.Exit(1)
+		}
+		encrypted = append(encrypted, f)
+		log.Success("Encrypted %s → %s.enc", f, f)
+	}
+
+	if added, err := ensureGitignored(".gitignore", encrypted); err != nil {
+		log.Warn("Failed to update .gitignore: %v", err)
+	} else if len(added) > 0 {
+		log.Info("Added to .gitignore: %s", strings.Join(added, ", "))
+	}
+
+	if removePlain && len(encrypted) > 0 {
+		if !yes && !confirm(fmt.Sprintf("Delete %d plaintext file(s)? Only the .enc copies will remain", len(encrypted))) {
+			return
+		}
+		for _, f := range encrypted {
+			if err := os.Remove(f); err != nil {
+				log.Warn("Failed to remove %s: %v", f, err)
+			}
+		}
+	}
+}
+
+func runSecretsDecrypt(files []string, clean, yes bool) {
+	log := shared.PackageLogger("secrets", "🔐 SECRETS")
+	if len(files) == 0 {
+		files = defaultCryptTargets(true)
+	}
+	if len(files) == 0 {
+		log.Warn("Nothing to decrypt: no .enc files in the current directory")
+		return
+	}
+
+	sm, _ := newCryptSecretManager(log)
+	var decrypted []string
+	for _, f := range files {
+		f = strings.TrimSuffix(f, ".enc")
+		plain, err := sm.DecryptWithPlatformKey(f + ".enc")
+		if err != nil {
+			log.Error("Failed to decrypt %s.enc: %v", f, err)
+			os.Exit(1)
+		}
+		if _, err := os.Stat(f); err == nil && !yes && !confirm(fmt.Sprintf("%s already exists. Overwrite with the decrypted copy?", f)) {
+			log.Info("Skipped %s", f)
+			continue
+		}
+		if err := os.WriteFile(f, []byte(plain), 0o600); err != nil {
+			log.Error("Failed to write %s: %v", f, err)
+			os.Exit(1)
+		}
+		decrypted = append(decrypted, f)
+		log.Success("Decrypted %s.enc → %s", f, f)
+	}
+
+	if added, err := ensureGitignored(".gitignore", decrypted); err != nil {
+		log.Warn("Failed to update .gitignore: %v", err)
+	} else if len(added) > 0 {
+		log.Info("Added to .gitignore: %s", strings.Join(added, ", "))
+	}
+
+	if clean && len(decrypted) > 0 {
+		// The .enc files are the copies that get committed; once they are
+		// gone the secrets live only in gitignored plaintext.
+		if !yes && !confirm(fmt.Sprintf("Delete %d .enc file(s)? Only the plaintext copies will remain", len(decrypted))) {
+			return
+		}
+		for _, f := range decrypted {
+			if err := os.Remove(f + ".enc"); err != nil {
+				log.Warn("Failed to remove %s.enc: %v", f, err)
+			}
+		}
+	}
+}
+
+// ensureGitignored appends each path that is not already listed verbatim to
+// the .gitignore at gitignorePath, creating the file if needed, and returns
+// the entries it added.
+func ensureGitignored(gitignorePath string, paths []string) ([]string, error) {
+	// #nosec G304 -- fixed project-local .gitignore path
+	existing, err := os.ReadFile(gitignorePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	listed := map[string]bool{}
+	for line := range strings.SplitSeq(string(existing), "\n") {
+		listed[strings.TrimSpace(line)] = true
+	}
+
+	var added []string
+	for _, p := range paths {
+		entry := "/" + filepath.ToSlash(filepath.Clean(p))
+		if listed[entry] || listed[strings.TrimPrefix(entry, "/")] {
+			continue
+		}
+		listed[entry] = true
+		added = append(added, entry)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	var b strings.Builder
+	b.Write(existing)
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		b.WriteString("\n")
+	}
+	for _, e := range added {
+		b.WriteString(e + "\n")
+	}
+	// #nosec G306 -- .gitignore is a regular, world-readable project file
+	if err := os.WriteFile(gitignorePath, []byte(b.String()), 0o644); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+var secretsKeyForce bool
+
+var secretsKeyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Back up or restore the app master key used by 'secrets encrypt'",
+	Long: `The master key lives in ~/.nextdeploy/<app>/master.key (the keyring on
+Windows). Losing it makes every .enc file of the app undecryptable, so export
+it to safe storage and import it on each machine that needs to decrypt.`,
+}
+
+var secretsKeyExportCmd = &cobra.Command{
+	Use:   "export PATH",
+	Short: "Write the raw master key to PATH (0600)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		log := shared.PackageLogger("secrets", "🔐 SECRETS")
+		sm := newAppSecretManager(log)
+		log.Warn("Anyone with this file can decrypt every .enc file of %q. Store it offline or in a password manager.", sm.GetAppName())
+		if !secretsCryptYes && !confirm(fmt.Sprintf("Export the master key of %q to %s?", sm.GetAppName(), args[0])) {
+			log.Info("Export cancelled")
+			return
+		}
+		if err := sm.ExportMasterKey(args[0]); err != nil {
+			log.Error("Failed to export master key: %v", err)
+			os.Exit(1)
+		}
+		log.Success("Master key exported to %s", args[0])
+	},
+}
+
+var secretsKeyImportCmd = &cobra.Command{
+	Use:   "import PATH",
+	Short: "Install a master key written by 'secrets key export'",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		log := shared.PackageLogger("secrets", "🔐 SECRETS")
+		sm := newAppSecretManager(log)
+		err := sm.ImportMasterKey(args[0], secretsKeyForce)
+		if errors.Is(err, secrets.ErrMasterKeyExists) {
+			log.Error("%v. Files encrypted with it will no longer decrypt; re-run with --force to replace it anyway.", err)
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Error("Failed to import master key: %v", err)
+			os.Exit(1)
+		}
+		log.Success("Master key for %q imported from %s", sm.GetAppName(), args[0])
+	},
+}
+
 var secretsPruneCmd = &cobra.Command{
 	Use:   "prune",
 	Short: "Delete remote secrets that are not in the local allowlist",
@@ -334,7 +667,7 @@ func runVPSSecretAction(action string, args []string, appName string, log *share
 				continue
 			}
 			key, value := parts[0], parts[1]
-			daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd secrets --action=set --appName=%s --key=%s --value=%s", shellQuote(appName), shellQuote(key), shellQuote(value))
+			daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd secrets --action=set --appName=%s --key=%s --value=%s", shared.ShellQuote(appName), shared.ShellQuote(key), shared.ShellQuote(value))
 			output, err := srv.ExecuteCommand(ctx, deploymentServer, daemonCmd, nil)
 			if err != nil {
 				log.Error("Failed to set secret %s: %v\nOutput: %s", key, err, output)
@@ -344,7 +677,7 @@ func runVPSSecretAction(action string, args []string, appName string, log *share
 		}
 	case "get":
 		key := args[0]
-		daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd secrets --action=get --appName=%s --key=%s", shellQuote(appName), shellQuote(key))
+		daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd secrets --action=get --appName=%s --key=%s", shared.ShellQuote(appName), shared.ShellQuote(key))
 		output, err := srv.ExecuteCommand(ctx, deploymentServer, daemonCmd, nil)
 		if err != nil {
 			log.Error("Failed to get secret %s: %v\nOutput: %s", key, err, output)
@@ -352,7 +685,7 @@ func runVPSSecretAction(action string, args []string, appName string, log *share
 			fmt.Printf("%s=%s\n", key, strings.TrimSpace(output))
 		}
 	case "list":
-		daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd secrets --action=list --appName=%s", shellQuote(appName))
+		daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd secrets --action=list --appName=%s", shared.ShellQuote(appName))
 		output, err := srv.ExecuteCommand(ctx, deploymentServer, daemonCmd, nil)
 		if err != nil {
 			log.Error("Failed to list secrets: %v\nOutput: %s", err, output)
@@ -361,7 +694,7 @@ func runVPSSecretAction(action string, args []string, appName string, log *share
 		}
 	case "unset":
 		for _, key := range args {
-			daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd secrets --action=unset --appName=%s --key=%s", shellQuote(appName), shellQuote(key))
+			daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd secrets --action=unset --appName=%s --key=%s", shared.ShellQuote(appName), shared.ShellQuote(key))
 			output, err := srv.ExecuteCommand(ctx, deploymentServer, daemonCmd, nil)
 			if err != nil {
 				log.Error("Failed to unset secret %s: %v\nOutput: %s", key, err, output)
@@ -406,10 +739,26 @@ func runSecretsLoad(filename string) {
 func init() {
 	secretsCmd.AddCommand(secretsSetCmd)
 	secretsCmd.AddCommand(secretsGetCmd)
+	secretsListCmd.Flags().BoolVar(&secretsListLocal, "local", false, "List the secrets available locally (managed store and providers) with their source")
 	secretsCmd.AddCommand(secretsListCmd)
 	secretsCmd.AddCommand(secretsUnsetCmd)
 	secretsCmd.AddCommand(secretsLoadCmd)
 
+	secretsEncryptCmd.Flags().BoolVar(&secretsEncRemove, "remove-plaintext", false, "Delete the plaintext files after encrypting them")
+	secretsEncryptCmd.Flags().BoolVarP(&secretsCryptYes, "yes", "y", false, "Skip confirmation prompts")
+	secretsEncryptCmd.Flags().StringVar(&secretsCryptApp, "app", "", "App name whose master key to use (defaults to app.name in nextdeploy.yml)")
+	secretsCmd.AddCommand(secretsEncryptCmd)
+	secretsDecryptCmd.Flags().BoolVar(&secretsDecClean, "clean", false, "Delete the .enc files after decrypting them (asks first unless --yes)")
+	secretsDecryptCmd.Flags().BoolVarP(&secretsCryptYes, "yes", "y", false, "Skip confirmation prompts")
+	secretsDecryptCmd.Flags().StringVar(&secretsCryptApp, "app", "", "App name whose master key to use (defaults to app.name in nextdeploy.yml)")
+	secretsCmd.AddCommand(secretsDecryptCmd)
+
+	secretsKeyExportCmd.Flags().BoolVarP(&secretsCryptYes, "yes", "y", false, "Skip the confirmation prompt")
+	secretsKeyImportCmd.Flags().BoolVar(&secretsKeyForce, "force", false, "Replace a different existing master key")
+	secretsKeyCmd.PersistentFlags().StringVar(&secretsCryptApp, "app", "", "App name whose master key to use (defaults to app.name in nextdeploy.yml)")
+	secretsKeyCmd.AddCommand(secretsKeyExportCmd, secretsKeyImportCmd)
+	secretsCmd.AddCommand(secretsKeyCmd)
+
 	secretsPruneCmd.Flags().BoolVar(&secretsPruneApply, "apply", false, "Actually delete the candidates (default is dry-run)")
 	secretsCmd.AddCommand(secretsPruneCmd)
 
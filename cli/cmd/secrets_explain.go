@@ -11,7 +11,7 @@ var secretsExplanation = explanation{
 		".env and any files declared under secrets.files[] in " +
 		"nextdeploy.yml. Secrets set here have the highest precedence " +
 		"(explicit user intent wins). Subcommands: set, get, unset, list, " +
-		"load, sync.",
+		"load, sync, encrypt, decrypt.",
 	Phases: []phase{
 		{
 			Num:       1,
@@ -38,9 +38,9 @@ var secretsExplanation = explanation{
 		{
 			Num:       4,
 			Title:     "secrets list",
-			Narrative: "Prints all keys (values redacted). Useful for auditing what will ship.",
+			Narrative: "Prints all keys (values redacted). Useful for auditing what will ship. With --local, lists the managed store and every configured provider instead, de-duplicated, with each key's source and whether it is encrypted.",
 			Ref:       secretsGoFile,
-			Function:  "secrets.NewSecretManager → .FlattenSecrets",
+			Function:  "secrets.NewSecretManager → .ListAllSecrets",
 		},
 		{
 			Num:       5,
@@ -56,6 +56,22 @@ var secretsExplanation = explanation{
 			Ref:       secretsGoFile,
 			Function:  "Provider.UpdateSecrets",
 		},
+		{
+			Num:       7,
+			Title:     "secrets encrypt / decrypt",
+			Narrative: "Encrypts nextdeploy.yml and .env files to FILE.enc with the per-app master key (~/.nextdeploy/<app>/master.key), or decrypts them back for local use. Prompts before overwriting either side, and adds the plaintext paths to .gitignore so only the .enc copies are committed.",
+			Ref:       secretsGoFile,
+			Function:  "SecretManager.EncryptFile / .DecryptFile",
+			Output:    "FILE.enc or FILE",
+		},
+		{
+			Num:       8,
+			Title:     "secrets key export / import",
+			Narrative: "Backs up the per-app master key to a 0600 file (after an explicit confirmation) and restores it on another machine, so .enc files stay decryptable when the key store is recreated or the project moves hosts. Import refuses to replace a different existing key without --force.",
+			Ref:       secretsGoFile,
+			Function:  "SecretManager.ExportMasterKey / .ImportMasterKey",
+			Output:    "key file or installed master key",
+		},
 	},
 }
 
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+	"github.com/spf13/cobra"
+)
+
+func TestEnsureGitignored(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".gitignore")
+	if err := os.WriteFile(path, []byte("node_modules\n/.env"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := ensureGitignored(path, []string{".env", "nextdeploy.yml", "prod.env"})
+	if err != nil {
+		t.Fatalf("ensureGitignored: %v", err)
+	}
+	if want := []string{"/nextdeploy.yml", "/prod.env"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+
+	got, _ := os.ReadFile(path)
+	if want := "node_modules\n/.env\n/nextdeploy.yml\n/prod.env\n"; string(got) != want {
+		t.Errorf(".gitignore = %q, want %q", got, want)
+	}
+
+	added, err = ensureGitignored(path, []string{"nextdeploy.yml"})
+	if err != nil || added != nil {
+		t.Errorf("second run should be a no-op, got %v, %v", added, err)
+	}
+}
+
+func TestDefaultCryptTargets(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, f := range []string{"nextdeploy.yml", ".env", "prod.env", ".env.local.enc", "notes.txt", ".env.example", ".env.sample", ".env.sample.enc"} {
+		if err := os.WriteFile(f, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := defaultCryptTargets(false), []string{".env", "nextdeploy.yml", "prod.env"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("plaintext targets = %v, want %v", got, want)
+	}
+	if got, want := defaultCryptTargets(true), []string{".env.local"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("encrypted targets = %v, want %v", got, want)
+	}
+	for _, c := range []*cobra.Command{secretsEncryptCmd, secretsDecryptCmd} {
+		if c.Flags().Lookup("app") == nil {
+			t.Errorf("%s has no --app flag", c.Name())
+		}
+	}
+}
+
+func TestRootResolvesConfigSecretRefs(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Cleanup(func() { config.SetSecretResolver(nil) })
+	doc := "app:\n  name: shop\n  domain:\n    name: ${secret:SHOP_DOMAIN}\n"
+	if err := os.WriteFile(config.ConfigFile, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(".nextdeploy", 0o700); err != nil {
+		t.Fatal(err)
+	}
+	managed := `{"SHOP_DOMAIN": {"value": "shop.example.com", "version": 1}}`
+	if err := os.WriteFile(filepath.Join(".nextdeploy", ".env"), []byte(managed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd.PersistentPreRun(rootCmd, nil)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	if cfg.App.Domain.Name != "shop.example.com" {
+		t.Errorf("app.domain.name = %q, want the resolved secret", cfg.App.Domain.Name)
+	}
+
+	if err := os.WriteFile(config.ConfigFile, []byte("app:\n  name: ${secret:MISSING}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "MISSING") {
+		t.Errorf("unknown secret: err = %v, want it named", err)
+	}
+}
+
+func TestSecretsDecryptCleanAsksFirst(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(config.ConfigFile, []byte("app:\n  name: shop\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".env", []byte("API_KEY=abc\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	runSecretsEncrypt([]string{".env"}, true, true)
+
+	// Declining the prompt keeps the .enc copy that gets committed.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	_, _ = w.WriteString("n\n")
+	_ = w.Close()
+	runSecretsDecrypt([]string{".env"}, true, false)
+	if _, err := os.Stat(".env.enc"); err != nil {
+		t.Errorf("--clean deleted .env.enc without confirmation: %v", err)
+	}
+	if got, _ := os.ReadFile(".env"); string(got) != "API_KEY=abc\n" {
+		t.Errorf(".env = %q, want the decrypted file", got)
+	}
+}
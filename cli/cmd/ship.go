@@ -18,6 +18,7 @@ import (
 	"github.com/aynaash/nextdeploy/shared/config"
 	"github.com/aynaash/nextdeploy/shared/git"
 	"github.com/aynaash/nextdeploy/shared/nextcore"
+	"github.com/aynaash/nextdeploy/shared/secrets"
 	"github.com/aynaash/nextdeploy/shared/telemetry"
 
 	"github.com/spf13/cobra"
@@ -27,6 +28,19 @@ var (
 	shipVerbose     bool
 	shipNoProvision bool
 	shipVerify      bool
+	shipSkipBuild   bool
+	shipPlan        bool
+
+	shipContainerized    bool
+	shipReadinessTimeout time.Duration
+	shipIdempotencyKey   string
+	shipCommit           string
+	shipFailLogLines     int
+
+	shipEnvFromSecrets bool
+	shipEnvPrefix      string
+
+	shipProgress string
 )
 
 var shipCmd = &cobra.Command{
@@ -58,45 +72,72 @@ var shipCmd = &cobra.Command{
 			log.Warn("   Commit before shipping for cleaner deployment provenance.")
 		}
 
+		if shipPlan {
+			printShipPlan(ctx, log, cfg)
+			return
+		}
+
+		render, err := progressRenderer(shipProgress, log, os.Stderr)
+		if err != nil {
+			log.Error("%v", err)
+			os.Exit(1)
+		}
+		stages := &shipStages{log: log, progress: newProgressEmitter(render)}
+		stages.begin("build")
 		result, err := buildflow.Run(ctx, buildflow.Opts{
-			ProjectDir: ".",
-			Cfg:        cfg,
-			Force:      false,
-			Log:        log,
+			ProjectDir:         ".",
+			Cfg:                cfg,
+			Force:              false,
+			SkipBuild:          shipSkipBuild,
+			ContainerizedBuild: shipContainerized,
+			Log:                log,
 		})
 		if err != nil {
-			log.Error("Build flow failed: %v", err)
-			os.Exit(1)
+			stages.fatal("Build flow failed: %v", err)
 		}
 
 		if result.EffectiveTarget == "serverless" {
-			shipServerless(ctx, log, cfg, &result.Payload)
+			stages.begin("deploy")
+			shipServerless(ctx, log, cfg, &result.Payload, stages)
 			// Reached only on success — shipServerless exits the process on failure.
+			stages.report()
 			telemetry.RecordShipSuccess(cfg.Serverless.Provider, shared.Version)
 			return
 		}
-		shipVPS(log, cfg, result)
+		shipVPS(log, cfg, result, stages)
+		stages.report()
 		telemetry.RecordShipSuccess("vps", shared.Version)
 	},
 }
 
-func shipServerless(ctx context.Context, log *shared.Logger, cfg *config.NextDeployConfig, meta *nextcore.NextCorePayload) {
-	log.Info("Deployment Target: SERVERLESS (provider=%s)", cfg.Serverless.Provider)
+func shipServerless(ctx context.Context, log *shared.Logger, cfg *config.NextDeployConfig, meta *nextcore.NextCorePayload, stages *shipStages) {
 	if cfg.Serverless == nil {
-		log.Error("Inferred 'serverless' target but 'serverless' config block is missing.")
-		os.Exit(1)
+		stages.fatal("Inferred 'serverless' target but 'serverless' config block is missing.")
 	}
+	log.Info("Deployment Target: SERVERLESS (provider=%s)", cfg.Serverless.Provider)
 	if err := serverless.Deploy(ctx, cfg, meta, shipVerbose, !shipNoProvision, shipVerify); err != nil {
 		if ctx.Err() != nil {
 			log.Warn("Deploy interrupted — state may be partial. Re-run `nextdeploy ship` " +
 				"to converge (steps are idempotent).")
 		}
-		log.Error("Serverless deployment failed: %v", err)
-		os.Exit(1)
+		stages.fatal("Serverless deployment failed: %v", err)
+	}
+}
+
+// shipMetadataCommit is the commit the daemon may look the release's
+// metadata up by in the metadata store, should the tarball lack it: --commit,
+// else the build's own commit when it was clean enough to be published.
+func shipMetadataCommit(cfg *config.NextDeployConfig, meta *nextcore.NextCorePayload) string {
+	if shipCommit != "" {
+		return shipCommit
 	}
+	if cfg.MetadataStore == nil || meta.GitDirty {
+		return ""
+	}
+	return meta.GitCommit
 }
 
-func shipVPS(log *shared.Logger, cfg *config.NextDeployConfig, result *buildflow.Result) {
+func shipVPS(log *shared.Logger, cfg *config.NextDeployConfig, result *buildflow.Result, stages *shipStages) {
 	log.Info("Deployment Target: VPS (Traditional Server)")
 	meta := &result.Payload
 
@@ -106,7 +147,7 @@ func shipVPS(log *shared.Logger, cfg *config.NextDeployConfig, result *buildflow
 			domain = cfg.App.Domain.Name
 		}
 		if domain != "" {
-			caddyPlan := caddy.GenerateCaddyfile(meta.AppName, domain, string(meta.OutputMode), meta.Config.Port, "/opt/nextdeploy/apps/"+meta.AppName+"/current", meta.DetectedFeatures, meta.DistDir, meta.ExportDir)
+			caddyPlan := caddy.GenerateCaddyfile(meta.AppName, caddy.Site{Domain: domain, Aliases: meta.DomainAliases, Redirect: meta.DomainRedirect}, string(meta.OutputMode), meta.Config.Port, "/opt/nextdeploy/apps/"+meta.AppName+"/current", meta.DetectedFeatures, meta.DistDir, meta.ExportDir, meta.CaddyDirectives)
 			log.Info("  Caddy Configuration Plan Preview:")
 			for line := range strings.SplitSeq(caddyPlan, "\n") {
 				if strings.TrimSpace(line) != "" {
@@ -118,15 +159,13 @@ func shipVPS(log *shared.Logger, cfg *config.NextDeployConfig, result *buildflow
 
 	srv, err := server.New(server.WithConfig(), server.WithSSH())
 	if err != nil {
-		log.Error("Failed to initialize server connection: %v", err)
-		os.Exit(1)
+		stages.fatal("Failed to initialize server connection: %v", err)
 	}
 	defer srv.CloseSSHConnection()
 
 	deploymentServer, err := srv.GetDeploymentServer()
 	if err != nil {
-		log.Error("Failed to get deployment server: %v", err)
-		os.Exit(1)
+		stages.fatal("Failed to get deployment server: %v", err)
 	}
 	log.Info("Deployment server: %s", deploymentServer)
 
@@ -143,27 +182,57 @@ func shipVPS(log *shared.Logger, cfg *config.NextDeployConfig, result *buildflow
 		tarballName = "app.tar.gz"
 	}
 	if _, err := os.Stat(tarballName); os.IsNotExist(err) {
-		log.Error("Deployment artifact %s not found. Run `nextdeploy build` to produce it (or remove --skip-build flags upstream).", tarballName)
-		os.Exit(1)
+		stages.fatal("Deployment artifact %s not found. Run `nextdeploy build` to produce it (or drop --skip-build).", tarballName)
 	}
 
+	checksum, err := shared.FileSHA256(tarballName)
+	if err != nil {
+		stages.fatal("Failed to checksum %s: %v", tarballName, err)
+	}
+
+	stages.begin("upload")
 	remotePath := fmt.Sprintf("/opt/nextdeploy/uploads/nextdeploy_%s_%d.tar.gz", cfg.App.Name, time.Now().Unix())
-	log.Info("Uploading %s to %s on %s...", tarballName, remotePath, deploymentServer)
+	log.Info("Uploading %s (sha256 %s) to %s on %s...", tarballName, checksum[:12], remotePath, deploymentServer)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	if err := srv.UploadFile(ctx, deploymentServer, tarballName, remotePath); err != nil {
-		log.Error("Failed to upload tarball: %v", err)
-		os.Exit(1)
+	if err := srv.UploadFileWithProgress(ctx, deploymentServer, tarballName, remotePath, stages.bytes); err != nil {
+		stages.fatal("Failed to upload tarball: %v", err)
+	}
+
+	envArg := ""
+	remoteEnvPath := strings.TrimSuffix(remotePath, ".tar.gz") + ".env"
+	uploaded, err := uploadResolvedEnv(ctx, log, srv, deploymentServer, cfg, remoteEnvPath)
+	if err != nil {
+		removeRemoteEnv(log, srv, deploymentServer, remoteEnvPath)
+		stages.fatal("Failed to upload environment: %v", err)
+	}
+	if uploaded {
+		envArg = " --envFile=" + shared.ShellQuote(remoteEnvPath)
 	}
 
 	log.Info("Upload complete. Triggering daemon to process deployment...")
+	stages.begin("activate")
 
-	daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd ship --tarball=%s --socket-path=/run/nextdeployd/nextdeployd.sock", shellQuote(remotePath))
+	// The daemon blocks until the release is healthy; on failure its
+	// response carries the tail of the release's journal.
+	readyArgs := fmt.Sprintf(" --fail-log-lines=%d", shipFailLogLines)
+	if shipReadinessTimeout > 0 {
+		readyArgs += " --readiness-timeout=" + shipReadinessTimeout.String()
+	}
+	if shipIdempotencyKey != "" {
+		readyArgs += " --idempotency-key=" + shared.ShellQuote(shipIdempotencyKey)
+	}
+	if commit := shipMetadataCommit(cfg, meta); commit != "" {
+		readyArgs += " --commit=" + shared.ShellQuote(commit)
+	}
+	daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd ship --tarball=%s --sha256=%s%s%s --socket-path=/run/nextdeployd/nextdeployd.sock", shared.ShellQuote(remotePath), checksum, envArg, readyArgs)
 	output, err := srv.ExecuteCommand(ctx, deploymentServer, daemonCmd, os.Stdout)
 	if err != nil {
-		log.Error("Failed to trigger daemon (ensure nextdeployd is in PATH): %v\nOutput: %s", err, output)
-		os.Exit(1)
+		if uploaded {
+			removeRemoteEnv(log, srv, deploymentServer, remoteEnvPath)
+		}
+		stages.fatal("Failed to trigger daemon (ensure nextdeployd is in PATH): %v\nOutput: %s", err, output)
 	}
 
 	log.Info("Ship successful! Deployment instructions relayed to the daemon.")
@@ -173,7 +242,7 @@ func shipVPS(log *shared.Logger, cfg *config.NextDeployConfig, result *buildflow
 		port = cfg.App.Port
 	}
 	if port == 0 {
-		port = 3000
+		port = nextcore.DefaultAppPort
 	}
 
 	dnsProvider := "other"
@@ -208,9 +277,246 @@ func shipVPS(log *shared.Logger, cfg *config.NextDeployConfig, result *buildflow
 	}
 }
 
+// printShipPlan shows what a VPS ship would do — the artifact, the release it
+// replaces, how traffic is cut over and where a rollback would land — by
+// querying the daemon read-only. Nothing is built, uploaded or activated.
+func printShipPlan(ctx context.Context, log *shared.Logger, cfg *config.NextDeployConfig) {
+	if target := cfg.ResolveTargetType(""); target != "vps" {
+		log.Error("ship --plan covers VPS deploys; this app targets %s (use `nextdeploy plan` for Cloudflare resources)", target)
+		os.Exit(1)
+	}
+
+	artifact := "app.tar.gz (not built yet — ship will build it)"
+	if _, err := os.Stat("app.tar.gz"); err == nil {
+		sum, err := shared.FileSHA256("app.tar.gz")
+		if err != nil {
+			log.Error("Failed to checksum app.tar.gz: %v", err)
+			os.Exit(1)
+		}
+		artifact = "app.tar.gz (sha256 " + sum + ", reused only with --skip-build)"
+	}
+	commit, err := git.GetCommitHash()
+	if err != nil {
+		commit = "unknown"
+	}
+
+	healthPath := cfg.App.HealthPath
+	if healthPath == "" {
+		healthPath = "/"
+	}
+	readiness := cfg.App.ReadinessTimeout
+	if readiness == "" {
+		readiness = "5m"
+	}
+
+	srv, err := server.New(server.WithConfig(), server.WithSSH())
+	if err != nil {
+		log.Error("Failed to initialize server connection: %v", err)
+		os.Exit(1)
+	}
+	defer srv.CloseSSHConnection()
+
+	deploymentServer, err := srv.GetDeploymentServer()
+	if err != nil {
+		log.Error("Failed to get deployment server: %v", err)
+		os.Exit(1)
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd plan --appName=%s", shared.ShellQuote(cfg.App.Name))
+	output, err := srv.ExecuteCommand(queryCtx, deploymentServer, daemonCmd, nil)
+	if err != nil {
+		log.Error("Failed to query daemon: %v\nOutput: %s", err, output)
+		os.Exit(1)
+	}
+	output = strings.TrimSpace(output)
+	if idx := strings.Index(output, "Current release:"); idx >= 0 {
+		output = output[idx:]
+	}
+	// Drift is changes on the server that ship would silently replace (or
+	// that a restart, not a ship, would apply). Older daemons lack the command.
+	driftCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd drift --appName=%s", shared.ShellQuote(cfg.App.Name))
+	drift, err := srv.ExecuteCommand(queryCtx, deploymentServer, driftCmd, nil)
+	if err != nil {
+		drift = "Drift: unavailable (" + strings.TrimSpace(drift) + ")"
+	}
+	drift = strings.TrimSpace(drift)
+
+	fmt.Printf("\n📋 Ship plan: %s → %s\n", cfg.App.Name, deploymentServer)
+	fmt.Println("──────────────────────────────────────────────────")
+	fmt.Printf("Artifact: %s\n", artifact)
+	fmt.Printf("Commit: %s\n", commit)
+	fmt.Println("Strategy: blue/green — the new release starts on its own port next to the current one")
+	fmt.Printf("Health check: GET %s must pass within %s before Caddy switches; otherwise the current release keeps serving\n", healthPath, readiness)
+	fmt.Println(output)
+	if drift != "" && drift != "APP_NOT_DEPLOYED" {
+		fmt.Println(drift)
+	}
+	fmt.Println("──────────────────────────────────────────────────")
+	fmt.Println("No changes were made. Run `nextdeploy ship` to apply.")
+}
+
+// shipStages times each phase of a ship (build, upload, activate / deploy)
+// and reports it as ProgressEvents, so a successful run ends with a
+// per-stage summary instead of leaving the operator to work out from the log
+// where the time went, and integrations can follow along (--progress=json).
+type shipStages struct {
+	log      *shared.Logger
+	progress *progressEmitter
+	names    []string
+	took     []time.Duration
+	start    time.Time
+}
+
+// begin closes the running stage, if any, and starts timing name.
+func (s *shipStages) begin(name string) {
+	s.end()
+	s.names = append(s.names, name)
+	s.start = time.Now()
+	s.progress.emit(ProgressEvent{Stage: name, Status: ProgressStart})
+}
+
+// running reports whether a stage has begun and not yet ended.
+func (s *shipStages) running() bool {
+	return len(s.took) < len(s.names)
+}
+
+func (s *shipStages) end() {
+	if s.running() {
+		s.took = append(s.took, time.Since(s.start))
+		s.progress.emit(ProgressEvent{Stage: s.names[len(s.names)-1], Status: ProgressDone, Elapsed: s.elapsed()})
+	}
+}
+
+func (s *shipStages) elapsed() string {
+	return s.took[len(s.took)-1].Round(100 * time.Millisecond).String()
+}
+
+// bytes reports transfer progress of the running stage; it fits
+// server.UploadFileWithProgress.
+func (s *shipStages) bytes(done, total int64) {
+	if !s.running() {
+		return
+	}
+	pct := percentOf(done, total)
+	s.progress.emit(ProgressEvent{Stage: s.names[len(s.names)-1], Status: ProgressProgress, Percent: &pct})
+}
+
+// fatal logs the error, marks the running stage failed and exits.
+func (s *shipStages) fatal(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	s.log.Error("%s", msg)
+	if s.running() {
+		s.took = append(s.took, time.Since(s.start))
+		s.progress.emit(ProgressEvent{Stage: s.names[len(s.names)-1], Status: ProgressFailed, Message: msg, Elapsed: s.elapsed()})
+	}
+	s.progress.close()
+	os.Exit(1)
+}
+
+// report closes the running stage and logs how long the ship took.
+func (s *shipStages) report() {
+	s.end()
+	s.progress.close()
+	var total time.Duration
+	for _, took := range s.took {
+		total += took
+	}
+	s.log.Success("Shipped in %s", total.Round(100*time.Millisecond))
+}
+
+// removeRemoteEnv deletes the uploaded env file after a failed ship. It holds
+// plaintext secrets, and the daemon may never have run to clean it up.
+func removeRemoteEnv(log *shared.Logger, srv *server.ServerStruct, host, remotePath string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := srv.ExecuteCommand(ctx, host, "sudo rm -f "+shared.ShellQuote(remotePath), nil); err != nil {
+		log.Warn("Failed to remove %s on %s: %v", remotePath, host, err)
+	}
+}
+
+// uploadResolvedEnv merges the project's dotenv files the way Next.js does for
+// the configured environment and uploads the result next to the tarball, so the
+// daemon can render it into the release's runtime environment. It reports
+// false when there is nothing to upload.
+func uploadResolvedEnv(ctx context.Context, log *shared.Logger, srv *server.ServerStruct, host string, cfg *config.NextDeployConfig, remotePath string) (bool, error) {
+	sm, err := secrets.NewSecretManager(secrets.WithConfig(cfg))
+	if err != nil {
+		return false, fmt.Errorf("init secret manager: %w", err)
+	}
+	env, loaded, err := config.ResolveEnv(".", cfg.App.Environment, sm.DecryptWithPlatformKey)
+	if err != nil {
+		return false, err
+	}
+	if shipEnvFromSecrets {
+		harvested, source := serverless.HarvestDopplerEnv(cfg)
+		if source == "" {
+			return false, fmt.Errorf("--env-from-secrets needs Doppler: run under `doppler run --` or set secrets.doppler.inject_env")
+		}
+		if env == nil {
+			env = map[string]string{}
+		}
+		injected := withEnvPrefix(harvested, shipEnvPrefix)
+		for k, v := range injected {
+			env[k] = v
+		}
+		loaded = append(loaded, fmt.Sprintf("%d secrets from Doppler (%s)", len(injected), source))
+	}
+	if len(env) == 0 {
+		return false, nil
+	}
+	log.Info("Shipping %d env vars from %s", len(env), strings.Join(loaded, ", "))
+
+	tmp, err := os.CreateTemp("", "nextdeploy-env-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(config.FormatDotenv(env)); err != nil {
+		_ = tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+
+	if err := srv.UploadFile(ctx, host, tmp.Name(), remotePath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// withEnvPrefix keeps the keys of env that start with prefix, with the prefix
+// stripped, so SHOP_DATABASE_URL reaches the app as DATABASE_URL and secrets
+// of other apps in the same Doppler config are left out. An empty prefix keeps
+// everything.
+func withEnvPrefix(env map[string]string, prefix string) map[string]string {
+	if prefix == "" {
+		return env
+	}
+	out := make(map[string]string)
+	for k, v := range env {
+		if name, ok := strings.CutPrefix(k, prefix); ok && name != "" {
+			out[name] = v
+		}
+	}
+	return out
+}
+
 func init() {
 	shipCmd.Flags().BoolVarP(&shipVerbose, "verbose", "v", false, "Print detailed deployment logs (S3 uploads, Lambda steps, CloudFront status)")
 	shipCmd.Flags().BoolVar(&shipNoProvision, "no-provision", false, "Skip reconciling declared Cloudflare resources (KV/Hyperdrive/D1) before deploying")
 	shipCmd.Flags().BoolVar(&shipVerify, "verify", false, "Fail the deploy if the post-deploy smoke check does not pass (for CI)")
+	shipCmd.Flags().BoolVar(&shipSkipBuild, "skip-build", false, "Reuse the existing build output instead of running `next build` (metadata is regenerated from it)")
+	shipCmd.Flags().DurationVar(&shipReadinessTimeout, "readiness-timeout", 0, "How long the new VPS release may take to pass its health check (overrides app.readiness_timeout)")
+	shipCmd.Flags().StringVar(&shipIdempotencyKey, "idempotency-key", "", "Deploy at most once per key (e.g. the CI run ID); a retry with the same key returns the first deploy's result")
+	shipCmd.Flags().StringVar(&shipCommit, "commit", "", "Commit whose metadata the daemon fetches from metadata_store if the tarball has none (defaults to the build's commit when metadata_store is set)")
+	shipCmd.Flags().IntVar(&shipFailLogLines, "fail-log-lines", 50, "Lines of the release's logs to print if it fails to start or become ready (VPS, 0 for none)")
+	shipCmd.Flags().BoolVar(&shipContainerized, "containerized-build", false, "Run next build in a Node container (app.build_image) so the artifact does not depend on the host toolchain")
+	shipCmd.Flags().BoolVar(&shipPlan, "plan", false, "Show what would be deployed and replaced on the server, without building or changing anything (VPS only)")
+	shipCmd.Flags().BoolVar(&shipEnvFromSecrets, "env-from-secrets", false, "Inject every secret of the active Doppler config into the VPS release env, in a 0600 file rather than on the command line")
+	shipCmd.Flags().StringVar(&shipProgress, "progress", "text", "How to report stage progress: text, or json for one event per line on stderr")
+	shipCmd.Flags().StringVar(&shipEnvPrefix, "env-prefix", "", "With --env-from-secrets, inject only secrets whose names start with this prefix, with the prefix stripped (e.g. SHOP_)")
 	rootCmd.AddCommand(shipCmd)
 }
@@ -11,7 +11,10 @@ var shipExplanation = explanation{
 		"nextdeploy.yml (serverless=AWS or Cloudflare, or VPS). The " +
 		"Cloudflare path invokes the nextcompile pipeline to produce a " +
 		"single Worker bundle; the AWS path produces a Lambda zip + " +
-		"CloudFront distribution. `ship` is aliased to `deploy`.",
+		"CloudFront distribution. Each stage (build, upload, activate / " +
+		"deploy) is reported as a progress event: logged by default, or " +
+		"one JSON object per line on stderr with --progress=json. `ship` " +
+		"is aliased to `deploy`.",
 	Phases: []phase{
 		{
 			Num:       1,
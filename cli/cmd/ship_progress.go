@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aynaash/nextdeploy/shared"
+)
+
+// ProgressStatus is where a ship stage is in its lifecycle.
+type ProgressStatus string
+
+const (
+	ProgressStart    ProgressStatus = "start"
+	ProgressProgress ProgressStatus = "progress"
+	ProgressDone     ProgressStatus = "done"
+	ProgressFailed   ProgressStatus = "failed"
+)
+
+// ProgressEvent is one step of a ship, as rendered by `ship --progress`.
+// Percent is set only on progress events of stages that can measure it
+// (upload); Elapsed only on done and failed.
+type ProgressEvent struct {
+	Stage   string         `json:"stage"`
+	Status  ProgressStatus `json:"status"`
+	Percent *int           `json:"percent,omitempty"`
+	Message string         `json:"message,omitempty"`
+	Elapsed string         `json:"elapsed,omitempty"`
+	Time    time.Time      `json:"time"`
+}
+
+// progressEmitter hands events from the ship pipeline to a renderer on its own
+// goroutine. Stage transitions (start, done, failed) wait until they are
+// rendered, so they stay in order with the surrounding log lines; progress
+// updates never wait and are dropped while the renderer is still busy, so a
+// slow terminal or pipe cannot stall an upload. close waits for the renderer
+// to finish.
+type progressEmitter struct {
+	events chan queuedEvent
+	done   chan struct{}
+	once   sync.Once
+}
+
+type queuedEvent struct {
+	ev       ProgressEvent
+	rendered chan struct{} // nil for progress updates
+}
+
+func newProgressEmitter(render func(ProgressEvent)) *progressEmitter {
+	e := &progressEmitter{events: make(chan queuedEvent), done: make(chan struct{})}
+	go func() {
+		defer close(e.done)
+		for q := range e.events {
+			render(q.ev)
+			if q.rendered != nil {
+				close(q.rendered)
+			}
+		}
+	}()
+	return e
+}
+
+func (e *progressEmitter) emit(ev ProgressEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if ev.Status == ProgressProgress {
+		select {
+		case e.events <- queuedEvent{ev: ev}:
+		default:
+		}
+		return
+	}
+	q := queuedEvent{ev: ev, rendered: make(chan struct{})}
+	e.events <- q
+	<-q.rendered
+}
+
+func (e *progressEmitter) close() {
+	e.once.Do(func() { close(e.events) })
+	<-e.done
+}
+
+// progressRenderer picks how events are shown: "json" writes one event per
+// line to w for integrations; "text" logs them, drawing progress as a bar
+// that redraws in place when w is a terminal and as a line every 25%
+// otherwise (CI logs).
+func progressRenderer(mode string, log *shared.Logger, w io.Writer) (func(ProgressEvent), error) {
+	switch mode {
+	case "json":
+		enc := json.NewEncoder(w)
+		return func(ev ProgressEvent) { _ = enc.Encode(ev) }, nil
+	case "", "text":
+		return (&textProgress{log: log, w: w, tty: isTerminal(w)}).render, nil
+	default:
+		return nil, fmt.Errorf("unknown --progress %q (want text or json)", mode)
+	}
+}
+
+// textProgress is the human renderer.
+type textProgress struct {
+	log      *shared.Logger
+	w        io.Writer
+	tty      bool
+	stage    int
+	lastStep int  // last 25% step printed, non-TTY
+	barShown bool // a bar is on the current line, TTY
+}
+
+func (t *textProgress) render(ev ProgressEvent) {
+	if t.barShown && ev.Status != ProgressProgress {
+		fmt.Fprintln(t.w)
+		t.barShown = false
+	}
+	switch ev.Status {
+	case ProgressStart:
+		t.stage++
+		t.lastStep = 0
+		t.log.Info("── Stage %d: %s ──", t.stage, ev.Stage)
+	case ProgressProgress:
+		if ev.Percent == nil {
+			if ev.Message != "" {
+				t.log.Info("  %s: %s", ev.Stage, ev.Message)
+			}
+			return
+		}
+		pct := *ev.Percent
+		if t.tty {
+			fmt.Fprintf(t.w, "\r  %s %s %3d%%", ev.Stage, progressBar(pct, 30), pct)
+			t.barShown = true
+			return
+		}
+		if step := pct / 25 * 25; step > t.lastStep {
+			t.lastStep = step
+			t.log.Info("  %s: %d%%", ev.Stage, step)
+		}
+	case ProgressDone:
+		t.log.Info("  ✓ %s (%s)", ev.Stage, ev.Elapsed)
+	case ProgressFailed:
+		t.log.Error("  ✗ %s failed after %s", ev.Stage, ev.Elapsed)
+	}
+}
+
+// progressBar draws pct (0-100) as a bar width cells wide.
+func progressBar(pct, width int) string {
+	pct = max(0, min(pct, 100))
+	filled := pct * width / 100
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// percentOf converts done/total bytes into a whole percentage.
+func percentOf(done, total int64) int {
+	if total <= 0 {
+		return 100
+	}
+	return int(done * 100 / total)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aynaash/nextdeploy/shared"
+)
+
+func TestWithEnvPrefix(t *testing.T) {
+	env := map[string]string{
+		"SHOP_DATABASE_URL": "postgres://shop",
+		"SHOP_":             "empty name",
+		"BLOG_DATABASE_URL": "postgres://blog",
+		"STRIPE_KEY":        "sk",
+	}
+	tests := []struct {
+		name   string
+		prefix string
+		want   map[string]string
+	}{
+		{"no prefix keeps all", "", env},
+		{"prefix filters and strips", "SHOP_", map[string]string{"DATABASE_URL": "postgres://shop"}},
+		{"no match", "CRM_", map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withEnvPrefix(env, tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withEnvPrefix(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShipStagesJSONProgress(t *testing.T) {
+	var out bytes.Buffer
+	log := shared.New(io.Discard, "", 0, shared.LevelDebug)
+	render, err := progressRenderer("json", log, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages := &shipStages{log: log, progress: newProgressEmitter(render)}
+	stages.begin("build")
+	stages.begin("upload")
+	stages.bytes(512, 1024)
+	stages.begin("activate")
+	stages.report()
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var ev ProgressEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("event %q is not JSON: %v", line, err)
+		}
+		if ev.Time.IsZero() {
+			t.Errorf("event %q has no time", line)
+		}
+		if (ev.Status == ProgressDone) != (ev.Elapsed != "") {
+			t.Errorf("elapsed should be set exactly on done events: %q", line)
+		}
+		desc := ev.Stage + ":" + string(ev.Status)
+		if ev.Percent != nil {
+			desc += ":" + strconv.Itoa(*ev.Percent)
+		}
+		got = append(got, desc)
+	}
+	// The progress update may be dropped if the renderer is busy; transitions
+	// never are, and always arrive in order.
+	want := []string{"build:start", "build:done", "upload:start", "upload:progress:50", "upload:done", "activate:start", "activate:done"}
+	if !reflect.DeepEqual(got, want) && !reflect.DeepEqual(got, append(want[:3:3], want[4:]...)) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestTextProgressSteps(t *testing.T) {
+	var out bytes.Buffer
+	log := shared.New(&out, "", 0, shared.LevelDebug)
+	tp := &textProgress{log: log, w: &out}
+	tp.render(ProgressEvent{Stage: "upload", Status: ProgressStart})
+	for _, pct := range []int{3, 20, 26, 40, 51, 99, 100} {
+		tp.render(ProgressEvent{Stage: "upload", Status: ProgressProgress, Percent: &pct})
+	}
+	text := out.String()
+	for _, want := range []string{"Stage 1: upload", "upload: 25%", "upload: 50%", "upload: 75%", "upload: 100%"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "upload: 25%") != 1 {
+		t.Errorf("each step should be printed once:\n%s", text)
+	}
+
+	if _, err := progressRenderer("xml", log, &out); err == nil {
+		t.Error("unknown progress mode should be rejected")
+	}
+	if got := progressBar(40, 10); got != "[####------]" {
+		t.Errorf("progressBar(40, 10) = %q", got)
+	}
+}
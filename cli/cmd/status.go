@@ -13,6 +13,13 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	statusAll      bool
+	statusSelftest bool
+	statusWatch    bool
+	statusInterval time.Duration
+)
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show the current status of your deployed application",
@@ -41,10 +48,70 @@ var statusCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		if statusWatch {
+			if statusInterval < time.Second {
+				log.Error("--interval must be at least 1s")
+				os.Exit(1)
+			}
+			fetch := func(ctx context.Context) (*statusReport, error) {
+				ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+				defer cancel()
+				// Exits non-zero when an app is unhealthy, but the report
+				// is still printed; only a missing report is an error.
+				output, err := srv.ExecuteCommand(ctx, deploymentServer, "sudo /usr/local/bin/nextdeployd status --all --json", nil)
+				report, perr := parseStatusReport(output)
+				if perr != nil && err != nil {
+					return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(output))
+				}
+				return report, perr
+			}
+			report, err := watchStatus(context.Background(), os.Stdout, statusInterval, fetch)
+			if err != nil {
+				log.Error("Failed to query daemon: %v", err)
+				os.Exit(1)
+			}
+			if !isTerminal(os.Stdout) && !report.OverallHealthy {
+				os.Exit(1)
+			}
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
-		daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd status --appName=%s", shellQuote(appName))
+		if statusSelftest {
+			// The canary may take up to its 30s readiness window, plus
+			// install and teardown.
+			stCtx, stCancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer stCancel()
+			output, err := srv.ExecuteCommand(stCtx, deploymentServer, "sudo /usr/local/bin/nextdeployd selftest", nil)
+			output = strings.TrimSpace(output)
+			if idx := strings.Index(output, "Selftest:"); idx >= 0 {
+				output = output[idx:]
+			}
+			fmt.Println(output)
+			if err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+
+		if statusAll {
+			// The daemon exits non-zero unless every app is healthy; pass
+			// that on so CI can gate on it.
+			output, err := srv.ExecuteCommand(ctx, deploymentServer, "sudo /usr/local/bin/nextdeployd status --all", nil)
+			output = strings.TrimSpace(output)
+			if idx := strings.Index(output, "Health:"); idx >= 0 {
+				output = output[idx:]
+			}
+			fmt.Println(output)
+			if err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+
+		daemonCmd := fmt.Sprintf("sudo /usr/local/bin/nextdeployd status --appName=%s", shared.ShellQuote(appName))
 		output, err := srv.ExecuteCommand(ctx, deploymentServer, daemonCmd, nil)
 		if err != nil {
 			log.Error("Failed to query daemon: %v\nOutput: %s", err, output)
@@ -65,5 +132,9 @@ var statusCmd = &cobra.Command{
 }
 
 func init() {
+	statusCmd.Flags().BoolVar(&statusAll, "all", false, "Report the health of every app on the server; exits non-zero unless all are healthy")
+	statusCmd.Flags().BoolVar(&statusSelftest, "selftest", false, "Run a canary unit on the server end to end (start, health, request, remove); exits non-zero if any step fails")
+	statusCmd.Flags().BoolVar(&statusWatch, "watch", false, "Show every app's state, health, CPU and memory as a table that refreshes until Ctrl-C; prints one snapshot when not on a terminal")
+	statusCmd.Flags().DurationVar(&statusInterval, "interval", 2*time.Second, "Refresh interval for --watch")
 	rootCmd.AddCommand(statusCmd)
 }
@@ -7,7 +7,14 @@ var statusExplanation = explanation{
 		"the app: serverless surfaces the worker/function name, most " +
 		"recent deployment timestamp, and health probes; VPS surfaces " +
 		"the daemon's report for each configured server (running release, " +
-		"process health, open ports).",
+		"process health, open ports). `--all` asks the daemon for the " +
+		"health of every app on the server and exits non-zero unless all " +
+		"are healthy. `--selftest` has the daemon start a canary unit, " +
+		"wait for it to pass the readiness probe, request it and remove " +
+		"it, printing each step's timing; run it before trusting a new " +
+		"host with a real deploy. `--watch` redraws a table of every " +
+		"app's state, health, CPU% and memory each --interval (2s) " +
+		"until Ctrl-C; piped, it prints one snapshot.",
 	Phases: []phase{
 		{
 			Num:       1,
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const statusJSON = `{"apps":{"web":{"healthy":true,"state":"active","release":"1700000002-0a1b2c3","memory_bytes":157286400,"cpu_usage_nsec":4000000000},` +
+	`"shop":{"healthy":false,"state":"failed","release":"1700000001-def5678","error":"unit is failed"}},"overall_healthy":false,"unhealthy":1}`
+
+func TestParseStatusReport(t *testing.T) {
+	r, err := parseStatusReport("sudo: unable to resolve host\n" + statusJSON + "\n")
+	if err != nil {
+		t.Fatalf("parseStatusReport: %v", err)
+	}
+	if r.OverallHealthy || r.Unhealthy != 1 || len(r.Apps) != 2 || r.Apps["web"].MemoryBytes != 157286400 {
+		t.Errorf("got %+v", r)
+	}
+	if _, err := parseStatusReport("Error: daemon not running\n"); err == nil {
+		t.Error("expected an error without a report")
+	}
+}
+
+func TestRenderStatusTable(t *testing.T) {
+	cur, _ := parseStatusReport(statusJSON)
+	prev, _ := parseStatusReport(strings.Replace(statusJSON, "4000000000", "3000000000", 1))
+	now := time.Now()
+
+	var b strings.Builder
+	renderStatusTable(&b, &statusSample{report: prev, at: now.Add(-2 * time.Second)}, &statusSample{report: cur, at: now}, 0)
+	out := b.String()
+	for _, want := range []string{"APP", "shop", "UNHEALTHY (unit is failed)", "web", "active", "50.0", "150.0MB", "1/2 app(s) healthy"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("table missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "shop") > strings.Index(out, "web") {
+		t.Errorf("apps should be sorted:\n%s", out)
+	}
+
+	b.Reset()
+	renderStatusTable(&b, nil, &statusSample{report: cur, at: now}, 20)
+	for line := range strings.SplitSeq(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		if len([]rune(line)) > 20 {
+			t.Errorf("line wider than the terminal: %q", line)
+		}
+	}
+}
+
+func TestCPUPercent(t *testing.T) {
+	tests := []struct {
+		prev, cur uint64
+		elapsed   time.Duration
+		want      string
+	}{
+		{1e9, 3e9, 2 * time.Second, "100.0"},
+		{0, 5e8, time.Second, "50.0"},
+		{0, 0, time.Second, "-"},     // no accounting
+		{3e9, 1e9, time.Second, "-"}, // counter reset (restart)
+		{1e9, 2e9, 0, "-"},           // no interval
+	}
+	for _, tt := range tests {
+		if got := cpuPercent(tt.prev, tt.cur, tt.elapsed); got != tt.want {
+			t.Errorf("cpuPercent(%d, %d, %s) = %s, want %s", tt.prev, tt.cur, tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestWatchStatusNonTTYPrintsOneSnapshot(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	calls := 0
+	report, err := watchStatus(context.Background(), out, time.Second, func(context.Context) (*statusReport, error) {
+		calls++
+		return parseStatusReport(statusJSON)
+	})
+	if err != nil || report == nil || report.OverallHealthy {
+		t.Fatalf("watchStatus = %+v, %v", report, err)
+	}
+	if calls != 1 {
+		t.Errorf("fetched %d times, want one snapshot", calls)
+	}
+	data, _ := os.ReadFile(out.Name())
+	if strings.Contains(string(data), "\033[") || !strings.Contains(string(data), "1/2 app(s) healthy") {
+		t.Errorf("unexpected snapshot:\n%q", data)
+	}
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// appStatus is one app in the daemon's `status --all --json` report.
+type appStatus struct {
+	Healthy      bool   `json:"healthy"`
+	State        string `json:"state"`
+	Release      string `json:"release"`
+	Error        string `json:"error,omitempty"`
+	MemoryBytes  uint64 `json:"memory_bytes,omitempty"`
+	CPUUsageNSec uint64 `json:"cpu_usage_nsec,omitempty"`
+}
+
+// statusReport is the daemon's `status --all --json` report.
+type statusReport struct {
+	Apps           map[string]appStatus `json:"apps"`
+	OverallHealthy bool                 `json:"overall_healthy"`
+	Unhealthy      int                  `json:"unhealthy"`
+}
+
+// parseStatusReport reads the JSON report out of the remote command's
+// output, skipping anything the shell printed before it.
+func parseStatusReport(output string) (*statusReport, error) {
+	idx := strings.Index(output, "{")
+	if idx < 0 {
+		return nil, fmt.Errorf("no status report in output: %s", strings.TrimSpace(output))
+	}
+	var r statusReport
+	if err := json.NewDecoder(strings.NewReader(output[idx:])).Decode(&r); err != nil {
+		return nil, fmt.Errorf("invalid status report: %w", err)
+	}
+	return &r, nil
+}
+
+// statusSample is a report and when it was taken; two samples give CPU%.
+type statusSample struct {
+	report *statusReport
+	at     time.Time
+}
+
+// renderStatusTable draws cur as a table of apps, one line each, cut to
+// width columns (0 for no limit). CPU% is the unit's CPU time between prev
+// and cur over the wall time between them; it is blank on the first sample
+// and for apps without CPU accounting.
+func renderStatusTable(w io.Writer, prev, cur *statusSample, width int) {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "APP\tSTATE\tHEALTH\tCPU%\tMEMORY\tRELEASE")
+	names := make([]string, 0, len(cur.report.Apps))
+	for name := range cur.report.Apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a := cur.report.Apps[name]
+		health := "healthy"
+		if !a.Healthy {
+			health = "UNHEALTHY"
+			if a.Error != "" {
+				health += " (" + a.Error + ")"
+			}
+		}
+		cpu := "-"
+		if prev != nil {
+			if p, ok := prev.report.Apps[name]; ok && p.Release == a.Release {
+				cpu = cpuPercent(p.CPUUsageNSec, a.CPUUsageNSec, cur.at.Sub(prev.at))
+			}
+		}
+		mem := "-"
+		if a.MemoryBytes > 0 {
+			mem = fmt.Sprintf("%.1fMB", float64(a.MemoryBytes)/(1024*1024))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", name, a.State, health, cpu, mem, a.Release)
+	}
+	_ = tw.Flush()
+
+	healthy := len(cur.report.Apps) - cur.report.Unhealthy
+	fmt.Fprintf(&b, "\n%d/%d app(s) healthy · %s\n", healthy, len(cur.report.Apps), cur.at.Format("15:04:05"))
+
+	for line := range strings.SplitSeq(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		if width > 0 && len([]rune(line)) > width {
+			line = string([]rune(line)[:width])
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// cpuPercent is the share of one CPU used between two cumulative CPU
+// readings taken elapsed apart; "-" when there is nothing to compare.
+func cpuPercent(prev, cur uint64, elapsed time.Duration) string {
+	if cur == 0 || cur < prev || elapsed <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", float64(cur-prev)/float64(elapsed.Nanoseconds())*100)
+}
+
+// watchStatus polls fetch every interval and redraws the table in place
+// until Ctrl-C. It also redraws the last table when the terminal is resized.
+// When out is not a terminal it prints one snapshot instead. The returned
+// report is the last one fetched.
+func watchStatus(ctx context.Context, out *os.File, interval time.Duration, fetch func(context.Context) (*statusReport, error)) (*statusReport, error) {
+	report, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cur := &statusSample{report: report, at: time.Now()}
+	if !isTerminal(out) {
+		renderStatusTable(out, nil, cur, 0)
+		return report, nil
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer signal.Stop(resized)
+
+	// Hide the cursor while redrawing; show it again however we leave.
+	fmt.Fprint(out, "\033[?25l")
+	defer fmt.Fprint(out, "\033[?25h")
+
+	var prev *statusSample
+	var lastErr error
+	draw := func() {
+		width, _, err := term.GetSize(int(out.Fd()))
+		if err != nil {
+			width = 0
+		}
+		fmt.Fprint(out, "\033[H\033[2J")
+		renderStatusTable(out, prev, cur, width)
+		if lastErr != nil {
+			fmt.Fprintf(out, "last refresh failed: %v\n", lastErr)
+		}
+		fmt.Fprintf(out, "every %s · Ctrl-C to exit\n", interval)
+	}
+	draw()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			return cur.report, nil
+		case <-resized:
+			draw()
+		case <-ticker.C:
+			report, err := fetch(ctx)
+			if errors.Is(ctx.Err(), context.Canceled) {
+				continue
+			}
+			// Keep showing the last good table; a dropped connection should
+			// not blank the screen.
+			lastErr = err
+			if err == nil {
+				prev, cur = cur, &statusSample{report: report, at: time.Now()}
+			}
+			draw()
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package cmd
+
+import "os"
+
+// notifyResize is a no-op on Windows, which has no resize signal; the table
+// picks up the new width on its next refresh.
+func notifyResize(c chan<- os.Signal) {}
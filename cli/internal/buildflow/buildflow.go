@@ -18,8 +18,10 @@ package buildflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 
 	"github.com/aynaash/nextdeploy/internal/packaging"
@@ -44,6 +46,18 @@ type Opts struct {
 	// false because shipping with an unverified-stale build is a footgun.
 	Force bool
 
+	// SkipBuild reuses the output of a previous build: metadata is
+	// regenerated from the existing .next and validated, but `next build`
+	// and the VPS tarball are not re-run. Fails when there is no build.
+	// Wired to `nextdeploy ship --skip-build` and `nextdeploy build
+	// --no-build`.
+	SkipBuild bool
+
+	// ContainerizedBuild runs `next build` in a Node container instead of on
+	// the host, so the output does not depend on the host toolchain. Wired
+	// to `--containerized-build` on build and ship.
+	ContainerizedBuild bool
+
 	// Log receives lifecycle messages. Required.
 	Log *shared.Logger
 }
@@ -74,10 +88,11 @@ type Result struct {
 // Run executes the unified build flow:
 //
 //  1. Incremental skip (unless Force): if git commit is unchanged, return
-//     early with a fresh metadata payload.
+//     early with a metadata payload read from the existing build.
 //  2. Generate metadata (nextcore.GenerateMetadata) — reads next.config
 //     and the routes/prerender manifests.
-//  3. Validate output mode + features against the resolved target.
+//  3. Validate output mode + features against the resolved target. With
+//     SkipBuild, return here and leave the existing artifacts in place.
 //  4. Decide whether `next build` needs to run, and with which flags
 //     (Cloudflare requires --webpack; AWS / VPS take the user's default).
 //  5. For VPS: copy public/ + static/ + metadata.json into the release
@@ -94,26 +109,48 @@ func Run(ctx context.Context, opts Opts) (*Result, error) {
 	if project == "" {
 		project = "."
 	}
+	metaOpts := nextcore.MetadataOpts{ProjectDir: project, Containerized: opts.ContainerizedBuild, NoBuild: opts.SkipBuild}
+	if opts.ContainerizedBuild {
+		if _, err := exec.LookPath("docker"); err != nil {
+			return nil, fmt.Errorf("--containerized-build needs docker on PATH: %w", err)
+		}
+	}
 
 	// ── 1. Incremental skip ────────────────────────────────────────────
+	// The metadata is read from the existing build; if .next has since been
+	// removed, fall through to a full build.
 	if !opts.Force {
-		if err := nextcore.ValidateBuildState(); err == nil {
-			opts.Log.Info("Git commit unchanged — skipping build (incremental state matched).")
-			payload, mErr := nextcore.GenerateMetadata()
-			if mErr != nil {
+		if err := nextcore.ValidateBuildStateIn(project); err == nil {
+			skipOpts := metaOpts
+			skipOpts.NoBuild = true
+			payload, mErr := nextcore.GenerateMetadataWith(skipOpts)
+			var standaloneErr error
+			if mErr == nil && payload.OutputMode == nextcore.OutputModeStandalone {
+				standaloneErr = checkStandaloneOutput(filepath.Join(project, payload.DistDir, "standalone"))
+			}
+			switch {
+			case mErr == nil && standaloneErr != nil && !opts.SkipBuild:
+				opts.Log.Info("Git commit unchanged but the standalone output is incomplete — rebuilding.")
+			case mErr == nil && standaloneErr != nil:
+				return nil, standaloneErr
+			case mErr == nil:
+				opts.Log.Info("Git commit unchanged — skipping build (incremental state matched).")
+				return &Result{
+					Payload:         payload,
+					EffectiveTarget: opts.Cfg.ResolveTargetType(payload.Config.TargetType),
+					StandaloneDir:   filepath.Join(project, payload.DistDir, "standalone"),
+					Skipped:         true,
+				}, nil
+			case errors.Is(mErr, nextcore.ErrNoBuild) && !opts.SkipBuild:
+				opts.Log.Info("Git commit unchanged but the build output is gone — rebuilding.")
+			default:
 				return nil, fmt.Errorf("regenerate metadata after incremental skip: %w", mErr)
 			}
-			return &Result{
-				Payload:         payload,
-				EffectiveTarget: opts.Cfg.ResolveTargetType(payload.Config.TargetType),
-				StandaloneDir:   filepath.Join(payload.DistDir, "standalone"),
-				Skipped:         true,
-			}, nil
 		}
 	}
 
 	// ── 2. Metadata ────────────────────────────────────────────────────
-	payload, err := nextcore.GenerateMetadata()
+	payload, err := nextcore.GenerateMetadataWith(metaOpts)
 	if err != nil {
 		return nil, fmt.Errorf("generate metadata: %w", err)
 	}
@@ -125,20 +162,45 @@ func Run(ctx context.Context, opts Opts) (*Result, error) {
 		return nil, err
 	}
 
+	if opts.SkipBuild {
+		if payload.OutputMode == nextcore.OutputModeStandalone {
+			if err := checkStandaloneOutput(filepath.Join(project, payload.DistDir, "standalone")); err != nil {
+				return nil, err
+			}
+		}
+		opts.Log.Info("Skipping build — reusing existing build output.")
+		return &Result{
+			Payload:         payload,
+			EffectiveTarget: target,
+			StandaloneDir:   filepath.Join(project, payload.DistDir, "standalone"),
+			Skipped:         true,
+		}, nil
+	}
+
 	// ── 4. next build (if needed) ──────────────────────────────────────
-	rebuilt, err := ensureNextBuild(ctx, target, opts.Cfg, opts.Log)
-	if err != nil {
-		return nil, err
+	// A containerized build already ran inside GenerateMetadataWith; a host
+	// fallback here would defeat its purpose.
+	rebuilt := false
+	if !opts.ContainerizedBuild {
+		rebuilt, err = ensureNextBuild(ctx, project, target, opts.Cfg, opts.Log)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if rebuilt {
 		// Manifests changed underneath us — refresh.
-		payload, err = nextcore.GenerateMetadata()
+		payload, err = nextcore.GenerateMetadataWith(metaOpts)
 		if err != nil {
 			return nil, fmt.Errorf("regenerate metadata after build: %w", err)
 		}
 	}
 
-	standaloneDir := filepath.Join(payload.DistDir, "standalone")
+	standaloneDir := filepath.Join(project, payload.DistDir, "standalone")
+	if payload.OutputMode == nextcore.OutputModeStandalone {
+		if err := checkStandaloneOutput(standaloneDir); err != nil {
+			return nil, err
+		}
+	}
 	result := &Result{
 		Payload:         payload,
 		EffectiveTarget: target,
@@ -147,7 +209,7 @@ func Run(ctx context.Context, opts Opts) (*Result, error) {
 
 	// ── 5. VPS artifact ────────────────────────────────────────────────
 	if target == "vps" {
-		releaseDir, tarballPath, err := buildVPSArtifact(payload, opts.Log)
+		releaseDir, tarballPath, err := buildVPSArtifact(project, payload, opts.Log)
 		if err != nil {
 			return nil, err
 		}
@@ -188,6 +250,11 @@ func validateForTarget(target string, payload *nextcore.NextCorePayload, cfg *co
 	if target == "vps" && payload.OutputMode == nextcore.OutputModeStandalone {
 		log.Warn("Targeting 'vps' with 'output: standalone' — works, but the default mode is often preferred for VPS.")
 	}
+	if target == "vps" {
+		if errs := config.ValidateApp(cfg.App); len(errs) > 0 {
+			return fmt.Errorf("app.%w", errs[0])
+		}
+	}
 	if payload.DetectedFeatures != nil && payload.DetectedFeatures.HasServerActions && payload.OutputMode == nextcore.OutputModeExport {
 		return fmt.Errorf("Server Actions detected with OutputMode=export — change Next.js config to a runtime-enabled mode")
 	}
@@ -223,13 +290,13 @@ func validateForTarget(target string, payload *nextcore.NextCorePayload, cfg *co
 // page from a dispatch table — Turbopack's runtime-resolved chunks crash
 // once esbuild bundles them. AWS and VPS ship the full standalone
 // server.js so either bundler works there.
-func ensureNextBuild(ctx context.Context, target string, cfg *config.NextDeployConfig, log *shared.Logger) (bool, error) {
-	standalone := ".next/standalone"
+func ensureNextBuild(ctx context.Context, project, target string, cfg *config.NextDeployConfig, log *shared.Logger) (bool, error) {
+	standalone := filepath.Join(project, ".next", "standalone")
 	info, err := os.Stat(standalone)
 	hasBuild := err == nil && info.IsDir()
 
 	if target == "serverless" && cfg.Serverless != nil && cfg.Serverless.Provider == "cloudflare" {
-		if hasBuild && !nextbuild.IsTurbopackOutput(".") {
+		if hasBuild && !nextbuild.IsTurbopackOutput(project) {
 			log.Info("Existing Webpack standalone detected — skipping rebuild.")
 			return false, nil
 		}
@@ -240,7 +307,7 @@ func ensureNextBuild(ctx context.Context, target string, cfg *config.NextDeployC
 			log.Info("Re-running `next build --webpack` (this overwrites .next/).")
 		}
 		if err := nextbuild.Run(ctx, nextbuild.Opts{
-			ProjectDir: ".",
+			ProjectDir: project,
 			Target:     nextbuild.TargetCloudflareWorker,
 			Log:        log,
 		}); err != nil {
@@ -255,7 +322,7 @@ func ensureNextBuild(ctx context.Context, target string, cfg *config.NextDeployC
 	}
 	log.Info("No standalone build found — running `next build`.")
 	if err := nextbuild.Run(ctx, nextbuild.Opts{
-		ProjectDir: ".",
+		ProjectDir: project,
 		Target:     nextbuildTargetFor(target),
 		Log:        log,
 	}); err != nil {
@@ -275,39 +342,86 @@ func nextbuildTargetFor(target string) nextbuild.Target {
 	}
 }
 
-// buildVPSArtifact stages public/ + static/ + metadata.json into the
-// release directory and tars it into app.tar.gz. Mirrors what the old
-// `nextdeploy build` did for the VPS path.
-func buildVPSArtifact(payload nextcore.NextCorePayload, log *shared.Logger) (releaseDir, tarballPath string, err error) {
+// checkStandaloneOutput fails when a standalone build left no server.js in
+// standaloneDir. Without this check, packaging copies public/ into an empty
+// tree, and the failure only shows up when the release's unit cannot find
+// server.js on the server, or in the serverless packager.
+func checkStandaloneOutput(standaloneDir string) error {
+	if _, err := os.Stat(filepath.Join(standaloneDir, "server.js")); err == nil {
+		return nil
+	}
+	return fmt.Errorf("the build produced no standalone output: %s is missing. "+
+		"Set output: \"standalone\" in the next.config the build reads (next.config.js, .mjs or .ts), "+
+		"check the build log above for errors, and rebuild with `nextdeploy build --force`", filepath.Join(standaloneDir, "server.js"))
+}
+
+// ensureServerTrees copies the compiled routes of each detected router
+// (server/app for the App Router's server components, server/pages for the
+// Pages Router) of project into the standalone tree when file tracing left
+// them out. Without them the server starts and then answers every route with
+// a 500.
+func ensureServerTrees(project string, payload nextcore.NextCorePayload, standaloneDir string, log *shared.Logger) error {
+	var trees []string
+	if payload.NextBuildMetadata.HasAppRouter {
+		trees = append(trees, "app")
+	}
+	if payload.NextBuildMetadata.HasPagesRouter {
+		trees = append(trees, "pages")
+	}
+	for _, tree := range trees {
+		src := filepath.Join(project, payload.DistDir, "server", tree)
+		dst := filepath.Join(standaloneDir, payload.DistDir, "server", tree)
+		if _, err := os.Stat(dst); err == nil {
+			continue
+		}
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		log.Warn("%s is missing from the standalone output; copying it from %s", dst, src)
+		if err := utils.CopyDir(src, dst); err != nil {
+			return fmt.Errorf("copy %s: %w", src, err)
+		}
+	}
+	return nil
+}
+
+// buildVPSArtifact stages project's public/ + static/ + metadata.json into
+// the release directory and tars it into app.tar.gz in project. Mirrors what
+// the old `nextdeploy build` did for the VPS path.
+func buildVPSArtifact(project string, payload nextcore.NextCorePayload, log *shared.Logger) (releaseDir, tarballPath string, err error) {
+	metadata := filepath.Join(project, ".nextdeploy", "metadata.json")
 	rd := ""
 	switch payload.OutputMode {
 	case nextcore.OutputModeStandalone:
-		rd = filepath.Join(payload.DistDir, "standalone")
+		rd = filepath.Join(project, payload.DistDir, "standalone")
 		log.Info("Copying public/ → %s/public/", rd)
-		if err := utils.CopyDir("public", filepath.Join(rd, "public")); err != nil {
+		if err := utils.CopyDir(filepath.Join(project, "public"), filepath.Join(rd, "public")); err != nil {
 			return "", "", fmt.Errorf("copy public/: %w", err)
 		}
 		log.Info("Copying %s/static/ → %s/%s/static/", payload.DistDir, rd, payload.DistDir)
-		if err := utils.CopyDir(filepath.Join(payload.DistDir, "static"), filepath.Join(rd, payload.DistDir, "static")); err != nil {
+		if err := utils.CopyDir(filepath.Join(project, payload.DistDir, "static"), filepath.Join(rd, payload.DistDir, "static")); err != nil {
 			return "", "", fmt.Errorf("copy %s/static/: %w", payload.DistDir, err)
 		}
-		if err := utils.CopyFile(".nextdeploy/metadata.json", filepath.Join(rd, "metadata.json")); err != nil {
+		if err := ensureServerTrees(project, payload, rd, log); err != nil {
+			return "", "", err
+		}
+		if err := utils.CopyFile(metadata, filepath.Join(rd, "metadata.json")); err != nil {
 			return "", "", fmt.Errorf("copy metadata.json: %w", err)
 		}
 	case nextcore.OutputModeExport:
-		rd = payload.ExportDir
-		if err := utils.CopyFile(".nextdeploy/metadata.json", filepath.Join(rd, "metadata.json")); err != nil {
+		rd = filepath.Join(project, payload.ExportDir)
+		if err := utils.CopyFile(metadata, filepath.Join(rd, "metadata.json")); err != nil {
 			return "", "", fmt.Errorf("copy metadata.json: %w", err)
 		}
 	default:
-		rd = "."
-		if err := utils.CopyFile(".nextdeploy/metadata.json", "metadata.json"); err != nil {
+		rd = project
+		if err := utils.CopyFile(metadata, filepath.Join(project, "metadata.json")); err != nil {
 			return "", "", fmt.Errorf("copy metadata.json: %w", err)
 		}
 	}
 	log.Info("Release directory: %s", rd)
 
-	tarball := "app.tar.gz"
+	tarball := filepath.Join(project, "app.tar.gz")
 	log.Info("Creating tarball: %s", tarball)
 	if err := utils.CreateTarball(rd, tarball, "vps", &payload, log); err != nil {
 		return "", "", fmt.Errorf("create tarball: %w", err)
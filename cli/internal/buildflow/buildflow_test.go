@@ -0,0 +1,170 @@
+package buildflow
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aynaash/nextdeploy/shared"
+	"github.com/aynaash/nextdeploy/shared/config"
+	"github.com/aynaash/nextdeploy/shared/nextcore"
+)
+
+func TestCheckStandaloneOutput(t *testing.T) {
+	dir := t.TempDir()
+	standalone := filepath.Join(dir, ".next", "standalone")
+
+	err := checkStandaloneOutput(standalone)
+	if err == nil || !strings.Contains(err.Error(), `output: "standalone"`) {
+		t.Fatalf("missing standalone dir: err = %v, want guidance on output: \"standalone\"", err)
+	}
+
+	// A tree without server.js, as when only public/ was copied in.
+	if err := os.MkdirAll(filepath.Join(standalone, "public"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkStandaloneOutput(standalone); err == nil {
+		t.Fatal("standalone tree without server.js accepted")
+	}
+
+	if err := os.WriteFile(filepath.Join(standalone, "server.js"), []byte("require('next')\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkStandaloneOutput(standalone); err != nil {
+		t.Errorf("complete standalone tree rejected: %v", err)
+	}
+}
+
+// stubBuildTools puts package manager and next stubs first on PATH that
+// record any invocation in the returned file.
+func stubBuildTools(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	marker := filepath.Join(t.TempDir(), "invoked")
+	for _, tool := range []string{"npm", "npx", "pnpm", "yarn", "bun", "next", "node"} {
+		script := "#!/bin/sh\necho " + tool + " \"$@\" >> " + marker + "\nexit 1\n"
+		if err := os.WriteFile(filepath.Join(bin, tool), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return marker
+}
+
+// writeProject lays out a minimal Next.js project in dir, without a build.
+func writeProject(t *testing.T, dir string) *config.NextDeployConfig {
+	t.Helper()
+	files := map[string]string{
+		config.ConfigFile:   "version: \"1.0\"\napp:\n  name: shop\n",
+		"package.json":      `{"name":"shop","scripts":{"build":"next build","start":"next start"},"dependencies":{"next":"15.0.0"}}`,
+		"package-lock.json": "{}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := config.LoadFrom(filepath.Join(dir, config.ConfigFile))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	return cfg
+}
+
+func TestRunSkipBuildNeverBuilds(t *testing.T) {
+	marker := stubBuildTools(t)
+	dir := t.TempDir()
+	cfg := writeProject(t, dir)
+	t.Chdir(dir)
+
+	_, err := Run(context.Background(), Opts{Cfg: cfg, SkipBuild: true, Force: true, Log: shared.PackageLogger("test", "test")})
+	if !errors.Is(err, nextcore.ErrNoBuild) {
+		t.Errorf("--skip-build without a build: err = %v, want ErrNoBuild", err)
+	}
+	if ran, err := os.ReadFile(marker); err == nil {
+		t.Errorf("--skip-build ran build tools:\n%s", ran)
+	}
+}
+
+func TestEnsureServerTrees(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, f := range []string{".next/server/app/page.js", ".next/server/pages/index.js", ".next/standalone/server.js"} {
+		if err := os.MkdirAll(filepath.Dir(f), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte("module.exports = {}\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	standalone := filepath.Join(".next", "standalone")
+	payload := nextcore.NextCorePayload{DistDir: ".next"}
+	payload.NextBuildMetadata.HasAppRouter = true
+	log := shared.PackageLogger("test", "test")
+
+	if err := ensureServerTrees(".", payload, standalone, log); err != nil {
+		t.Fatalf("ensureServerTrees: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(standalone, ".next", "server", "app", "page.js")); err != nil {
+		t.Errorf("App Router tree missing from the standalone output was not copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(standalone, ".next", "server", "pages")); !os.IsNotExist(err) {
+		t.Errorf("a router the build does not use must not be copied: %v", err)
+	}
+
+	// A tree file tracing already produced is left as it is.
+	traced := filepath.Join(standalone, ".next", "server", "pages")
+	if err := os.MkdirAll(traced, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	payload.NextBuildMetadata.HasPagesRouter = true
+	if err := ensureServerTrees(".", payload, standalone, log); err != nil {
+		t.Fatalf("ensureServerTrees: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(traced, "index.js")); !os.IsNotExist(err) {
+		t.Errorf("an existing traced tree was overwritten: %v", err)
+	}
+}
+
+func TestRunProjectDirFromAnotherCwd(t *testing.T) {
+	stubBuildTools(t)
+	dir := t.TempDir()
+	cfg := writeProject(t, dir)
+	for _, d := range []string{".next", "public"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".next", "BUILD_ID"), []byte("build-1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("git %s: %v\n%s", args[0], err, out)
+		}
+	}
+	cwd := t.TempDir()
+	t.Chdir(cwd)
+
+	res, err := Run(context.Background(), Opts{ProjectDir: dir, Cfg: cfg, SkipBuild: true, Force: true, Log: shared.PackageLogger("test", "test")})
+	if err != nil {
+		t.Fatalf("Run with ProjectDir: %v", err)
+	}
+	if res.Payload.NextBuildMetadata.BuildID != "build-1" {
+		t.Errorf("BuildID = %q, want the project's build-1", res.Payload.NextBuildMetadata.BuildID)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".nextdeploy", "metadata.json")); err != nil {
+		t.Errorf("metadata.json not written into the project: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cwd, ".nextdeploy")); !os.IsNotExist(err) {
+		t.Errorf("Run wrote into the working directory instead of the project: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package initialcommand
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -40,8 +41,11 @@ func RunInitCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	cwd, _ := os.Getwd()
-	pkgManager, _ := nextcore.DetectPackageManager(cwd)
-	if pkgManager != nextcore.Unknown {
+	pkgManager, err := nextcore.DetectPackageManager(cwd)
+	var ambiguous *nextcore.AmbiguousLockfilesError
+	if errors.As(err, &ambiguous) {
+		log.Warn("  ⚠ Package manager: guessing %s, but %v\n", pkgManager.String(), err)
+	} else if pkgManager != nextcore.Unknown {
 		log.Info("  ✓ Package manager: %s\n", pkgManager.String())
 	}
 
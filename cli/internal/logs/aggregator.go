@@ -59,8 +59,14 @@ func (a *LogAggregator) printLine(source LogSource, content string) {
 	reset := "\033[0m"
 	sourceLabel := fmt.Sprintf("%s% -6s%s ", sourceColor, source, reset)
 
-	// Special case for journalctl metadata (Mar 05 19:39:47 ...)
-	content = stripJournalMetadata(content)
+	// Lines from a multi-release stream (journalctl -o with-unit) are labelled
+	// with their release; everything else is plain journal metadata.
+	if labelled, ok := labelReleaseLine(content, a.AppName); ok {
+		content = labelled
+	} else {
+		// Special case for journalctl metadata (Mar 05 19:39:47 ...)
+		content = stripJournalMetadata(content)
+	}
 
 	// Apply Next.js specific colorization
 	content = colorizeNextJS(content)
@@ -79,6 +85,21 @@ func stripJournalMetadata(line string) string {
 	return re.ReplaceAllString(line, "")
 }
 
+// withUnitLine matches journalctl -o with-unit output:
+// "Tue 2024-03-05 19:39:47 UTC host nextdeploy-app-1712345678-abc1234.service[812]: msg"
+var withUnitLine = regexp.MustCompile(`^\w{3} \d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} \S+ \S+ (\S+?)\.service(?:\[\d+\])?: (.*)$`)
+
+// labelReleaseLine rewrites a with-unit journal line as "[<releaseID>] msg",
+// so interleaved output from several releases of appName stays attributable.
+func labelReleaseLine(line, appName string) (string, bool) {
+	m := withUnitLine.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	release := strings.TrimPrefix(m[1], "nextdeploy-"+appName+"-")
+	return fmt.Sprintf("\033[90m[%s]\033[0m %s", release, m[2]), true
+}
+
 func colorizeNextJS(line string) string {
 	// Levels
 	line = strings.ReplaceAll(line, "✓ Starting...", "\033[32m✓ Starting...\033[0m")
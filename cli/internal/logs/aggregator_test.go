@@ -0,0 +1,18 @@
+package logs
+
+import "testing"
+
+func TestLabelReleaseLine(t *testing.T) {
+	line := "Tue 2024-03-05 19:39:47 UTC web-1 nextdeploy-shop-1712345678-abc1234.service[812]: ✓ Ready in 412ms"
+	got, ok := labelReleaseLine(line, "shop")
+	if !ok {
+		t.Fatalf("expected with-unit line to be labelled")
+	}
+	if want := "\033[90m[1712345678-abc1234]\033[0m ✓ Ready in 412ms"; got != want {
+		t.Errorf("labelReleaseLine = %q, want %q", got, want)
+	}
+
+	if _, ok := labelReleaseLine("Mar 05 19:39:47 web-1 node[812]: hello", "shop"); ok {
+		t.Error("plain short-format journal line must not be treated as a release line")
+	}
+}
@@ -447,6 +447,12 @@ func (s *ServerStruct) ExecuteCommand(ctx context.Context, serverName, command s
 }
 
 func (s *ServerStruct) UploadFile(ctx context.Context, serverName, localPath, remotePath string) error {
+	return s.UploadFileWithProgress(ctx, serverName, localPath, remotePath, nil)
+}
+
+// UploadFileWithProgress is UploadFile, calling progress (when non-nil) with
+// the bytes sent so far and the file size as the upload streams.
+func (s *ServerStruct) UploadFileWithProgress(ctx context.Context, serverName, localPath, remotePath string, progress func(done, total int64)) error {
 	client, err := s.getSSHClient(serverName)
 	if err != nil {
 		return err
@@ -491,15 +497,26 @@ func (s *ServerStruct) UploadFile(ctx context.Context, serverName, localPath, re
 	var stderrBuf bytes.Buffer
 	session.Stderr = &stderrBuf
 
+	info, err := localFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat local file: %w", err)
+	}
+
 	// #nosec G204
-	// Using sh to ensure the path is correctly handled
-	cmd := fmt.Sprintf("cat > %q", remotePath)
+	// Using sh to ensure the path is correctly handled. The file is created
+	// under umask 077 and then given the local file's permissions, so a 0600
+	// file (e.g. an env file) is never readable by others on the server.
+	cmd := fmt.Sprintf("umask 077 && cat > %q && chmod %o %q", remotePath, info.Mode().Perm(), remotePath)
 	if err := session.Start(cmd); err != nil {
 		return fmt.Errorf("failed to start remote cat: %w", err)
 	}
 
 	// Fast streaming
-	if _, err := io.Copy(stdin, localFile); err != nil {
+	var src io.Reader = localFile
+	if progress != nil {
+		src = &progressReader{r: localFile, total: info.Size(), report: progress}
+	}
+	if _, err := io.Copy(stdin, src); err != nil {
 		_ = stdin.Close()
 		remoteErr := strings.TrimSpace(stderrBuf.String())
 		if remoteErr != "" {
@@ -525,6 +542,23 @@ func (s *ServerStruct) UploadFile(ctx context.Context, serverName, localPath, re
 	return nil
 }
 
+// progressReader reports how much of r has been read.
+type progressReader struct {
+	r      io.Reader
+	done   int64
+	total  int64
+	report func(done, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.report(p.done, p.total)
+	}
+	return n, err
+}
+
 func (s *ServerStruct) DownloadFile(ctx context.Context, serverName, remotePath, localPath string) error {
 	client, err := s.getSSHClient(serverName)
 	if err != nil {
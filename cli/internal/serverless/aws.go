@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"slices"
 	"strings"
 	"time"
@@ -42,6 +43,9 @@ type AWSProvider struct {
 	secretsLayerVersion string 
 	secretsKmsKeyId     string 
 	verbose             bool
+	// noRollback keeps a partially created IAM role after a failed setup
+	// (NEXTDEPLOY_NO_ROLLBACK=1), for inspecting what went wrong.
+	noRollback bool
 }
 
 func (p *AWSProvider) originReadTimeout() int32 {
@@ -65,8 +69,9 @@ func (p *AWSProvider) secretName(appName string) string {
 
 func NewAWSProvider(verbose bool) *AWSProvider {
 	return &AWSProvider{
-		log:     shared.PackageLogger("aws_serverless", "☁️  AWS::"),
-		verbose: verbose,
+		log:        shared.PackageLogger("aws_serverless", "☁️  AWS::"),
+		verbose:    verbose,
+		noRollback: os.Getenv("NEXTDEPLOY_NO_ROLLBACK") == "1",
 	}
 }
 
@@ -134,9 +139,10 @@ func loadAWSStaticCreds(cfg *cfgTypes.NextDeployConfig, log *shared.Logger) awsS
 		log.Warn("AWS access key loaded from nextdeploy.yml — committing this file leaks creds.")
 		log.Warn("Recommended: 'nextdeploy creds set --provider aws' (encrypted, mode 0600).")
 		return awsStaticCreds{
-			accessKey: cfg.CloudProvider.AccessKey,
-			secretKey: cfg.CloudProvider.SecretKey,
-			source:    "nextdeploy.yml",
+			accessKey:    cfg.CloudProvider.AccessKey,
+			secretKey:    cfg.CloudProvider.SecretKey,
+			sessionToken: cfg.CloudProvider.SessionToken,
+			source:       "nextdeploy.yml",
 		}
 	}
 	return awsStaticCreds{}
@@ -0,0 +1,26 @@
+package serverless
+
+import (
+	"testing"
+
+	"github.com/aynaash/nextdeploy/shared"
+	"github.com/aynaash/nextdeploy/shared/config"
+)
+
+func TestLoadAWSStaticCredsKeepsSessionToken(t *testing.T) {
+	// No credstore entry, so the keys come from nextdeploy.yml.
+	t.Setenv("HOME", t.TempDir())
+
+	cfg := &config.NextDeployConfig{CloudProvider: &config.CloudProviderStruct{
+		AccessKey:    "ASIAEXAMPLE",
+		SecretKey:    "secret",
+		SessionToken: "token",
+	}}
+	got := loadAWSStaticCreds(cfg, shared.PackageLogger("test", ""))
+	if got.source != "nextdeploy.yml" {
+		t.Fatalf("source = %q, want nextdeploy.yml", got.source)
+	}
+	if got.accessKey != "ASIAEXAMPLE" || got.secretKey != "secret" || got.sessionToken != "token" {
+		t.Errorf("creds = %+v, want the session token carried with the keys", got)
+	}
+}
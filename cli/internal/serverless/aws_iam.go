@@ -5,15 +5,44 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
 )
 
+// iamSetupTimeout bounds ensureExecutionRoleExists when the caller's context
+// has no tighter deadline, so a hung IAM call cannot stall a deploy forever.
+const iamSetupTimeout = 2 * time.Minute
+
+// iamAPI is the subset of the IAM client the execution-role setup uses.
+type iamAPI interface {
+	GetRole(context.Context, *iam.GetRoleInput, ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	CreateRole(context.Context, *iam.CreateRoleInput, ...func(*iam.Options)) (*iam.CreateRoleOutput, error)
+	AttachRolePolicy(context.Context, *iam.AttachRolePolicyInput, ...func(*iam.Options)) (*iam.AttachRolePolicyOutput, error)
+	PutRolePolicy(context.Context, *iam.PutRolePolicyInput, ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error)
+	DetachRolePolicy(context.Context, *iam.DetachRolePolicyInput, ...func(*iam.Options)) (*iam.DetachRolePolicyOutput, error)
+	DeleteRole(context.Context, *iam.DeleteRoleInput, ...func(*iam.Options)) (*iam.DeleteRoleOutput, error)
+}
+
 func (p *AWSProvider) ensureExecutionRoleExists(ctx context.Context) (string, error) {
-	client := iam.NewFromConfig(p.cfg)
+	ctx, cancel := context.WithTimeout(ctx, iamSetupTimeout)
+	defer cancel()
+	return p.ensureExecutionRole(ctx, iam.NewFromConfig(p.cfg))
+}
+
+// ensureExecutionRole creates or refreshes the managed Lambda execution role.
+// For an existing role a failed policy update is only a warning, unless ctx
+// is done. A role this call created must come out complete: any failed step
+// tears down what was created, in reverse, before the error is returned, so
+// the next run starts clean instead of finding a role without permissions.
+// NEXTDEPLOY_NO_ROLLBACK=1 leaves the partial role in place for debugging.
+func (p *AWSProvider) ensureExecutionRole(ctx context.Context, client iamAPI) (string, error) {
 	roleName := "nextdeploy-serverless-role"
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("IAM role setup aborted: %w", err)
+	}
 
 	p.log.Info("Checking for IAM execution role: %s...", roleName)
 	getOutput, err := client.GetRole(ctx, &iam.GetRoleInput{
@@ -21,6 +50,7 @@ func (p *AWSProvider) ensureExecutionRoleExists(ctx context.Context) (string, er
 	})
 
 	var roleArn string
+	created := false
 	if err == nil {
 		p.log.Info("IAM execution role found: %s, verifying policies...", *getOutput.Role.Arn)
 		roleArn = *getOutput.Role.Arn
@@ -55,6 +85,22 @@ func (p *AWSProvider) ensureExecutionRoleExists(ctx context.Context) (string, er
 			return "", fmt.Errorf("failed to create IAM role: %w", err)
 		}
 		roleArn = *createOutput.Role.Arn
+		created = true
+	}
+
+	var attached []string
+	// failed reports whether a failed step must abort the setup, rolling a
+	// newly created role back first.
+	failed := func() bool {
+		if !created {
+			return ctx.Err() != nil
+		}
+		if p.noRollback {
+			p.log.Warn("NEXTDEPLOY_NO_ROLLBACK set: leaving partially provisioned IAM role %s in place", roleName)
+		} else {
+			p.rollbackExecutionRole(client, roleName, attached)
+		}
+		return true
 	}
 
 	p.log.Info("Attaching managed policies to role %s...", roleName)
@@ -68,8 +114,13 @@ func (p *AWSProvider) ensureExecutionRoleExists(ctx context.Context) (string, er
 			PolicyArn: aws.String(policyArn),
 		})
 		if err != nil {
+			if failed() {
+				return "", fmt.Errorf("failed to attach policy %s to IAM role %s: %w", policyArn, roleName, errors.Join(ctx.Err(), err))
+			}
 			p.log.Warn("Failed to attach policy %s: %v", policyArn, err)
+			continue
 		}
+		attached = append(attached, policyArn)
 	}
 
 	// Build and attach scoped inline policy.
@@ -124,9 +175,32 @@ func (p *AWSProvider) ensureExecutionRoleExists(ctx context.Context) (string, er
 		PolicyDocument: aws.String(string(inlinePolicyJSON)),
 	})
 	if err != nil {
+		if failed() {
+			return "", fmt.Errorf("failed to attach scoped inline policy to IAM role %s: %w", roleName, errors.Join(ctx.Err(), err))
+		}
 		p.log.Warn("Failed to attach scoped inline policy: %v", err)
 	}
 
 	p.log.Info("IAM role ready: %s", roleArn)
 	return roleArn, nil
 }
+
+// rollbackExecutionRole deletes a role created by a failed
+// ensureExecutionRole, detaching its policies in reverse order first. It runs
+// on its own short deadline because the setup context may already be done;
+// failures are logged for manual cleanup.
+func (p *AWSProvider) rollbackExecutionRole(client iamAPI, roleName string, attached []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	p.log.Warn("Removing partially provisioned IAM role %s...", roleName)
+	for i := len(attached) - 1; i >= 0; i-- {
+		policyArn := attached[i]
+		if _, err := client.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{RoleName: aws.String(roleName), PolicyArn: aws.String(policyArn)}); err != nil {
+			p.log.Warn("Failed to detach %s from %s: %v", policyArn, roleName, err)
+		}
+	}
+	if _, err := client.DeleteRole(ctx, &iam.DeleteRoleInput{RoleName: aws.String(roleName)}); err != nil {
+		p.log.Warn("Failed to delete IAM role %s, remove it manually: %v", roleName, err)
+	}
+}
@@ -0,0 +1,118 @@
+package serverless
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// fakeIAM records calls; blockAttach makes AttachRolePolicy wait for ctx
+// like a hung AWS call and failPut makes PutRolePolicy fail.
+type fakeIAM struct {
+	calls       []string
+	blockAttach bool
+	failPut     bool
+}
+
+func (f *fakeIAM) GetRole(context.Context, *iam.GetRoleInput, ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	f.calls = append(f.calls, "GetRole")
+	return nil, &types.NoSuchEntityException{}
+}
+
+func (f *fakeIAM) CreateRole(context.Context, *iam.CreateRoleInput, ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+	f.calls = append(f.calls, "CreateRole")
+	return &iam.CreateRoleOutput{Role: &types.Role{Arn: aws.String("arn:aws:iam::123:role/nextdeploy-serverless-role")}}, nil
+}
+
+func (f *fakeIAM) AttachRolePolicy(ctx context.Context, _ *iam.AttachRolePolicyInput, _ ...func(*iam.Options)) (*iam.AttachRolePolicyOutput, error) {
+	f.calls = append(f.calls, "AttachRolePolicy")
+	if f.blockAttach {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &iam.AttachRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) PutRolePolicy(context.Context, *iam.PutRolePolicyInput, ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+	f.calls = append(f.calls, "PutRolePolicy")
+	if f.failPut {
+		return nil, errors.New("LimitExceeded: inline policy quota")
+	}
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) DetachRolePolicy(context.Context, *iam.DetachRolePolicyInput, ...func(*iam.Options)) (*iam.DetachRolePolicyOutput, error) {
+	f.calls = append(f.calls, "DetachRolePolicy")
+	return &iam.DetachRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) DeleteRole(context.Context, *iam.DeleteRoleInput, ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+	f.calls = append(f.calls, "DeleteRole")
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+func TestEnsureExecutionRoleCancelledContext(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client := &fakeIAM{}
+	_, err := NewAWSProvider(false).ensureExecutionRole(ctx, client)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(client.calls) != 0 {
+		t.Fatalf("no IAM calls expected on a cancelled context, got %v", client.calls)
+	}
+}
+
+func TestEnsureExecutionRoleRollsBackOnTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client := &fakeIAM{blockAttach: true}
+
+	start := time.Now()
+	_, err := NewAWSProvider(false).ensureExecutionRole(ctx, client)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("setup did not abort promptly")
+	}
+	got := strings.Join(client.calls, ",")
+	if want := "GetRole,CreateRole,AttachRolePolicy,DeleteRole"; got != want {
+		t.Fatalf("calls = %s, want %s (role created this run must be removed)", got, want)
+	}
+}
+
+func TestEnsureExecutionRoleRollsBackFailedStep(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeIAM{failPut: true}
+	if _, err := NewAWSProvider(false).ensureExecutionRole(context.Background(), client); err == nil {
+		t.Fatal("expected the failed inline policy to fail setup of a new role")
+	}
+	got := strings.Join(client.calls, ",")
+	if want := "GetRole,CreateRole,AttachRolePolicy,PutRolePolicy,DetachRolePolicy,DeleteRole"; got != want {
+		t.Fatalf("calls = %s, want %s", got, want)
+	}
+
+	// With rollback disabled the partial role is left for inspection.
+	client = &fakeIAM{failPut: true}
+	p := NewAWSProvider(false)
+	p.noRollback = true
+	if _, err := p.ensureExecutionRole(context.Background(), client); err == nil {
+		t.Fatal("expected an error with rollback disabled too")
+	}
+	if got := strings.Join(client.calls, ","); strings.Contains(got, "Delete") || strings.Contains(got, "Detach") {
+		t.Fatalf("noRollback should skip cleanup, calls = %s", got)
+	}
+}
@@ -268,11 +268,12 @@ func LoadLocalSecrets(cfg *config.NextDeployConfig) (map[string]string, error) {
 // loadLocalSecrets merges secrets from every supported source for the current
 // project. Precedence (lowest → highest):
 //
-//  1. Auto-detected dotenv file at project root (`.env`)
+//  1. Auto-detected dotenv files at project root, merged like Next.js does
+//     (see config.ResolveEnv)
 //  2. Files declared in `nextdeploy.yml` under `secrets.files[]` (in order)
 //  3. Doppler — when running under `doppler run -- nextdeploy ship`, or when
 //     `secrets.doppler.inject_env: true` is set in nextdeploy.yml, the
-//     process environment is harvested and merged. See harvestDopplerEnv.
+//     process environment is harvested and merged. See HarvestDopplerEnv.
 //  4. The managed JSON store at `.nextdeploy/.env`, populated by
 //     `nextdeploy secrets set/load`
 //
@@ -304,12 +305,19 @@ func loadLocalSecrets(cfg *config.NextDeployConfig) (map[string]string, error) {
 	log := shared.PackageLogger("serverless", "🔐 SECRETS")
 	merged := map[string]string{}
 
-	// 1. Project-root .env (dotenv format) — silently skipped if missing.
-	if env, err := envstore.ReadEnvFile(".env"); err == nil {
+	sm, err := secrets.NewSecretManager(secrets.WithConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to init secret manager: %w", err)
+	}
+
+	// 1. Project-root dotenv files in Next.js precedence order (.env,
+	// .env.<environment>, .env.local, .env.<environment>.local), decrypting
+	// .enc variants. Missing files are skipped.
+	if env, loaded, err := config.ResolveEnv(".", cfg.App.Environment, sm.DecryptWithPlatformKey); err != nil {
+		log.Warn("Failed to read .env files (non-fatal): %v", err)
+	} else if len(loaded) > 0 {
 		mergeInto(merged, env)
-		log.Info("Loaded %d secrets from .env", len(env))
-	} else if !os.IsNotExist(err) {
-		log.Warn("Failed to read .env (non-fatal): %v", err)
+		log.Info("Loaded %d secrets from %s", len(env), strings.Join(loaded, ", "))
 	}
 
 	// 2. YAML-declared files (cfg.Secrets.Files). Each file is parsed as
@@ -328,16 +336,12 @@ func loadLocalSecrets(cfg *config.NextDeployConfig) (map[string]string, error) {
 	}
 
 	// 3. Doppler — harvest process env when running under `doppler run --`.
-	if dopplerEnv, source := harvestDopplerEnv(cfg); source != "" {
+	if dopplerEnv, source := HarvestDopplerEnv(cfg); source != "" {
 		mergeInto(merged, dopplerEnv)
 		log.Info("Loaded %d secrets from Doppler (%s)", len(dopplerEnv), source)
 	}
 
 	// 4. Managed JSON store (.nextdeploy/.env). Highest precedence.
-	sm, err := secrets.NewSecretManager(secrets.WithConfig(cfg))
-	if err != nil {
-		return nil, fmt.Errorf("failed to init secret manager: %w", err)
-	}
 	managedPath := filepath.Join(".nextdeploy", ".env")
 	if _, statErr := os.Stat(managedPath); statErr == nil {
 		if err := sm.ImportSecrets(managedPath); err != nil {
@@ -352,7 +356,7 @@ func loadLocalSecrets(cfg *config.NextDeployConfig) (map[string]string, error) {
 	return merged, nil
 }
 
-// harvestDopplerEnv inspects the process environment for Doppler-injected
+// HarvestDopplerEnv inspects the process environment for Doppler-injected
 // secrets and returns them as a name→value map. Returns an empty map when
 // Doppler is not in play.
 //
@@ -388,7 +392,7 @@ func loadLocalSecrets(cfg *config.NextDeployConfig) (map[string]string, error) {
 // The second return value is a short label describing the activation
 // source, used for logging. Empty string means "Doppler not active,
 // nothing was harvested".
-func harvestDopplerEnv(cfg *config.NextDeployConfig) (map[string]string, string) {
+func HarvestDopplerEnv(cfg *config.NextDeployConfig) (map[string]string, string) {
 	dopplerProject := os.Getenv("DOPPLER_PROJECT")
 	dopplerConfig := os.Getenv("DOPPLER_CONFIG")
 	dopplerEnvName := os.Getenv("DOPPLER_ENVIRONMENT")
@@ -9,6 +9,7 @@ import (
 
 	"github.com/aynaash/nextdeploy/shared"
 	"github.com/aynaash/nextdeploy/shared/config"
+	"github.com/aynaash/nextdeploy/shared/httpx"
 	"github.com/aynaash/nextdeploy/shared/nextcore"
 )
 
@@ -75,7 +76,7 @@ func SmokeVerify(
 		return &SmokeResult{}, nil
 	}
 
-	client := &http.Client{Timeout: opts.Timeout}
+	client := httpx.New(httpx.Options{Timeout: opts.Timeout})
 	result := &SmokeResult{}
 
 	log.Info("Smoke verify: probing %d URL(s)...", len(urls))
@@ -16,6 +16,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -23,6 +24,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	xdraw "golang.org/x/image/draw"
+
+	"github.com/aynaash/nextdeploy/shared/httpx"
 )
 
 type ImageOptConfig struct {
@@ -189,7 +192,8 @@ func fetchImage(ctx context.Context, rawURL string) (image.Image, string, error)
 	// default — an allowed origin could 302 to an internal address (SSRF). Use a
 	// client that re-validates every hop against the same allowlist so a
 	// redirect can never escape the permitted domains.
-	client := &http.Client{
+	client := httpx.New(httpx.Options{
+		Timeout: 15 * time.Second,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) >= 10 {
 				return fmt.Errorf("stopped after 10 redirects")
@@ -199,7 +203,7 @@ func fetchImage(ctx context.Context, rawURL string) (image.Image, string, error)
 			}
 			return nil
 		},
-	}
+	})
 	resp, err := client.Get(rawURL)
 	if err != nil {
 		return nil, "", err
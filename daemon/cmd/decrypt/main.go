@@ -31,6 +31,10 @@ func main() {
 		fmt.Println("Failed to decrypt nextdeploy.yml:", err)
 		return
 	}
+	if err := secrets.ValidateDecrypted("nextdeploy.yml", nextdeployyml); err != nil {
+		fmt.Println("Refusing to write nextdeploy.yml:", err)
+		return
+	}
 	fmt.Println("Decrypted nextdeploy.yml content:\n", string(nextdeployyml))
 	// Decrypt the .env file
 	envfile, err := sm.DecryptFile(".env.enc", master)
@@ -38,6 +42,10 @@ func main() {
 		fmt.Println("Failed to decrypt .env file:", err)
 		return
 	}
+	if err := secrets.ValidateDecrypted(".env", envfile); err != nil {
+		fmt.Println("Refusing to write .env:", err)
+		return
+	}
 	fmt.Println("Decrypted .env content:\n", string(envfile))
 	// save the decrypted files
 	err = os.WriteFile("nextdeploy.yml", []byte(nextdeployyml), 0600)
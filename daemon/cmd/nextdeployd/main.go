@@ -3,11 +3,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -50,6 +53,18 @@ func main() {
 		case "logs":
 			handleLogsSubcommand()
 			return
+		case "plan":
+			handlePlanSubcommand()
+			return
+		case "drift":
+			handleDriftSubcommand()
+			return
+		case "diff":
+			handleDiffSubcommand()
+			return
+		case "prune":
+			handlePruneSubcommand()
+			return
 		case "rollback":
 			handleRollbackSubcommand()
 			return
@@ -62,6 +77,40 @@ func main() {
 		case "remove":
 			handleDestroySubcommand() // remove is an alias for destroy
 			return
+		case "rotate-secret":
+			handleRotateSecretSubcommand()
+			return
+		case "restart":
+			handleRestartSubcommand()
+			return
+		case "selftest":
+			sendDaemonCommand(daemontypes.Command{Type: "selftest", Args: map[string]any{}})
+			return
+		case "queue":
+			handleQueueSubcommand()
+			return
+		case "probe":
+			handleProbeSubcommand()
+			return
+		case "ramp", "promote", "abort":
+			handleCanaryActionSubcommand(os.Args[1])
+			return
+		case "maintenance":
+			handleMaintenanceSubcommand()
+			return
+		case "install":
+			handleInstallSubcommand()
+			return
+		case "uninstall":
+			if err := daemon.UninstallDaemonService(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("nextdeployd stopped, disabled and removed from systemd; apps and config are untouched")
+			return
+		case "canary":
+			handleCanarySubcommand()
+			return
 		case "help", "--help", "-h":
 			handleHelpSubcommand()
 			return
@@ -120,6 +169,22 @@ func getSocketPath() string {
 }
 
 func sendDaemonCommand(cmd daemontypes.Command) {
+	resp := requestDaemon(cmd)
+	if resp != nil {
+		if !resp.Success {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Message)
+			os.Exit(1)
+		}
+		fmt.Print(resp.Message)
+		if !strings.HasSuffix(resp.Message, "\n") {
+			fmt.Println()
+		}
+	}
+}
+
+// requestDaemon sends cmd to the running daemon and returns its response,
+// exiting if the daemon cannot be reached.
+func requestDaemon(cmd daemontypes.Command) *daemontypes.Response {
 	socketPath := getSocketPath()
 
 	// Load config for security settings
@@ -143,42 +208,187 @@ func sendDaemonCommand(cmd daemontypes.Command) {
 		fmt.Fprintf(os.Stderr, "Error contacting daemon: %v (Is nextdeployd running?)\n", err)
 		os.Exit(1)
 	}
-	if resp != nil {
-		if !resp.Success {
-			fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Message)
-			os.Exit(1)
-		}
-		fmt.Print(resp.Message)
-		if !strings.HasSuffix(resp.Message, "\n") {
-			fmt.Println()
-		}
-	}
+	return resp
 }
 
 func handleShipSubcommand() {
 	tarball := ""
+	envFile := ""
+	checksum := ""
 	dopplerToken := ""
+	readinessTimeout := ""
+	commit := ""
+	failLogLines := -1.0
+	printUnit := false
+	canaryWeight := 0
+	idempotencyKey := ""
+	channel := ""
+	placement := map[string]any{}
+	gpus := ""
+	var devices []any
 	for _, arg := range os.Args[2:] {
-		if after, ok := strings.CutPrefix(arg, "--tarball="); ok {
+		if arg == "--print-unit" {
+			printUnit = true
+		} else if after, ok := strings.CutPrefix(arg, "--tarball="); ok {
 			tarball = after
 			tarball = strings.Trim(tarball, "\"'")
+		} else if after, ok := strings.CutPrefix(arg, "--channel="); ok {
+			channel = after
+		} else if after, ok := strings.CutPrefix(arg, "--idempotency-key="); ok {
+			idempotencyKey = after
+		} else if arg == "--canary" {
+			canaryWeight = -1 // the daemon's default
+		} else if after, ok := strings.CutPrefix(arg, "--canary="); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n < 1 || n > 99 {
+				fmt.Fprintln(os.Stderr, "Error: --canary must be a percentage from 1 to 99")
+				os.Exit(1)
+			}
+			canaryWeight = n
+		} else if after, ok := strings.CutPrefix(arg, "--envFile="); ok {
+			envFile = strings.Trim(after, "\"'")
+		} else if after, ok := strings.CutPrefix(arg, "--sha256="); ok {
+			checksum = after
 		} else if after, ok := strings.CutPrefix(arg, "--dopplerToken="); ok {
 			dopplerToken = after
+		} else if after, ok := strings.CutPrefix(arg, "--readiness-timeout="); ok {
+			readinessTimeout = after
+		} else if after, ok := strings.CutPrefix(arg, "--commit="); ok {
+			commit = after
+		} else if after, ok := strings.CutPrefix(arg, "--fail-log-lines="); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n < 0 {
+				fmt.Fprintln(os.Stderr, "Error: --fail-log-lines must be a non-negative integer")
+				os.Exit(1)
+			}
+			failLogLines = float64(n)
+		} else if after, ok := strings.CutPrefix(arg, "--placement="); ok {
+			for _, label := range strings.Split(after, ",") {
+				k, v, ok := strings.Cut(label, "=")
+				if !ok || k == "" {
+					fmt.Fprintf(os.Stderr, "Error: --placement label %q must be key=value\n", label)
+					os.Exit(1)
+				}
+				placement[k] = v
+			}
+		} else if after, ok := strings.CutPrefix(arg, "--gpus="); ok {
+			gpus = after
+		} else if after, ok := strings.CutPrefix(arg, "--device="); ok {
+			devices = append(devices, after)
 		} else if after, ok := strings.CutPrefix(arg, "--socket-path="); ok {
 			socketPathOverride = after
 		}
 	}
-	if tarball == "" {
-		fmt.Fprintln(os.Stderr, "Error: --tarball is required")
+	args := map[string]any{}
+	switch {
+	case channel != "" && tarball != "":
+		fmt.Fprintln(os.Stderr, "Error: --tarball and --channel are mutually exclusive")
 		os.Exit(1)
+	case channel != "":
+		args["channel"] = channel
+	case tarball == "":
+		fmt.Fprintln(os.Stderr, "Error: --tarball or --channel is required")
+		os.Exit(1)
+	default:
+		// A tarball brought to the host by hand (no SSH upload, air-gapped)
+		// is copied into the uploads directory first.
+		staged, copied, err := daemon.StageTarball(tarball)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: staging %s: %v\n", tarball, err)
+			os.Exit(1)
+		}
+		if copied {
+			fmt.Printf("Staged %s as %s\n", tarball, staged)
+		}
+		args["tarball"] = staged
+	}
+	if envFile != "" {
+		args["envFile"] = envFile
+	}
+	if checksum != "" {
+		args["sha256"] = checksum
 	}
-	args := map[string]any{"tarball": tarball}
 	if dopplerToken != "" {
 		args["dopplerToken"] = dopplerToken
 	}
+	if readinessTimeout != "" {
+		args["readinessTimeout"] = readinessTimeout
+	}
+	if commit != "" {
+		args["commit"] = commit
+	}
+	if failLogLines >= 0 {
+		args["failLogLines"] = failLogLines
+	}
+	if printUnit {
+		args["printUnit"] = true
+	}
+	if len(placement) > 0 {
+		args["placement"] = placement
+	}
+	if gpus != "" {
+		args["gpus"] = gpus
+	}
+	if len(devices) > 0 {
+		args["devices"] = devices
+	}
+	if idempotencyKey != "" {
+		args["idempotency_key"] = idempotencyKey
+	}
+	if canaryWeight != 0 {
+		args["canary"] = true
+		if canaryWeight > 0 {
+			args["weight"] = float64(canaryWeight)
+		}
+	}
 	sendDaemonCommand(daemontypes.Command{Type: "ship", Args: args})
 }
 
+// handleCanaryActionSubcommand sends ramp, promote or abort for an app's
+// canary.
+func handleCanaryActionSubcommand(action string) {
+	args := map[string]any{"action": action}
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
+			args["appName"] = after
+		} else if after, ok := strings.CutPrefix(arg, "--weight="); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n < 1 || n > 99 {
+				fmt.Fprintln(os.Stderr, "Error: --weight must be a percentage from 1 to 99")
+				os.Exit(1)
+			}
+			args["weight"] = float64(n)
+		}
+	}
+	if args["appName"] == nil {
+		fmt.Fprintln(os.Stderr, "Error: --appName is required")
+		os.Exit(1)
+	}
+	if action == "ramp" && args["weight"] == nil {
+		fmt.Fprintln(os.Stderr, "Error: ramp needs --weight")
+		os.Exit(1)
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "canary", Args: args})
+}
+
+// handleMaintenanceSubcommand puts an app's site into maintenance or routes
+// it back to the app.
+func handleMaintenanceSubcommand() {
+	args := map[string]any{}
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
+			args["appName"] = after
+		} else if arg == "--on" || arg == "--off" {
+			args["action"] = strings.TrimPrefix(arg, "--")
+		}
+	}
+	if args["appName"] == nil || args["action"] == nil {
+		fmt.Fprintln(os.Stderr, "Error: usage: nextdeployd maintenance --appName=<name> --on|--off")
+		os.Exit(1)
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "maintenance", Args: args})
+}
+
 func handleSecretsSubcommand() {
 	action := ""
 	appName := ""
@@ -207,36 +417,238 @@ func handleSecretsSubcommand() {
 
 func handleStatusSubcommand() {
 	appName := ""
+	all, asJSON := false, false
 	for _, arg := range os.Args[2:] {
 		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
 			appName = after
+		} else if arg == "--all" {
+			all = true
+		} else if arg == "--json" {
+			asJSON = true
+		}
+	}
+	if all && asJSON {
+		// The report goes to stdout even when an app is unhealthy; the exit
+		// status still says whether all are.
+		resp := requestDaemon(daemontypes.Command{Type: "status", Args: map[string]any{"all": true}})
+		if resp == nil {
+			fmt.Fprintln(os.Stderr, "Error: empty response from daemon")
+			os.Exit(1)
+		}
+		if resp.Data == nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Message)
+			os.Exit(1)
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(resp.Data); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !resp.Success {
+			os.Exit(1)
 		}
+		return
+	}
+	if all {
+		sendDaemonCommand(daemontypes.Command{Type: "status", Args: map[string]any{"all": true}})
+		return
 	}
 	sendDaemonCommand(daemontypes.Command{Type: "status", Args: map[string]any{"appName": appName}})
 }
 
+func handlePlanSubcommand() {
+	appName := ""
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
+			appName = after
+		}
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "plan", Args: map[string]any{"appName": appName}})
+}
+
+func handleQueueSubcommand() {
+	args := map[string]any{}
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
+			args["appName"] = after
+		}
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "queue", Args: args})
+}
+
+func handleProbeSubcommand() {
+	args := map[string]any{}
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
+			args["appName"] = after
+		} else if after, ok := strings.CutPrefix(arg, "--url="); ok {
+			args["probe_url"] = after
+		} else if after, ok := strings.CutPrefix(arg, "--path="); ok {
+			args["path"] = after
+		} else if after, ok := strings.CutPrefix(arg, "--timeout="); ok {
+			args["timeout"] = after
+		}
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "probe", Args: args})
+}
+
+func handleDriftSubcommand() {
+	appName := ""
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
+			appName = after
+		}
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "drift", Args: map[string]any{"appName": appName}})
+}
+
+func handleDiffSubcommand() {
+	args := map[string]any{}
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
+			args["appName"] = after
+		} else if after, ok := strings.CutPrefix(arg, "--from="); ok {
+			args["from"] = after
+		} else if after, ok := strings.CutPrefix(arg, "--to="); ok {
+			args["to"] = after
+		}
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "diff", Args: args})
+}
+
+func handlePruneSubcommand() {
+	args := map[string]any{}
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
+			args["appName"] = after
+		} else if after, ok := strings.CutPrefix(arg, "--keep="); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "Error: --keep must be a positive integer")
+				os.Exit(1)
+			}
+			// JSON over the wire decodes numbers as float64; encode as such for symmetry.
+			args["keep"] = float64(n)
+		} else if arg == "--dry-run" {
+			args["dryRun"] = true
+		}
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "prune", Args: args})
+}
+
+func handleRotateSecretSubcommand() {
+	args := map[string]any{}
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--grace="); ok {
+			args["grace"] = after
+		}
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "rotateSecret", Args: args})
+}
+
+func handleRestartSubcommand() {
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--socket-path="); ok {
+			socketPathOverride = after
+		}
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "restartDaemon", Args: map[string]any{}})
+}
+
+// handleInstallSubcommand installs this binary as the nextdeployd systemd
+// unit so the daemon starts on boot.
+func handleInstallSubcommand() {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: locate nextdeployd: %v\n", err)
+		os.Exit(1)
+	}
+	opts := daemon.DaemonUnitOptions{Executable: exe, ConfigPath: "/etc/nextdeployd/config.json"}
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--config="); ok {
+			opts.ConfigPath = after
+		} else if after, ok := strings.CutPrefix(arg, "--socket-path="); ok {
+			opts.SocketPath = after
+		}
+	}
+	if err := daemon.InstallDaemonService(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("nextdeployd installed as %s, enabled and started\n", daemon.DaemonUnit)
+}
+
+// handleCanarySubcommand is the process selftest runs as a unit; it is not
+// meant to be started by hand and is left out of help.
+func handleCanarySubcommand() {
+	port := 0
+	for _, arg := range os.Args[2:] {
+		if after, ok := strings.CutPrefix(arg, "--port="); ok {
+			port, _ = strconv.Atoi(after)
+		}
+	}
+	if port < 1 || port > 65535 {
+		fmt.Fprintln(os.Stderr, "Error: --port must be a TCP port")
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if err := daemon.ServeCanary(ctx, port); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 func handleLogsSubcommand() {
 	appName := ""
+	allReleases := false
+	args := map[string]any{}
 	for _, arg := range os.Args[2:] {
 		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
 			appName = after
+		} else if arg == "--all-releases" {
+			allReleases = true
+		} else if after, ok := strings.CutPrefix(arg, "--grep="); ok {
+			args["grep"] = after
+		} else if after, ok := strings.CutPrefix(arg, "--export="); ok {
+			args["export_path"] = after
+		} else if arg == "--invert" {
+			args["invert"] = true
+		} else if after, ok := strings.CutPrefix(arg, "--since="); ok {
+			args["since"] = after
+		} else if after, ok := strings.CutPrefix(arg, "--tail="); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n <= 0 {
+				fmt.Fprintln(os.Stderr, "Error: --tail must be a positive integer")
+				os.Exit(1)
+			}
+			args["tail"] = float64(n)
 		}
 	}
-	sendDaemonCommand(daemontypes.Command{Type: "logs", Args: map[string]any{"appName": appName}})
+	args["appName"] = appName
+	if allReleases {
+		args["allReleases"] = true
+	}
+	sendDaemonCommand(daemontypes.Command{Type: "logs", Args: args})
 }
 
 func handleRollbackSubcommand() {
 	appName := ""
 	dopplerToken := ""
 	toCommit := ""
+	idempotencyKey := ""
 	steps := 0
+	dryRun := false
 	for _, arg := range os.Args[2:] {
 		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
 			appName = after
+		} else if arg == "--dry-run" {
+			dryRun = true
 		} else if after, ok := strings.CutPrefix(arg, "--dopplerToken="); ok {
 			dopplerToken = after
 		} else if after, ok := strings.CutPrefix(arg, "--toCommit="); ok {
 			toCommit = after
+		} else if after, ok := strings.CutPrefix(arg, "--idempotency-key="); ok {
+			idempotencyKey = after
 		} else if after, ok := strings.CutPrefix(arg, "--steps="); ok {
 			n, err := strconv.Atoi(after)
 			if err != nil || n < 0 {
@@ -257,25 +669,54 @@ func handleRollbackSubcommand() {
 	if toCommit != "" {
 		args["toCommit"] = toCommit
 	}
+	if idempotencyKey != "" {
+		args["idempotency_key"] = idempotencyKey
+	}
 	if steps > 0 {
 		// JSON over the wire decodes numbers as float64; encode as such for symmetry.
 		args["steps"] = float64(steps)
 	}
+	if dryRun {
+		args["dryRun"] = true
+	}
 	sendDaemonCommand(daemontypes.Command{Type: "rollback", Args: args})
 }
 
 func handleStopSubcommand() {
 	appName := ""
+	prefix := ""
+	args := map[string]any{}
 	for _, arg := range os.Args[2:] {
 		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
 			appName = after
+		} else if after, ok := strings.CutPrefix(arg, "--prefix="); ok {
+			prefix = after
+		} else if after, ok := strings.CutPrefix(arg, "--stop-timeout="); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n <= 0 {
+				fmt.Fprintln(os.Stderr, "Error: --stop-timeout must be a positive number of seconds")
+				os.Exit(1)
+			}
+			args["stop_timeout"] = float64(n)
+		} else if after, ok := strings.CutPrefix(arg, "--stop-signal="); ok {
+			args["stop_signal"] = after
+		} else if arg == "--fail-fast" {
+			args["keep_going"] = false
+		} else if arg == "--maintenance" {
+			args["maintenance"] = true
 		}
 	}
+	if prefix != "" {
+		args["prefix"] = prefix
+		sendDaemonCommand(daemontypes.Command{Type: "stop", Args: args})
+		return
+	}
 	if appName == "" {
-		fmt.Fprintln(os.Stderr, "Error: --appName is required")
+		fmt.Fprintln(os.Stderr, "Error: --appName or --prefix is required")
 		os.Exit(1)
 	}
-	sendDaemonCommand(daemontypes.Command{Type: "stop", Args: map[string]any{"appName": appName}})
+	args["appName"] = appName
+	sendDaemonCommand(daemontypes.Command{Type: "stop", Args: args})
 }
 
 func handleHelpSubcommand() {
@@ -283,14 +724,59 @@ func handleHelpSubcommand() {
 	fmt.Println("Usage: nextdeployd <command> [arguments]")
 	fmt.Println()
 	fmt.Println("Available commands:")
-	fmt.Println("  ship --tarball=<path>     Deploy a new release")
+	fmt.Println("  ship --tarball=<path>     Deploy a new release; a tarball outside the uploads directory is copied in first")
+	fmt.Println("  ship --channel=<name>     Deploy the tarball a channel (stable, canary) points at in channel_manifest")
+	fmt.Println("    [--sha256=<hex>]        Refuse the tarball unless it matches this digest")
+	fmt.Println("    [--readiness-timeout=<d>] Override app.readiness_timeout for this release")
+	fmt.Println("    [--fail-log-lines=50]   Journal lines to include if the release fails (0 for none)")
+	fmt.Println("    [--placement=env=prod,zone=eu-west] Label the release; keys must be in placement_keys")
+	fmt.Println("    [--gpus=all|device=0,1] Give the release these NVIDIA GPUs; the nodes must be in allowed_devices")
+	fmt.Println("    [--device=<path>]       Give the release a device node (repeatable); must be in allowed_devices")
+	fmt.Println("    [--print-unit]          Print the systemd unit the release runs as (secrets stay in its env file)")
+	fmt.Println("    [--commit=<sha>]        Fetch metadata from the metadata store if the tarball has none")
+	fmt.Println("    [--idempotency-key=<k>] Run once per key; a retry with the same key gets the first response")
+	fmt.Println("    [--canary[=10]]         Run the release next to the live one, taking this percentage of requests")
+	fmt.Println("  ramp --appName=<name> --weight=<1-99>")
+	fmt.Println("                            Change the percentage of requests the app's canary takes")
+	fmt.Println("  promote --appName=<name>  Make the canary the live release")
+	fmt.Println("  abort --appName=<name>    Remove the canary; the live release takes all requests again")
 	fmt.Println("  status --appName=<name>   Check app status")
+	fmt.Println("  status --all [--json]     Health of every deployed app; fails unless all are healthy")
+	fmt.Println("  plan --appName=<name>     Show what the next ship would replace (read-only)")
+	fmt.Println("  drift --appName=<name>    Show where the running unit differs from the deployed release")
+	fmt.Println("  diff --appName=<name> [--from=<release>] [--to=<release>]")
+	fmt.Println("                            Compare two releases' sizes entry by entry; defaults to the live one and the one before")
 	fmt.Println("  stop --appName=<name>     Stop an application")
+	fmt.Println("    [--stop-timeout=<secs>] [--stop-signal=SIGINT] Override app.stop for this stop")
+	fmt.Println("    [--maintenance]         Serve the maintenance page (503) before stopping; the next ship removes it")
+	fmt.Println("  maintenance --appName=<name> --on|--off")
+	fmt.Println("                            Serve the app's maintenance page, or route its site back to the app")
 	fmt.Println("  destroy --appName=<name>  Remove an application")
 	fmt.Println("  remove --appName=<name>   Remove an application (alias for destroy)")
+	fmt.Println("  stop --prefix=<p>         Stop every application whose name starts with <p>")
+	fmt.Println("  destroy --prefix=<p> --confirm")
+	fmt.Println("                            Remove every application whose name starts with <p>")
+	fmt.Println("    [--fail-fast]           Bulk stop/destroy: stop at the first failing app instead of trying them all")
 	fmt.Println("  logs --appName=<name>     Stream app logs")
+	fmt.Println("    [--grep=<regex>] [--invert] [--since=<time>] [--tail=<lines>] Search the journal here; print only matches")
+	fmt.Println("    [--export=<path>[.gz]]  Write the whole journal (from --since) to a file here under log_export_dirs")
+	fmt.Println("    [--all-releases]        List every release unit of the app, not just the active one")
 	fmt.Println("  rollback --appName=<name> Rollback to previous release")
+	fmt.Println("    [--idempotency-key=<k>] As for ship")
+	fmt.Println("    [--dry-run]             Report the release and commit it would restore, changing nothing")
+	fmt.Println("  prune [--appName=<name>] [--keep=5] [--dry-run]")
+	fmt.Println("                            Remove old releases and stale uploads; the live release and any a unit uses are kept")
 	fmt.Println("  secrets --action=...      Manage application secrets")
+	fmt.Println("  rotate-secret [--grace=15m]")
+	fmt.Println("                            Replace the security secret; the old one stays valid for the grace window")
+	fmt.Println("  queue [--appName=<name>]  Show running deploys and the queue behind them (max_concurrent_deploys)")
+	fmt.Println("  probe --appName=<name> [--path=/api/health] | --url=http://localhost:3000/api/health")
+	fmt.Println("    [--timeout=5s]          GET the endpoint once; fails unless it answers 2xx in time")
+	fmt.Println("  selftest                  Run, probe and remove a canary unit; reports each step's timing")
+	fmt.Println("  install [--config=<path>] [--socket-path=<path>]")
+	fmt.Println("                            Install, enable and start the nextdeployd systemd unit (root)")
+	fmt.Println("  uninstall                 Stop, disable and remove the systemd unit; apps are kept (root)")
+	fmt.Println("  restart                   Re-exec the daemon binary in place; the socket stays open")
 	fmt.Println("  version                   Show version information")
 	fmt.Println("  update                    Update nextdeployd to latest version")
 	fmt.Println()
@@ -300,13 +786,26 @@ func handleHelpSubcommand() {
 
 func handleDestroySubcommand() {
 	appName := ""
+	prefix := ""
+	confirm := false
+	keepGoing := true
 	for _, arg := range os.Args[2:] {
 		if after, ok := strings.CutPrefix(arg, "--appName="); ok {
 			appName = after
+		} else if after, ok := strings.CutPrefix(arg, "--prefix="); ok {
+			prefix = after
+		} else if arg == "--confirm" {
+			confirm = true
+		} else if arg == "--fail-fast" {
+			keepGoing = false
 		}
 	}
+	if prefix != "" {
+		sendDaemonCommand(daemontypes.Command{Type: "destroy", Args: map[string]any{"prefix": prefix, "confirm": confirm, "keep_going": keepGoing}})
+		return
+	}
 	if appName == "" {
-		fmt.Fprintln(os.Stderr, "Error: --appName is required")
+		fmt.Fprintln(os.Stderr, "Error: --appName or --prefix is required")
 		os.Exit(1)
 	}
 	sendDaemonCommand(daemontypes.Command{Type: "destroy", Args: map[string]any{"appName": appName}})
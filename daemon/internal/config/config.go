@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/aynaash/nextdeploy/daemon/internal/types"
 	"github.com/aynaash/nextdeploy/shared/config"
@@ -30,7 +32,7 @@ func LoadConfig(filePath string) (*types.DaemonConfig, error) {
 
 	config := &types.DaemonConfig{
 		SocketPath:      socketPath,
-		SocketMode:      "0666",
+		SocketMode:      "0660",
 		DockerSocket:    "/var/run/docker.sock",
 		ContainerPrefix: "nextdeploy_",
 		LogLevel:        "info",
@@ -43,11 +45,9 @@ func LoadConfig(filePath string) (*types.DaemonConfig, error) {
 
 	if filePath != "" {
 		// #nosec G304
-		file, err := os.Open(filePath)
+		data, err := os.ReadFile(filePath)
 		if err == nil {
-			defer file.Close()
-			decoder := json.NewDecoder(file)
-			if err := decoder.Decode(config); err != nil {
+			if err := decodeConfig(filePath, data, config); err != nil {
 				return nil, err
 			}
 		} else if !os.IsNotExist(err) {
@@ -57,6 +57,43 @@ func LoadConfig(filePath string) (*types.DaemonConfig, error) {
 	return config, nil
 }
 
+// isYAML reports whether the config file at path is YAML, by its extension
+// (.yaml or .yml); any other file is JSON.
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// decodeConfig decodes data, the contents of the config file at path, over
+// cfg. A YAML config uses the same keys as config.json: it is decoded to
+// generic values and re-read through the json tags.
+func decodeConfig(path string, data []byte, cfg *types.DaemonConfig) error {
+	if !isYAML(path) {
+		return json.Unmarshal(data, cfg)
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(node.Content) == 0 {
+		return nil
+	}
+	// An unquoted file mode (socket_mode: 0660) reads as the integer 432;
+	// keep the octal digits the operator wrote.
+	if v := mappingValue(node.Content[0], "socket_mode"); v != nil && v.Kind == yaml.ScalarNode && v.Tag == "!!int" {
+		v.Tag, v.Value = "!!str", strings.Replace(v.Value, "0o", "0", 1)
+	}
+	var doc any
+	if err := node.Decode(&doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	j, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return json.Unmarshal(j, cfg)
+}
+
 // EnsureSecuritySecret guarantees the daemon has a non-empty HMAC secret.
 // If cfg.SecuritySecret is empty it generates a cryptographically random
 // 32-byte secret, sets it on cfg, and persists the full config to configPath
@@ -70,28 +107,188 @@ func EnsureSecuritySecret(configPath string, cfg *types.DaemonConfig) (bool, err
 		return false, nil
 	}
 
+	secret, err := newSecuritySecret()
+	if err != nil {
+		return false, err
+	}
+	cfg.SecuritySecret = secret
+
+	if err := saveConfig(configPath, cfg); err != nil {
+		return true, fmt.Errorf("persist config with generated secret: %w", err)
+	}
+	return true, nil
+}
+
+// maxRetiredSecrets bounds how many rotated-out secrets stay valid at once, so
+// repeated rotations cannot grow the accepted set without limit.
+const maxRetiredSecrets = 3
+
+// RotateSecuritySecret replaces cfg.SecuritySecret with a new random secret.
+// The old secret moves to cfg.PreviousSecrets and keeps verifying signatures
+// until now+grace. Expired entries are dropped, at most maxRetiredSecrets are
+// kept (newest first), and the result is persisted to configPath like
+// EnsureSecuritySecret does.
+func RotateSecuritySecret(configPath string, cfg *types.DaemonConfig, grace time.Duration, now time.Time) error {
+	secret, err := newSecuritySecret()
+	if err != nil {
+		return err
+	}
+
+	retired := []types.RetiredSecret{}
+	if cfg.SecuritySecret != "" && grace > 0 {
+		retired = append(retired, types.RetiredSecret{Secret: cfg.SecuritySecret, ExpiresAt: now.Add(grace)})
+	}
+	for _, r := range cfg.PreviousSecrets {
+		if now.Before(r.ExpiresAt) && len(retired) < maxRetiredSecrets {
+			retired = append(retired, r)
+		}
+	}
+	cfg.SecuritySecret = secret
+	cfg.PreviousSecrets = retired
+
+	if err := saveConfig(configPath, cfg); err != nil {
+		return fmt.Errorf("persist rotated secret: %w", err)
+	}
+	return nil
+}
+
+func newSecuritySecret() (string, error) {
 	buf := make([]byte, 32)
 	if _, err := rand.Read(buf); err != nil {
-		return false, fmt.Errorf("generate security secret: %w", err)
+		return "", fmt.Errorf("generate security secret: %w", err)
 	}
-	cfg.SecuritySecret = hex.EncodeToString(buf)
+	return hex.EncodeToString(buf), nil
+}
 
+// saveConfig writes cfg to configPath with 0600 permissions. An empty path
+// means there is no file to persist to; the in-memory config still applies.
+func saveConfig(configPath string, cfg *types.DaemonConfig) error {
 	if configPath == "" {
-		// No file to persist to; the in-memory secret still secures this run.
-		return true, nil
+		return nil
 	}
-
 	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
-		return true, fmt.Errorf("create config dir: %w", err)
+		return fmt.Errorf("create config dir: %w", err)
 	}
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
-		return true, fmt.Errorf("marshal config: %w", err)
+		return fmt.Errorf("marshal config: %w", err)
 	}
-	if err := os.WriteFile(configPath, data, 0600); err != nil {
-		return true, fmt.Errorf("persist config with generated secret: %w", err)
+	if isYAML(configPath) {
+		if data, err = encodeYAMLConfig(configPath, data); err != nil {
+			return fmt.Errorf("marshal config: %w", err)
+		}
+	}
+	return os.WriteFile(configPath, data, 0600)
+}
+
+// encodeYAMLConfig renders the JSON config j as YAML. When configPath already
+// holds a YAML config, j is merged into that document, so that the operator's
+// comments, key order and quoting survive the daemon writing back a
+// generated or rotated secret.
+func encodeYAMLConfig(configPath string, j []byte) ([]byte, error) {
+	// JSON is YAML; this gives j as a node tree in flow style.
+	var updated yaml.Node
+	if err := yaml.Unmarshal(j, &updated); err != nil {
+		return nil, err
+	}
+	blockStyle(&updated)
+
+	doc := &updated
+	// #nosec G304 -- the daemon's own config file
+	if existing, err := os.ReadFile(configPath); err == nil {
+		var orig yaml.Node
+		if yaml.Unmarshal(existing, &orig) == nil && len(orig.Content) == 1 && orig.Content[0].Kind == yaml.MappingNode {
+			mergeYAMLNode(orig.Content[0], updated.Content[0])
+			doc = &orig
+		}
+	}
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// mergeYAMLNode makes the node dst hold the values of src while keeping
+// dst's comments. Mapping keys keep their order in dst; keys only in src are
+// appended and keys missing from src are dropped. A scalar keeps its
+// quoting style.
+func mergeYAMLNode(dst, src *yaml.Node) {
+	if dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode {
+		var content []*yaml.Node
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			if v := mappingValue(src, dst.Content[i].Value); v != nil {
+				mergeYAMLNode(dst.Content[i+1], v)
+				content = append(content, dst.Content[i], dst.Content[i+1])
+			}
+		}
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			if mappingValue(dst, src.Content[i].Value) == nil {
+				content = append(content, src.Content[i], src.Content[i+1])
+			}
+		}
+		dst.Content = content
+		return
+	}
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+	style := dst.Style
+	keepStyle := dst.Kind == yaml.ScalarNode && src.Kind == yaml.ScalarNode && dst.ShortTag() == src.ShortTag()
+	*dst = *src
+	dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+	if keepStyle {
+		dst.Style = style
 	}
-	return true, nil
+}
+
+// mappingValue returns the value of key in the mapping node m, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// blockStyle clears the flow and quoting styles of nodes parsed from JSON;
+// the encoder still quotes scalars that would otherwise change type.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// CheckPrivate reports an error when path, which holds key material (the
+// daemon config with its HMAC secrets, or the app secrets store), is
+// accessible to group or others. The daemon refuses to start rather than
+// repair the mode itself: a loose mode means the secrets may already have
+// been read, which the operator needs to know. A missing path is fine.
+func CheckPrivate(path string) error {
+	if path == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	mode := info.Mode().Perm()
+	if mode&0o077 == 0 {
+		return nil
+	}
+	want := "0600"
+	if info.IsDir() {
+		want = "0700"
+	}
+	return fmt.Errorf("%s is accessible to group/others (mode %04o); treat the secrets in it as exposed, rotate them, then run `chmod %s %s`", path, mode, want, path)
 }
 
 func ReadConfigInServer(path string) (*config.NextDeployConfig, error) {
@@ -104,5 +301,8 @@ func ReadConfigInServer(path string) (*config.NextDeployConfig, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("Invalid config format: %w", err)
 	}
+	if err := config.CheckSchemaVersion(cfg.SchemaVersion); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
@@ -17,6 +17,30 @@ type AuditEntry struct {
 	Args           any       `json:"args,omitempty"`
 }
 
+// sensitiveArgs are command arguments whose values must not reach the audit
+// log: the Doppler token a ship passes and the value of secrets set.
+var sensitiveArgs = map[string]struct{}{
+	"dopplerToken": {},
+	"value":        {},
+}
+
+// redactArgs returns args with sensitive values replaced, leaving args
+// itself untouched. An empty value stays empty so the log still shows it was
+// not set.
+func redactArgs(args map[string]any) map[string]any {
+	if args == nil {
+		return nil
+	}
+	out := make(map[string]any, len(args))
+	for k, v := range args {
+		if _, ok := sensitiveArgs[k]; ok && v != "" && v != nil {
+			v = "[REDACTED]"
+		}
+		out[k] = v
+	}
+	return out
+}
+
 type AuditLogger struct {
 	path string
 }
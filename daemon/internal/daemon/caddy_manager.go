@@ -41,11 +41,11 @@ func NewCaddyManager() *CaddyManager {
 	}
 }
 
-func (cm *CaddyManager) GenerateConfig(appName, domain, outputMode string, port int, appDir string, features *nextcore.DetectedFeatures, distDir, exportDir string) error {
+func (cm *CaddyManager) GenerateConfig(appName string, site caddy.Site, outputMode string, upstreams []caddy.Upstream, appDir string, features *nextcore.DetectedFeatures, distDir, exportDir, extra string) error {
 	if err := sanitizeAppName(appName); err != nil {
 		return err
 	}
-	caddyConfig := caddy.GenerateCaddyfile(appName, domain, outputMode, port, appDir, features, distDir, exportDir)
+	caddyConfig := caddy.GenerateCaddyfileUpstreams(appName, site, outputMode, upstreams, appDir, features, distDir, exportDir, extra)
 	if err := cm.commitFragmentSafely(appName, []byte(caddyConfig)); err != nil {
 		return err
 	}
@@ -53,6 +53,19 @@ func (cm *CaddyManager) GenerateConfig(appName, domain, outputMode string, port
 	return nil
 }
 
+// GenerateMaintenanceConfig replaces the app's site with one serving the
+// maintenance page in pageDir (see caddy.GenerateMaintenanceCaddyfile).
+func (cm *CaddyManager) GenerateMaintenanceConfig(appName string, site caddy.Site, pageDir string, retryAfter int) error {
+	if err := sanitizeAppName(appName); err != nil {
+		return err
+	}
+	if err := cm.commitFragmentSafely(appName, []byte(caddy.GenerateMaintenanceCaddyfile(site, pageDir, retryAfter))); err != nil {
+		return err
+	}
+	log.Printf("Caddy maintenance config generated for %s", appName)
+	return nil
+}
+
 // commitFragmentSafely validates the *resulting* Caddy configuration in a
 // sandbox before the fragment is allowed to touch the live import directory.
 // Previously a malformed fragment was written straight into configDir and only
@@ -141,6 +154,87 @@ func (cm *CaddyManager) commitFragmentSafely(appName string, content []byte) err
 	return nil
 }
 
+// ApplyMainCaddyfile replaces the host's main Caddyfile with content without
+// ever leaving an invalid one live: the candidate is validated first, the
+// previous file is kept as Caddyfile.bak, and if Caddy cannot load the new
+// file the previous one is put back.
+func (cm *CaddyManager) ApplyMainCaddyfile(content []byte) error {
+	caddyPath := resolveTool("caddy")
+	validate := func(path string) error {
+		// #nosec G204
+		if out, err := exec.Command(caddyPath, "validate", "--config", path, "--adapter", "caddyfile").CombinedOutput(); err != nil {
+			return fmt.Errorf("%w - %s", err, string(out))
+		}
+		return nil
+	}
+	reload := func() error {
+		// #nosec G204
+		out, err := exec.Command(caddyPath, "reload", "--config", mainCaddyfilePath, "--adapter", "caddyfile").CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		// Not running yet (fresh host): starting it loads the file instead.
+		log.Printf("caddy reload failed (%v: %s), attempting systemctl start...", err, string(out))
+		// #nosec G204
+		if out2, err2 := exec.Command(resolveTool("systemctl"), "start", "caddy").CombinedOutput(); err2 != nil {
+			return fmt.Errorf("%w - %s", err2, string(out2))
+		}
+		return nil
+	}
+	return installCaddyfile(mainCaddyfilePath, content, validate, reload)
+}
+
+// installCaddyfile is ApplyMainCaddyfile with the caddy calls injected.
+func installCaddyfile(path string, content []byte, validate func(path string) error, reload func() error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".Caddyfile.*")
+	if err != nil {
+		return fmt.Errorf("failed to stage candidate Caddyfile: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write candidate Caddyfile: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write candidate Caddyfile: %w", err)
+	}
+
+	if err := validate(tmpPath); err != nil {
+		return fmt.Errorf("caddy validation failed (live Caddyfile left unchanged): %w", err)
+	}
+
+	backupPath := path + ".bak"
+	previous, err := os.ReadFile(path)
+	hadPrevious := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read current Caddyfile: %w", err)
+	}
+	if hadPrevious {
+		if err := os.WriteFile(backupPath, previous, 0o600); err != nil {
+			return fmt.Errorf("failed to back up current Caddyfile: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to install Caddyfile: %w", err)
+	}
+
+	if reloadErr := reload(); reloadErr != nil {
+		if !hadPrevious {
+			return fmt.Errorf("caddy failed to load the new Caddyfile: %w", reloadErr)
+		}
+		if err := os.WriteFile(path, previous, 0o600); err != nil {
+			return fmt.Errorf("caddy failed to load the new Caddyfile (%v) and restoring %s failed: %w", reloadErr, backupPath, err)
+		}
+		if err := reload(); err != nil {
+			log.Printf("Warning: reload after restoring the previous Caddyfile failed: %v", err)
+		}
+		return fmt.Errorf("caddy failed to load the new Caddyfile; previous one restored: %w", reloadErr)
+	}
+	return nil
+}
+
 func (cm *CaddyManager) EnsureMainCaddyfile() error {
 	importDirective := fmt.Sprintf("import %s/*.caddy\n", cm.configDir)
 	corazaGlobal := "{\n\torder coraza_waf first\n}\n\n"
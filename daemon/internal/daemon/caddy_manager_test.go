@@ -1,10 +1,14 @@
 package daemon
 
 import (
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/aynaash/nextdeploy/shared/caddy"
 )
 
 func TestSanitizeAppName(t *testing.T) {
@@ -60,3 +64,96 @@ func TestCaddyPreCommitValidation(t *testing.T) {
 		t.Errorf("valid fragment was not committed to the live dir: %v", err)
 	}
 }
+
+// TestMaintenanceConfig checks that Caddy is handed the maintenance site and
+// then, once the app is routed again, the normal one. A stub caddy binary
+// accepts every configuration.
+func TestMaintenanceConfig(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "caddy"), []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cm := &CaddyManager{configDir: t.TempDir()}
+	fragment := filepath.Join(cm.configDir, "shop.caddy")
+	site := caddy.Site{Domain: "shop.example.com"}
+	pageDir := "/opt/nextdeploy/apps/shop/maintenance"
+
+	if err := cm.GenerateMaintenanceConfig("shop", site, pageDir, maintenanceRetryAfter); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(fragment)
+	for _, want := range []string{"shop.example.com {", "root * " + pageDir, "status 503", `Retry-After "30"`} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("maintenance config missing %q:\n%s", want, got)
+		}
+	}
+
+	if err := cm.GenerateConfig("shop", site, "standalone", []caddy.Upstream{{Port: 3001, Weight: 1}}, "/opt/nextdeploy/apps/shop/current", nil, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = os.ReadFile(fragment)
+	if !strings.Contains(string(got), "reverse_proxy localhost:3001") || strings.Contains(string(got), pageDir) {
+		t.Errorf("restored config should proxy to the app, not serve the page:\n%s", got)
+	}
+}
+
+func TestInstallCaddyfile(t *testing.T) {
+	okValidate := func(string) error { return nil }
+	okReload := func() error { return nil }
+
+	t.Run("invalid candidate leaves live file untouched", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "Caddyfile")
+		if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		err := installCaddyfile(path, []byte("bad"), func(string) error { return errors.New("parse error") }, okReload)
+		if err == nil {
+			t.Fatal("expected validation error")
+		}
+		if got, _ := os.ReadFile(path); string(got) != "old" {
+			t.Errorf("live Caddyfile = %q, want it unchanged", got)
+		}
+	})
+
+	t.Run("valid candidate is installed with a backup", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "Caddyfile")
+		if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := installCaddyfile(path, []byte("new"), okValidate, okReload); err != nil {
+			t.Fatalf("installCaddyfile: %v", err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != "new" {
+			t.Errorf("live Caddyfile = %q, want new", got)
+		}
+		if got, _ := os.ReadFile(path + ".bak"); string(got) != "old" {
+			t.Errorf("backup = %q, want old", got)
+		}
+	})
+
+	t.Run("reload failure restores the previous file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "Caddyfile")
+		if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		reloads := 0
+		reload := func() error {
+			reloads++
+			if reloads == 1 {
+				return errors.New("listener conflict")
+			}
+			return nil
+		}
+		if err := installCaddyfile(path, []byte("new"), okValidate, reload); err == nil {
+			t.Fatal("expected the reload error to be returned")
+		}
+		if got, _ := os.ReadFile(path); string(got) != "old" {
+			t.Errorf("live Caddyfile = %q, want the previous one restored", got)
+		}
+		if reloads != 2 {
+			t.Errorf("reloads = %d, want a second reload of the restored file", reloads)
+		}
+	})
+}
@@ -0,0 +1,420 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+	"github.com/aynaash/nextdeploy/shared/caddy"
+)
+
+const (
+	// canaryFile, in the app directory, records the canary in progress.
+	canaryFile          = "canary.json"
+	defaultCanaryWeight = 10
+)
+
+// canaryState is a release running next to the live one and taking Weight
+// percent of its requests. The live release keeps the app's port and the
+// current symlink until the canary is promoted.
+type canaryState struct {
+	ReleaseID string    `json:"releaseId"`
+	Service   string    `json:"service"`
+	Port      int       `json:"port"`
+	Weight    int       `json:"weight"`
+	Started   time.Time `json:"started"`
+}
+
+// readCanary returns the app's canary, or nil when none is in progress.
+func readCanary(appName string) (*canaryState, error) {
+	// #nosec G304 -- fixed file name inside a validated app directory
+	data, err := os.ReadFile(filepath.Join(appsDir, appName, canaryFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st canaryState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", canaryFile, err)
+	}
+	return &st, nil
+}
+
+func writeCanary(appName string, st *canaryState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	// #nosec G306 -- ports and release IDs are not secret
+	return os.WriteFile(filepath.Join(appsDir, appName, canaryFile), data, 0o644)
+}
+
+func canaryInProgress(appName string, st *canaryState, err error) string {
+	if err != nil {
+		return fmt.Sprintf("cannot read the canary state of %s: %v", appName, err)
+	}
+	return fmt.Sprintf("%s has canary release %s taking %d%% of requests; promote or abort it first", appName, st.ReleaseID, st.Weight)
+}
+
+// parseCanaryWeight reads the percentage of requests a canary takes: a whole
+// number from 1 to 99, since 0 is an abort and 100 a promote.
+func parseCanaryWeight(raw any) (int, error) {
+	if raw == nil {
+		return defaultCanaryWeight, nil
+	}
+	w, ok := raw.(float64)
+	if !ok || w != math.Trunc(w) || w < 1 || w > 99 {
+		return 0, fmt.Errorf("canary weight must be a whole percentage from 1 to 99, got %v", raw)
+	}
+	return int(w), nil
+}
+
+// shipCanaryWeight checks whether a ship may go ahead and returns the
+// canary weight it asked for, 0 for a normal activation. Either kind of ship
+// is refused while a canary is running: the next release must start from a
+// single live one.
+func shipCanaryWeight(args map[string]any, appName, outputMode string) (int, error) {
+	if st, err := readCanary(appName); err != nil || st != nil {
+		return 0, errors.New(canaryInProgress(appName, st, err))
+	}
+	if canary, _ := args["canary"].(bool); !canary {
+		return 0, nil
+	}
+	if outputMode == "export" {
+		return 0, fmt.Errorf("%s is a static export; there is no process to run as a canary", appName)
+	}
+	if inMaintenance(appName) {
+		return 0, fmt.Errorf("%s is in maintenance; ship it without --canary to bring it back", appName)
+	}
+	if _, err := os.Stat(filepath.Join(appsDir, appName, "current")); err != nil {
+		return 0, fmt.Errorf("%s has no live release to run a canary next to; ship it without --canary first", appName)
+	}
+	return parseCanaryWeight(args["weight"])
+}
+
+// canaryUpstreams splits the site's requests between the live release and
+// the canary, weight percent to the canary.
+func canaryUpstreams(livePort, canaryPort, weight int) []caddy.Upstream {
+	return []caddy.Upstream{
+		{Port: livePort, Weight: 100 - weight},
+		{Port: canaryPort, Weight: weight},
+	}
+}
+
+// activateCanary starts ctx's release on a port of its own next to the live
+// release and, once it is ready, routes ctx.CanaryWeight percent of the
+// site's requests to it. Unlike activateRelease it leaves the current
+// symlink, the app's port and the live unit alone: until promote, the live
+// release is still the app, and abort only has to remove the canary.
+func (ch *CommandHandler) activateCanary(ctx ReleaseContext) types.Response {
+	livePort := ch.stateManager.GetPort(ctx.AppName)
+	if livePort == 0 {
+		return types.Response{Success: false, Message: fmt.Sprintf("%s has no port assigned; ship it without --canary first", ctx.AppName)}
+	}
+	port, closePort, err := findUnclaimedPort(func(p int) string {
+		if p == livePort {
+			return ctx.AppName
+		}
+		return ch.stateManager.PortOwner(p, ctx.AppName)
+	})
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to allocate port: %v", err)}
+	}
+	defer func() { _ = closePort() }()
+
+	if err := ch.renderEnvFile(ctx.AppName, ctx.ReleaseDir, map[string]string{
+		"DOPPLER_TOKEN": ctx.DopplerToken,
+	}); err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to render secrets env file: %v", err)}
+	}
+	mounts, err := ch.resolveVolumes(ctx.AppName, ctx.ReleaseDir, ctx.Volumes)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	devices, err := resolveDevices(ctx.Devices, ch.config.AllowedDevices)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+
+	var hookResults []hookResult
+	if ctx.Hooks != nil && len(ctx.Hooks.PreDeploy) > 0 {
+		results, err := runHooks("pre_deploy", ctx.Hooks.PreDeploy, ctx.ReleaseDir, mounts, ctx.Deadline)
+		hookResults = results
+		if err != nil {
+			return types.Response{
+				Success: false,
+				Message: fmt.Sprintf("canary aborted: %v; the live release is unchanged%s", err, hookSummary(results)),
+				Data:    map[string]any{"hooks": results},
+			}
+		}
+	}
+
+	serviceName, generated, err := ch.processManager.GenerateServiceFile(
+		ctx.AppName, ctx.ReleaseDir, ctx.OutputMode, ctx.DopplerToken, port, ctx.PackageManager, ctx.ReleaseID, ctx.Resources, ctx.Start, mounts, ctx.Stop, ctx.Placement, devices,
+	)
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to generate service file: %v", err)}
+	}
+	if !generated {
+		return types.Response{Success: false, Message: fmt.Sprintf("%s (%s) runs no process to canary", ctx.AppName, ctx.OutputMode)}
+	}
+
+	_ = closePort()
+	if err := ch.processManager.StartService(serviceName); err != nil {
+		resp := ch.failedReleaseResponse(fmt.Sprintf("failed to start canary: %v", err), serviceName, ctx.FailLogLines)
+		_ = ch.processManager.RemoveService(serviceName)
+		return resp
+	}
+
+	readinessTimeout := ctx.ReadinessTimeout
+	if readinessTimeout <= 0 {
+		readinessTimeout = defaultReadinessTimeout
+	}
+	timeToReady, err := waitForHealthy(port, ctx.HealthPath, readinessTimeout)
+	if err != nil {
+		resp := ch.failedReleaseResponse(fmt.Sprintf("canary never became ready: %v", err), serviceName, ctx.FailLogLines)
+		_ = ch.processManager.RemoveService(serviceName)
+		return resp
+	}
+	log.Printf("[canary] Release %s ready on port %d after %s", ctx.ReleaseID, port, timeToReady.Round(time.Millisecond))
+
+	// The canary's pages reference its own chunks; they must be servable
+	// before any request reaches it.
+	syncSharedStatic(ctx.AppName, ctx.ReleaseDir, ctx.DistDir)
+
+	st := &canaryState{ReleaseID: ctx.ReleaseID, Service: serviceName, Port: port, Weight: ctx.CanaryWeight, Started: time.Now().UTC()}
+	if err := writeCanary(ctx.AppName, st); err != nil {
+		_ = ch.processManager.RemoveService(serviceName)
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to record canary: %v", err)}
+	}
+	if err := ch.routeSite(ctx, canaryUpstreams(livePort, port, st.Weight)); err != nil {
+		_ = ch.processManager.RemoveService(serviceName)
+		_ = os.Remove(filepath.Join(appsDir, ctx.AppName, canaryFile))
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	if ctx.TarballPath != "" {
+		_ = os.Remove(ctx.TarballPath)
+	}
+
+	msg := fmt.Sprintf("Canary release %s for %s is taking %d%% of requests (ready in %s); ramp it with `nextdeployd ramp`, then promote or abort it",
+		ctx.ReleaseID, ctx.AppName, st.Weight, timeToReady.Round(time.Millisecond))
+	if len(hookResults) > 0 {
+		msg += hookSummary(hookResults)
+	}
+	data := map[string]any{"releaseId": ctx.ReleaseID, "timeToReadyMs": timeToReady.Milliseconds(), "hooks": hookResults, "canary": st}
+	if len(devices) > 0 {
+		msg += "\nDevices: " + strings.Join(devicePaths(devices), ", ")
+		data["devices"] = devicePaths(devices)
+	}
+	return types.Response{
+		Success: true,
+		Message: msg,
+		Data:    data,
+	}
+}
+
+// siteContext is the part of a release's context that shapes its Caddy site,
+// plus the hooks and volumes a promote needs to run its post_deploy hooks.
+func siteContext(appName, releaseDir string) (ReleaseContext, error) {
+	meta, err := readMetadata(releaseDir)
+	if err != nil {
+		return ReleaseContext{}, fmt.Errorf("failed to read metadata of %s: %w", filepath.Base(releaseDir), err)
+	}
+	return ReleaseContext{
+		AppName:          appName,
+		Domain:           Coalesce(meta.Domain, "localhost"),
+		ReleaseDir:       releaseDir,
+		ReleaseID:        filepath.Base(releaseDir),
+		OutputMode:       string(meta.OutputMode),
+		DetectedFeatures: meta.DetectedFeatures,
+		DistDir:          meta.DistDir,
+		ExportDir:        meta.ExportDir,
+		CaddyDirectives:  meta.CaddyDirectives,
+		DomainAliases:    meta.DomainAliases,
+		DomainRedirect:   meta.DomainRedirect,
+		Hooks:            meta.Hooks,
+		Volumes:          meta.Volumes,
+	}, nil
+}
+
+// handleCanary moves an app's canary along: action "ramp" sets the
+// percentage of requests it takes, "promote" makes it the live release and
+// "abort" removes it, leaving the live release serving everything.
+func (ch *CommandHandler) handleCanary(args map[string]any, deadline time.Time) types.Response {
+	appName, ok := StringArg(args, "appName")
+	if !ok {
+		return types.Response{Success: false, Message: "missing 'appName' argument"}
+	}
+	if err := validateAppName(appName); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	action, _ := StringArg(args, "action")
+
+	release, ok := ch.deployLocks.tryAcquire(appName)
+	if !ok {
+		return busyResponse(appName)
+	}
+	defer release()
+
+	st, err := readCanary(appName)
+	if err != nil {
+		return types.Response{Success: false, Message: canaryInProgress(appName, nil, err)}
+	}
+	if st == nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("%s has no canary in progress", appName)}
+	}
+
+	switch action {
+	case "ramp":
+		return ch.rampCanary(appName, st, args["weight"])
+	case "promote":
+		return ch.promoteCanary(appName, st, deadline)
+	case "abort":
+		return ch.abortCanary(appName, st)
+	default:
+		return types.Response{Success: false, Message: fmt.Sprintf("unknown canary action %q (want ramp, promote or abort)", action)}
+	}
+}
+
+func (ch *CommandHandler) rampCanary(appName string, st *canaryState, rawWeight any) types.Response {
+	if rawWeight == nil {
+		return types.Response{Success: false, Message: "missing 'weight' argument"}
+	}
+	weight, err := parseCanaryWeight(rawWeight)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	ctx, err := siteContext(appName, filepath.Join(appsDir, appName, "releases", st.ReleaseID))
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	if err := ch.routeSite(ctx, canaryUpstreams(ch.stateManager.GetPort(appName), st.Port, weight)); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	from := st.Weight
+	st.Weight = weight
+	if err := writeCanary(appName, st); err != nil {
+		log.Printf("[canary] Warning: failed to record weight of %s: %v", appName, err)
+	}
+	log.Printf("[canary] %s: release %s ramped from %d%% to %d%%", appName, st.ReleaseID, from, weight)
+	return types.Response{
+		Success: true,
+		Message: fmt.Sprintf("Canary release %s for %s now takes %d%% of requests (was %d%%)", st.ReleaseID, appName, weight, from),
+		Data:    map[string]any{"canary": st},
+	}
+}
+
+// promoteCanary makes the canary the live release the way activateRelease
+// would have: it gets all the traffic, then takes over the current symlink
+// and the app's port record, and the previous release's unit is removed.
+// Routing goes first so a Caddy failure leaves the canary as it was.
+// post_deploy hooks run now, since this is when the release goes live.
+func (ch *CommandHandler) promoteCanary(appName string, st *canaryState, deadline time.Time) types.Response {
+	releaseDir := filepath.Join(appsDir, appName, "releases", st.ReleaseID)
+	ctx, err := siteContext(appName, releaseDir)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	if err := ch.routeSite(ctx, []caddy.Upstream{{Port: st.Port, Weight: 1}}); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+
+	currentSymlink := filepath.Join(appsDir, appName, "current")
+	tmpSymlink := currentSymlink + ".tmp"
+	_ = os.Remove(tmpSymlink)
+	err = os.Symlink(releaseDir, tmpSymlink)
+	if err == nil {
+		if err = os.Rename(tmpSymlink, currentSymlink); err != nil {
+			_ = os.Remove(tmpSymlink)
+		}
+	}
+	if err != nil {
+		// Put the split back so the site and the live release agree again.
+		if routeErr := ch.routeSite(ctx, canaryUpstreams(ch.stateManager.GetPort(appName), st.Port, st.Weight)); routeErr != nil {
+			log.Printf("[canary] Warning: failed to restore the canary split of %s: %v", appName, routeErr)
+		}
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to switch the current symlink: %v", err)}
+	}
+
+	ch.stateManager.SetPort(appName, st.Port)
+	if err := ch.stateManager.Save(); err != nil {
+		log.Printf("[canary] Warning: failed to save state: %v", err)
+	}
+	portFilePath := filepath.Join(appsDir, appName, "port")
+	// #nosec G306 -- must be world-readable for Caddy/other discovery tools to read the port
+	if err := os.WriteFile(portFilePath, []byte(fmt.Sprintf("%d", st.Port)), 0o644); err != nil {
+		log.Printf("[canary] Warning: failed to write port file to %s: %v", portFilePath, err)
+	}
+	_ = os.Remove(filepath.Join(appsDir, appName, canaryFile))
+
+	if services, err := ch.processManager.FindAppServices(appName); err == nil {
+		for _, s := range services {
+			if s != st.Service {
+				log.Printf("[canary] Cleaning up old service: %s", s)
+				_ = ch.processManager.RemoveService(s)
+			}
+		}
+	}
+	if err := pruneReleases(appName, 5); err != nil {
+		log.Printf("[canary] Warning: failed to prune releases: %v", err)
+	}
+
+	msg := fmt.Sprintf("Promoted canary release %s: it is now the live release of %s", st.ReleaseID, appName)
+	success := true
+	var hookResults []hookResult
+	if ctx.Hooks != nil && len(ctx.Hooks.PostDeploy) > 0 {
+		if err := ctx.Hooks.Validate(); err != nil {
+			success = false
+			msg = fmt.Sprintf("Release %s for %s is live, but app.%v", st.ReleaseID, appName, err)
+		} else if mounts, err := ch.resolveVolumes(appName, releaseDir, ctx.Volumes); err != nil {
+			success = false
+			msg = fmt.Sprintf("Release %s for %s is live, but its post_deploy hooks did not run: %v", st.ReleaseID, appName, err)
+		} else if hookResults, err = runHooks("post_deploy", ctx.Hooks.PostDeploy, releaseDir, mounts, deadline); err != nil {
+			success = false
+			msg = fmt.Sprintf("Release %s for %s is live, but %v", st.ReleaseID, appName, err)
+		}
+	}
+	if len(hookResults) > 0 {
+		msg += hookSummary(hookResults)
+	}
+	return types.Response{Success: success, Message: msg, Data: map[string]any{"releaseId": st.ReleaseID, "hooks": hookResults}}
+}
+
+// abortCanary sends every request back to the live release, then removes
+// the canary's unit and release directory; it never became the app, so
+// there is nothing to roll back to it.
+func (ch *CommandHandler) abortCanary(appName string, st *canaryState) types.Response {
+	liveDir, err := filepath.EvalSymlinks(filepath.Join(appsDir, appName, "current"))
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to resolve the live release of %s: %v", appName, err)}
+	}
+	ctx, err := siteContext(appName, liveDir)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	if err := ch.routeSite(ctx, []caddy.Upstream{{Port: ch.stateManager.GetPort(appName), Weight: 1}}); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	_ = os.Remove(filepath.Join(appsDir, appName, canaryFile))
+
+	if err := ch.processManager.RemoveService(st.Service); err != nil {
+		log.Printf("[canary] Warning: failed to remove %s: %v", st.Service, err)
+	}
+	if err := os.RemoveAll(filepath.Join(appsDir, appName, "releases", st.ReleaseID)); err != nil {
+		log.Printf("[canary] Warning: failed to remove release %s: %v", st.ReleaseID, err)
+	}
+	return types.Response{
+		Success: true,
+		Message: fmt.Sprintf("Aborted canary release %s: %s serves all requests from release %s again", st.ReleaseID, appName, filepath.Base(liveDir)),
+		Data:    map[string]any{"releaseId": st.ReleaseID},
+	}
+}
@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+	"github.com/aynaash/nextdeploy/shared/httpx"
+)
+
+// maxChannelManifest caps how much of a channel manifest is read.
+const maxChannelManifest = 1 << 20
+
+var (
+	channelName = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+	sha256Hex   = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// channelRelease is the release a channel points at: a tarball already
+// uploaded to the host, pinned by its digest.
+type channelRelease struct {
+	// Tarball is a file name in the uploads directory.
+	Tarball string `json:"tarball"`
+	SHA256  string `json:"sha256"`
+	// Commit is passed on to ship for the metadata store lookup.
+	Commit string `json:"commit,omitempty"`
+}
+
+// channelManifestClient fetches remote channel manifests; a var so tests can
+// trust their own TLS server.
+var channelManifestClient = func() *http.Client {
+	return httpx.New(httpx.Options{Timeout: 15 * time.Second, Retries: 2})
+}
+
+// loadChannelManifest reads the channel manifest, a JSON object mapping
+// channel names to releases, from an https URL or a local file:
+//
+//	{"stable": {"tarball": "web-1a2b3c.tar.gz", "sha256": "…"}}
+//
+// A plain http URL is refused: whoever can rewrite the manifest in transit
+// picks the digest ship verifies against.
+func loadChannelManifest(source string) (map[string]channelRelease, error) {
+	var r io.Reader
+	if strings.HasPrefix(source, "http://") {
+		return nil, fmt.Errorf("channel manifest %s must be fetched over https", source)
+	}
+	if strings.HasPrefix(source, "https://") {
+		resp, err := channelManifestClient().Get(source)
+		if err != nil {
+			return nil, fmt.Errorf("fetch channel manifest: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch channel manifest: %s returned %d", source, resp.StatusCode)
+		}
+		r = resp.Body
+	} else {
+		// #nosec G304 -- path from the daemon's own config
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("open channel manifest: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var manifest map[string]channelRelease
+	if err := json.NewDecoder(io.LimitReader(r, maxChannelManifest)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("parse channel manifest %s: %w", source, err)
+	}
+	return manifest, nil
+}
+
+// resolveChannel returns what channel points at in the manifest at source.
+// The entry must name a tarball inside the uploads directory and its full
+// digest, so a manifest can only select among uploaded artifacts and ship
+// verifies exactly the one it selected.
+func resolveChannel(source, channel string) (channelRelease, error) {
+	if source == "" {
+		return channelRelease{}, fmt.Errorf("channel deploys need channel_manifest in the daemon config")
+	}
+	if !channelName.MatchString(channel) {
+		return channelRelease{}, fmt.Errorf("invalid channel name %q", channel)
+	}
+	manifest, err := loadChannelManifest(source)
+	if err != nil {
+		return channelRelease{}, err
+	}
+	rel, ok := manifest[channel]
+	if !ok {
+		return channelRelease{}, fmt.Errorf("channel %q is not in %s", channel, source)
+	}
+	if rel.Tarball == "" || rel.Tarball != filepath.Base(rel.Tarball) || strings.HasPrefix(rel.Tarball, ".") {
+		return channelRelease{}, fmt.Errorf("channel %q: tarball must be a file name in the uploads directory, got %q", channel, rel.Tarball)
+	}
+	rel.SHA256 = strings.ToLower(rel.SHA256)
+	if !sha256Hex.MatchString(rel.SHA256) {
+		return channelRelease{}, fmt.Errorf("channel %q: sha256 must be a 64-character hex digest", channel)
+	}
+	return rel, nil
+}
+
+// shipChannel deploys whatever channel currently points at: it resolves the
+// tarball and digest from the channel manifest, ships it like any other
+// tarball, and reports the resolved digest with the result.
+func (ch *CommandHandler) shipChannel(channel string, args map[string]any, deadline time.Time) types.Response {
+	rel, err := resolveChannel(ch.config.ChannelManifest, channel)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	if want, ok := StringArg(args, "sha256"); ok && want != "" && !strings.EqualFold(want, rel.SHA256) {
+		return types.Response{Success: false, Message: fmt.Sprintf("channel %q points at sha256 %s, not the requested %s", channel, rel.SHA256, want)}
+	}
+	log.Printf("[ship] Channel %s resolved to %s (sha256 %s)", channel, rel.Tarball, rel.SHA256)
+
+	shipArgs := make(map[string]any, len(args)+1)
+	for k, v := range args {
+		if k != "channel" && k != "tarball" {
+			shipArgs[k] = v
+		}
+	}
+	shipArgs["sha256"] = rel.SHA256
+	if _, ok := shipArgs["commit"]; !ok && rel.Commit != "" {
+		shipArgs["commit"] = rel.Commit
+	}
+
+	// The channel keeps pointing at its tarball, so the release must not
+	// consume it the way an uploaded one is.
+	resp := ch.shipTarball(filepath.Join(uploadsDir, rel.Tarball), false, shipArgs, deadline)
+	resp.Message = fmt.Sprintf("Channel %s → %s (sha256 %s)\n%s", channel, rel.Tarball, rel.SHA256, resp.Message)
+	data, _ := resp.Data.(map[string]any)
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["channel"] = map[string]any{"name": channel, "tarball": rel.Tarball, "sha256": rel.SHA256, "commit": rel.Commit}
+	resp.Data = data
+	return resp
+}
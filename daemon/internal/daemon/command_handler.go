@@ -1,23 +1,28 @@
 package daemon
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	daemonconfig "github.com/aynaash/nextdeploy/daemon/internal/config"
 	"github.com/aynaash/nextdeploy/daemon/internal/types"
 	"github.com/aynaash/nextdeploy/shared"
+	"github.com/aynaash/nextdeploy/shared/caddy"
 	"github.com/aynaash/nextdeploy/shared/config"
+	"github.com/aynaash/nextdeploy/shared/httpx"
 	"github.com/aynaash/nextdeploy/shared/nextcore"
 	"github.com/aynaash/nextdeploy/shared/updater"
 )
@@ -25,11 +30,17 @@ import (
 const (
 	baseDir       = "/opt/nextdeploy"
 	appsDir       = "/opt/nextdeploy/apps"
-	uploadsDir    = "/opt/nextdeploy/uploads"
-	workTmpDir    = "/opt/nextdeploy/tmp"
 	nextdeployDir = ".nextdeploy"
 )
 
+// uploadsDir is where the CLI drops tarballs and env files for ship, and the
+// only place ship reads from; ship unpacks into workTmpDir. Vars (not const)
+// so tests can point them at temp dirs.
+var (
+	uploadsDir = "/opt/nextdeploy/uploads"
+	workTmpDir = "/opt/nextdeploy/tmp"
+)
+
 type CommandHandler struct {
 	config         *types.DaemonConfig
 	caddyManager   *CaddyManager
@@ -39,6 +50,17 @@ type CommandHandler struct {
 	rateLimiter    *RateLimiter
 	replayGuard    *ReplayGuard
 	deployLocks    *appLocker
+	deployQueue    *deployQueue
+	idempotency    *idempotencyStore
+	// secretsKey is the data key the secrets store is encrypted under; nil
+	// keeps it in plaintext (see openSecretsKey).
+	secretsKey []byte
+	// reexec replaces the process with a fresh binary while keeping the
+	// sockets bound; wired to SocketServer.Reexec by the daemon.
+	reexec func(execPath string) error
+	// secretMu guards config.SecuritySecret/PreviousSecrets, which
+	// rotateSecret replaces while other commands are being verified.
+	secretMu sync.RWMutex
 }
 
 // appLocker serializes mutating operations (ship, rollback, destroy) per app so
@@ -72,6 +94,12 @@ func (a *appLocker) tryAcquire(app string) (release func(), ok bool) {
 	return m.Unlock, true
 }
 
+// busyResponse refuses an operation on appName because another one holds
+// its lock.
+func busyResponse(appName string) types.Response {
+	return retryableResponse(fmt.Sprintf("another deploy or rollback for %q is already in progress", appName))
+}
+
 func NewCommandHandler(config *types.DaemonConfig) *CommandHandler {
 	statePath := "/var/lib/nextdeployd/state.json"
 	if os.Geteuid() != 0 {
@@ -90,6 +118,15 @@ func NewCommandHandler(config *types.DaemonConfig) *CommandHandler {
 		burst = 20
 	}
 
+	idempotencyTTL := defaultIdempotencyTTL
+	if config.IdempotencyTTL != "" {
+		if d, err := time.ParseDuration(config.IdempotencyTTL); err == nil && d > 0 {
+			idempotencyTTL = d
+		} else {
+			log.Printf("[daemon] Warning: invalid idempotency_ttl %q, using %s", config.IdempotencyTTL, defaultIdempotencyTTL)
+		}
+	}
+
 	return &CommandHandler{
 		config:         config,
 		caddyManager:   NewCaddyManager(),
@@ -99,6 +136,8 @@ func NewCommandHandler(config *types.DaemonConfig) *CommandHandler {
 		rateLimiter:    NewRateLimiter(rate, burst),
 		replayGuard:    NewReplayGuard(5 * time.Minute),
 		deployLocks:    newAppLocker(),
+		deployQueue:    newDeployQueue(config.MaxConcurrentDeploys),
+		idempotency:    newIdempotencyStore(filepath.Join(filepath.Dir(statePath), idempotencyFile), idempotencyTTL),
 	}
 }
 
@@ -111,8 +150,18 @@ var allowedCommands = map[string]struct{}{
 	"secrets":       {},
 	"status":        {},
 	"logs":          {},
+	"plan":          {},
+	"drift":         {},
+	"diff":          {},
+	"prune":         {},
 	"destroy":       {},
 	"stop":          {},
+	"rotateSecret":  {},
+	"selftest":      {},
+	"queue":         {},
+	"probe":         {},
+	"canary":        {},
+	"maintenance":   {},
 }
 
 func (ch *CommandHandler) ValidateCommand(cmd types.Command) error {
@@ -142,7 +191,10 @@ func (ch *CommandHandler) HandleCommand(cmd types.Command, clientIdentity string
 		"timestamp": cmd.Timestamp,
 		"nonce":     cmd.Nonce,
 	})
-	if !VerifySignature(payload, cmd.Signature, ch.config.SecuritySecret) {
+	ch.secretMu.RLock()
+	secrets := acceptedSecrets(ch.config, time.Now())
+	ch.secretMu.RUnlock()
+	if !verifySignatureAny(payload, cmd.Signature, secrets) {
 		return types.Response{Success: false, Message: "invalid command signature"}
 	}
 
@@ -153,45 +205,80 @@ func (ch *CommandHandler) HandleCommand(cmd types.Command, clientIdentity string
 		return types.Response{Success: false, Message: fmt.Sprintf("replay protection: %v", err)}
 	}
 
+	// 3c. Idempotency: a retried command with the same key gets the first
+	// call's response instead of running again. Ship keys its own by the
+	// app named in the tarball (see handleShip). A dry run changes nothing,
+	// so it is never recorded: its plan must not answer the real command.
 	var resp types.Response
+	dryRun, _ := cmd.Args["dryRun"].(bool)
+	if key, ok := StringArg(cmd.Args, "idempotency_key"); ok && key != "" && cmd.Type != "ship" && !dryRun {
+		app, _ := StringArg(cmd.Args, "appName")
+		resp = ch.idempotency.Do(app, key, cmd.Type, func() types.Response { return ch.dispatch(cmd) })
+	} else {
+		resp = ch.dispatch(cmd)
+	}
+
+	// 4. Audit Logging
+	ch.auditLogger.Log(AuditEntry{
+		CommandType:    cmd.Type,
+		ClientIdentity: clientIdentity,
+		Result:         fmt.Sprintf("%v", resp.Success),
+		ErrorDetails:   resp.Message,
+		Args:           redactArgs(cmd.Args),
+	})
+
+	return resp
+}
+
+// dispatch runs a verified command.
+func (ch *CommandHandler) dispatch(cmd types.Command) types.Response {
 	switch cmd.Type {
 	case "setupCaddy":
-		resp = ch.setUpCaddy(cmd.Args)
+		return ch.setUpCaddy(cmd.Args)
 	case "stopdaemon":
-		resp = ch.stopDaemon(cmd.Args)
+		return ch.stopDaemon(cmd.Args)
 	case "restartDaemon":
-		resp = ch.restartDaemon(cmd.Args)
+		return ch.restartDaemon(cmd.Args)
 	case "ship":
-		resp = ch.handleShip(cmd.Args)
+		return ch.handleShip(cmd.Args, cmd.Deadline)
 	case "rollback":
-		resp = ch.handleRollback(cmd.Args)
+		return ch.handleRollback(cmd.Args, cmd.Deadline)
 	case "secrets":
-		resp = ch.handleSecrets(cmd.Args)
+		return ch.handleSecrets(cmd.Args)
 	case "status":
-		resp = ch.handleStatus(cmd.Args)
+		return ch.handleStatus(cmd.Args)
 	case "logs":
-		resp = ch.handleLogs(cmd.Args)
+		return ch.handleLogs(cmd.Args)
+	case "plan":
+		return ch.handlePlan(cmd.Args)
+	case "drift":
+		return ch.handleDrift(cmd.Args)
+	case "diff":
+		return ch.handleDiff(cmd.Args)
+	case "prune":
+		return ch.handlePrune(cmd.Args)
 	case "destroy":
-		resp = ch.handleDestroy(cmd.Args)
+		return ch.handleDestroy(cmd.Args)
 	case "stop":
-		resp = ch.handleStopApp(cmd.Args)
+		return ch.handleStopApp(cmd.Args)
+	case "rotateSecret":
+		return ch.rotateSecret(cmd.Args)
+	case "selftest":
+		return ch.handleSelftest(cmd.Args)
+	case "queue":
+		return ch.handleQueue(cmd.Args)
+	case "probe":
+		return ch.handleProbe(cmd.Args)
+	case "canary":
+		return ch.handleCanary(cmd.Args, cmd.Deadline)
+	case "maintenance":
+		return ch.handleMaintenance(cmd.Args)
 	default:
-		resp = types.Response{
+		return types.Response{
 			Success: false,
 			Message: fmt.Sprintf("unknown command: %s", cmd.Type),
 		}
 	}
-
-	// 4. Audit Logging
-	ch.auditLogger.Log(AuditEntry{
-		CommandType:    cmd.Type,
-		ClientIdentity: clientIdentity,
-		Result:         fmt.Sprintf("%v", resp.Success),
-		ErrorDetails:   resp.Message,
-		Args:           cmd.Args,
-	})
-
-	return resp
 }
 
 func (ch *CommandHandler) stopDaemon(args map[string]interface{}) types.Response {
@@ -200,9 +287,48 @@ func (ch *CommandHandler) stopDaemon(args map[string]interface{}) types.Response
 	return types.Response{Success: true, Message: "daemon stopped"}
 }
 
-func (ch *CommandHandler) restartDaemon(args map[string]interface{}) types.Response {
-	log.Println("Restarting daemon...")
+// defaultSecretGrace is how long a rotated-out security secret keeps
+// verifying signatures when rotateSecret is not given a grace window.
+const defaultSecretGrace = 15 * time.Minute
+
+// rotateSecret replaces the HMAC security secret. The previous secret stays
+// valid for args["grace"] (a Go duration, default 15m) so clients that loaded
+// it just before the rotation are not rejected; new commands are signed with
+// the new secret, which clients read from the persisted config.
+func (ch *CommandHandler) rotateSecret(args map[string]interface{}) types.Response {
+	grace := defaultSecretGrace
+	if raw, ok := StringArg(args, "grace"); ok && raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return types.Response{Success: false, Message: fmt.Sprintf("invalid grace %q: want a non-negative duration like 15m", raw)}
+		}
+		grace = d
+	}
+
+	ch.secretMu.Lock()
+	defer ch.secretMu.Unlock()
+	now := time.Now()
+	if err := daemonconfig.RotateSecuritySecret(ch.config.ConfigPath, ch.config, grace, now); err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to rotate security secret: %v", err)}
+	}
 
+	log.Printf("[security] Security secret rotated; previous secret accepted for %s", grace)
+	return types.Response{
+		Success: true,
+		Message: fmt.Sprintf("Security secret rotated. The previous secret is accepted until %s.", now.Add(grace).Format(time.RFC3339)),
+		Data:    map[string]any{"graceUntil": now.Add(grace), "retiredSecrets": len(ch.config.PreviousSecrets)},
+	}
+}
+
+// restartDaemon replaces the running daemon with a fresh copy of its binary
+// (e.g. after an update) without a window where the socket is gone. The new
+// binary is run once first so a broken one never replaces a working daemon,
+// and state is flushed before the handoff, which starts after this response
+// has been sent.
+func (ch *CommandHandler) restartDaemon(args map[string]interface{}) types.Response {
+	if ch.reexec == nil {
+		return types.Response{Success: false, Message: "restart is not available in this process"}
+	}
 	execPath, err := os.Executable()
 	if err != nil {
 		return types.Response{
@@ -211,24 +337,24 @@ func (ch *CommandHandler) restartDaemon(args map[string]interface{}) types.Respo
 		}
 	}
 
-	// #nosec G204
-	cmd := exec.Command(execPath, "--foreground=true", "--config="+ch.config.ConfigPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Start(); err != nil {
+	// #nosec G204 -- execPath is this daemon's own executable
+	if out, err := exec.Command(execPath, "version").CombinedOutput(); err != nil {
 		return types.Response{
 			Success: false,
-			Message: fmt.Sprintf("failed to start new daemon process: %v", err),
+			Message: fmt.Sprintf("%s does not run (%v: %s); keeping the current daemon", execPath, err, strings.TrimSpace(string(out))),
 		}
 	}
+	if err := ch.stateManager.Save(); err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to save state before restart: %v", err)}
+	}
 
-	log.Printf("New daemon process started (pid %d), shutting down current...", cmd.Process.Pid)
-
-	// Minimal delay to let the new process bind the socket if necessary
-	time.Sleep(100 * time.Millisecond)
-	ch.Shutdown()
-
-	return types.Response{Success: true, Message: "daemon restarted"}
+	log.Printf("Restarting daemon in place (pid %d)...", os.Getpid())
+	go func() {
+		if err := ch.reexec(execPath); err != nil {
+			log.Printf("[restart] Handoff failed, still serving from pid %d: %v", os.Getpid(), err)
+		}
+	}()
+	return types.Response{Success: true, Message: fmt.Sprintf("daemon restarting in place (pid %d); the socket stays open", os.Getpid())}
 }
 
 func (ch *CommandHandler) Shutdown() {
@@ -271,22 +397,10 @@ func (ch *CommandHandler) setUpCaddy(args map[string]interface{}) types.Response
 		}
 	}
 
-	if err := os.WriteFile("/etc/caddy/Caddyfile", caddyfileContent, 0o600); err != nil {
+	if err := ch.caddyManager.ApplyMainCaddyfile(caddyfileContent); err != nil {
 		return types.Response{
 			Success: false,
-			Message: fmt.Sprintf("failed to write /etc/caddy/Caddyfile: %v", err),
-		}
-	}
-
-	systemctl := resolveTool("systemctl")
-	if out, err := exec.Command("caddy", "reload", "--config", "/etc/caddy/Caddyfile").CombinedOutput(); err != nil {
-		log.Printf("caddy reload failed (%v: %s), attempting systemctl start...", err, string(out))
-		// #nosec G204
-		if out2, err2 := exec.Command(systemctl, "start", "caddy").CombinedOutput(); err2 != nil {
-			return types.Response{
-				Success: false,
-				Message: fmt.Sprintf("failed to start Caddy service: %v — %s", err2, string(out2)),
-			}
+			Message: fmt.Sprintf("failed to apply Caddyfile: %v", err),
 		}
 	}
 
@@ -294,7 +408,7 @@ func (ch *CommandHandler) setUpCaddy(args map[string]interface{}) types.Response
 	return types.Response{Success: true, Message: "Caddy configured and running"}
 }
 
-func (ch *CommandHandler) handleShip(args map[string]interface{}) types.Response {
+func (ch *CommandHandler) handleShip(args map[string]interface{}, deadline time.Time) types.Response {
 	// Auto-update check before processing deployment
 	// This ensures the daemon updates itself when a new version is available
 	go func() {
@@ -305,17 +419,40 @@ func (ch *CommandHandler) handleShip(args map[string]interface{}) types.Response
 		}
 	}()
 
+	// The shipped env file holds plaintext secrets. installShipEnv copies it
+	// into the release, but any earlier failure must not leave it behind.
+	if envFile, ok := StringArg(args, "envFile"); ok && envFile != "" {
+		defer removeUpload(envFile)
+	}
+
+	if channel, ok := StringArg(args, "channel"); ok && channel != "" {
+		return ch.shipChannel(channel, args, deadline)
+	}
+
 	tarballPath, ok := StringArg(args, "tarball")
 	if !ok {
-		return types.Response{Success: false, Message: "missing 'tarball' argument"}
+		return types.Response{Success: false, Message: "missing 'tarball' or 'channel' argument"}
 	}
+	return ch.shipTarball(tarballPath, true, args, deadline)
+}
 
+// shipTarball verifies and unpacks a tarball from the uploads directory and
+// deploys it. consume removes the tarball once its release is live.
+func (ch *CommandHandler) shipTarball(tarballPath string, consume bool, args map[string]interface{}, deadline time.Time) types.Response {
 	// Path sanitization
 	tarballPath = filepath.Clean(tarballPath)
-	if !strings.HasPrefix(tarballPath, uploadsDir) {
+	if !withinDir(tarballPath, uploadsDir) {
 		return types.Response{Success: false, Message: "security error: tarball path must be within uploads directory"}
 	}
 
+	// The CLI hashes the tarball before upload; refuse to unpack anything else.
+	if want, ok := StringArg(args, "sha256"); ok && want != "" {
+		if err := shared.VerifyFileSHA256(tarballPath, want); err != nil {
+			return types.Response{Success: false, Message: fmt.Sprintf("artifact verification failed, aborting deploy: %v", err)}
+		}
+		log.Printf("[ship] Verified tarball sha256 %s", want)
+	}
+
 	log.Printf("[ship] Starting deployment from: %s", tarballPath)
 
 	// Ensure workTmpDir exists
@@ -327,19 +464,16 @@ func (ch *CommandHandler) handleShip(args map[string]interface{}) types.Response
 	if err != nil {
 		return types.Response{Success: false, Message: fmt.Sprintf("failed to create temp dir in %s: %v", workTmpDir, err)}
 	}
-	cleanupTmp := true
-	defer func() {
-		if cleanupTmp {
-			_ = os.RemoveAll(tmpDir)
-		}
-	}()
+	// A no-op once the release has been moved out of it.
+	defer func() { _ = os.RemoveAll(tmpDir) }()
 
 	log.Printf("[ship] Extracting to %s...", tmpDir)
 	if err := shared.ExtractTarGz(tarballPath, tmpDir); err != nil {
 		return types.Response{Success: false, Message: fmt.Sprintf("extraction failed: %v", err)}
 	}
 
-	meta, err := readMetadata(tmpDir)
+	commit, _ := StringArg(args, "commit")
+	meta, err := ch.shipMetadata(tmpDir, commit)
 	if err != nil {
 		return types.Response{Success: false, Message: fmt.Sprintf("metadata error: %v", err)}
 	}
@@ -349,31 +483,92 @@ func (ch *CommandHandler) handleShip(args map[string]interface{}) types.Response
 		return types.Response{Success: false, Message: err.Error()}
 	}
 
+	if !consume {
+		tarballPath = ""
+	}
+
+	// The app is only known from the tarball, so ship scopes its
+	// idempotency key here rather than in HandleCommand.
+	if key, ok := StringArg(args, "idempotency_key"); ok && key != "" {
+		return ch.idempotency.Do(appName, key, "ship", func() types.Response {
+			return ch.deployShipped(appName, meta, tmpDir, tarballPath, args, deadline)
+		})
+	}
+	return ch.deployShipped(appName, meta, tmpDir, tarballPath, args, deadline)
+}
+
+// deployShipped turns a verified, unpacked ship tarball into a release of
+// appName and activates it. A non-empty tarballPath is removed once the
+// release is live.
+func (ch *CommandHandler) deployShipped(appName string, meta *nextcore.NextCorePayload, tmpDir, tarballPath string, args map[string]interface{}, deadline time.Time) types.Response {
 	// Serialize mutating ops per app: a concurrent ship/rollback/destroy for the
 	// same app must not interleave symlink flips or port writes.
 	release, ok := ch.deployLocks.tryAcquire(appName)
 	if !ok {
-		return types.Response{Success: false, Message: fmt.Sprintf("another deploy or rollback for %q is already in progress", appName)}
+		return busyResponse(appName)
 	}
 	defer release()
 
+	// Bound deploys across apps; beyond the limit, wait in arrival order.
+	queueWait := deployQueueWait(deadline, time.Now())
+	queueCtx, cancelQueue := context.WithTimeout(context.Background(), queueWait)
+	defer cancelQueue()
+	queuedAt := time.Now()
+	queued := false
+	releaseSlot, err := ch.deployQueue.acquire(queueCtx, appName, func(position int) {
+		queued = true
+		log.Printf("[ship] %s queued at position %d; %d deploy(s) already running", appName, position, ch.deployQueue.limit)
+	})
+	if err != nil {
+		return retryableResponse(fmt.Sprintf("%s waited %s for a deploy slot; the host is busy, try again later (see `nextdeployd queue`)", appName, queueWait.Round(time.Second)))
+	}
+	defer releaseSlot()
+	if queued {
+		log.Printf("[ship] %s left the queue after %s", appName, time.Since(queuedAt).Round(time.Second))
+	}
+
 	domain := Coalesce(meta.Domain, "localhost")
 	if err := validateDomain(domain); err != nil {
 		return types.Response{Success: false, Message: err.Error()}
 	}
+	for _, alias := range meta.DomainAliases {
+		if err := validateDomain(alias); err != nil {
+			return types.Response{Success: false, Message: fmt.Sprintf("domain alias %q: %v", alias, err)}
+		}
+	}
+	if r := meta.DomainRedirect; r != "" && r != "www" && r != "apex" {
+		return types.Response{Success: false, Message: fmt.Sprintf("invalid domain redirect %q", r)}
+	}
+	if err := meta.Hooks.Validate(); err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("app.%v", err)}
+	}
+	if err := config.CheckCaddyDirectives(meta.CaddyDirectives); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	placement, err := parsePlacement(args["placement"], ch.config.PlacementKeys)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	devices, err := parseDevices(args["gpus"], args["devices"], ch.config.AllowedDevices)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	canaryWeight, err := shipCanaryWeight(args, appName, string(meta.OutputMode))
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
 
 	outputMode := string(meta.OutputMode)
 
 	log.Printf("[ship] App=%s domain=%s mode=%s pkg=%s", appName, domain, outputMode, meta.PackageManager)
 
 	// Release IDs are {unix-timestamp}-{shortSha}. The leading timestamp keeps
-	// lexicographic ordering aligned with chronological ordering (so the existing
-	// sort.Strings rollback walk still works), while the trailing short SHA gives
+	// compareReleaseIDs ordering aligned with chronological ordering (so the
+	// rollback walk still works), while the trailing short SHA gives
 	// a human-readable identity for operators and lets --toCommit lookups avoid
 	// reading every metadata.json. Falls back to "nogit" when the build had no
 	// git context (e.g. CI without a checkout).
-	timestamp := time.Now().Unix()
-	releaseID := fmt.Sprintf("%d-%s", timestamp, shortSha(meta.GitCommit))
+	releaseID := nextReleaseID(filepath.Join(appsDir, appName, "releases"), time.Now().Unix(), meta.GitCommit)
 	releaseDir := filepath.Join(appsDir, appName, "releases", releaseID)
 
 	// #nosec G301 G703
@@ -396,12 +591,30 @@ func (ch *CommandHandler) handleShip(args map[string]interface{}) types.Response
 			return types.Response{Success: false, Message: fmt.Sprintf("failed to move release: %v", err)}
 		}
 	}
-	cleanupTmp = false
 
 	// Fix permissions and ownership for the release directory
 	ch.ensureDirPermissions(releaseDir)
 
+	if err := writePlacement(filepath.Join(appsDir, appName), releaseID, placement); err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to record placement: %v", err)}
+	}
+	if err := writeDevices(filepath.Join(appsDir, appName), releaseID, devices); err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to record devices: %v", err)}
+	}
+
+	if envFile, ok := StringArg(args, "envFile"); ok && envFile != "" {
+		if err := installShipEnv(envFile, releaseDir); err != nil {
+			return types.Response{Success: false, Message: fmt.Sprintf("failed to install shipped env file: %v", err)}
+		}
+	}
+
 	dopplerToken, _ := StringArg(args, "dopplerToken")
+	readinessTimeout := parseReadinessTimeout(meta.ReadinessTimeout)
+	if raw, ok := StringArg(args, "readinessTimeout"); ok && raw != "" {
+		readinessTimeout = parseReadinessTimeout(raw)
+	}
+	failLogLines := failLogLinesArg(args)
+	printUnit, _ := args["printUnit"].(bool)
 	log.Printf("[ship] %s extracted to %s, activating...", appName, releaseDir)
 
 	ctx := ReleaseContext{
@@ -418,27 +631,77 @@ func (ch *CommandHandler) handleShip(args map[string]interface{}) types.Response
 		ExportDir:        meta.ExportDir,
 		Resources:        meta.Resources,
 		HealthPath:       meta.HealthPath,
+		ReadinessTimeout: readinessTimeout,
+		Start:            meta.Start,
+		Volumes:          meta.Volumes,
+		Stop:             meta.Stop,
+		CaddyDirectives:  meta.CaddyDirectives,
+		DomainAliases:    meta.DomainAliases,
+		DomainRedirect:   meta.DomainRedirect,
+		FailLogLines:     failLogLines,
+		Hooks:            meta.Hooks,
+		Placement:        placement,
+		Devices:          devices,
+		PrintUnit:        printUnit,
+		CanaryWeight:     canaryWeight,
+		Deadline:         deadline,
 	}
 	return ch.activateRelease(ctx)
 }
 
 type ReleaseContext struct {
-	AppName          string
-	Domain           string
-	ReleaseDir       string
-	ReleaseID        string
-	OutputMode       string
-	DopplerToken     string
-	PackageManager   string
+	AppName        string
+	Domain         string
+	ReleaseDir     string
+	ReleaseID      string
+	OutputMode     string
+	DopplerToken   string
+	PackageManager string
+	// TarballPath is the uploaded tarball, removed once the release is live.
+	// Empty on rollback and for a channel ship, whose tarball stays put.
 	TarballPath      string
 	DetectedFeatures *nextcore.DetectedFeatures
 	DistDir          string
 	ExportDir        string
 	Resources        *config.ResourceLimits
 	HealthPath       string
+	ReadinessTimeout time.Duration
+	Start            *config.StartCommand
+	Volumes          []config.Volume
+	Stop             *config.StopPolicy
+	CaddyDirectives  string
+	DomainAliases    []string
+	DomainRedirect   string
+	// FailLogLines is how many journal lines of the release unit to attach
+	// when it fails to start or become ready; 0 attaches none.
+	FailLogLines int
+	// Hooks run around a new release: pre_deploy before its unit starts,
+	// post_deploy once it is live. Nil on rollback, which re-activates a
+	// release whose hooks already ran.
+	Hooks *config.DeployHooks
+	// Placement labels the release (env, zone) in its unit for monitoring
+	// and, later, multi-host scheduling.
+	Placement map[string]string
+	// Devices are the host device nodes the release's unit may use; they
+	// are checked against allowed_devices again on every activation.
+	Devices []string
+	// PrintUnit returns the release's systemd unit, exactly as written, in
+	// the response. It holds no secrets: those live in the EnvironmentFile.
+	PrintUnit bool
+	// CanaryWeight, when non-zero, starts the release as a canary next to
+	// the live one, taking this percentage of requests, instead of
+	// activating it (see activateCanary).
+	CanaryWeight int
+	// Deadline is when the client stops waiting for the command; hooks are
+	// cut short to finish before it. Zero means no bound.
+	Deadline time.Time
 }
 
 func (ch *CommandHandler) activateRelease(ctx ReleaseContext) types.Response {
+	if ctx.CanaryWeight > 0 {
+		return ch.activateCanary(ctx)
+	}
+
 	// Host runtime drift: records the baseline on first deploy; on later deploys
 	// warns loudly if Node/glibc/arch changed out from under the compiled
 	// artifact (e.g. an apt upgrade). Streams to the operator's CLI.
@@ -455,8 +718,14 @@ func (ch *CommandHandler) activateRelease(ctx ReleaseContext) types.Response {
 	// Port selection with persistence
 	port := ch.stateManager.GetPort(ctx.AppName)
 	var cleanupPort func() error
+	if owner := ch.stateManager.PortOwner(port, ctx.AppName); port != 0 && owner != "" {
+		log.Printf("[activate] Warning: persisted port %d for %s is also claimed by %s, reallocating", port, ctx.AppName, owner)
+		port = 0
+	}
 	if port == 0 || !isPortAvailable(port) {
-		p, closePort, err := findFreePort()
+		p, closePort, err := findUnclaimedPort(func(p int) string {
+			return ch.stateManager.PortOwner(p, ctx.AppName)
+		})
 		if err != nil {
 			return types.Response{Success: false, Message: fmt.Sprintf("failed to allocate port: %v", err)}
 		}
@@ -486,8 +755,36 @@ func (ch *CommandHandler) activateRelease(ctx ReleaseContext) types.Response {
 		return types.Response{Success: false, Message: fmt.Sprintf("failed to render secrets env file: %v", err)}
 	}
 
+	mounts, err := ch.resolveVolumes(ctx.AppName, ctx.ReleaseDir, ctx.Volumes)
+	if err != nil {
+		ch.stateManager.SetPort(ctx.AppName, 0)
+		_ = ch.stateManager.Save()
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	devices, err := resolveDevices(ctx.Devices, ch.config.AllowedDevices)
+	if err != nil {
+		ch.stateManager.SetPort(ctx.AppName, 0)
+		_ = ch.stateManager.Save()
+		return types.Response{Success: false, Message: err.Error()}
+	}
+
+	var hookResults []hookResult
+	if ctx.Hooks != nil && len(ctx.Hooks.PreDeploy) > 0 {
+		results, err := runHooks("pre_deploy", ctx.Hooks.PreDeploy, ctx.ReleaseDir, mounts, ctx.Deadline)
+		hookResults = results
+		if err != nil {
+			ch.stateManager.SetPort(ctx.AppName, 0)
+			_ = ch.stateManager.Save()
+			return types.Response{
+				Success: false,
+				Message: fmt.Sprintf("deploy aborted: %v; the live release is unchanged%s", err, hookSummary(results)),
+				Data:    map[string]any{"hooks": results},
+			}
+		}
+	}
+
 	serviceName, serviceGenerated, err = ch.processManager.GenerateServiceFile(
-		ctx.AppName, ctx.ReleaseDir, ctx.OutputMode, ctx.DopplerToken, port, ctx.PackageManager, ctx.ReleaseID, ctx.Resources,
+		ctx.AppName, ctx.ReleaseDir, ctx.OutputMode, ctx.DopplerToken, port, ctx.PackageManager, ctx.ReleaseID, ctx.Resources, ctx.Start, mounts, ctx.Stop, ctx.Placement, devices,
 	)
 	if err != nil {
 		ch.stateManager.SetPort(ctx.AppName, 0)
@@ -495,6 +792,14 @@ func (ch *CommandHandler) activateRelease(ctx ReleaseContext) types.Response {
 		return types.Response{Success: false, Message: fmt.Sprintf("failed to generate service file: %v", err)}
 	}
 
+	var unitText string
+	if serviceGenerated && ctx.PrintUnit {
+		// #nosec G304 -- the unit GenerateServiceFile just wrote
+		if data, err := os.ReadFile(filepath.Join(ch.processManager.systemdDir, serviceName)); err == nil {
+			unitText = string(data)
+		}
+	}
+
 	if serviceGenerated {
 		// Port release: we must close our listener BEFORE starting the service so it can bind to the port
 		if portAcquired != 0 && cleanupPort != nil {
@@ -504,24 +809,34 @@ func (ch *CommandHandler) activateRelease(ctx ReleaseContext) types.Response {
 		}
 
 		if err := ch.processManager.StartService(serviceName); err != nil {
+			resp := ch.failedReleaseResponse(fmt.Sprintf("failed to start service: %v", err), serviceName, ctx.FailLogLines)
 			_ = ch.processManager.RemoveService(serviceName)
 			ch.stateManager.SetPort(ctx.AppName, 0)
 			_ = ch.stateManager.Save()
-			return types.Response{Success: false, Message: fmt.Sprintf("failed to start service: %v", err)}
+			return resp
 		}
 	}
 
-	log.Printf("[activate] Waiting for app to become healthy on port %d...", port)
-	if err := waitForHealthy(port, ctx.HealthPath, 5*time.Minute); err != nil {
+	readinessTimeout := ctx.ReadinessTimeout
+	if readinessTimeout <= 0 {
+		readinessTimeout = defaultReadinessTimeout
+	}
+	log.Printf("[activate] Waiting up to %s for app to become ready on port %d...", readinessTimeout, port)
+	timeToReady, err := waitForHealthy(port, ctx.HealthPath, readinessTimeout)
+	if err != nil {
 		log.Printf("[activate] Health check failed on port %d, cleaning up...", port)
+		// Read the journal before the unit is removed; it usually holds the
+		// crash reason.
+		resp := ch.failedReleaseResponse(fmt.Sprintf("release never became ready: %v", err), serviceName, ctx.FailLogLines)
 		if serviceGenerated {
 			_ = ch.processManager.RemoveService(serviceName)
 		}
 		// Release the port back to the pool
 		ch.stateManager.SetPort(ctx.AppName, 0)
 		_ = ch.stateManager.Save()
-		return types.Response{Success: false, Message: fmt.Sprintf("health check failed after 5m: %v", err)}
+		return resp
 	}
+	log.Printf("[activate] Release %s ready on port %d after %s", ctx.ReleaseID, port, timeToReady.Round(time.Millisecond))
 
 	// Port is now in use by the healthy service - close our listener if it was still open
 	if portAcquired != 0 && cleanupPort != nil {
@@ -543,43 +858,16 @@ func (ch *CommandHandler) activateRelease(ctx ReleaseContext) types.Response {
 		return types.Response{Success: false, Message: fmt.Sprintf("failed to create atomic symlink: %v", err)}
 	}
 
-	// Persistent Static Assets Sync
-	// We sync .next/static to a shared directory so old client sessions don't break when Caddy switches roots
-	sharedStaticDir := filepath.Join(appsDir, ctx.AppName, "shared_static")
-	sourceStaticDir := filepath.Join(ctx.ReleaseDir, ctx.DistDir, "static")
-	if _, err := os.Stat(sourceStaticDir); err == nil {
-		// #nosec G301 -- static assets dir is served by Caddy, needs group/other traversal
-		if err := os.MkdirAll(sharedStaticDir, 0o755); err == nil {
-			// Use cp -R to copy assets, overwriting existing ones to ensure newest versions are served
-			cpPath := resolveTool("cp")
-			// #nosec G204
-			cmd := exec.Command(cpPath, "-R", sourceStaticDir+string(filepath.Separator)+".", sharedStaticDir)
-			if out, err := cmd.CombinedOutput(); err != nil {
-				log.Printf("[activate] Warning: failed to sync shared static assets: %v - %s", err, string(out))
-			} else {
-				log.Printf("[activate] Synced static assets to %s", sharedStaticDir)
-				_ = exec.Command(resolveTool("chown"), "-R", "nextdeploy:nextdeploy", sharedStaticDir).Run()
-			}
-		}
-	}
+	syncSharedStatic(ctx.AppName, ctx.ReleaseDir, ctx.DistDir)
 
 	if err := os.Rename(tmpSymlink, currentSymlink); err != nil {
 		_ = os.Remove(tmpSymlink)
 		return types.Response{Success: false, Message: fmt.Sprintf("failed to rename atomic symlink: %v", err)}
 	}
 
-	if err := ch.caddyManager.EnsureMainCaddyfile(); err != nil {
-		return types.Response{Success: false, Message: fmt.Sprintf("failed to update main Caddyfile: %v", err)}
-	}
-
-	if err := ch.caddyManager.GenerateConfig(ctx.AppName, ctx.Domain, ctx.OutputMode, port, currentSymlink, ctx.DetectedFeatures, ctx.DistDir, ctx.ExportDir); err != nil {
-		return types.Response{Success: false, Message: fmt.Sprintf("failed to configure Caddy: %v", err)}
-	}
-
-	if err := ch.caddyManager.Validate(); err != nil {
-		return types.Response{Success: false, Message: fmt.Sprintf("Caddy validation failed: %v", err)}
+	if err := ch.routeSite(ctx, []caddy.Upstream{{Port: port, Weight: 1}}); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
 	}
-	_ = ch.caddyManager.Reload()
 
 	if services, err := ch.processManager.FindAppServices(ctx.AppName); err == nil {
 		for _, s := range services {
@@ -598,13 +886,83 @@ func (ch *CommandHandler) activateRelease(ctx ReleaseContext) types.Response {
 		_ = os.Remove(ctx.TarballPath)
 	}
 
+	msg := fmt.Sprintf("Successfully activated release %s for %s (ready in %s)", ctx.ReleaseID, ctx.AppName, timeToReady.Round(time.Millisecond))
+	success := true
+	if ctx.Hooks != nil && len(ctx.Hooks.PostDeploy) > 0 {
+		results, err := runHooks("post_deploy", ctx.Hooks.PostDeploy, ctx.ReleaseDir, mounts, ctx.Deadline)
+		hookResults = append(hookResults, results...)
+		if err != nil {
+			// The release is already serving; undoing that is a rollback,
+			// which is the operator's call.
+			success = false
+			msg = fmt.Sprintf("Release %s for %s is live, but %v", ctx.ReleaseID, ctx.AppName, err)
+		}
+	}
+	if len(hookResults) > 0 {
+		msg += hookSummary(hookResults)
+	}
+	data := map[string]interface{}{"releaseId": ctx.ReleaseID, "timeToReadyMs": timeToReady.Milliseconds(), "hooks": hookResults}
+	if len(devices) > 0 {
+		msg += "\nDevices: " + strings.Join(devicePaths(devices), ", ")
+		data["devices"] = devicePaths(devices)
+	}
+	if unitText != "" {
+		msg += fmt.Sprintf("\n\n# %s\n%s", serviceName, unitText)
+		data["unit"] = unitText
+	}
+
 	return types.Response{
-		Success: true,
-		Message: fmt.Sprintf("Successfully activated release %s for %s", ctx.ReleaseID, ctx.AppName),
+		Success: success,
+		Message: msg,
+		Data:    data,
 	}
 }
 
-func (ch *CommandHandler) handleRollback(args map[string]interface{}) types.Response {
+// syncSharedStatic copies a release's static assets into the app's
+// shared_static directory, which Caddy serves for every release, so clients
+// still running an older build keep loading their chunks after a switch.
+func syncSharedStatic(appName, releaseDir, distDir string) {
+	sharedStaticDir := filepath.Join(appsDir, appName, "shared_static")
+	sourceStaticDir := filepath.Join(releaseDir, distDir, "static")
+	if _, err := os.Stat(sourceStaticDir); err != nil {
+		return
+	}
+	// #nosec G301 -- static assets dir is served by Caddy, needs group/other traversal
+	if err := os.MkdirAll(sharedStaticDir, 0o755); err != nil {
+		return
+	}
+	// Use cp -R to copy assets, overwriting existing ones to ensure newest versions are served
+	cpPath := resolveTool("cp")
+	// #nosec G204
+	cmd := exec.Command(cpPath, "-R", sourceStaticDir+string(filepath.Separator)+".", sharedStaticDir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("[activate] Warning: failed to sync shared static assets: %v - %s", err, string(out))
+		return
+	}
+	log.Printf("[activate] Synced static assets to %s", sharedStaticDir)
+	_ = exec.Command(resolveTool("chown"), "-R", "nextdeploy:nextdeploy", sharedStaticDir).Run()
+}
+
+// routeSite writes the app's Caddy site for ctx, proxying to upstreams, and
+// reloads Caddy once the whole configuration validates. That replaces a
+// maintenance page, if the site had one.
+func (ch *CommandHandler) routeSite(ctx ReleaseContext, upstreams []caddy.Upstream) error {
+	if err := ch.caddyManager.EnsureMainCaddyfile(); err != nil {
+		return fmt.Errorf("failed to update main Caddyfile: %w", err)
+	}
+	currentSymlink := filepath.Join(appsDir, ctx.AppName, "current")
+	if err := ch.caddyManager.GenerateConfig(ctx.AppName, caddy.Site{Domain: ctx.Domain, Aliases: ctx.DomainAliases, Redirect: ctx.DomainRedirect}, ctx.OutputMode, upstreams, currentSymlink, ctx.DetectedFeatures, ctx.DistDir, ctx.ExportDir, ctx.CaddyDirectives); err != nil {
+		return fmt.Errorf("failed to configure Caddy: %w", err)
+	}
+	if err := ch.caddyManager.Validate(); err != nil {
+		return fmt.Errorf("Caddy validation failed: %w", err)
+	}
+	_ = ch.caddyManager.Reload()
+	clearMaintenance(ctx.AppName)
+	return nil
+}
+
+func (ch *CommandHandler) handleRollback(args map[string]interface{}, deadline time.Time) types.Response {
 	appName, ok := StringArg(args, "appName")
 	if !ok {
 		return types.Response{Success: false, Message: "missing 'appName' argument"}
@@ -613,12 +971,6 @@ func (ch *CommandHandler) handleRollback(args map[string]interface{}) types.Resp
 		return types.Response{Success: false, Message: err.Error()}
 	}
 
-	release, ok := ch.deployLocks.tryAcquire(appName)
-	if !ok {
-		return types.Response{Success: false, Message: fmt.Sprintf("another deploy or rollback for %q is already in progress", appName)}
-	}
-	defer release()
-
 	// Optional rollback selectors. JSON-over-socket decodes numbers as float64.
 	steps := 1
 	if v, ok := args["steps"].(float64); ok && v > 0 {
@@ -629,44 +981,56 @@ func (ch *CommandHandler) handleRollback(args map[string]interface{}) types.Resp
 		return types.Response{Success: false, Message: "--toCommit and --steps are mutually exclusive"}
 	}
 
-	releasesDir := filepath.Join(appsDir, appName, "releases")
-	entries, err := os.ReadDir(releasesDir)
-	if err != nil {
-		return types.Response{Success: false, Message: fmt.Sprintf("failed to read releases: %v", err)}
+	if dryRun, _ := args["dryRun"].(bool); dryRun {
+		return rollbackDryRun(appName, steps, toCommit)
 	}
 
-	var releases []string
-	for _, e := range entries {
-		if e.IsDir() {
-			releases = append(releases, e.Name())
-		}
+	release, ok := ch.deployLocks.tryAcquire(appName)
+	if !ok {
+		return busyResponse(appName)
 	}
+	defer release()
 
-	if len(releases) < 2 {
-		return types.Response{Success: false, Message: "not enough releases to rollback"}
+	if st, err := readCanary(appName); err != nil || st != nil {
+		return types.Response{Success: false, Message: canaryInProgress(appName, st, err)}
 	}
 
-	// Lex sort works because releaseID is {unix-ts}-{shortSha}; the timestamp
-	// prefix preserves chronological order. Legacy bare-timestamp release dirs
-	// from older daemon versions still sort correctly because they share the
-	// same numeric leading segment.
-	sort.Strings(releases)
-
-	previousReleaseID, err := resolveRollbackTarget(releasesDir, releases, steps, toCommit)
+	plan, err := planRollback(filepath.Join(appsDir, appName), steps, toCommit)
 	if err != nil {
 		return types.Response{Success: false, Message: err.Error()}
 	}
-	previousReleaseDir := filepath.Join(releasesDir, previousReleaseID)
-
-	meta, err := readMetadata(previousReleaseDir)
-	if err != nil {
-		return types.Response{Success: false, Message: fmt.Sprintf("failed to read metadata of previous release: %v", err)}
-	}
+	previousReleaseID := plan.Target
+	previousReleaseDir := filepath.Join(appsDir, appName, "releases", previousReleaseID)
+	meta := plan.targetMeta
 
 	domain := Coalesce(meta.Domain, "localhost")
 	outputMode := string(meta.OutputMode)
 	dopplerToken, _ := StringArg(args, "dopplerToken")
 
+	// pre_rollback hooks belong to the release being rolled back from: it is
+	// the one that knows how to undo itself (e.g. down migrations).
+	var hookResults []hookResult
+	if liveDir, err := filepath.EvalSymlinks(filepath.Join(appsDir, appName, "current")); err == nil {
+		if live, err := readMetadata(liveDir); err == nil && live.Hooks != nil && len(live.Hooks.PreRollback) > 0 {
+			if err := live.Hooks.Validate(); err != nil {
+				return types.Response{Success: false, Message: fmt.Sprintf("app.%v", err)}
+			}
+			mounts, err := ch.resolveVolumes(appName, liveDir, live.Volumes)
+			if err != nil {
+				return types.Response{Success: false, Message: err.Error()}
+			}
+			results, err := runHooks("pre_rollback", live.Hooks.PreRollback, liveDir, mounts, deadline)
+			hookResults = results
+			if err != nil {
+				return types.Response{
+					Success: false,
+					Message: fmt.Sprintf("rollback aborted: %v; the live release is unchanged%s", err, hookSummary(results)),
+					Data:    map[string]any{"hooks": results},
+				}
+			}
+		}
+	}
+
 	log.Printf("[rollback] Reverting %s to release %s", appName, previousReleaseID)
 
 	ctx := ReleaseContext{
@@ -683,8 +1047,23 @@ func (ch *CommandHandler) handleRollback(args map[string]interface{}) types.Resp
 		ExportDir:        meta.ExportDir,
 		Resources:        meta.Resources,
 		HealthPath:       meta.HealthPath,
+		ReadinessTimeout: parseReadinessTimeout(meta.ReadinessTimeout),
+		Start:            meta.Start,
+		Volumes:          meta.Volumes,
+		Stop:             meta.Stop,
+		CaddyDirectives:  meta.CaddyDirectives,
+		DomainAliases:    meta.DomainAliases,
+		DomainRedirect:   meta.DomainRedirect,
+		FailLogLines:     defaultFailLogLines,
+		Placement:        readPlacement(filepath.Join(appsDir, appName), previousReleaseID),
+		Devices:          readDevices(filepath.Join(appsDir, appName), previousReleaseID),
+		Deadline:         deadline,
+	}
+	resp := ch.activateRelease(ctx)
+	if len(hookResults) > 0 {
+		resp.Message += hookSummary(hookResults)
 	}
-	return ch.activateRelease(ctx)
+	return resp
 }
 
 // shortSha returns a 7-char prefix of a git commit hash, or "nogit" when the
@@ -700,6 +1079,48 @@ func shortSha(full string) string {
 	return full
 }
 
+// nextReleaseID returns "{ts}-{shortSha}" for a new release, adding a ".N"
+// suffix only when that directory already exists — re-shipping the same commit
+// within one second would otherwise move the new tree onto the old release.
+// compareReleaseIDs sorts the suffix after the bare ID, so chronological
+// ordering holds.
+func nextReleaseID(releasesDir string, ts int64, commit string) string {
+	base := fmt.Sprintf("%d-%s", ts, shortSha(commit))
+	id := base
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(filepath.Join(releasesDir, id)); os.IsNotExist(err) {
+			return id
+		}
+		id = fmt.Sprintf("%s.%d", base, n)
+	}
+}
+
+// compareReleaseIDs orders release IDs oldest first: by "{ts}-{shortSha}",
+// then by the ".N" suffix of nextReleaseID as a number, so ".10" follows
+// ".9" instead of ".1". Unit names of one app compare the same way.
+func compareReleaseIDs(a, b string) int {
+	aBase, aN := splitReleaseSuffix(strings.TrimSuffix(a, ".service"))
+	bBase, bN := splitReleaseSuffix(strings.TrimSuffix(b, ".service"))
+	if c := strings.Compare(aBase, bBase); c != 0 {
+		return c
+	}
+	return aN - bN
+}
+
+// splitReleaseSuffix splits "{ts}-{shortSha}.N" into the bare ID and N; an
+// ID without a suffix has N 0.
+func splitReleaseSuffix(id string) (string, int) {
+	i := strings.LastIndexByte(id, '.')
+	if i < 0 {
+		return id, 0
+	}
+	n, err := strconv.Atoi(id[i+1:])
+	if err != nil || n < 0 {
+		return id, 0
+	}
+	return id[:i], n
+}
+
 // resolveRollbackTarget picks the release directory to roll back to. The
 // `releases` slice must already be sorted oldest-first. The active deployment
 // is the last entry; it is never returned.
@@ -747,6 +1168,45 @@ func resolveRollbackTarget(releasesDir string, releases []string, steps int, toC
 
 // ExtractTarGz is now handled universally by shared.ExtractTarGz
 
+// shipMetadata reads the metadata of the tarball unpacked in unpackDir. A
+// tarball without one falls back to the metadata published for commit in the
+// metadata store, which is written into unpackDir so the release carries its
+// metadata.json like any other (status, rollback and --toCommit read it).
+func (ch *CommandHandler) shipMetadata(unpackDir, commit string) (*nextcore.NextCorePayload, error) {
+	meta, err := readMetadata(unpackDir)
+	if err == nil {
+		return meta, nil
+	}
+	if commit == "" || ch.config.MetadataStore == nil {
+		return nil, err
+	}
+	if meta, err = ch.fetchMetadata(commit); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G306 -- build metadata holds no secrets
+	if err := os.WriteFile(filepath.Join(unpackDir, "metadata.json"), data, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write metadata.json: %w", err)
+	}
+	log.Printf("[ship] Using metadata published for commit %s", commit)
+	return meta, nil
+}
+
+// fetchMetadata loads a release's metadata from the configured metadata
+// store, for tarballs built on another host (see config.MetadataStoreConfig).
+func (ch *CommandHandler) fetchMetadata(commit string) (*nextcore.NextCorePayload, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	store, err := nextcore.NewMetadataStore(ctx, ch.config.MetadataStore)
+	if err != nil {
+		return nil, err
+	}
+	return nextcore.FetchMetadata(ctx, store, commit)
+}
+
 func readMetadata(unpackDir string) (*nextcore.NextCorePayload, error) {
 	candidates := []string{
 		filepath.Join(unpackDir, nextdeployDir, "metadata.json"),
@@ -785,13 +1245,96 @@ func findFreePort() (int, func() error, error) {
 	return port, ln.Close, nil
 }
 
+// defaultReadinessTimeout bounds how long a new release may take to pass its
+// health probe when nextdeploy.yml does not set app.readiness_timeout.
+const defaultReadinessTimeout = 5 * time.Minute
+
+// parseReadinessTimeout reads app.readiness_timeout from the release metadata,
+// falling back to the default when it is unset or malformed.
+func parseReadinessTimeout(raw string) time.Duration {
+	if raw == "" {
+		return defaultReadinessTimeout
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Printf("[activate] Warning: ignoring invalid readiness_timeout %q, using %s", raw, defaultReadinessTimeout)
+		return defaultReadinessTimeout
+	}
+	return d
+}
+
+// defaultFailLogLines is how much of a failed release's journal a ship or
+// rollback response carries when the caller does not ask for a size.
+const defaultFailLogLines = 50
+
+// failLogLinesArg is the failLogLines argument of a ship: how many journal
+// lines to attach when the release fails, 0 for none. A missing, negative
+// or non-numeric value means defaultFailLogLines.
+func failLogLinesArg(args map[string]any) int {
+	if v, ok := args["failLogLines"].(float64); ok && v >= 0 {
+		return int(v)
+	}
+	return defaultFailLogLines
+}
+
+// failedReleaseResponse builds the failure response for a release unit that
+// did not start or become ready, attaching the last n lines of its journal so
+// the operator (or a CI log) sees why without a second command.
+func (ch *CommandHandler) failedReleaseResponse(msg, serviceName string, n int) types.Response {
+	resp := types.Response{Success: false, Message: msg}
+	if n <= 0 || serviceName == "" {
+		return resp
+	}
+	logs, err := ch.processManager.TailLogs(serviceName, n)
+	if err != nil {
+		log.Printf("[activate] Warning: could not read logs of %s: %v", serviceName, err)
+		return resp
+	}
+	if logs = strings.TrimRight(logs, "\n"); logs != "" {
+		resp.Message = fmt.Sprintf("%s\n--- last %d log lines of %s ---\n%s", msg, n, serviceName, logs)
+		resp.Data = map[string]any{"unit": serviceName, "logs": logs}
+	}
+	return resp
+}
+
+// findUnclaimedPort asks the kernel for free ports until it gets one that
+// claimedBy reports as unowned, so a new app never takes the persisted port of
+// another app that merely happens to be stopped. Rejected listeners stay open
+// until the search ends so the kernel cannot hand the same port back.
+func findUnclaimedPort(claimedBy func(port int) string) (int, func() error, error) {
+	const maxAttempts = 10
+
+	var rejected []func() error
+	defer func() {
+		for _, closeFn := range rejected {
+			_ = closeFn()
+		}
+	}()
+
+	var conflicts []string
+	for range maxAttempts {
+		port, closePort, err := findFreePort()
+		if err != nil {
+			return 0, nil, err
+		}
+		owner := claimedBy(port)
+		if owner == "" {
+			return port, closePort, nil
+		}
+		rejected = append(rejected, closePort)
+		conflicts = append(conflicts, fmt.Sprintf("%d (%s)", port, owner))
+	}
+	return 0, nil, fmt.Errorf("port conflict: every candidate port is already assigned to another app: %s", strings.Join(conflicts, ", "))
+}
+
 // waitForHealthy gates the cutover. It first waits for the port to accept a TCP
 // connection (fast-fail while the process is still starting), then escalates to
 // an HTTP GET on healthPath and requires a status < 500. A Next.js process can
 // accept TCP while returning 500 on every request (bad env, failed DB connect,
 // broken ISR) — the HTTP probe stops the daemon from flipping `current` onto a
-// release that is "up" but serving errors. healthPath defaults to "/".
-func waitForHealthy(port int, healthPath string, timeout time.Duration) error {
+// release that is "up" but serving errors. healthPath defaults to "/". On
+// success it returns how long the release took to become ready.
+func waitForHealthy(port int, healthPath string, timeout time.Duration) (time.Duration, error) {
 	if healthPath == "" {
 		healthPath = "/"
 	}
@@ -800,9 +1343,10 @@ func waitForHealthy(port int, healthPath string, timeout time.Duration) error {
 	}
 	addr := fmt.Sprintf("127.0.0.1:%d", port)
 	url := fmt.Sprintf("http://%s%s", addr, healthPath)
-	deadline := time.Now().Add(timeout)
+	start := time.Now()
+	deadline := start.Add(timeout)
 
-	client := &http.Client{Timeout: 3 * time.Second}
+	client := httpx.New(httpx.Options{Timeout: 3 * time.Second})
 	backoff := 100 * time.Millisecond
 	maxBackoff := 2 * time.Second
 
@@ -818,7 +1362,7 @@ func waitForHealthy(port int, healthPath string, timeout time.Duration) error {
 			if herr == nil {
 				_ = resp.Body.Close()
 				if resp.StatusCode < 500 {
-					return nil
+					return time.Since(start), nil
 				}
 				log.Printf("[activate] %s returned %d, still waiting for a healthy response...", url, resp.StatusCode)
 			}
@@ -830,7 +1374,7 @@ func waitForHealthy(port int, healthPath string, timeout time.Duration) error {
 			backoff = maxBackoff
 		}
 	}
-	return fmt.Errorf("app did not become healthy on %s within %s", url, timeout)
+	return 0, fmt.Errorf("app did not become healthy on %s within %s", url, timeout)
 }
 
 func pruneReleases(appName string, keep int) error {
@@ -847,8 +1391,8 @@ func pruneReleases(appName string, keep int) error {
 	// returns lexically-sorted names, but relying on that ordering is brittle:
 	// a single non-conforming dir name (legacy bare-timestamp, manual dir) could
 	// otherwise prune the wrong release. The release-ID scheme {unix-ts}-{sha}
-	// makes lexical order == chronological order, so sort.Strings is canonical —
-	// mirroring the explicit sort in handleRollback.
+	// makes compareReleaseIDs order == chronological order, so it is canonical —
+	// mirroring the explicit sort in releaseHistory.
 	var names []string
 	for _, entry := range entries {
 		if entry.IsDir() {
@@ -874,7 +1418,7 @@ func releasesToPrune(names []string, keep int) []string {
 		return nil
 	}
 	sorted := append([]string(nil), names...)
-	sort.Strings(sorted)
+	slices.SortFunc(sorted, compareReleaseIDs)
 	return sorted[:len(sorted)-keep]
 }
 
@@ -963,21 +1507,32 @@ func (ch *CommandHandler) ensureDirPermissions(root string) {
 	// this pass over the whole app dir, so without the exclusion the live
 	// release's env file would become world-readable one deploy later.
 	//nolint:gosec,noctx // fixed args + resolved system binaries; a deploy-time find/chmod, context cancellation not needed
-	chmodFileCmd := exec.Command(findPath, root, "-type", "f", "!", "-name", ".env.nextdeploy", "!", "-perm", "0644", "-exec", chmodPath, "0644", "{}", "+")
+	chmodFileCmd := exec.Command(findPath, root, "-type", "f", "!", "-name", ".env.nextdeploy", "!", "-name", shipEnvFile, "!", "-perm", "0644", "-exec", chmodPath, "0644", "{}", "+")
 	if out, err := chmodFileCmd.CombinedOutput(); err != nil {
 		log.Printf("[ship] Warning: failed to chmod files in %s: %v - %s", root, err, string(out))
 	}
 }
 
 func (ch *CommandHandler) handleDestroy(args map[string]interface{}) types.Response {
+	if prefix, ok := StringArg(args, "prefix"); ok {
+		// Bulk removal is irreversible, so it must be asked for explicitly.
+		if confirm, _ := args["confirm"].(bool); !confirm {
+			return types.Response{Success: false, Message: fmt.Sprintf("refusing to destroy every app matching prefix %q without 'confirm'=true", prefix)}
+		}
+		return ch.forEachApp("destroy", prefix, keepGoing(args), ch.destroyApp)
+	}
+
 	appName, ok := StringArg(args, "appName")
 	if !ok {
-		return types.Response{Success: false, Message: "missing 'appName' argument"}
+		return types.Response{Success: false, Message: "missing 'appName' or 'prefix' argument"}
 	}
+	return ch.destroyApp(appName)
+}
 
+func (ch *CommandHandler) destroyApp(appName string) types.Response {
 	release, ok := ch.deployLocks.tryAcquire(appName)
 	if !ok {
-		return types.Response{Success: false, Message: fmt.Sprintf("another deploy or rollback for %q is already in progress", appName)}
+		return busyResponse(appName)
 	}
 	defer release()
 
@@ -1057,13 +1612,80 @@ func (ch *CommandHandler) handleDestroy(args map[string]interface{}) types.Respo
 }
 
 func (ch *CommandHandler) handleStopApp(args map[string]interface{}) types.Response {
+	override, err := stopOverride(args)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	maintenance, _ := args["maintenance"].(bool)
+	stop := func(appName string) types.Response {
+		if !maintenance {
+			return ch.stopApp(appName, override)
+		}
+		if err := validateAppName(appName); err != nil {
+			return types.Response{Success: false, Message: err.Error()}
+		}
+		if err := ch.enterMaintenance(appName); err != nil {
+			return types.Response{Success: false, Message: fmt.Sprintf("not stopping %s: %v", appName, err)}
+		}
+		resp := ch.stopApp(appName, override)
+		resp.Message += "; its site serves the maintenance page until the next ship or `nextdeployd maintenance --off`"
+		return resp
+	}
+
+	if prefix, ok := StringArg(args, "prefix"); ok {
+		return ch.forEachApp("stop", prefix, keepGoing(args), stop)
+	}
+
 	appName, ok := StringArg(args, "appName")
 	if !ok {
-		return types.Response{Success: false, Message: "missing 'appName' argument"}
+		return types.Response{Success: false, Message: "missing 'appName' or 'prefix' argument"}
 	}
+	return stop(appName)
+}
+
+// stopOverride reads the optional stop_timeout (seconds) and stop_signal
+// arguments of a stop command. Nil means the units' own app.stop policy.
+func stopOverride(args map[string]interface{}) (*config.StopPolicy, error) {
+	var stop config.StopPolicy
+	if v, ok := args["stop_timeout"]; ok {
+		secs, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("stop_timeout must be a number of seconds")
+		}
+		stop.Timeout = (time.Duration(secs) * time.Second).String()
+	}
+	if v, ok := args["stop_signal"]; ok {
+		if stop.Signal, ok = v.(string); !ok {
+			return nil, fmt.Errorf("stop_signal must be a string")
+		}
+	}
+	if stop == (config.StopPolicy{}) {
+		return nil, nil
+	}
+	if err := stop.Validate(); err != nil {
+		return nil, err
+	}
+	return &stop, nil
+}
 
+// stopApp stops every unit of appName. override, when set, replaces the
+// signal and grace period for this stop; a field it leaves empty falls back
+// to the live release's app.stop.
+func (ch *CommandHandler) stopApp(appName string, override *config.StopPolicy) types.Response {
 	log.Printf("[stop] Stopping app: %s", appName)
 
+	if override != nil {
+		merged := *override
+		if current, _, err := releaseHistory(filepath.Join(appsDir, appName)); err == nil && current != "" {
+			if meta, err := readMetadata(filepath.Join(appsDir, appName, "releases", current)); err == nil && meta.Stop != nil {
+				merged.Timeout = Coalesce(merged.Timeout, meta.Stop.Timeout)
+				merged.Signal = Coalesce(merged.Signal, meta.Stop.Signal)
+			}
+		}
+		override = &merged
+		log.Printf("[stop] Using %s with a %s grace period", override.SignalOrDefault(), override.TimeoutOrDefault())
+	}
+
 	services, err := ch.processManager.FindAppServices(appName)
 	if err != nil {
 		return types.Response{Success: false, Message: fmt.Sprintf("failed to find app services: %v", err)}
@@ -1076,7 +1698,7 @@ func (ch *CommandHandler) handleStopApp(args map[string]interface{}) types.Respo
 	var errors []string
 	for _, s := range services {
 		log.Printf("[stop] Stopping service: %s", s)
-		if err := ch.processManager.StopService(s); err != nil {
+		if err := ch.processManager.StopServiceWith(s, override); err != nil {
 			errors = append(errors, fmt.Sprintf("failed to stop service %s: %v", s, err))
 		}
 	}
@@ -1090,3 +1712,108 @@ func (ch *CommandHandler) handleStopApp(args map[string]interface{}) types.Respo
 
 	return types.Response{Success: true, Message: fmt.Sprintf("App %s stopped successfully", appName)}
 }
+
+// forEachApp runs op against every deployed app whose name starts with prefix
+// and reports the per-app outcome in Data. The overall response only succeeds
+// when every app did.
+func (ch *CommandHandler) forEachApp(action, prefix string, keepGoing bool, op func(appName string) types.Response) types.Response {
+	apps, err := listApps()
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to list apps: %v", err)}
+	}
+	matched := matchAppsByPrefix(apps, prefix)
+	if len(matched) == 0 {
+		return types.Response{Success: false, Message: fmt.Sprintf("no apps match prefix %q", prefix)}
+	}
+
+	log.Printf("[%s] Bulk %s of %d app(s) matching prefix %q", action, action, len(matched), prefix)
+	return runBulk(fmt.Sprintf("%s of apps matching %q", action, prefix), matched, keepGoing, op)
+}
+
+// keepGoing reads a bulk command's keep_going argument. It defaults to true:
+// a failure on one app does not stop the rest. With keep_going=false the
+// sweep stops at the first failure and the remaining apps are skipped.
+func keepGoing(args map[string]any) bool {
+	v, ok := args["keep_going"].(bool)
+	return !ok || v
+}
+
+// runBulk applies op to each app in order and summarises the outcomes. The
+// response succeeds only if every app did; Data holds each app's result and
+// the succeeded/failed/skipped counts.
+func runBulk(what string, apps []string, keepGoing bool, op func(appName string) types.Response) types.Response {
+	results := make(map[string]any, len(apps))
+	var lines []string
+	succeeded, failed := 0, 0
+	for i, app := range apps {
+		resp := op(app)
+		results[app] = map[string]any{"success": resp.Success, "message": resp.Message}
+		status := "ok"
+		if resp.Success {
+			succeeded++
+		} else {
+			status = "FAILED"
+			failed++
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s (%s)", app, status, resp.Message))
+		if !resp.Success && !keepGoing {
+			for _, rest := range apps[i+1:] {
+				results[rest] = map[string]any{"success": false, "skipped": true}
+				lines = append(lines, rest+": skipped")
+			}
+			break
+		}
+	}
+	skipped := len(apps) - succeeded - failed
+
+	msg := fmt.Sprintf("%s: %d succeeded, %d failed", what, succeeded, failed)
+	if skipped > 0 {
+		msg += fmt.Sprintf(", %d skipped", skipped)
+	}
+	msg += ":\n- " + strings.Join(lines, "\n- ")
+	return types.Response{
+		Success: failed == 0 && skipped == 0,
+		Message: msg,
+		Data: map[string]any{
+			"apps":      results,
+			"succeeded": succeeded,
+			"failed":    failed,
+			"skipped":   skipped,
+		},
+	}
+}
+
+// listApps returns the names of all apps with a directory under appsDir.
+func listApps() ([]string, error) {
+	entries, err := os.ReadDir(appsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var apps []string
+	for _, e := range entries {
+		if e.IsDir() {
+			apps = append(apps, e.Name())
+		}
+	}
+	return apps, nil
+}
+
+// matchAppsByPrefix returns the valid app names starting with prefix, sorted.
+// An empty prefix matches nothing so a bulk operation can never silently
+// target every app on the host.
+func matchAppsByPrefix(apps []string, prefix string) []string {
+	if prefix == "" {
+		return nil
+	}
+	var matched []string
+	for _, app := range apps {
+		if strings.HasPrefix(app, prefix) && validateAppName(app) == nil {
+			matched = append(matched, app)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
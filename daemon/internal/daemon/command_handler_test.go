@@ -1,14 +1,30 @@
 package daemon
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+	"github.com/aynaash/nextdeploy/shared"
+	"github.com/aynaash/nextdeploy/shared/caddy"
+	"github.com/aynaash/nextdeploy/shared/config"
 )
 
 func TestReleasesToPrune(t *testing.T) {
@@ -54,6 +70,312 @@ func TestReleasesToPrune(t *testing.T) {
 	}
 }
 
+func TestMatchAppsByPrefix(t *testing.T) {
+	apps := []string{"shop-staging", "blog", "shop-prod", "shop_bad", "Shop-upper"}
+
+	tests := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{name: "matches sorted", prefix: "shop-", want: []string{"shop-prod", "shop-staging"}},
+		{name: "no match", prefix: "api-", want: nil},
+		{name: "empty prefix matches nothing", prefix: "", want: nil},
+		{name: "invalid app dirs are skipped", prefix: "shop", want: []string{"shop-prod", "shop-staging"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchAppsByPrefix(apps, tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchAppsByPrefix(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseServices(t *testing.T) {
+	services := []string{
+		"nextdeploy-shop-1712345678-abc1234.service",
+		"nextdeploy-shop-1712349999-nogit.service",
+		"nextdeploy-shop.service",
+		"nextdeploy-shop-api-1712345678-abc1234.service", // a different app
+	}
+	want := []string{
+		"nextdeploy-shop-1712345678-abc1234.service",
+		"nextdeploy-shop-1712349999-nogit.service",
+		"nextdeploy-shop.service",
+	}
+	if got := releaseServices("shop", services); !reflect.DeepEqual(got, want) {
+		t.Errorf("releaseServices = %v, want %v", got, want)
+	}
+}
+
+func TestNextReleaseID(t *testing.T) {
+	dir := t.TempDir()
+	const ts = 1712345678
+	commit := "abc1234def5678"
+
+	first := nextReleaseID(dir, ts, commit)
+	if first != "1712345678-abc1234" {
+		t.Fatalf("nextReleaseID = %q, want {ts}-{shortSha}", first)
+	}
+	if got := nextReleaseID(dir, ts, ""); got != "1712345678-nogit" {
+		t.Errorf("nextReleaseID without a commit = %q, want the nogit marker", got)
+	}
+
+	// Same commit shipped twice in one second: the second gets a suffix that
+	// still sorts after the first and is still recognised as a release unit.
+	if err := os.Mkdir(filepath.Join(dir, first), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	second := nextReleaseID(dir, ts, commit)
+	if second != "1712345678-abc1234.1" {
+		t.Fatalf("colliding nextReleaseID = %q, want a .1 suffix", second)
+	}
+	if compareReleaseIDs(second, first) <= 0 {
+		t.Errorf("%q must sort after %q", second, first)
+	}
+	if got := releaseServices("shop", []string{"nextdeploy-shop-" + second + ".service"}); len(got) != 1 {
+		t.Errorf("suffixed release unit not recognised: %v", got)
+	}
+	if err := os.Mkdir(filepath.Join(dir, second), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextReleaseID(dir, ts, commit); got != "1712345678-abc1234.2" {
+		t.Errorf("third nextReleaseID = %q, want a .2 suffix", got)
+	}
+}
+
+func TestCompareReleaseIDs(t *testing.T) {
+	ids := []string{
+		"1712345679-aaa1111",
+		"1712345678-abc1234.10",
+		"1712345678-abc1234.2",
+		"1712345678-abc1234",
+		"1712345678-abc1234.9",
+		"1712345678-abc1234.1",
+	}
+	want := []string{
+		"1712345678-abc1234",
+		"1712345678-abc1234.1",
+		"1712345678-abc1234.2",
+		"1712345678-abc1234.9",
+		"1712345678-abc1234.10",
+		"1712345679-aaa1111",
+	}
+	got := slices.Clone(ids)
+	slices.SortFunc(got, compareReleaseIDs)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted release IDs = %v, want %v", got, want)
+	}
+
+	units := make([]string, len(ids))
+	for i, id := range ids {
+		units[i] = "nextdeploy-shop-" + id + ".service"
+	}
+	slices.SortFunc(units, compareReleaseIDs)
+	if last := units[len(units)-1]; last != "nextdeploy-shop-1712345679-aaa1111.service" {
+		t.Errorf("newest unit = %s", last)
+	}
+	if units[4] != "nextdeploy-shop-1712345678-abc1234.10.service" {
+		t.Errorf("units = %v, want .10 after .9", units)
+	}
+}
+
+func TestReleaseHistory(t *testing.T) {
+	appDir := t.TempDir()
+	current, releases, err := releaseHistory(appDir)
+	if err != nil || current != "" || len(releases) != 0 {
+		t.Fatalf("undeployed app: got %q, %v, %v; want no history", current, releases, err)
+	}
+
+	for _, id := range []string{"1712349999-def5678", "1712345678-abc1234"} {
+		if err := os.MkdirAll(filepath.Join(appDir, "releases", id), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(appDir, "releases", "1712349999-def5678"), filepath.Join(appDir, "current")); err != nil {
+		t.Fatal(err)
+	}
+
+	current, releases, err = releaseHistory(appDir)
+	if err != nil {
+		t.Fatalf("releaseHistory: %v", err)
+	}
+	if current != "1712349999-def5678" {
+		t.Errorf("current = %q, want the symlinked release", current)
+	}
+	if want := []string{"1712345678-abc1234", "1712349999-def5678"}; !reflect.DeepEqual(releases, want) {
+		t.Errorf("releases = %v, want %v", releases, want)
+	}
+}
+
+func TestAppDiskUsage(t *testing.T) {
+	appDir := t.TempDir()
+	files := map[string]int{
+		"releases/1712345678-abc1234/server.js":      300,
+		"releases/1712349999-def5678/server.js":      500,
+		"releases/1712349999-def5678/.next/BUILD_ID": 20,
+		"shared_static/chunks/main.js":               100,
+	}
+	for name, size := range files {
+		path := filepath.Join(appDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(appDir, "releases", "1712349999-def5678"), filepath.Join(appDir, "current")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := appDiskUsage(appDir)
+	if err != nil {
+		t.Fatalf("appDiskUsage: %v", err)
+	}
+	want := diskUsage{Releases: 2, CurrentBytes: 520, ReleasesBytes: 820, SharedBytes: 100, TotalBytes: 920, ReclaimableBytes: 300}
+	if got != want {
+		t.Errorf("appDiskUsage = %+v, want %+v", got, want)
+	}
+}
+
+func TestPruneAppReleasesKeepsReleasesInUse(t *testing.T) {
+	appDir := t.TempDir()
+	ids := []string{"100-a", "200-b", "300-c", "400-d", "500-e"}
+	for _, id := range ids {
+		dir := filepath.Join(appDir, "releases", id)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "server.js"), make([]byte, 10), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Rolled back to 400-d; 200-b still has a unit (the outgoing release of a rollout).
+	if err := os.Symlink(filepath.Join(appDir, "releases", "400-d"), filepath.Join(appDir, "current")); err != nil {
+		t.Fatal(err)
+	}
+	services := []string{"nextdeploy-shop-200-b.service", "nextdeploy-shop-400-d.service"}
+
+	removed, _, err := pruneAppReleases(appDir, "shop", 1, services, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if want := []string{"100-a", "300-c"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("dry run removed = %v, want %v", removed, want)
+	}
+	if _, err := os.Stat(filepath.Join(appDir, "releases", "100-a")); err != nil {
+		t.Error("dry run must not delete anything")
+	}
+
+	removed, reclaimed, err := pruneAppReleases(appDir, "shop", 1, services, false)
+	if err != nil {
+		t.Fatalf("pruneAppReleases: %v", err)
+	}
+	if want := []string{"100-a", "300-c"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+	if reclaimed != 20 {
+		t.Errorf("reclaimed = %d, want 20", reclaimed)
+	}
+	_, left, _ := releaseHistory(appDir)
+	if want := []string{"200-b", "400-d", "500-e"}; !reflect.DeepEqual(left, want) {
+		t.Errorf("remaining releases = %v, want %v", left, want)
+	}
+}
+
+func TestPruneStaleUploads(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"old.tar.gz": 2 * time.Hour, "inflight.tar.gz": time.Minute} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, reclaimed, err := pruneStaleUploads(dir, now, false)
+	if err != nil {
+		t.Fatalf("pruneStaleUploads: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"old.tar.gz"}) || reclaimed != 4 {
+		t.Errorf("removed %v (%d bytes), want only old.tar.gz", removed, reclaimed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "inflight.tar.gz")); err != nil {
+		t.Error("an upload of a ship in flight must be kept")
+	}
+}
+
+func TestCompareUnit(t *testing.T) {
+	want := unitIntent{
+		Unit:       "nextdeploy-shop-1700000100-abc1234.service",
+		Port:       3001,
+		WorkingDir: "/opt/nextdeploy/apps/shop/releases/1700000100-abc1234",
+		Restart:    "on-failure",
+		Resources:  renderResourceLimits(&config.ResourceLimits{MemoryMax: "512M"}),
+	}
+	inSync := unitObserved{
+		Unit: want.Unit,
+		Props: map[string]string{
+			"Environment":            "NODE_ENV=production PORT=3001",
+			"Restart":                "on-failure",
+			"WorkingDirectory":       want.WorkingDir,
+			"NeedDaemonReload":       "no",
+			"ExecMainStartTimestamp": "Tue 2023-11-14 22:15:00 UTC",
+		},
+		UnitFile:    "[Service]\nMemoryAccounting=true\nMemoryMax=512M\n",
+		EnvModified: time.Date(2023, 11, 14, 22, 10, 0, 0, time.UTC),
+	}
+	if got := compareUnit(want, inSync); len(got) != 0 {
+		t.Fatalf("in-sync unit reported drift: %+v", got)
+	}
+
+	drifted := inSync
+	drifted.Props = map[string]string{
+		"Environment":            "NODE_ENV=production PORT=4000",
+		"Restart":                "always",
+		"WorkingDirectory":       want.WorkingDir,
+		"NeedDaemonReload":       "yes",
+		"ExecMainStartTimestamp": "Tue 2023-11-14 22:15:00 UTC",
+	}
+	drifted.UnitFile = "[Service]\nMemoryMax=1G\nCPUQuota=50%\n"
+	drifted.EnvModified = time.Date(2023, 11, 14, 23, 0, 0, 0, time.UTC)
+
+	got := map[string]driftItem{}
+	for _, it := range compareUnit(want, drifted) {
+		got[it.Field] = it
+	}
+	wantFields := map[string][2]string{
+		"port":      {"3001", "4000"},
+		"restart":   {"on-failure", "always"},
+		"MemoryMax": {"512M", "1G"},
+		"CPUQuota":  {"none", "50%"},
+	}
+	for field, wg := range wantFields {
+		if it, ok := got[field]; !ok || it.Want != wg[0] || it.Got != wg[1] {
+			t.Errorf("%s: got %+v, want want=%s got=%s", field, it, wg[0], wg[1])
+		}
+	}
+	for _, field := range []string{"unit_file", "env"} {
+		if _, ok := got[field]; !ok {
+			t.Errorf("expected %s drift, got %+v", field, got)
+		}
+	}
+	if len(got) != len(wantFields)+2 {
+		t.Errorf("unexpected drift items: %+v", got)
+	}
+
+	stopped := compareUnit(want, unitObserved{})
+	if len(stopped) != 1 || stopped[0].Field != "unit" || stopped[0].Got != "nothing" {
+		t.Errorf("stopped app: got %+v", stopped)
+	}
+}
+
 func TestAppLocker(t *testing.T) {
 	l := newAppLocker()
 
@@ -83,6 +405,241 @@ func TestAppLocker(t *testing.T) {
 	}
 }
 
+func TestDeployQueue(t *testing.T) {
+	q := newDeployQueue(2)
+	apps := []string{"a", "b", "c", "d", "e", "f"}
+
+	var mu sync.Mutex
+	var started []string
+	running, peak := 0, 0
+	finish := make(map[string]chan struct{})
+	done := make(chan string, len(apps))
+	for _, app := range apps {
+		finish[app] = make(chan struct{})
+	}
+
+	for i, app := range apps {
+		go func() {
+			release, err := q.acquire(context.Background(), app, nil)
+			if err != nil {
+				t.Errorf("%s: %v", app, err)
+				done <- app
+				return
+			}
+			mu.Lock()
+			started = append(started, app)
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			<-finish[app]
+			mu.Lock()
+			running--
+			mu.Unlock()
+			release()
+			done <- app
+		}()
+		// Submit one at a time so arrival order is the slice order.
+		waitFor(t, func() bool {
+			r, w := q.snapshot()
+			return len(r)+len(w) == i+1
+		})
+	}
+
+	_, waiting := q.snapshot()
+	if len(waiting) != 4 || waiting[0].App != "c" || waiting[0].Position != 1 || waiting[3].App != "f" {
+		t.Fatalf("queue = %+v, want c..f behind a and b", waiting)
+	}
+
+	// Finish deploys in the order they started; each frees a slot for the
+	// oldest waiter.
+	for i := range apps {
+		waitFor(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(started) > i
+		})
+		mu.Lock()
+		app := started[i]
+		mu.Unlock()
+		close(finish[app])
+		<-done
+	}
+
+	if !reflect.DeepEqual(started, apps) {
+		t.Errorf("deploys started in order %v, want %v", started, apps)
+	}
+	if peak > 2 {
+		t.Errorf("%d deploys ran at once, limit is 2", peak)
+	}
+
+	// A waiter that gives up leaves the queue without taking a slot.
+	hold, _ := q.acquire(context.Background(), "x", nil)
+	hold2, _ := q.acquire(context.Background(), "y", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	position := 0
+	if _, err := q.acquire(ctx, "z", func(p int) { position = p }); err == nil || position != 1 {
+		t.Errorf("expected z to queue at 1 and time out, got position %d, err %v", position, err)
+	}
+	hold()
+	hold2()
+	if r, w := q.snapshot(); len(r) != 0 || len(w) != 0 {
+		t.Errorf("queue not empty after all deploys: running %v, waiting %v", r, w)
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDeployQueueWait(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		deadline time.Time
+		want     time.Duration
+	}{
+		{"no connection", time.Time{}, maxDeployQueueWait},
+		{"fresh connection", now.Add(connDeadline), maxDeployQueueWait},
+		{"staging took two minutes", now.Add(connDeadline - 2*time.Minute), maxDeployQueueWait - 2*time.Minute},
+		{"only the deploy's time left", now.Add(connDeadline - maxDeployQueueWait), 0},
+		{"past the deadline", now.Add(-time.Minute), 0},
+	}
+	for _, tt := range tests {
+		if got := deployQueueWait(tt.deadline, now); got != tt.want {
+			t.Errorf("%s: deployQueueWait = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	var ran []string
+	hookRunner = func(h config.Hook, releaseDir string, _ []bindMount, _ time.Duration) ([]byte, error) {
+		ran = append(ran, h.Label()+"@"+releaseDir)
+		if h.Run[0] == "false" {
+			return []byte("migration 0042 failed: relation exists\n"), errors.New("exit status 1")
+		}
+		return []byte("done\n"), nil
+	}
+	defer func() { hookRunner = runHookInRelease }()
+
+	hooks := []config.Hook{
+		{Name: "migrate", Run: config.Args{"npx", "prisma", "migrate", "deploy"}},
+		{Run: config.Args{"./scripts/warm-cache.sh"}},
+	}
+	results, err := runHooks("post_deploy", hooks, "/rel", nil, time.Time{})
+	if err != nil {
+		t.Fatalf("runHooks: %v", err)
+	}
+	if want := []string{"migrate@/rel", "warm-cache.sh@/rel"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, want %v", ran, want)
+	}
+	if len(results) != 2 || !results[0].OK || results[0].Phase != "post_deploy" || results[0].Output != "done\n" {
+		t.Errorf("results = %+v", results)
+	}
+
+	// A failure stops the phase and its output reaches the summary.
+	ran = nil
+	hooks = []config.Hook{{Name: "migrate", Run: config.Args{"false"}}, {Name: "warm", Run: config.Args{"true"}}}
+	results, err = runHooks("post_deploy", hooks, "/rel", nil, time.Time{})
+	if err == nil || !strings.Contains(err.Error(), `post_deploy hook "migrate" failed`) {
+		t.Errorf("err = %v", err)
+	}
+	if len(ran) != 1 || len(results) != 1 || results[0].OK {
+		t.Errorf("hooks after a failure must not run: ran %v, results %+v", ran, results)
+	}
+	if summary := hookSummary(results); !strings.Contains(summary, "| migration 0042 failed") {
+		t.Errorf("summary missing hook output:\n%s", summary)
+	}
+}
+
+func TestRunHooksDeadline(t *testing.T) {
+	var timeouts []time.Duration
+	hookRunner = func(_ config.Hook, _ string, _ []bindMount, timeout time.Duration) ([]byte, error) {
+		timeouts = append(timeouts, timeout)
+		return nil, nil
+	}
+	defer func() { hookRunner = runHookInRelease }()
+
+	// Two hooks of five minutes each cannot both have them when the client
+	// waits three: each is cut to what is left of the command's time.
+	hooks := []config.Hook{{Name: "migrate", Run: config.Args{"true"}}, {Name: "warm", Run: config.Args{"true"}}}
+	if _, err := runHooks("pre_deploy", hooks, "/rel", nil, time.Now().Add(3*time.Minute)); err != nil {
+		t.Fatalf("runHooks: %v", err)
+	}
+	for i, got := range timeouts {
+		if got > 3*time.Minute-hookDeadlineMargin || got < time.Minute {
+			t.Errorf("hook %d timeout = %s, want about %s", i, got, 3*time.Minute-hookDeadlineMargin)
+		}
+	}
+
+	// With no time left a hook fails without running.
+	timeouts = nil
+	results, err := runHooks("pre_deploy", hooks, "/rel", nil, time.Now().Add(hookDeadlineMargin))
+	if err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Errorf("err = %v, want a deadline error", err)
+	}
+	if len(timeouts) != 0 || len(results) != 1 || results[0].OK {
+		t.Errorf("hook ran past the deadline: timeouts %v, results %+v", timeouts, results)
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		timeout  string
+		deadline time.Time
+		want     time.Duration
+		wantErr  bool
+	}{
+		{"no deadline", "", time.Time{}, config.DefaultHookTimeout, false},
+		{"configured timeout fits", "2m", now.Add(10 * time.Minute), 2 * time.Minute, false},
+		{"capped at what is left", "", now.Add(3 * time.Minute), 3*time.Minute - hookDeadlineMargin, false},
+		{"whole seconds", "", now.Add(hookDeadlineMargin + 1500*time.Millisecond), time.Second, false},
+		{"nothing left", "", now.Add(hookDeadlineMargin + 500*time.Millisecond), 0, true},
+		{"already past", "", now.Add(-time.Minute), 0, true},
+	}
+	for _, tt := range tests {
+		got, err := hookTimeout(config.Hook{Run: config.Args{"true"}, Timeout: tt.timeout}, tt.deadline, now)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: hookTimeout = %s, %v; want %s, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHookUnitArgs(t *testing.T) {
+	mounts := []bindMount{
+		{Source: "/opt/nextdeploy/apps/web/volumes/uploads", Target: "/rel/public/uploads"},
+		{Source: "/srv/geoip", Target: "/rel/data/geoip", ReadOnly: true},
+	}
+	args := strings.Join(hookUnitArgs("/rel", 2*time.Minute, mounts), " ")
+	for _, want := range []string{
+		"--working-directory=/rel",
+		"-p RuntimeMaxSec=120",
+		"-p BindPaths=/opt/nextdeploy/apps/web/volumes/uploads:/rel/public/uploads",
+		"-p BindReadOnlyPaths=/srv/geoip:/rel/data/geoip",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("hook unit args missing %q: %s", want, args)
+		}
+	}
+	if !strings.HasSuffix(args, " --") {
+		t.Errorf("hook unit args must end before the command: %s", args)
+	}
+	if args := strings.Join(hookUnitArgs("/rel", time.Minute, nil), " "); strings.Contains(args, "BindPaths") {
+		t.Errorf("no volumes, no bind mounts: %s", args)
+	}
+}
+
 // portOf extracts the TCP port an httptest server is listening on.
 func portOf(t *testing.T, ts *httptest.Server) int {
 	t.Helper()
@@ -103,7 +660,7 @@ func TestWaitForHealthy(t *testing.T) {
 			w.WriteHeader(http.StatusOK)
 		}))
 		defer ts.Close()
-		if err := waitForHealthy(portOf(t, ts), "/", 2*time.Second); err != nil {
+		if _, err := waitForHealthy(portOf(t, ts), "/", 2*time.Second); err != nil {
 			t.Errorf("expected healthy, got %v", err)
 		}
 	})
@@ -117,7 +674,7 @@ func TestWaitForHealthy(t *testing.T) {
 			w.WriteHeader(http.StatusNotFound)
 		}))
 		defer ts.Close()
-		if err := waitForHealthy(portOf(t, ts), "/healthz", 2*time.Second); err != nil {
+		if _, err := waitForHealthy(portOf(t, ts), "/healthz", 2*time.Second); err != nil {
 			t.Errorf("expected healthy on /healthz, got %v", err)
 		}
 	})
@@ -128,7 +685,7 @@ func TestWaitForHealthy(t *testing.T) {
 		}))
 		defer ts.Close()
 		// Short timeout: a TCP-only gate would pass here; the HTTP gate must not.
-		if err := waitForHealthy(portOf(t, ts), "/", 600*time.Millisecond); err == nil {
+		if _, err := waitForHealthy(portOf(t, ts), "/", 600*time.Millisecond); err == nil {
 			t.Error("expected health check to fail on persistent 500")
 		}
 	})
@@ -142,11 +699,31 @@ func TestWaitForHealthy(t *testing.T) {
 		_, portStr, _ := net.SplitHostPort(ln.Addr().String())
 		port, _ := strconv.Atoi(portStr)
 		_ = ln.Close()
-		if err := waitForHealthy(port, "/", 400*time.Millisecond); err == nil {
+		if _, err := waitForHealthy(port, "/", 400*time.Millisecond); err == nil {
 			t.Error("expected timeout when nothing is listening")
 		}
 	})
 
+	t.Run("reports time to ready", func(t *testing.T) {
+		var calls atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer ts.Close()
+		ready, err := waitForHealthy(portOf(t, ts), "/", 5*time.Second)
+		if err != nil {
+			t.Fatalf("expected ready, got %v", err)
+		}
+		// Two failed probes back off 100ms then 200ms before the third succeeds.
+		if ready < 300*time.Millisecond {
+			t.Errorf("time to ready = %s, want at least the backoff between probes", ready)
+		}
+	})
+
 	t.Run("empty path defaults to root", func(t *testing.T) {
 		var gotPath string
 		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -154,7 +731,7 @@ func TestWaitForHealthy(t *testing.T) {
 			w.WriteHeader(http.StatusOK)
 		}))
 		defer ts.Close()
-		if err := waitForHealthy(portOf(t, ts), "", 2*time.Second); err != nil {
+		if _, err := waitForHealthy(portOf(t, ts), "", 2*time.Second); err != nil {
 			t.Fatalf("expected healthy, got %v", err)
 		}
 		if gotPath != "/" {
@@ -163,23 +740,1077 @@ func TestWaitForHealthy(t *testing.T) {
 	})
 }
 
-func TestProcessAlive(t *testing.T) {
+func TestFindUnclaimedPort(t *testing.T) {
+	t.Run("skips ports owned by other apps", func(t *testing.T) {
+		var seen []int
+		port, closePort, err := findUnclaimedPort(func(p int) string {
+			seen = append(seen, p)
+			if len(seen) == 1 {
+				return "other-app"
+			}
+			return ""
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer closePort()
+		if port == seen[0] {
+			t.Errorf("got claimed port %d back", port)
+		}
+	})
+
+	t.Run("reports a conflict when every port is claimed", func(t *testing.T) {
+		_, _, err := findUnclaimedPort(func(int) string { return "other-app" })
+		if err == nil {
+			t.Fatal("expected a port conflict error")
+		}
+		if !strings.Contains(err.Error(), "port conflict") || !strings.Contains(err.Error(), "other-app") {
+			t.Errorf("error %q does not name the conflict", err)
+		}
+	})
+}
+
+func TestStateManagerPortOwner(t *testing.T) {
+	sm := NewStateManager(filepath.Join(t.TempDir(), "state.json"))
+	sm.SetPort("shop", 4100)
+	sm.SetPort("blog", 4200)
+
+	if got := sm.PortOwner(4100, "blog"); got != "shop" {
+		t.Errorf("PortOwner(4100) = %q, want shop", got)
+	}
+	if got := sm.PortOwner(4100, "shop"); got != "" {
+		t.Errorf("an app must not conflict with its own port, got %q", got)
+	}
+	if got := sm.PortOwner(4300, "shop"); got != "" {
+		t.Errorf("unclaimed port reported owner %q", got)
+	}
+}
+
+func TestStateManagerRecoversCorruptState(t *testing.T) {
+	dir := t.TempDir()
+	appsRoot := filepath.Join(dir, "apps")
+	for app, port := range map[string]string{"shop": "3001\n", "blog": "3002", "bad": "x"} {
+		if err := os.MkdirAll(filepath.Join(appsRoot, app), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(appsRoot, app, "port"), []byte(port), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statePath := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(statePath, []byte(`{"ports": {"shop": 30`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := &StateManager{path: statePath}
+	if err := sm.load(appsRoot); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if want := map[string]int{"shop": 3001, "blog": 3002}; !reflect.DeepEqual(sm.state.Ports, want) {
+		t.Errorf("recovered ports = %v, want %v", sm.state.Ports, want)
+	}
+	backups, _ := filepath.Glob(statePath + ".corrupt-*")
+	if len(backups) != 1 {
+		t.Errorf("corrupt state file should be kept aside, found %v", backups)
+	}
+
+	sm.SetPort("api", 3003)
+	if err := sm.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	reloaded := &StateManager{path: statePath}
+	if err := reloaded.load(appsRoot); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if reloaded.GetPort("api") != 3003 || reloaded.GetPort("shop") != 3001 {
+		t.Errorf("saved state did not round-trip: %v", reloaded.state.Ports)
+	}
+
+	// "null" ports must not leave a nil map behind for SetPort to panic on.
+	if err := os.WriteFile(statePath, []byte(`{"ports": null}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	nullPorts := &StateManager{path: statePath}
+	if err := nullPorts.load(appsRoot); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	nullPorts.SetPort("shop", 3001)
+}
+
+func TestParseReadinessTimeout(t *testing.T) {
 	tests := []struct {
-		name   string
-		pidStr string
-		want   bool
+		raw  string
+		want time.Duration
 	}{
-		{"non-numeric", "abc", false},
-		{"zero", "0", false},
-		{"negative", "-1", false},
-		{"empty", "", false},
-		{"unlikely-huge-pid", fmt.Sprintf("%d", 1<<30), false},
+		{"", defaultReadinessTimeout},
+		{"90s", 90 * time.Second},
+		{"10m", 10 * time.Minute},
+		{"soon", defaultReadinessTimeout},
+		{"-5s", defaultReadinessTimeout},
 	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := processAlive(tt.pidStr); got != tt.want {
-				t.Errorf("processAlive(%q) = %v, want %v", tt.pidStr, got, tt.want)
-			}
-		})
+		if got := parseReadinessTimeout(tt.raw); got != tt.want {
+			t.Errorf("parseReadinessTimeout(%q) = %s, want %s", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestFailLogLinesArg(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]any
+		want int
+	}{
+		{"absent", map[string]any{}, defaultFailLogLines},
+		{"nil args", nil, defaultFailLogLines},
+		{"set", map[string]any{"failLogLines": 20.0}, 20},
+		{"zero turns logs off", map[string]any{"failLogLines": 0.0}, 0},
+		{"negative", map[string]any{"failLogLines": -1.0}, defaultFailLogLines},
+		{"string", map[string]any{"failLogLines": "20"}, defaultFailLogLines},
+		{"bool", map[string]any{"failLogLines": true}, defaultFailLogLines},
+	}
+	for _, tt := range tests {
+		if got := failLogLinesArg(tt.args); got != tt.want {
+			t.Errorf("%s: failLogLinesArg(%v) = %d, want %d", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestFailedReleaseResponse runs failedReleaseResponse against a stub
+// journalctl that prints two lines for any unit but "broken.service", for
+// which it fails, and "quiet.service", which has no journal yet.
+func TestFailedReleaseResponse(t *testing.T) {
+	bin := t.TempDir()
+	stub := `#!/bin/sh
+case "$2" in
+broken.service) echo "no journal access" >&2; exit 1 ;;
+quiet.service) exit 0 ;;
+esac
+printf 'Error: Cannot find module next\nexited with 1\n'
+`
+	if err := os.WriteFile(filepath.Join(bin, "journalctl"), []byte(stub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	ch := &CommandHandler{processManager: &ProcessManager{}}
+
+	tests := []struct {
+		name     string
+		unit     string
+		n        int
+		wantLogs bool
+	}{
+		{"logs attached", "app.service", 50, true},
+		{"logs off", "app.service", 0, false},
+		{"negative lines", "app.service", -1, false},
+		{"no unit", "", 50, false},
+		{"journalctl fails", "broken.service", 50, false},
+		{"empty journal", "quiet.service", 50, false},
+	}
+	for _, tt := range tests {
+		resp := ch.failedReleaseResponse("release never became ready", tt.unit, tt.n)
+		if resp.Success {
+			t.Errorf("%s: a failed release reported success", tt.name)
+		}
+		if !strings.HasPrefix(resp.Message, "release never became ready") {
+			t.Errorf("%s: message %q lost the failure", tt.name, resp.Message)
+		}
+		if !tt.wantLogs {
+			if resp.Message != "release never became ready" || resp.Data != nil {
+				t.Errorf("%s: want the bare failure, got %q, data %v", tt.name, resp.Message, resp.Data)
+			}
+			continue
+		}
+		if !strings.Contains(resp.Message, "--- last 50 log lines of app.service ---\nError: Cannot find module next\nexited with 1") {
+			t.Errorf("%s: message without the journal tail:\n%s", tt.name, resp.Message)
+		}
+		data, _ := resp.Data.(map[string]any)
+		if data["unit"] != "app.service" || data["logs"] != "Error: Cannot find module next\nexited with 1" {
+			t.Errorf("%s: data = %v", tt.name, resp.Data)
+		}
+	}
+}
+
+func TestProcessAlive(t *testing.T) {
+	tests := []struct {
+		name   string
+		pidStr string
+		want   bool
+	}{
+		{"non-numeric", "abc", false},
+		{"zero", "0", false},
+		{"negative", "-1", false},
+		{"empty", "", false},
+		{"unlikely-huge-pid", fmt.Sprintf("%d", 1<<30), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := processAlive(tt.pidStr); got != tt.want {
+				t.Errorf("processAlive(%q) = %v, want %v", tt.pidStr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateHealth(t *testing.T) {
+	states := map[string]appHealthStatus{
+		"api":  {Healthy: true, State: "active", Release: "1700000000-abc1234"},
+		"shop": {Healthy: false, State: "failed", Release: "1700000001-def5678", Error: "unit is failed"},
+		"web":  {Healthy: true, State: "active", Release: "1700000002-0a1b2c3"},
+	}
+	check := func(app string) (appHealthStatus, bool) {
+		h, ok := states[app]
+		return h, ok
+	}
+
+	resp := aggregateHealth([]string{"api", "shop", "web", "fresh", "../bad"}, check)
+	if resp.Success {
+		t.Error("one unhealthy app must fail the aggregate")
+	}
+	data := resp.Data.(map[string]any)
+	if data["overall_healthy"] != false || data["unhealthy"] != 1 {
+		t.Errorf("overall_healthy=%v unhealthy=%v, want false/1", data["overall_healthy"], data["unhealthy"])
+	}
+	apps := data["apps"].(map[string]appHealthStatus)
+	if len(apps) != 3 {
+		t.Errorf("got %d apps, want 3 (undeployed and invalid names skipped): %v", len(apps), apps)
+	}
+	if !strings.Contains(resp.Message, "2/3 app(s) healthy") || !strings.Contains(resp.Message, "shop: UNHEALTHY (unit is failed)") {
+		t.Errorf("unexpected message:\n%s", resp.Message)
+	}
+
+	resp = aggregateHealth([]string{"api", "web"}, check)
+	if !resp.Success || resp.Data.(map[string]any)["overall_healthy"] != true {
+		t.Errorf("all healthy apps should succeed: %+v", resp)
+	}
+}
+
+func TestAppHealthStaticExport(t *testing.T) {
+	appDir := t.TempDir()
+	releaseDir := filepath.Join(appDir, "releases", "1700000000-abc1234")
+	if err := os.MkdirAll(releaseDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(releaseDir, "metadata.json"), []byte(`{"app_name":"docs","output_mode":"export"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(releaseDir, filepath.Join(appDir, "current")); err != nil {
+		t.Fatal(err)
+	}
+
+	// No process manager or state: an export must not reach the unit or
+	// port checks at all.
+	ch := &CommandHandler{}
+	h, deployed := ch.appHealthIn(appDir, "docs")
+	if !deployed {
+		t.Fatal("an export with a live release is deployed")
+	}
+	if !h.Healthy || h.State != "static" || h.Release != "1700000000-abc1234" {
+		t.Errorf("export health = %+v, want healthy static release", h)
+	}
+
+	if _, deployed := ch.appHealthIn(t.TempDir(), "fresh"); deployed {
+		t.Error("an app without a live release is not deployed")
+	}
+}
+
+func TestProbeHealth(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ok.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	if err := probeHealth(portOf(t, ok), "healthz"); err != nil {
+		t.Errorf("expected healthy, got %v", err)
+	}
+	if err := probeHealth(portOf(t, broken), ""); err == nil {
+		t.Error("a 503 should be unhealthy")
+	}
+	if err := probeHealth(0, "/"); err == nil {
+		t.Error("an app without a port should be unhealthy")
+	}
+}
+
+func TestParseLogSearch(t *testing.T) {
+	s, err := parseLogSearch(map[string]any{"grep": "status=5[0-9]{2}", "invert": true, "since": "-1h", "tail": float64(500)})
+	if err != nil {
+		t.Fatalf("parseLogSearch: %v", err)
+	}
+	if !s.invert || s.since != "-1h" || s.scan != 500 {
+		t.Errorf("got %+v", s)
+	}
+	if s, _ := parseLogSearch(map[string]any{"grep": "x", "tail": float64(1e9)}); s.scan != maxLogScanLines {
+		t.Errorf("tail should be capped at %d, got %d", maxLogScanLines, s.scan)
+	}
+
+	for _, bad := range []map[string]any{
+		{"grep": ""},
+		{"grep": "([a-z"},
+		{"grep": strings.Repeat("a", maxGrepPatternLen+1)},
+		{"grep": "x", "since": "today; rm -rf /"},
+		{"grep": "x", "since": "--output=json"},
+	} {
+		if _, err := parseLogSearch(bad); err == nil {
+			t.Errorf("parseLogSearch(%v): expected an error", bad)
+		}
+	}
+}
+
+func TestFilterLogLines(t *testing.T) {
+	journal := "GET /api/users 200\nPOST /api/upload 500\nGET /healthz 200\nPOST /api/upload 502\n"
+	search := func(pattern string, invert bool) logMatches {
+		t.Helper()
+		s, err := parseLogSearch(map[string]any{"grep": pattern, "invert": invert})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := filterLogLines(strings.NewReader(journal), s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	m := search(`/api/upload 5\d\d`, false)
+	if m.Matched != 2 || m.Scanned != 4 || m.Truncated || !reflect.DeepEqual(m.Lines, []string{"POST /api/upload 500", "POST /api/upload 502"}) {
+		t.Errorf("regex search: %+v", m)
+	}
+	if m := search("healthz", true); m.Matched != 3 || strings.Contains(strings.Join(m.Lines, "\n"), "healthz") {
+		t.Errorf("inverted search: %+v", m)
+	}
+
+	var many strings.Builder
+	for i := 0; i < maxLogMatchLines+10; i++ {
+		fmt.Fprintf(&many, "line %d\n", i)
+	}
+	s, _ := parseLogSearch(map[string]any{"grep": "line"})
+	m, err := filterLogLines(strings.NewReader(many.String()), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Truncated || len(m.Lines) != maxLogMatchLines || m.Matched != maxLogMatchLines+10 {
+		t.Errorf("cap: truncated=%v lines=%d matched=%d", m.Truncated, len(m.Lines), m.Matched)
+	}
+	if last := m.Lines[len(m.Lines)-1]; last != fmt.Sprintf("line %d", maxLogMatchLines+9) {
+		t.Errorf("the newest lines should be kept, last is %q", last)
+	}
+}
+
+func TestRunStepsCleansUpAfterFailure(t *testing.T) {
+	var ran []string
+	step := func(name string, err error) func() error {
+		return func() error { ran = append(ran, name); return err }
+	}
+	report := runSteps(
+		[]func() error{step("install", nil), step("start", errors.New("unit failed")), step("health", nil)},
+		[]string{"install", "start", "health"},
+		step("cleanup", nil),
+	)
+	if got := strings.Join(ran, ","); got != "install,start,cleanup" {
+		t.Errorf("ran %s, want install,start,cleanup", got)
+	}
+	if len(report) != 3 || !report[0].OK || report[1].OK || report[1].Error != "unit failed" || report[2].Name != "cleanup" || !report[2].OK {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	for _, s := range report {
+		if s.Took == "" {
+			t.Errorf("step %s has no timing", s.Name)
+		}
+	}
+}
+
+func TestServeCanary(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ServeCanary(ctx, port) }()
+	if _, err := waitForHealthy(port, "/", 5*time.Second); err != nil {
+		t.Fatalf("canary never came up: %v", err)
+	}
+	if err := probeCanary(port); err != nil {
+		t.Errorf("probeCanary: %v", err)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("ServeCanary returned %v after cancel", err)
+	}
+}
+
+func TestStageTarball(t *testing.T) {
+	uploads := filepath.Join(t.TempDir(), "uploads")
+	src := filepath.Join(t.TempDir(), "my app (v2).tar.gz")
+	if err := os.WriteFile(src, []byte("release"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	got, copied, err := stageTarball(src, uploads, now)
+	if err != nil {
+		t.Fatalf("stageTarball: %v", err)
+	}
+	want := filepath.Join(uploads, "staged_1700000000_my_app__v2_.tar.gz")
+	if got != want || !copied {
+		t.Errorf("staged to %s (copied=%v), want %s", got, copied, want)
+	}
+	if data, _ := os.ReadFile(got); string(data) != "release" {
+		t.Errorf("staged copy = %q", data)
+	}
+
+	// Already in the uploads directory: used in place.
+	if again, copied, err := stageTarball(got, uploads, now); err != nil || again != got || copied {
+		t.Errorf("restaging = %s, %v, %v; want %s in place", again, copied, err, got)
+	}
+	// The same second again must not overwrite the first copy.
+	if _, _, err := stageTarball(src, uploads, now); err == nil {
+		t.Error("expected an error rather than overwriting a staged tarball")
+	}
+	if _, _, err := stageTarball(filepath.Dir(src), uploads, now); err == nil {
+		t.Error("a directory cannot be staged")
+	}
+
+	if withinDir(uploads+"-evil/x.tar.gz", uploads) || withinDir(uploads, uploads) || !withinDir(uploads+"/a/../b.tar.gz", uploads) {
+		t.Error("withinDir must require a path inside the directory")
+	}
+}
+
+func TestAuditLogRedactsSecrets(t *testing.T) {
+	args := map[string]any{
+		"appName":      "blog",
+		"tarball":      "/tmp/blog.tar.gz",
+		"dopplerToken": "dp.st.prd.s3cr3t",
+		"value":        "hunter2",
+		"key":          "DATABASE_URL",
+	}
+	path := filepath.Join(t.TempDir(), "audit.log")
+	NewAuditLogger(path).Log(AuditEntry{CommandType: "ship", Result: "success", Args: redactArgs(args)})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"dp.st.prd.s3cr3t", "hunter2"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("audit log contains %q: %s", secret, data)
+		}
+	}
+	for _, kept := range []string{"blog", "/tmp/blog.tar.gz", "DATABASE_URL", "[REDACTED]"} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("audit log lacks %q: %s", kept, data)
+		}
+	}
+	if args["dopplerToken"] != "dp.st.prd.s3cr3t" {
+		t.Error("redactArgs modified the caller's args")
+	}
+	if got := redactArgs(map[string]any{"dopplerToken": ""}); got["dopplerToken"] != "" {
+		t.Errorf("empty token redacted to %v, want it left empty", got["dopplerToken"])
+	}
+}
+
+func TestProbeURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/health":
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		case "/broken":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(strings.Repeat("x", 2*probeBodySnippet)))
+		case "/old":
+			http.Redirect(w, r, "http://example.com/", http.StatusFound)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	r := probeURL(srv.URL+"/api/health", time.Second)
+	if !r.OK || r.Status != 200 || r.Body != `{"ok":true}` || r.Error != "" {
+		t.Errorf("healthy probe = %+v", r)
+	}
+
+	r = probeURL(srv.URL+"/broken", time.Second)
+	if r.OK || r.Status != 503 || len(r.Body) != probeBodySnippet {
+		t.Errorf("503 probe = ok %v status %d body %d bytes, want failure with a %d-byte snippet", r.OK, r.Status, len(r.Body), probeBodySnippet)
+	}
+
+	r = probeURL(srv.URL+"/old", time.Second)
+	if r.OK || r.Status != http.StatusFound {
+		t.Errorf("redirect probe = %+v, want the 302 itself, not followed", r)
+	}
+
+	r = probeURL(srv.URL+"/slow", 50*time.Millisecond)
+	if r.OK || r.Status != 0 || r.Error == "" {
+		t.Errorf("timed-out probe = %+v", r)
+	}
+
+	for raw, ok := range map[string]bool{
+		"http://localhost:3000/api/health": true,
+		"http://127.0.0.1:3000/":           true,
+		"https://[::1]:8443/":              true,
+		"http://10.0.0.5/":                 false,
+		"http://example.com/":              false,
+		"file:///etc/passwd":               false,
+	} {
+		if err := checkProbeURL(raw); (err == nil) != ok {
+			t.Errorf("checkProbeURL(%q) = %v, want allowed=%v", raw, err, ok)
+		}
+	}
+}
+
+func TestRunBulk(t *testing.T) {
+	op := func(app string) types.Response {
+		if strings.HasSuffix(app, "-bad") {
+			return types.Response{Success: false, Message: "unit failed to stop"}
+		}
+		return types.Response{Success: true, Message: "stopped"}
+	}
+	apps := []string{"api", "cron-bad", "web", "worker-bad", "www"}
+
+	resp := runBulk("stop", apps, true, op)
+	if resp.Success {
+		t.Error("keep-going sweep with failures reported success")
+	}
+	data := resp.Data.(map[string]any)
+	if data["succeeded"] != 3 || data["failed"] != 2 || data["skipped"] != 0 {
+		t.Errorf("keep-going counts = %v", data)
+	}
+	if n := len(data["apps"].(map[string]any)); n != len(apps) {
+		t.Errorf("results for %d apps, want %d", n, len(apps))
+	}
+	if !strings.Contains(resp.Message, "3 succeeded, 2 failed") || !strings.Contains(resp.Message, "worker-bad: FAILED (unit failed to stop)") {
+		t.Errorf("message = %q", resp.Message)
+	}
+
+	resp = runBulk("stop", apps, false, op)
+	data = resp.Data.(map[string]any)
+	if resp.Success || data["succeeded"] != 1 || data["failed"] != 1 || data["skipped"] != 3 {
+		t.Errorf("fail-fast = success %v, counts %v", resp.Success, data)
+	}
+	if r := data["apps"].(map[string]any)["www"].(map[string]any); r["skipped"] != true {
+		t.Errorf("www after the failure = %v, want skipped", r)
+	}
+
+	if resp := runBulk("stop", []string{"api", "web"}, true, op); !resp.Success {
+		t.Errorf("all-ok sweep failed: %s", resp.Message)
+	}
+}
+
+func TestResolveChannel(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	manifest := fmt.Sprintf(`{
+		"stable": {"tarball": "web-1a2b3c.tar.gz", "sha256": %q, "commit": "1a2b3c4"},
+		"canary": {"tarball": "../../etc/passwd", "sha256": %q},
+		"broken": {"tarball": "web.tar.gz", "sha256": "abc"}
+	}`, strings.ToUpper(digest), digest)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(manifest))
+	}))
+	defer srv.Close()
+	origClient := channelManifestClient
+	channelManifestClient = srv.Client
+	t.Cleanup(func() { channelManifestClient = origClient })
+	file := filepath.Join(t.TempDir(), "channels.json")
+	if err := os.WriteFile(file, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{srv.URL, file} {
+		rel, err := resolveChannel(source, "stable")
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		want := channelRelease{Tarball: "web-1a2b3c.tar.gz", SHA256: digest, Commit: "1a2b3c4"}
+		if rel != want {
+			t.Errorf("%s: stable = %+v, want %+v", source, rel, want)
+		}
+	}
+
+	for channel, wantErr := range map[string]string{
+		"canary":  "file name in the uploads directory",
+		"broken":  "64-character hex digest",
+		"nightly": "not in",
+		"../x":    "invalid channel name",
+	} {
+		if _, err := resolveChannel(srv.URL, channel); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: err = %v, want containing %q", channel, err, wantErr)
+		}
+	}
+	if _, err := resolveChannel("", "stable"); err == nil {
+		t.Error("resolved a channel with no channel_manifest configured")
+	}
+	plain := "http://" + strings.TrimPrefix(srv.URL, "https://")
+	if _, err := resolveChannel(plain, "stable"); err == nil || !strings.Contains(err.Error(), "https") {
+		t.Errorf("resolved a channel from plain http: err = %v", err)
+	}
+}
+
+func TestCanaryUpstreams(t *testing.T) {
+	tests := []struct {
+		weight any
+		want   string
+	}{
+		{weight: nil, want: "lb_policy weighted_round_robin 90 10"},
+		{weight: float64(25), want: "lb_policy weighted_round_robin 75 25"},
+		{weight: float64(99), want: "lb_policy weighted_round_robin 1 99"},
+	}
+	for _, tt := range tests {
+		w, err := parseCanaryWeight(tt.weight)
+		if err != nil {
+			t.Fatalf("parseCanaryWeight(%v): %v", tt.weight, err)
+		}
+		out := caddy.GenerateCaddyfileUpstreams("shop", caddy.Site{Domain: "example.com"}, "standalone", canaryUpstreams(3000, 3001, w), "/opt/nextdeploy/apps/shop/current", nil, "", "", "")
+		if !strings.Contains(out, "reverse_proxy localhost:3000 localhost:3001 {\n\t\t\t"+tt.want+"\n\t\t}") {
+			t.Errorf("weight %v: want live then canary with %q:\n%s", tt.weight, tt.want, out)
+		}
+	}
+
+	single := caddy.GenerateCaddyfileUpstreams("shop", caddy.Site{Domain: "example.com"}, "standalone", []caddy.Upstream{{Port: 3001, Weight: 1}}, "/opt/nextdeploy/apps/shop/current", nil, "", "", "")
+	if !strings.Contains(single, "\t\treverse_proxy localhost:3001\n") || strings.Contains(single, "lb_policy") {
+		t.Errorf("a promoted or aborted canary should leave a plain reverse_proxy:\n%s", single)
+	}
+
+	for _, bad := range []any{float64(0), float64(100), float64(12.5), "10"} {
+		if _, err := parseCanaryWeight(bad); err == nil {
+			t.Errorf("parseCanaryWeight(%v) should fail", bad)
+		}
+	}
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), idempotencyFile)
+	store := newIdempotencyStore(path, time.Hour)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	deploys := 0
+	ship := func() types.Response {
+		deploys++
+		return types.Response{Success: true, Message: fmt.Sprintf("activated release %d", deploys), Data: map[string]any{"releaseId": "1700000000-abc1234"}}
+	}
+
+	first := store.Do("shop", "ci-run-42", "ship", ship)
+	second := store.Do("shop", "ci-run-42", "ship", ship)
+	if deploys != 1 {
+		t.Fatalf("a retry with the same key deployed again: %d deploys", deploys)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("retry got %+v, want the first response %+v", second, first)
+	}
+
+	// The key survives a daemon restart.
+	restarted := newIdempotencyStore(path, time.Hour)
+	restarted.now = store.now
+	if resp := restarted.Do("shop", "ci-run-42", "ship", ship); deploys != 1 || resp.Message != first.Message {
+		t.Errorf("after restart: %d deploys, response %q", deploys, resp.Message)
+	}
+
+	if resp := store.Do("shop", "ci-run-42", "rollback", ship); resp.Success || deploys != 1 {
+		t.Errorf("a key reused for another command should be refused, got %+v", resp)
+	}
+	if resp := store.Do("shop", "bad key!", "ship", ship); resp.Success || deploys != 1 {
+		t.Errorf("an invalid key should be refused, got %+v", resp)
+	}
+
+	// Keys are per app: another app's CI may pick the same run number.
+	if resp := store.Do("blog", "ci-run-42", "ship", ship); deploys != 2 || resp.Message != "activated release 2" {
+		t.Errorf("the same key for another app should run: %d deploys, response %q", deploys, resp.Message)
+	}
+
+	// A refusal because the app or host was busy never ran, so the retry
+	// with the same key does.
+	busy := func() types.Response { deploys++; return busyResponse("docs") }
+	if resp := store.Do("docs", "ci-run-7", "ship", busy); resp.Success || !isRetryable(resp) {
+		t.Errorf("busy response = %+v, want a retryable failure", resp)
+	}
+	if resp := store.Do("docs", "ci-run-7", "ship", ship); deploys != 4 || !resp.Success {
+		t.Errorf("a retry after a busy refusal should run: %d deploys, response %+v", deploys, resp)
+	}
+	failed := func() types.Response {
+		deploys++
+		return types.Response{Success: false, Message: "release never became ready"}
+	}
+	store.Do("docs", "ci-run-8", "ship", failed)
+	if resp := store.Do("docs", "ci-run-8", "ship", ship); deploys != 5 || resp.Success {
+		t.Errorf("a definitive failure should be returned again: %d deploys, response %+v", deploys, resp)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if store.Do("shop", "ci-run-42", "ship", ship); deploys != 6 {
+		t.Errorf("an expired key should run again: %d deploys", deploys)
+	}
+}
+
+func TestIdempotencyStoreInflight(t *testing.T) {
+	store := newIdempotencyStore(filepath.Join(t.TempDir(), idempotencyFile), time.Hour)
+	started, finish := make(chan struct{}), make(chan struct{})
+	done := make(chan types.Response)
+	go func() {
+		done <- store.Do("shop", "k", "ship", func() types.Response {
+			close(started)
+			<-finish
+			return types.Response{Success: true, Message: "shipped"}
+		})
+	}()
+	<-started
+	if resp := store.Do("shop", "k", "ship", func() types.Response { t.Error("ran twice"); return types.Response{} }); resp.Success || !strings.Contains(resp.Message, "still running") {
+		t.Errorf("a retry while the first call runs should be refused, got %+v", resp)
+	}
+	close(finish)
+	if resp := <-done; !resp.Success {
+		t.Errorf("first call: %+v", resp)
+	}
+}
+
+// newSignedHandler returns a handler with no host state behind it and a
+// function that sends it a correctly signed command through HandleCommand.
+func newSignedHandler(t *testing.T) (*CommandHandler, func(typ string, args map[string]any) types.Response) {
+	t.Helper()
+	const secret = "test-secret"
+	ch := &CommandHandler{
+		config:      &types.DaemonConfig{SecuritySecret: secret},
+		auditLogger: NewAuditLogger(filepath.Join(t.TempDir(), "audit.log")),
+		rateLimiter: NewRateLimiter(100, 100),
+		replayGuard: NewReplayGuard(5 * time.Minute),
+		deployLocks: newAppLocker(),
+		deployQueue: newDeployQueue(0),
+		idempotency: newIdempotencyStore(filepath.Join(t.TempDir(), idempotencyFile), time.Hour),
+	}
+	nonce := 0
+	return ch, func(typ string, args map[string]any) types.Response {
+		nonce++
+		cmd := types.Command{Type: typ, Args: args, Timestamp: time.Now().Unix(), Nonce: fmt.Sprintf("nonce-%d", nonce)}
+		payload, _ := json.Marshal(map[string]any{"type": cmd.Type, "args": cmd.Args, "timestamp": cmd.Timestamp, "nonce": cmd.Nonce})
+		cmd.Signature = sign(string(payload), secret)
+		return ch.HandleCommand(cmd, "unix")
+	}
+}
+
+func TestShipIdempotencyKeyIsPerApp(t *testing.T) {
+	origUploads, origTmp := uploadsDir, workTmpDir
+	uploadsDir, workTmpDir = t.TempDir(), t.TempDir()
+	t.Cleanup(func() { uploadsDir, workTmpDir = origUploads, origTmp })
+
+	// Each tarball names its app only in its metadata, as the CLI ships
+	// it, and fails validation on an alias that names the app.
+	tarball := func(app string) string {
+		src := t.TempDir()
+		meta := fmt.Sprintf(`{"app_name": %q, "domain": "localhost", "domain_aliases": ["%s alias"]}`, app, app)
+		if err := os.WriteFile(filepath.Join(src, "metadata.json"), []byte(meta), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(uploadsDir, app+".tar.gz")
+		if err := shared.CreateTarGz(src, path); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	shop, blog := tarball("shop"), tarball("blog")
+
+	_, run := newSignedHandler(t)
+	ship := func(tarball string) types.Response {
+		return run("ship", map[string]any{"tarball": tarball, "idempotency_key": "ci-run-1"})
+	}
+
+	first := ship(shop)
+	if first.Success || !strings.Contains(first.Message, "shop alias") {
+		t.Fatalf("shop ship = %+v, want its alias refused", first)
+	}
+	// Another app's CI may use the same key; it must run, not get shop's
+	// response.
+	if resp := ship(blog); resp.Success || !strings.Contains(resp.Message, "blog alias") {
+		t.Errorf("blog ship with shop's key = %+v, want blog's own alias refused", resp)
+	}
+	if resp := ship(shop); !reflect.DeepEqual(resp, first) {
+		t.Errorf("shop retry = %+v, want the recorded %+v", resp, first)
+	}
+}
+
+func TestRollbackDryRunIsNotRecorded(t *testing.T) {
+	ch, run := newSignedHandler(t)
+	args := func(dryRun bool) map[string]any {
+		return map[string]any{"appName": "shop", "idempotency_key": "ci-run-9", "dryRun": dryRun}
+	}
+
+	plan := run("rollback", args(true))
+	if len(ch.idempotency.records) != 0 {
+		t.Fatalf("a dry run was recorded: %+v", ch.idempotency.records)
+	}
+
+	// Hold the app's lock so the real rollback answers busy instead of
+	// touching the host; a recorded dry run would answer with its plan.
+	release, _ := ch.deployLocks.tryAcquire("shop")
+	defer release()
+	if resp := run("rollback", args(false)); reflect.DeepEqual(resp, plan) || !isRetryable(resp) {
+		t.Errorf("real rollback after a dry run with its key = %+v, want it to run (busy)", resp)
+	}
+}
+
+func TestLogExport(t *testing.T) {
+	allowed := t.TempDir()
+	logs := strings.Repeat("2026-01-02T03:04:05+0000 host node[42]: GET / 200\n", 1000)
+
+	path, err := checkExportPath(filepath.Join(allowed, "incident", "shop.log.gz"), []string{allowed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, size, err := writeLogExport(path, strings.NewReader(logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(logs)) || size <= 0 || size >= n {
+		t.Errorf("exported %d bytes into a %d-byte file; want all %d bytes, compressed", n, size, len(logs))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil || string(got) != logs {
+		t.Errorf("export does not read back as the logs (err %v)", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("export mode %v, want 0600", info.Mode().Perm())
+	}
+
+	if _, _, err := writeLogExport(path, strings.NewReader("x")); err == nil {
+		t.Error("an existing export must not be overwritten")
+	}
+
+	// When journalctl fails, the export it was writing is removed, but a
+	// file that was already at the path is left alone.
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "journalctl"), []byte("#!/bin/sh\necho 'no journal' >&2\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	if resp := exportLogs([]string{"nextdeploy-shop.service"}, "", path); resp.Success {
+		t.Errorf("export with a failing journalctl succeeded: %+v", resp)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("failed export removed the existing file at its path: %v", err)
+	}
+	newExport := filepath.Join(allowed, "incident", "fresh.log")
+	if resp := exportLogs([]string{"nextdeploy-shop.service"}, "", newExport); resp.Success {
+		t.Errorf("export with a failing journalctl succeeded: %+v", resp)
+	}
+	if _, err := os.Stat(newExport); !os.IsNotExist(err) {
+		t.Errorf("failed export left its file behind: %v", err)
+	}
+
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(allowed, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{
+		filepath.Join(outside, "shop.log"),
+		filepath.Join(allowed, "escape", "shop.log"),
+		filepath.Join(allowed, "escape", "new", "shop.log"),
+		"relative/shop.log",
+		allowed + "/../shop.log",
+	} {
+		if _, err := checkExportPath(bad, []string{allowed}); err == nil {
+			t.Errorf("checkExportPath(%q) should fail", bad)
+		}
+	}
+	// Refused before anything is created through the symlink.
+	if _, err := os.Stat(filepath.Join(outside, "new")); !os.IsNotExist(err) {
+		t.Errorf("checkExportPath created a directory outside the allowlist: %v", err)
+	}
+
+	// An allowed directory that does not exist yet is created.
+	fresh := filepath.Join(t.TempDir(), "log-exports")
+	if _, err := checkExportPath(filepath.Join(fresh, "shop.log"), []string{fresh}); err != nil {
+		t.Errorf("export into a missing allowed directory: %v", err)
+	}
+	if info, err := os.Stat(fresh); err != nil || !info.IsDir() {
+		t.Errorf("allowed directory not created: %v", err)
+	}
+}
+
+// snapshotTree lists every path under dir with its mode and, for symlinks,
+// target, so a test can assert nothing was changed.
+func snapshotTree(t *testing.T, dir string) string {
+	t.Helper()
+	var b strings.Builder
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %v %d", path, info.Mode(), info.Size())
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, _ := os.Readlink(path)
+			b.WriteString(" -> " + target)
+		}
+		b.WriteString("\n")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestPlanRollback(t *testing.T) {
+	appDir := t.TempDir()
+	for _, r := range []struct{ id, commit string }{
+		{"100-aaaaaaa", "aaaaaaa1111"},
+		{"200-bbbbbbb", "bbbbbbb2222"},
+		{"300-ccccccc", "ccccccc3333"},
+	} {
+		dir := filepath.Join(appDir, "releases", r.id)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		meta := fmt.Sprintf(`{"git_commit":%q,"generated_at":"2026-01-0%sT00:00:00Z","hooks":{"PreRollback":[{"Name":"down-migrate"}]}}`, r.commit, r.id[:1])
+		if err := os.WriteFile(filepath.Join(dir, "metadata.json"), []byte(meta), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(appDir, "releases", "300-ccccccc"), filepath.Join(appDir, "current")); err != nil {
+		t.Fatal(err)
+	}
+	before := snapshotTree(t, appDir)
+
+	tests := []struct {
+		steps      int
+		toCommit   string
+		wantTarget string
+		wantCommit string
+	}{
+		{1, "", "200-bbbbbbb", "bbbbbbb2222"},
+		{2, "", "100-aaaaaaa", "aaaaaaa1111"},
+		{1, "aaaaaaa", "100-aaaaaaa", "aaaaaaa1111"},
+	}
+	for _, tt := range tests {
+		plan, err := planRollback(appDir, tt.steps, tt.toCommit)
+		if err != nil {
+			t.Fatalf("steps=%d toCommit=%q: %v", tt.steps, tt.toCommit, err)
+		}
+		if plan.Target != tt.wantTarget || plan.TargetCommit != tt.wantCommit {
+			t.Errorf("steps=%d toCommit=%q: target %s (%s), want %s (%s)", tt.steps, tt.toCommit, plan.Target, plan.TargetCommit, tt.wantTarget, tt.wantCommit)
+		}
+		if plan.Current != "300-ccccccc" || plan.CurrentCommit != "ccccccc3333" {
+			t.Errorf("current = %s (%s), want 300-ccccccc (ccccccc3333)", plan.Current, plan.CurrentCommit)
+		}
+		if !reflect.DeepEqual(plan.PreRollback, []string{"down-migrate"}) {
+			t.Errorf("pre_rollback hooks = %v, want the live release's", plan.PreRollback)
+		}
+	}
+	if _, err := planRollback(appDir, 3, ""); err == nil {
+		t.Error("rolling back past the oldest release should fail")
+	}
+
+	if after := snapshotTree(t, appDir); after != before {
+		t.Errorf("planning a rollback changed the app directory:\nbefore:\n%safter:\n%s", before, after)
+	}
+}
+
+func TestDiffReleases(t *testing.T) {
+	appDir := t.TempDir()
+	files := map[string]map[string]int{
+		"100-aaaaaaa": {"server.js": 1000, ".next/server/app.js": 5000, "public/logo.png": 2000},
+		"200-bbbbbbb": {"server.js": 1000, ".next/server/app.js": 7000, "node_modules/left-pad/index.js": 30000},
+	}
+	for id, fs := range files {
+		for name, size := range fs {
+			path := filepath.Join(appDir, "releases", id, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := os.Symlink(filepath.Join(appDir, "releases", "200-bbbbbbb"), filepath.Join(appDir, "current")); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := diffReleases(appDir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.From != "100-aaaaaaa" || d.To != "200-bbbbbbb" {
+		t.Errorf("compared %s -> %s, want 100-aaaaaaa -> 200-bbbbbbb", d.From, d.To)
+	}
+	if d.FromBytes != 8000 || d.ToBytes != 38000 || d.Delta != 30000 {
+		t.Errorf("sizes %d -> %d (%+d), want 8000 -> 38000 (+30000)", d.FromBytes, d.ToBytes, d.Delta)
+	}
+	want := []entryDiff{
+		{Path: "node_modules", To: 30000, Delta: 30000, Status: "added"},
+		{Path: ".next", From: 5000, To: 7000, Delta: 2000, Status: "changed"},
+		{Path: "public", From: 2000, Delta: -2000, Status: "removed"},
+		{Path: "server.js", From: 1000, To: 1000, Status: "same"},
+	}
+	if !reflect.DeepEqual(d.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", d.Entries, want)
+	}
+
+	if _, err := diffReleases(appDir, "../../etc", ""); err == nil {
+		t.Error("a release outside the app was compared")
+	}
+	if _, err := diffReleases(appDir, "", "100-aaaaaaa"); err == nil {
+		t.Error("the oldest release was compared with nothing")
+	}
+}
+
+func TestShipMetadataFromStore(t *testing.T) {
+	store := t.TempDir()
+	const commit = "3f2a9c1d"
+	if err := os.MkdirAll(filepath.Join(store, commit), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	published := `{"app_name":"shop","git_commit":"3f2a9c1d","output_mode":"standalone"}`
+	if err := os.WriteFile(filepath.Join(store, commit, "metadata.json"), []byte(published), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ch := &CommandHandler{config: &types.DaemonConfig{MetadataStore: &config.MetadataStoreConfig{Backend: "local", Path: store}}}
+
+	unpacked := t.TempDir()
+	if _, err := ch.shipMetadata(unpacked, ""); err == nil {
+		t.Fatal("a tarball without metadata and no --commit must fail")
+	}
+	if _, err := ch.shipMetadata(unpacked, "deadbeef"); err == nil {
+		t.Fatal("a commit with nothing published must fail")
+	}
+
+	meta, err := ch.shipMetadata(unpacked, commit)
+	if err != nil {
+		t.Fatalf("shipMetadata: %v", err)
+	}
+	if meta.AppName != "shop" {
+		t.Errorf("AppName = %q, want shop", meta.AppName)
+	}
+	// The release must carry the fetched metadata like a tarball's own.
+	onDisk, err := readMetadata(unpacked)
+	if err != nil {
+		t.Fatalf("fetched metadata was not written into the release: %v", err)
+	}
+	if onDisk.AppName != "shop" || onDisk.GitCommit != commit {
+		t.Errorf("written metadata = %+v", onDisk)
+	}
+
+	// A tarball's own metadata wins over the store.
+	if err := os.WriteFile(filepath.Join(unpacked, "metadata.json"), []byte(`{"app_name":"blog"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := ch.shipMetadata(unpacked, commit); err != nil || meta.AppName != "blog" {
+		t.Errorf("tarball metadata = %+v, %v; want blog", meta, err)
 	}
 }
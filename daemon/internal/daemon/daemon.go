@@ -35,6 +35,34 @@ func NewNextDeployDaemon(configPath string, socketPathOverride string) (*NextDep
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
+	// The config holds the HMAC secrets and the store holds app secrets; both
+	// must stay private to the daemon's user.
+	for _, p := range []string{configPath, secretsDir} {
+		if err := config.CheckPrivate(p); err != nil {
+			return nil, fmt.Errorf("refusing to start: %w", err)
+		}
+	}
+	// With a passphrase configured the app secrets are encrypted at rest
+	// (see secrets_crypto.go); existing plaintext stores are sealed now.
+	passphrase, err := secretsPassphrase()
+	if err != nil {
+		return nil, fmt.Errorf("refusing to start: %w", err)
+	}
+	secretsKey, err := openSecretsKey(secretsDir, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to start: %w", err)
+	}
+	if secretsKey == nil {
+		log.Printf("[security] No %s credential or %s set; app secrets in %s are stored unencrypted", secretsCredential, secretsPassphraseEnv, secretsDir)
+	} else if err := (&CommandHandler{secretsKey: secretsKey}).sealSecretsStore(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt the secrets store: %w", err)
+	}
+
+	// rotateSecret and restartDaemon need to know where the config lives.
+	if cfg.ConfigPath == "" {
+		cfg.ConfigPath = configPath
+	}
+
 	// Secure by default: generate and persist a random HMAC secret if none is
 	// configured. Without this the daemon would accept unsigned commands (see
 	// VerifySignature, which now fails closed on an empty secret).
@@ -60,7 +88,9 @@ func NewNextDeployDaemon(configPath string, socketPathOverride string) (*NextDep
 
 	logger := logging.SetupLogger(logConfig)
 	commandHandler := NewCommandHandler(cfg)
+	commandHandler.secretsKey = secretsKey
 	socketServer := NewSocketServer(cfg, commandHandler)
+	commandHandler.reexec = socketServer.Reexec
 
 	return &NextDeployDaemon{
 		ctx:            ctx,
@@ -0,0 +1,166 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+)
+
+const (
+	// defaultMaxConcurrentDeploys applies when max_concurrent_deploys is unset.
+	defaultMaxConcurrentDeploys = 2
+	// maxDeployQueueWait is how long a ship waits for a slot before giving up.
+	// It stays well inside connDeadline so the client hears why.
+	maxDeployQueueWait = 5 * time.Minute
+)
+
+// deployQueueWait is how long a ship may wait for a slot when its connection
+// closes at deadline: at most maxDeployQueueWait, and never into the last
+// connDeadline-maxDeployQueueWait of the connection, which is kept for the
+// deploy itself. Time spent before the queue (staging, verifying the tarball)
+// so shortens the wait instead of the deploy. A zero deadline, for a command
+// not read from a connection, leaves maxDeployQueueWait.
+func deployQueueWait(deadline, now time.Time) time.Duration {
+	if deadline.IsZero() {
+		return maxDeployQueueWait
+	}
+	wait := deadline.Sub(now) - (connDeadline - maxDeployQueueWait)
+	return max(0, min(wait, maxDeployQueueWait))
+}
+
+// deployQueue bounds how many deploys run at once across all apps. Deploys
+// beyond the limit wait in arrival order; a slot freed by one deploy goes to
+// the oldest waiter, never to a newcomer. It sits behind the per-app lock, so
+// each app has at most one entry and the queue only orders different apps.
+type deployQueue struct {
+	mu      sync.Mutex
+	limit   int
+	running []*deployTicket
+	waiting []*deployTicket
+}
+
+// deployTicket is one deploy's place in the queue. ready is closed when it
+// is given a slot.
+type deployTicket struct {
+	App      string    `json:"app"`
+	Since    time.Time `json:"since"`
+	Position int       `json:"position,omitempty"`
+	ready    chan struct{}
+}
+
+func newDeployQueue(limit int) *deployQueue {
+	if limit <= 0 {
+		limit = defaultMaxConcurrentDeploys
+	}
+	return &deployQueue{limit: limit}
+}
+
+// acquire waits for a deploy slot for app. onQueued is called with the
+// 1-based queue position when the deploy has to wait. The returned release
+// frees the slot; on error the deploy has left the queue and holds nothing.
+func (q *deployQueue) acquire(ctx context.Context, app string, onQueued func(position int)) (release func(), err error) {
+	t := &deployTicket{App: app, Since: time.Now(), ready: make(chan struct{})}
+	q.mu.Lock()
+	if len(q.running) < q.limit && len(q.waiting) == 0 {
+		q.running = append(q.running, t)
+		q.mu.Unlock()
+		return func() { q.release(t) }, nil
+	}
+	q.waiting = append(q.waiting, t)
+	position := len(q.waiting)
+	q.mu.Unlock()
+	if onQueued != nil {
+		onQueued(position)
+	}
+
+	select {
+	case <-t.ready:
+		return func() { q.release(t) }, nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		select {
+		case <-t.ready:
+			// Promoted while giving up: hand the slot on instead of leaking it.
+			q.removeRunning(t)
+			q.promote()
+		default:
+			q.waiting = removeTicket(q.waiting, t)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (q *deployQueue) release(t *deployTicket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.removeRunning(t)
+	q.promote()
+}
+
+func (q *deployQueue) removeRunning(t *deployTicket) {
+	q.running = removeTicket(q.running, t)
+}
+
+// promote moves waiters into free slots, oldest first. Callers hold q.mu.
+func (q *deployQueue) promote() {
+	for len(q.running) < q.limit && len(q.waiting) > 0 {
+		next := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		q.running = append(q.running, next)
+		close(next.ready)
+	}
+}
+
+func removeTicket(ts []*deployTicket, t *deployTicket) []*deployTicket {
+	for i, x := range ts {
+		if x == t {
+			return append(ts[:i:i], ts[i+1:]...)
+		}
+	}
+	return ts
+}
+
+// snapshot is the running deploys and the queue behind them, in order.
+func (q *deployQueue) snapshot() (running, waiting []deployTicket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, t := range q.running {
+		running = append(running, deployTicket{App: t.App, Since: t.Since})
+	}
+	for i, t := range q.waiting {
+		waiting = append(waiting, deployTicket{App: t.App, Since: t.Since, Position: i + 1})
+	}
+	return running, waiting
+}
+
+// handleQueue reports the deploys holding a slot and those waiting for one,
+// so a client whose ship is queued can poll its position.
+func (ch *CommandHandler) handleQueue(args map[string]any) types.Response {
+	running, waiting := ch.deployQueue.snapshot()
+	msg := fmt.Sprintf("Deploys running: %d/%d", len(running), ch.deployQueue.limit)
+	for _, t := range running {
+		msg += fmt.Sprintf("\n  %-24s running for %s", t.App, time.Since(t.Since).Round(time.Second))
+	}
+	if len(waiting) > 0 {
+		msg += fmt.Sprintf("\nQueued: %d", len(waiting))
+		for _, t := range waiting {
+			msg += fmt.Sprintf("\n  %2d. %-20s waiting %s", t.Position, t.App, time.Since(t.Since).Round(time.Second))
+		}
+	}
+	if app, ok := StringArg(args, "appName"); ok && app != "" {
+		for _, t := range waiting {
+			if t.App == app {
+				msg += fmt.Sprintf("\n%s is at position %d", app, t.Position)
+			}
+		}
+	}
+	return types.Response{
+		Success: true,
+		Message: msg,
+		Data:    map[string]any{"limit": ch.deployQueue.limit, "running": running, "waiting": waiting},
+	}
+}
@@ -0,0 +1,237 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// devicesFile, in the app directory, records the device nodes each release
+// was shipped with by release ID, so a rollback re-grants them (if
+// allowed_devices still permits). Like placementFile it is kept out of the
+// release directories, which the tarball and the running app control.
+const devicesFile = "devices.json"
+
+var (
+	devicePath = regexp.MustCompile(`^/dev/[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*$`)
+	gpuIndex   = regexp.MustCompile(`^[0-9]{1,2}$`)
+)
+
+// nvidiaControlDevices are the nodes every CUDA process opens besides its
+// GPUs' /dev/nvidiaN.
+var nvidiaControlDevices = []string{"/dev/nvidiactl", "/dev/nvidia-uvm"}
+
+// deviceGrant is one device node a release's unit may use. Group is the
+// node's group, which the unit joins so the nextdeploy user can open it; ""
+// when the node belongs to root's group.
+type deviceGrant struct {
+	Path  string
+	Group string
+}
+
+// parseDevices turns the ship's gpus and devices arguments into the device
+// nodes the release asks for. gpus is "all" or "device=0,1" as with docker
+// run --gpus, and means the NVIDIA nodes of those GPUs; devices lists host
+// device paths such as "/dev/dri/renderD128". Every node must match
+// allowed_devices: with that unset, device passthrough is off.
+func parseDevices(gpus, devices any, allowed []string) ([]string, error) {
+	var paths []string
+	if gpus != nil {
+		s, ok := gpus.(string)
+		if !ok {
+			return nil, fmt.Errorf("gpus must be \"all\" or \"device=N[,N...]\"")
+		}
+		nodes, err := gpuDevices(s)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, nodes...)
+	}
+	if devices != nil {
+		list, ok := devices.([]any)
+		if !ok {
+			return nil, fmt.Errorf("devices must be a list of device paths")
+		}
+		for _, d := range list {
+			s, ok := d.(string)
+			if !ok {
+				return nil, fmt.Errorf("device %v must be a path such as /dev/dri/renderD128", d)
+			}
+			paths = append(paths, s)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("device passthrough is disabled on this host; list the devices apps may use in the daemon's allowed_devices")
+	}
+
+	var out []string
+	for _, p := range paths {
+		if !devicePath.MatchString(p) || filepath.Clean(p) != p {
+			return nil, fmt.Errorf("device %q is invalid: want a path under /dev", p)
+		}
+		if !deviceAllowed(p, allowed) {
+			return nil, fmt.Errorf("device %s is not allowed (allowed_devices: %s)", p, strings.Join(allowed, ", "))
+		}
+		if !slices.Contains(out, p) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// gpuDevices maps a docker-style --gpus value to NVIDIA device nodes.
+func gpuDevices(gpus string) ([]string, error) {
+	nodes := slices.Clone(nvidiaControlDevices)
+	if gpus == "all" {
+		found, _ := filepath.Glob("/dev/nvidia[0-9]*")
+		if len(found) == 0 {
+			return nil, fmt.Errorf("gpus=all: no NVIDIA GPUs found on this host")
+		}
+		return append(nodes, found...), nil
+	}
+	list, ok := strings.CutPrefix(gpus, "device=")
+	if !ok || list == "" {
+		return nil, fmt.Errorf("gpus %q is invalid: want \"all\" or \"device=N[,N...]\"", gpus)
+	}
+	for _, idx := range strings.Split(list, ",") {
+		if !gpuIndex.MatchString(idx) {
+			return nil, fmt.Errorf("gpus %q is invalid: %q is not a GPU index", gpus, idx)
+		}
+		nodes = append(nodes, "/dev/nvidia"+idx)
+	}
+	return nodes, nil
+}
+
+// deviceAllowed reports whether path matches one of the allowed_devices
+// patterns, which are paths or globs such as "/dev/nvidia*".
+func deviceAllowed(path string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDevices checks that each requested node is a device on this host,
+// still allowed, and finds the group the unit must join to open it.
+func resolveDevices(paths []string, allowed []string) ([]deviceGrant, error) {
+	grants := make([]deviceGrant, 0, len(paths))
+	for _, p := range paths {
+		if !deviceAllowed(p, allowed) {
+			return nil, fmt.Errorf("device %s is no longer in allowed_devices", p)
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("device %s: %w", p, err)
+		}
+		if fi.Mode()&os.ModeDevice == 0 {
+			return nil, fmt.Errorf("%s is not a device node", p)
+		}
+		g := deviceGrant{Path: p}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Gid != 0 {
+			gid := strconv.FormatUint(uint64(st.Gid), 10)
+			g.Group = gid
+			if grp, err := user.LookupGroupId(gid); err == nil {
+				g.Group = grp.Name
+			}
+		}
+		grants = append(grants, g)
+	}
+	return grants, nil
+}
+
+// renderDevices grants the unit its devices. DeviceAllow= also limits the
+// unit's cgroup to those nodes plus the standard pseudo-devices, so it is
+// only emitted when a release asks for a device.
+func renderDevices(grants []deviceGrant) string {
+	if len(grants) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	var groups []string
+	for _, g := range grants {
+		fmt.Fprintf(&b, "DeviceAllow=%s rw\n", g.Path)
+		if g.Group != "" && !slices.Contains(groups, g.Group) {
+			groups = append(groups, g.Group)
+		}
+	}
+	if len(groups) > 0 {
+		fmt.Fprintf(&b, "SupplementaryGroups=%s\n", strings.Join(groups, " "))
+	}
+	return "\n# --- Devices (opt-in via ship --gpus/--device) ---\n" + b.String()
+}
+
+// devicePaths is the paths of grants, for responses.
+func devicePaths(grants []deviceGrant) []string {
+	paths := make([]string, len(grants))
+	for i, g := range grants {
+		paths[i] = g.Path
+	}
+	return paths
+}
+
+// writeDevices records the device paths of releaseID in appDir, dropping
+// the records of releases that have since been pruned.
+func writeDevices(appDir, releaseID string, paths []string) error {
+	all := readAllDevices(appDir)
+	for id := range all {
+		if _, err := os.Stat(filepath.Join(appDir, "releases", id)); err != nil {
+			delete(all, id)
+		}
+	}
+	delete(all, releaseID)
+	if len(paths) > 0 {
+		all[releaseID] = paths
+	}
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(appDir, devicesFile)
+	// #nosec G306 -- device paths are not secret
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readDevices returns the device paths recorded for releaseID in appDir, or
+// nil for a release shipped without any. The paths are checked again as
+// parseDevices does, since they are rendered into a unit file; a record that
+// fails is ignored.
+func readDevices(appDir, releaseID string) []string {
+	paths := readAllDevices(appDir)[releaseID]
+	for _, p := range paths {
+		if !devicePath.MatchString(p) {
+			log.Printf("[devices] Warning: ignoring invalid device %q recorded for release %s", p, releaseID)
+			return nil
+		}
+	}
+	return paths
+}
+
+// readAllDevices returns every record in appDir's devicesFile.
+func readAllDevices(appDir string) map[string][]string {
+	all := map[string][]string{}
+	// #nosec G304 -- fixed file name inside a validated app directory
+	data, err := os.ReadFile(filepath.Join(appDir, devicesFile))
+	if err != nil {
+		return all
+	}
+	if json.Unmarshal(data, &all) != nil || all == nil {
+		return map[string][]string{}
+	}
+	return all
+}
@@ -0,0 +1,185 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+	"github.com/aynaash/nextdeploy/shared/nextcore"
+)
+
+// driftItem is one way the running unit differs from what the daemon last
+// deployed for the app.
+type driftItem struct {
+	Field string `json:"field"`
+	Want  string `json:"want"`
+	Got   string `json:"got"`
+}
+
+// unitIntent is what the app's live unit should look like given the current
+// release and the daemon's state.
+type unitIntent struct {
+	Unit       string
+	Port       int
+	WorkingDir string
+	Restart    string
+	// Resources is the renderResourceLimits block of the release metadata.
+	Resources string
+}
+
+// unitObserved is what systemd reports about the unit that is actually
+// serving the app.
+type unitObserved struct {
+	Unit string
+	// Props holds `systemctl show` properties of Unit.
+	Props map[string]string
+	// UnitFile is the unit file on disk.
+	UnitFile string
+	// EnvModified is the mtime of the unit's .env.nextdeploy; zero if absent.
+	EnvModified time.Time
+}
+
+// driftProps are the `systemctl show` properties compareUnit reads.
+const driftProps = "Environment,Restart,WorkingDirectory,NeedDaemonReload,ExecMainStartTimestamp,FragmentPath"
+
+// handleDrift reports how the app's running unit has drifted from what was
+// deployed: a different release serving, a port the daemon did not assign, a
+// unit file edited by hand or not reloaded, or an env file changed after the
+// process started (e.g. `secrets set` without a restart). Data carries the
+// items for monitors; the message lists them for operators.
+func (ch *CommandHandler) handleDrift(args map[string]any) types.Response {
+	appName, ok := StringArg(args, "appName")
+	if !ok {
+		return types.Response{Success: false, Message: "missing 'appName' argument"}
+	}
+	if err := validateAppName(appName); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+
+	appDir := filepath.Join(appsDir, appName)
+	current, _, err := releaseHistory(appDir)
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to read releases: %v", err)}
+	}
+	if current == "" {
+		return types.Response{Success: true, Message: "APP_NOT_DEPLOYED"}
+	}
+	releaseDir := filepath.Join(appDir, "releases", current)
+	meta, err := readMetadata(releaseDir)
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to read metadata of %s: %v", current, err)}
+	}
+	if meta.OutputMode == nextcore.OutputModeExport {
+		return types.Response{Success: true, Message: "Static export: no unit runs, nothing to drift", Data: []driftItem{}}
+	}
+
+	want := unitIntent{
+		Unit:       fmt.Sprintf("nextdeploy-%s-%s.service", appName, current),
+		Port:       ch.stateManager.GetPort(appName),
+		WorkingDir: releaseDir,
+		Restart:    "on-failure",
+		Resources:  renderResourceLimits(meta.Resources),
+	}
+	got, err := ch.observeUnit(appName)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+
+	items := compareUnit(want, got)
+	if len(items) == 0 {
+		return types.Response{Success: true, Message: fmt.Sprintf("No drift: %s runs release %s as deployed", appName, current), Data: items}
+	}
+	lines := []string{fmt.Sprintf("%s has drifted from release %s:", appName, current)}
+	for _, it := range items {
+		lines = append(lines, fmt.Sprintf("  %s: want %s, running %s", it.Field, it.Want, it.Got))
+	}
+	return types.Response{Success: true, Message: strings.Join(lines, "\n"), Data: items}
+}
+
+// observeUnit gathers the live state of the app's active unit. An app with no
+// active unit yields an empty observation rather than an error — that is drift
+// too.
+func (ch *CommandHandler) observeUnit(appName string) (unitObserved, error) {
+	service, err := ch.findActiveService(appName)
+	if err != nil {
+		return unitObserved{}, nil
+	}
+	systemctl := resolveTool("systemctl")
+	// #nosec G204
+	out, err := exec.Command(systemctl, "show", service, "--property="+driftProps).CombinedOutput()
+	if err != nil {
+		return unitObserved{}, fmt.Errorf("failed to read unit %s: %v - %s", service, err, out)
+	}
+	got := unitObserved{Unit: service, Props: parseProps(string(out))}
+	if path := got.Props["FragmentPath"]; path != "" {
+		// #nosec G304 -- path is the unit file systemd loaded for our own unit
+		if data, err := os.ReadFile(path); err == nil {
+			got.UnitFile = string(data)
+		}
+	}
+	if dir := got.Props["WorkingDirectory"]; dir != "" {
+		if info, err := os.Stat(filepath.Join(dir, ".env.nextdeploy")); err == nil {
+			got.EnvModified = info.ModTime()
+		}
+	}
+	return got, nil
+}
+
+// compareUnit lists the differences between want and got.
+func compareUnit(want unitIntent, got unitObserved) []driftItem {
+	items := []driftItem{}
+	add := func(field, w, g string) {
+		if w != g {
+			items = append(items, driftItem{Field: field, Want: w, Got: g})
+		}
+	}
+	if got.Unit == "" {
+		return append(items, driftItem{Field: "unit", Want: want.Unit, Got: "nothing"})
+	}
+	add("unit", want.Unit, got.Unit)
+
+	port := "none"
+	for _, kv := range strings.Fields(got.Props["Environment"]) {
+		if v, ok := strings.CutPrefix(kv, "PORT="); ok {
+			port = v
+		}
+	}
+	if want.Port != 0 {
+		add("port", strconv.Itoa(want.Port), port)
+	}
+	add("working_directory", want.WorkingDir, got.Props["WorkingDirectory"])
+	add("restart", want.Restart, got.Props["Restart"])
+	for _, key := range []string{"CPUQuota", "MemoryMax", "MemoryHigh"} {
+		add(key, orNone(unitDirective(want.Resources, key)), orNone(unitDirective(got.UnitFile, key)))
+	}
+	if got.Props["NeedDaemonReload"] == "yes" {
+		add("unit_file", "loaded", "changed on disk, not reloaded")
+	}
+	if started, err := time.Parse("Mon 2006-01-02 15:04:05 MST", got.Props["ExecMainStartTimestamp"]); err == nil && got.EnvModified.After(started) {
+		add("env", "applied", fmt.Sprintf("changed at %s, after the process started; restart to apply", got.EnvModified.UTC().Format(time.RFC3339)))
+	}
+	return items
+}
+
+// unitDirective returns the value of the last key= line in a unit file body.
+func unitDirective(unit, key string) string {
+	value := ""
+	for _, line := range strings.Split(unit, "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), key+"="); ok {
+			value = v
+		}
+	}
+	return value
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
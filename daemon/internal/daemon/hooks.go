@@ -0,0 +1,172 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+)
+
+// maxHookOutput is how much of a hook's output is kept for the response; the
+// tail, since that is where a failing command says why.
+const maxHookOutput = 8 << 10
+
+// hookDeadlineMargin is kept back from a command's deadline when bounding a
+// hook: the systemd-run guard in runHookInRelease may take that long past the
+// hook's own limit, and the client still has to hear how it went.
+const hookDeadlineMargin = 30 * time.Second
+
+// hookResult is one hook's outcome, as returned to the client.
+type hookResult struct {
+	Phase  string `json:"phase"`
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Took   string `json:"took"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// hookRunner runs one hook in a release directory, with the release's volumes
+// mounted, for at most timeout, and returns its combined output. Tests replace it; the daemon
+// uses runHookInRelease.
+var hookRunner = runHookInRelease
+
+// runHooks runs hooks in order in releaseDir, stopping at the first failure,
+// which it returns along with the results so far. Each hook gets its own
+// timeout, cut short so that all of them finish before deadline, the
+// command's; a zero deadline leaves the timeouts as configured.
+func runHooks(phase string, hooks []config.Hook, releaseDir string, mounts []bindMount, deadline time.Time) ([]hookResult, error) {
+	var results []hookResult
+	for _, h := range hooks {
+		log.Printf("[hooks] %s: running %s in %s", phase, h.Label(), releaseDir)
+		start := time.Now()
+		timeout, err := hookTimeout(h, deadline, start)
+		var out []byte
+		if err == nil {
+			out, err = hookRunner(h, releaseDir, mounts, timeout)
+		}
+		r := hookResult{Phase: phase, Name: h.Label(), OK: err == nil, Took: time.Since(start).Round(time.Millisecond).String(), Output: tailString(string(out), maxHookOutput)}
+		if err != nil {
+			r.Error = err.Error()
+			results = append(results, r)
+			log.Printf("[hooks] %s: %s failed after %s: %v", phase, r.Name, r.Took, err)
+			return results, fmt.Errorf("%s hook %q failed: %w", phase, r.Name, err)
+		}
+		results = append(results, r)
+		log.Printf("[hooks] %s: %s ok (%s)", phase, r.Name, r.Took)
+	}
+	return results, nil
+}
+
+// hookTimeout is how long h may run when the command must be answered by
+// deadline: its configured timeout, or what is left of the command's time
+// if that is less.
+func hookTimeout(h config.Hook, deadline, now time.Time) (time.Duration, error) {
+	timeout := h.TimeoutOrDefault()
+	if deadline.IsZero() {
+		return timeout, nil
+	}
+	// RuntimeMaxSec counts whole seconds, and 0 would mean no limit at all.
+	left := (deadline.Sub(now) - hookDeadlineMargin).Truncate(time.Second)
+	if left < time.Second {
+		return 0, fmt.Errorf("no time left before the command's deadline")
+	}
+	return min(timeout, left), nil
+}
+
+// runHookInRelease runs the hook as a transient unit with the release unit's
+// user, environment file, volumes and sandbox, so it sees what the app sees
+// and can do no more than the app can.
+func runHookInRelease(h config.Hook, releaseDir string, mounts []bindMount, timeout time.Duration) ([]byte, error) {
+	argv, err := hookArgv(h, releaseDir)
+	if err != nil {
+		return nil, err
+	}
+	// The unit's RuntimeMaxSec stops the hook; the context only guards
+	// against systemd-run itself hanging.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+30*time.Second)
+	defer cancel()
+	// #nosec G204 -- argv is validated by Hook.validate; no shell is involved
+	return exec.CommandContext(ctx, resolveTool("systemd-run"), append(hookUnitArgs(releaseDir, timeout, mounts), argv...)...).CombinedOutput()
+}
+
+// hookUnitArgs are the systemd-run arguments that give a hook the release
+// unit's user, environment, sandbox and bind mounts, up to the "--" before
+// its command.
+func hookUnitArgs(releaseDir string, timeout time.Duration, mounts []bindMount) []string {
+	args := []string{
+		"--quiet", "--wait", "--pipe", "--collect",
+		"--uid=nextdeploy", "--gid=nextdeploy",
+		"--working-directory=" + releaseDir,
+		"-p", "EnvironmentFile=-" + filepath.Join(releaseDir, ".env.nextdeploy"),
+		"-p", "Environment=NODE_ENV=production",
+		"-p", "ProtectSystem=strict",
+		"-p", "ProtectHome=yes",
+		"-p", "PrivateTmp=yes",
+		"-p", "NoNewPrivileges=yes",
+		"-p", "ReadWritePaths=" + releaseDir,
+		"-p", fmt.Sprintf("RuntimeMaxSec=%d", int(timeout.Seconds())),
+	}
+	// A migration writing to an uploads volume must see the same mounts
+	// the app will.
+	for _, m := range mounts {
+		key := "BindPaths"
+		if m.ReadOnly {
+			key = "BindReadOnlyPaths"
+		}
+		args = append(args, "-p", fmt.Sprintf("%s=%s:%s", key, m.Source, m.Target))
+	}
+	return append(args, "--")
+}
+
+// hookArgv resolves a hook's executable the way renderStartCommand does: a
+// path with a slash is relative to the release and must exist there, a bare
+// name is looked up like node or npm. Callers validate the hooks first.
+func hookArgv(h config.Hook, releaseDir string) ([]string, error) {
+	exe := h.Run[0]
+	switch {
+	case filepath.IsAbs(exe):
+	case strings.Contains(exe, "/"):
+		exe = filepath.Join(releaseDir, exe)
+		if _, err := os.Stat(exe); err != nil {
+			return nil, fmt.Errorf("hook executable %s not found in release: %w", exe, err)
+		}
+	default:
+		exe = resolveBinary(exe)
+	}
+	return append([]string{exe}, h.Run[1:]...), nil
+}
+
+// hookSummary renders results one line each, with the output of a failed
+// hook below it.
+func hookSummary(results []hookResult) string {
+	var b strings.Builder
+	for _, r := range results {
+		status := "ok"
+		if !r.OK {
+			status = "FAILED: " + r.Error
+		}
+		fmt.Fprintf(&b, "\n  %s %-20s %-8s %s", r.Phase, r.Name, r.Took, status)
+		if !r.OK && r.Output != "" {
+			b.WriteString("\n" + indent(strings.TrimRight(r.Output, "\n"), "    | "))
+		}
+	}
+	return b.String()
+}
+
+func tailString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "…" + s[len(s)-n:]
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
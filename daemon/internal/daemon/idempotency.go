@@ -0,0 +1,168 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+)
+
+const (
+	// idempotencyFile sits next to the daemon's state file.
+	idempotencyFile       = "idempotency.json"
+	defaultIdempotencyTTL = 24 * time.Hour
+	// maxIdempotencyRecords bounds the file when a client sends a fresh key
+	// with every command; the oldest records go first.
+	maxIdempotencyRecords = 1000
+)
+
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// idempotencyRecord is the response a command returned for a key.
+type idempotencyRecord struct {
+	Command  string         `json:"command"`
+	Response types.Response `json:"response"`
+	At       time.Time      `json:"at"`
+}
+
+// idempotencyStore makes a command carrying an idempotency_key run at most
+// once per app and key within the TTL: a retry gets the first call's
+// response, so a CI job that lost the response to a network blip can retry a
+// deploy without shipping twice. Failures are remembered too and a new
+// attempt needs a new key, except a retryable refusal (the app or the host
+// was busy), which never ran and so is not recorded. Records are persisted
+// so a retry across a daemon restart is still caught.
+type idempotencyStore struct {
+	mu       sync.Mutex
+	path     string
+	ttl      time.Duration
+	now      func() time.Time
+	records  map[string]idempotencyRecord // app/key -> record
+	inflight map[string]string            // app/key -> command
+}
+
+func newIdempotencyStore(path string, ttl time.Duration) *idempotencyStore {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	s := &idempotencyStore{path: path, ttl: ttl, now: time.Now, records: map[string]idempotencyRecord{}, inflight: map[string]string{}}
+	// #nosec G304 -- path derived from the daemon's state directory
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[idempotency] Warning: failed to read %s: %v", path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.records); err != nil {
+		log.Printf("[idempotency] Warning: ignoring unreadable %s: %v", path, err)
+		s.records = map[string]idempotencyRecord{}
+	}
+	return s
+}
+
+// Do runs command for app once per key and returns its response, or the
+// recorded response when the key was already used for app within the TTL. A
+// key still running, or used for a different command, is refused rather
+// than run again. app is "" for a command that names no app.
+func (s *idempotencyStore) Do(app, key, command string, run func() types.Response) types.Response {
+	if !idempotencyKeyPattern.MatchString(key) {
+		return types.Response{Success: false, Message: "idempotency_key must be 1-128 letters, digits, '.', '_', ':' or '-'"}
+	}
+	id := app + "/" + key
+
+	s.mu.Lock()
+	s.expire()
+	if rec, ok := s.records[id]; ok {
+		s.mu.Unlock()
+		if rec.Command != command {
+			return types.Response{Success: false, Message: fmt.Sprintf("idempotency key %q was already used for %s", key, rec.Command)}
+		}
+		log.Printf("[idempotency] %s with key %q already ran at %s; returning its response", command, key, rec.At.Format(time.RFC3339))
+		return rec.Response
+	}
+	if running, ok := s.inflight[id]; ok {
+		s.mu.Unlock()
+		return types.Response{Success: false, Message: fmt.Sprintf("a %s with idempotency key %q is still running; retry once it finishes", running, key)}
+	}
+	s.inflight[id] = command
+	s.mu.Unlock()
+
+	resp := run()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inflight, id)
+	if isRetryable(resp) {
+		return resp
+	}
+	s.records[id] = idempotencyRecord{Command: command, Response: resp, At: s.now().UTC()}
+	s.trim()
+	if err := s.save(); err != nil {
+		log.Printf("[idempotency] Warning: failed to persist %s: %v", s.path, err)
+	}
+	return resp
+}
+
+// retryableResponse refuses a command that did not run because the app or
+// the host was busy; the same command may succeed later, so it is not
+// recorded against an idempotency key.
+func retryableResponse(msg string) types.Response {
+	return types.Response{Success: false, Message: msg, Data: map[string]any{"retryable": true}}
+}
+
+// isRetryable reports whether resp came from retryableResponse.
+func isRetryable(resp types.Response) bool {
+	data, ok := resp.Data.(map[string]any)
+	return ok && !resp.Success && data["retryable"] == true
+}
+
+// expire drops records older than the TTL. Callers hold s.mu.
+func (s *idempotencyStore) expire() {
+	cutoff := s.now().Add(-s.ttl)
+	for k, rec := range s.records {
+		if rec.At.Before(cutoff) {
+			delete(s.records, k)
+		}
+	}
+}
+
+// trim drops the oldest records beyond maxIdempotencyRecords. Callers hold
+// s.mu.
+func (s *idempotencyStore) trim() {
+	if len(s.records) <= maxIdempotencyRecords {
+		return
+	}
+	keys := make([]string, 0, len(s.records))
+	for k := range s.records {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return s.records[keys[i]].At.Before(s.records[keys[j]].At) })
+	for _, k := range keys[:len(keys)-maxIdempotencyRecords] {
+		delete(s.records, k)
+	}
+}
+
+// save writes the records, write-then-rename like StateManager.Save. Callers
+// hold s.mu.
+func (s *idempotencyStore) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o750); err != nil {
+		return err
+	}
+	data, err := json.Marshal(s.records)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
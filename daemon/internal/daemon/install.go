@@ -0,0 +1,132 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DaemonUnit is the unit nextdeployd runs as; the prepare playbook writes the
+// same one.
+const DaemonUnit = "nextdeployd.service"
+
+// systemdBooted is where systemd marks a host it booted (sd_booted(3)).
+const systemdBooted = "/run/systemd/system"
+
+// DaemonUnitOptions are the settings baked into the daemon's unit.
+type DaemonUnitOptions struct {
+	Executable string
+	ConfigPath string
+	// SocketPath overrides the socket; empty keeps the daemon's default in
+	// /run/nextdeployd, which the unit's RuntimeDirectory creates.
+	SocketPath string
+}
+
+// RenderDaemonUnit is the unit that starts nextdeployd on boot and restarts
+// it if it dies. It matches what prepare installs, with the binary, config
+// and socket taken from opts.
+func RenderDaemonUnit(opts DaemonUnitOptions) string {
+	cmdline := []string{systemdQuote(opts.Executable), "--foreground=true"}
+	if opts.ConfigPath != "" {
+		cmdline = append(cmdline, "--config="+systemdQuote(opts.ConfigPath))
+	}
+	if opts.SocketPath != "" {
+		cmdline = append(cmdline, "--socket-path="+systemdQuote(opts.SocketPath))
+	}
+	return fmt.Sprintf(`[Unit]
+Description=NextDeploy Daemon
+Documentation=https://nextdeploy.org/docs
+After=network.target caddy.service
+Wants=caddy.service
+
+[Service]
+Type=simple
+User=root
+ExecStart=%s
+Restart=on-failure
+RestartSec=5s
+StandardOutput=journal
+StandardError=journal
+SyslogIdentifier=nextdeployd
+
+# systemd creates /run/nextdeployd/ (socket) and /var/log/nextdeployd/
+# (logs) before the service starts and removes them on stop.
+RuntimeDirectory=nextdeployd
+RuntimeDirectoryMode=0755
+RuntimeDirectoryGroup=nextdeploy
+LogsDirectory=nextdeployd
+LogsDirectoryMode=0755
+LogsDirectoryGroup=nextdeploy
+
+NoNewPrivileges=yes
+CapabilityBoundingSet=CAP_DAC_OVERRIDE CAP_NET_BIND_SERVICE CAP_CHOWN CAP_FOWNER
+
+[Install]
+WantedBy=multi-user.target
+`, strings.Join(cmdline, " "))
+}
+
+// checkSystemdHost refuses hosts the unit cannot work on: not root, or not
+// booted by systemd (OpenRC, runit, a container without an init).
+func checkSystemdHost() error {
+	if os.Geteuid() != 0 {
+		return errors.New("must be run as root (try sudo)")
+	}
+	if _, err := os.Stat(systemdBooted); err != nil {
+		return errors.New("this host was not booted with systemd; run nextdeployd under your init system by hand (nextdeployd --foreground)")
+	}
+	return nil
+}
+
+// InstallDaemonService writes the daemon's unit, reloads systemd, and
+// enables and starts it. Running it again rewrites the unit and restarts.
+func InstallDaemonService(opts DaemonUnitOptions) error {
+	if err := checkSystemdHost(); err != nil {
+		return err
+	}
+	pm := NewProcessManager()
+	unitPath := filepath.Join(pm.systemdDir, DaemonUnit)
+	// #nosec G306 -- unit files are world-readable by convention
+	if err := os.WriteFile(unitPath, []byte(RenderDaemonUnit(opts)), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", unitPath, err)
+	}
+	log.Printf("[install] Wrote %s", unitPath)
+	if err := pm.reloadDaemon(); err != nil {
+		return err
+	}
+	if err := runSystemctl("enable", DaemonUnit); err != nil {
+		return err
+	}
+	return runSystemctl("restart", DaemonUnit)
+}
+
+// UninstallDaemonService stops and disables the daemon and removes its unit.
+// Apps, releases and config are left in place.
+func UninstallDaemonService() error {
+	if err := checkSystemdHost(); err != nil {
+		return err
+	}
+	pm := NewProcessManager()
+	unitPath := filepath.Join(pm.systemdDir, DaemonUnit)
+	if err := runSystemctl("disable", "--now", DaemonUnit); err != nil {
+		log.Printf("[install] Warning: %v", err)
+	}
+	if err := os.Remove(unitPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %s: %w", unitPath, err)
+	}
+	log.Printf("[install] Removed %s", unitPath)
+	return pm.reloadDaemon()
+}
+
+// runSystemctl runs one systemctl call and returns its output on failure.
+func runSystemctl(args ...string) error {
+	// #nosec G204 -- fixed verbs and unit names
+	if out, err := exec.Command(resolveTool("systemctl"), args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("systemctl %s: %w - %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package daemon
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+)
+
+// defaultLogExportDir is where logs --export may write when log_export_dirs
+// is unset.
+const defaultLogExportDir = "/var/lib/nextdeployd/log-exports"
+
+// checkExportPath resolves where a log export may be written: an absolute
+// path to a new file under one of the allowed directories, after symlinks in
+// its directory are resolved. The directory is checked before it is created,
+// so a symlink out of the allowlist cannot make the daemon create
+// directories elsewhere. The daemon runs as root, so without the allowlist
+// an export could overwrite any file on the host.
+func checkExportPath(path string, allowed []string) (string, error) {
+	if len(allowed) == 0 {
+		allowed = []string{defaultLogExportDir}
+	}
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path {
+		return "", fmt.Errorf("export path %q must be a clean absolute path", path)
+	}
+	for _, dir := range allowed {
+		if !withinDir(path, dir) {
+			continue
+		}
+		realAllowed, err := resolveExisting(dir)
+		if err != nil {
+			return "", err
+		}
+		realDir, err := resolveExisting(filepath.Dir(path))
+		if err != nil {
+			return "", err
+		}
+		if realDir != realAllowed && !withinDir(realDir, realAllowed) {
+			return "", fmt.Errorf("export path %q leaves %s through a symlink", path, dir)
+		}
+		// #nosec G301 -- created under an allowlisted directory; exports are 0600
+		if err := os.MkdirAll(realDir, 0o750); err != nil {
+			return "", fmt.Errorf("failed to create export directory: %w", err)
+		}
+		// A symlink swapped in while the directory was created.
+		if again, err := filepath.EvalSymlinks(realDir); err != nil || again != realDir {
+			return "", fmt.Errorf("export directory %s changed while it was created", realDir)
+		}
+		return filepath.Join(realDir, filepath.Base(path)), nil
+	}
+	return "", fmt.Errorf("export path %q is not under an allowed directory (%s); see log_export_dirs", path, strings.Join(allowed, ", "))
+}
+
+// resolveExisting resolves the symlinks of path's deepest existing ancestor
+// and appends the components below it, which do not exist yet.
+func resolveExisting(path string) (string, error) {
+	rest := ""
+	for p := path; ; p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); err == nil {
+			real, err := filepath.EvalSymlinks(p)
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(real, rest), nil
+		} else if !os.IsNotExist(err) || p == filepath.Dir(p) {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+	}
+}
+
+// writeLogExport copies r into a new file at path, gzip-compressed when the
+// name ends in .gz, and returns the log bytes read and the file's size. An
+// existing file is never overwritten, and a failed export leaves no file.
+func writeLogExport(path string, r io.Reader) (int64, int64, error) {
+	// #nosec G304 -- path checked by checkExportPath
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return 0, 0, err
+	}
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		zw = gzip.NewWriter(f)
+		w = zw
+	}
+	n, err := io.Copy(w, r)
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return 0, 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return n, 0, err
+	}
+	return n, info.Size(), nil
+}
+
+// exportLogs writes the whole journal of units (since since, if set) to
+// path on this host and reports where and how much, instead of sending the
+// logs over the socket.
+func exportLogs(units []string, since, path string) types.Response {
+	args := []string{"--no-pager", "-o", "short-iso"}
+	if len(units) > 1 {
+		args[2] = "with-unit"
+	}
+	for _, u := range units {
+		args = append(args, "-u", u)
+	}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	// #nosec G204 -- units come from systemd, since is validated
+	cmd := exec.Command(resolveTool("journalctl"), args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to read journal: %v", err)}
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to read journal: %v", err)}
+	}
+	logBytes, fileBytes, writeErr := writeLogExport(path, out)
+	if writeErr != nil {
+		// Unblock journalctl, which may still be writing into the pipe.
+		_, _ = io.Copy(io.Discard, out)
+	}
+	if err := cmd.Wait(); err != nil {
+		// A failed writeLogExport has already removed its file, or never
+		// created one because path existed; that file is not ours.
+		if writeErr == nil {
+			_ = os.Remove(path)
+		}
+		return types.Response{Success: false, Message: fmt.Sprintf("journalctl failed: %v - %s", err, strings.TrimSpace(stderr.String()))}
+	}
+	if writeErr != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to export logs to %s: %v", path, writeErr)}
+	}
+	return types.Response{
+		Success: true,
+		Message: fmt.Sprintf("Exported %d bytes of logs from %s to %s (%d bytes on disk)", logBytes, strings.Join(units, ", "), path, fileBytes),
+		Data:    map[string]any{"path": path, "bytes": logBytes, "fileBytes": fileBytes, "units": units},
+	}
+}
@@ -0,0 +1,133 @@
+package daemon
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+)
+
+// Limits on a logs --grep search. The scan is bounded by the journal lines
+// read; the reply by the lines and bytes sent back, keeping the most recent.
+const (
+	defaultLogScanLines = 10000
+	maxLogScanLines     = 200000
+	maxLogMatchLines    = 1000
+	maxLogMatchBytes    = 1 << 20
+	maxGrepPatternLen   = 512
+)
+
+// journalSince accepts what journalctl --since does ("2024-05-01 10:00",
+// "-1h", "yesterday") but nothing that could read as another argument.
+var journalSince = regexp.MustCompile(`^[0-9A-Za-z :.+-]{1,64}$`)
+
+// logSearch is a server-side filter over an app's journal.
+type logSearch struct {
+	pattern *regexp.Regexp
+	invert  bool
+	since   string
+	scan    int // journal lines to read, newest last
+}
+
+// parseLogSearch reads the grep, invert, since and tail arguments of a logs
+// command. grep is an RE2 regular expression, so plain text matches as a
+// substring and no pattern can backtrack without bound.
+func parseLogSearch(args map[string]any) (*logSearch, error) {
+	raw, _ := StringArg(args, "grep")
+	if raw == "" || len(raw) > maxGrepPatternLen {
+		return nil, fmt.Errorf("grep pattern must be 1-%d characters", maxGrepPatternLen)
+	}
+	re, err := regexp.Compile(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grep pattern: %v", err)
+	}
+	s := &logSearch{pattern: re, scan: defaultLogScanLines}
+	s.invert, _ = args["invert"].(bool)
+	if since, ok := StringArg(args, "since"); ok && since != "" {
+		if !journalSince.MatchString(since) {
+			return nil, fmt.Errorf("invalid since %q: use a journalctl time like \"-1h\" or \"2024-05-01 10:00\"", since)
+		}
+		s.since = since
+	}
+	if v, ok := args["tail"].(float64); ok && v > 0 {
+		s.scan = min(int(v), maxLogScanLines)
+	}
+	return s, nil
+}
+
+// logMatches is the outcome of filtering a journal.
+type logMatches struct {
+	Lines     []string `json:"-"`
+	Matched   int      `json:"matched"`
+	Scanned   int      `json:"scanned"`
+	Truncated bool     `json:"truncated"`
+}
+
+// filterLogLines keeps the lines of r that match s (or do not, with invert).
+// When more match than fit in the reply, the oldest are dropped.
+func filterLogLines(r io.Reader, s *logSearch) (logMatches, error) {
+	var m logMatches
+	size := 0
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		m.Scanned++
+		if s.pattern.MatchString(line) == s.invert {
+			continue
+		}
+		m.Matched++
+		m.Lines = append(m.Lines, line)
+		size += len(line) + 1
+		for len(m.Lines) > maxLogMatchLines || size > maxLogMatchBytes {
+			size -= len(m.Lines[0]) + 1
+			m.Lines = m.Lines[1:]
+			m.Truncated = true
+		}
+	}
+	return m, sc.Err()
+}
+
+// searchLogs reads the last s.scan journal lines of units and filters them
+// here, so only the matches cross the socket.
+func searchLogs(units []string, s *logSearch) types.Response {
+	args := []string{"--no-pager", "-o", "short-iso", "-n", fmt.Sprint(s.scan)}
+	if len(units) > 1 {
+		args[2] = "with-unit"
+	}
+	for _, u := range units {
+		args = append(args, "-u", u)
+	}
+	if s.since != "" {
+		args = append(args, "--since="+s.since)
+	}
+	// #nosec G204 -- units come from systemd, since is validated
+	cmd := exec.Command(resolveTool("journalctl"), args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to read journal: %v", err)}
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to read journal: %v", err)}
+	}
+	m, scanErr := filterLogLines(out, s)
+	if err := cmd.Wait(); err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("journalctl failed: %v - %s", err, strings.TrimSpace(stderr.String()))}
+	}
+	if scanErr != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to read journal: %v", scanErr)}
+	}
+
+	summary := fmt.Sprintf("-- %d of %d scanned lines matched", m.Matched, m.Scanned)
+	if m.Truncated {
+		summary += fmt.Sprintf("; showing the last %d", len(m.Lines))
+	}
+	m.Lines = append(m.Lines, summary+" --")
+	return types.Response{Success: true, Message: strings.Join(m.Lines, "\n"), Data: m}
+}
@@ -0,0 +1,174 @@
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+	"github.com/aynaash/nextdeploy/shared/caddy"
+)
+
+const (
+	// maintenanceDir, in the app directory, holds the page Caddy serves while
+	// the app is in maintenance; it exists only for that long.
+	maintenanceDir = "maintenance"
+	// maintenanceRetryAfter is the Retry-After, in seconds, sent with the
+	// maintenance page.
+	maintenanceRetryAfter = 30
+)
+
+// defaultMaintenancePage is served when the release sets no
+// app.maintenance_page.
+const defaultMaintenancePage = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="30">
+<title>Be right back</title>
+<style>
+body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;font-family:system-ui,sans-serif;background:#fafafa;color:#222}
+main{text-align:center;padding:2rem}
+h1{font-size:1.5rem;margin:0 0 .5rem}
+p{margin:0;color:#666}
+</style>
+</head>
+<body>
+<main>
+<h1>Be right back</h1>
+<p>We're updating this site. This page will reload in a few seconds.</p>
+</main>
+</body>
+</html>
+`
+
+// inMaintenance reports whether the app's site is serving the maintenance
+// page.
+func inMaintenance(appName string) bool {
+	_, err := os.Stat(filepath.Join(appsDir, appName, maintenanceDir, "index.html"))
+	return err == nil
+}
+
+// writeMaintenancePage writes page, or the built-in page when it is empty,
+// to dir/index.html for Caddy to serve.
+func writeMaintenancePage(dir, page string) error {
+	if page == "" {
+		page = defaultMaintenancePage
+	}
+	// #nosec G301 -- served by Caddy, needs group/other traversal
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// #nosec G306 -- a public page, read by Caddy
+	return os.WriteFile(filepath.Join(dir, "index.html"), []byte(page), 0o644)
+}
+
+// enterMaintenance points the app's site at its maintenance page, so that
+// while its units are down visitors get a 503 with Retry-After instead of a
+// connection error. The next routeSite (a ship, rollback or `maintenance
+// --off`) takes the page down again.
+func (ch *CommandHandler) enterMaintenance(appName string) error {
+	releaseDir, err := filepath.EvalSymlinks(filepath.Join(appsDir, appName, "current"))
+	if err != nil {
+		return fmt.Errorf("%s has no live release to put into maintenance", appName)
+	}
+	meta, err := readMetadata(releaseDir)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata of %s: %w", filepath.Base(releaseDir), err)
+	}
+	dir := filepath.Join(appsDir, appName, maintenanceDir)
+	if err := writeMaintenancePage(dir, meta.MaintenancePage); err != nil {
+		return fmt.Errorf("failed to write maintenance page: %w", err)
+	}
+	site := caddy.Site{Domain: Coalesce(meta.Domain, "localhost"), Aliases: meta.DomainAliases, Redirect: meta.DomainRedirect}
+	if err := ch.caddyManager.EnsureMainCaddyfile(); err != nil {
+		_ = os.RemoveAll(dir)
+		return fmt.Errorf("failed to update main Caddyfile: %w", err)
+	}
+	if err := ch.caddyManager.GenerateMaintenanceConfig(appName, site, dir, maintenanceRetryAfter); err != nil {
+		_ = os.RemoveAll(dir)
+		return fmt.Errorf("failed to configure Caddy: %w", err)
+	}
+	if err := ch.caddyManager.Validate(); err != nil {
+		return fmt.Errorf("Caddy validation failed: %w", err)
+	}
+	_ = ch.caddyManager.Reload()
+	log.Printf("[maintenance] %s is serving its maintenance page", appName)
+	return nil
+}
+
+// leaveMaintenance routes the app's site back to its live release, and to
+// its canary when one is running.
+func (ch *CommandHandler) leaveMaintenance(appName string) error {
+	releaseDir, err := filepath.EvalSymlinks(filepath.Join(appsDir, appName, "current"))
+	if err != nil {
+		return fmt.Errorf("%s has no live release to route to", appName)
+	}
+	ctx, err := siteContext(appName, releaseDir)
+	if err != nil {
+		return err
+	}
+	port := ch.stateManager.GetPort(appName)
+	upstreams := []caddy.Upstream{{Port: port, Weight: 1}}
+	st, err := readCanary(appName)
+	if err != nil {
+		return fmt.Errorf("cannot read the canary state of %s: %w", appName, err)
+	}
+	if st != nil {
+		upstreams = canaryUpstreams(port, st.Port, st.Weight)
+	}
+	return ch.routeSite(ctx, upstreams)
+}
+
+// clearMaintenance removes the maintenance page once the app's site routes
+// to a release again.
+func clearMaintenance(appName string) {
+	if !inMaintenance(appName) {
+		return
+	}
+	if err := os.RemoveAll(filepath.Join(appsDir, appName, maintenanceDir)); err != nil {
+		log.Printf("[maintenance] Warning: failed to remove the maintenance page of %s: %v", appName, err)
+		return
+	}
+	log.Printf("[maintenance] %s is routed to its release again", appName)
+}
+
+// handleMaintenance puts an app's site into maintenance (action "on") or
+// routes it back to the app ("off"). It leaves the app's units alone: `stop
+// --maintenance` stops them behind the page, and the next ship replaces it.
+func (ch *CommandHandler) handleMaintenance(args map[string]any) types.Response {
+	appName, ok := StringArg(args, "appName")
+	if !ok {
+		return types.Response{Success: false, Message: "missing 'appName' argument"}
+	}
+	if err := validateAppName(appName); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	action, _ := StringArg(args, "action")
+
+	release, ok := ch.deployLocks.tryAcquire(appName)
+	if !ok {
+		return busyResponse(appName)
+	}
+	defer release()
+
+	switch action {
+	case "on":
+		if err := ch.enterMaintenance(appName); err != nil {
+			return types.Response{Success: false, Message: err.Error()}
+		}
+		return types.Response{Success: true, Message: fmt.Sprintf("%s is serving its maintenance page (503, Retry-After: %d) until the next ship or `nextdeployd maintenance --off`", appName, maintenanceRetryAfter)}
+	case "off":
+		if !inMaintenance(appName) {
+			return types.Response{Success: false, Message: fmt.Sprintf("%s is not in maintenance", appName)}
+		}
+		if err := ch.leaveMaintenance(appName); err != nil {
+			return types.Response{Success: false, Message: err.Error()}
+		}
+		return types.Response{Success: true, Message: fmt.Sprintf("%s is routed to its live release again", appName)}
+	default:
+		return types.Response{Success: false, Message: fmt.Sprintf("unknown maintenance action %q (want on or off)", action)}
+	}
+}
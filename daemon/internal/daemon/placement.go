@@ -0,0 +1,148 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// placementFile, in the app directory, records the placement labels of each
+// release by release ID, so a rollback re-activates a release with the labels
+// it was shipped with. It is kept out of the release directories: the
+// tarball chooses their contents and the running app may write to them, and
+// the labels end up in a unit file run by root.
+const placementFile = "placement.json"
+
+// defaultPlacementKeys apply when placement_keys is unset.
+var defaultPlacementKeys = []string{"env", "zone"}
+
+var (
+	placementKey   = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+	placementValue = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,62}$`)
+)
+
+// parsePlacement validates the ship's placement argument, a JSON object of
+// key/value labels such as {"env": "prod", "zone": "eu-west"}, against the
+// keys the daemon allows. Values are restricted to a label-safe alphabet
+// since they are written into the unit file.
+func parsePlacement(raw any, allowed []string) (map[string]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	obj, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("placement must be an object of key/value labels")
+	}
+	if len(allowed) == 0 {
+		allowed = defaultPlacementKeys
+	}
+	p := make(map[string]string, len(obj))
+	for k, v := range obj {
+		if !placementKey.MatchString(k) {
+			return nil, fmt.Errorf("placement key %q is invalid", k)
+		}
+		if !slices.Contains(allowed, k) {
+			return nil, fmt.Errorf("placement key %q is not allowed (allowed: %s)", k, strings.Join(allowed, ", "))
+		}
+		s, ok := v.(string)
+		if !ok || !placementValue.MatchString(s) {
+			return nil, fmt.Errorf("placement %s=%v is invalid: use letters, digits, '.', '_' or '-'", k, v)
+		}
+		p[k] = s
+	}
+	if len(p) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// renderPlacement renders the labels as X- keys in the unit's [Unit]
+// section, one per label (X-NextDeploy-Label=nextdeploy.env=prod). systemd
+// ignores X- keys, so they are for anything reading the unit: monitoring
+// today, a multi-host scheduler later.
+func renderPlacement(p map[string]string) string {
+	var b strings.Builder
+	for _, k := range sortedKeys(p) {
+		fmt.Fprintf(&b, "X-NextDeploy-Label=nextdeploy.%s=%s\n", k, p[k])
+	}
+	return b.String()
+}
+
+// formatPlacement is the labels as "env=prod zone=eu-west", for messages.
+func formatPlacement(p map[string]string) string {
+	parts := make([]string, 0, len(p))
+	for _, k := range sortedKeys(p) {
+		parts = append(parts, k+"="+p[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+func sortedKeys(p map[string]string) []string {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writePlacement records the labels of releaseID in appDir, replacing any
+// earlier record; no labels, no record. Records of releases that no longer
+// exist are dropped on the way.
+func writePlacement(appDir, releaseID string, p map[string]string) error {
+	all := readPlacements(appDir)
+	for id := range all {
+		if _, err := os.Stat(filepath.Join(appDir, "releases", id)); err != nil {
+			delete(all, id)
+		}
+	}
+	delete(all, releaseID)
+	if len(p) > 0 {
+		all[releaseID] = p
+	}
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(appDir, placementFile)
+	// #nosec G306 -- labels are not secret
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readPlacement returns the labels recorded for releaseID in appDir, or nil
+// for a release shipped without any. The labels are checked again as
+// parsePlacement does, since they are rendered into a unit file; a record
+// that fails is ignored.
+func readPlacement(appDir, releaseID string) map[string]string {
+	p := readPlacements(appDir)[releaseID]
+	for k, v := range p {
+		if !placementKey.MatchString(k) || !placementValue.MatchString(v) {
+			log.Printf("[placement] Warning: ignoring invalid placement %s=%q recorded for release %s", k, v, releaseID)
+			return nil
+		}
+	}
+	return p
+}
+
+// readPlacements returns every record in appDir's placementFile.
+func readPlacements(appDir string) map[string]map[string]string {
+	all := map[string]map[string]string{}
+	// #nosec G304 -- fixed file name inside a validated app directory
+	data, err := os.ReadFile(filepath.Join(appDir, placementFile))
+	if err != nil {
+		return all
+	}
+	if json.Unmarshal(data, &all) != nil || all == nil {
+		return map[string]map[string]string{}
+	}
+	return all
+}
@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+	"github.com/aynaash/nextdeploy/shared/httpx"
+)
+
+const (
+	defaultProbeTimeout = 5 * time.Second
+	maxProbeTimeout     = time.Minute
+	// probeBodySnippet is how much of the response body a probe returns.
+	probeBodySnippet = 512
+)
+
+// probeResult is the outcome of one HTTP probe. Status is 0 when no response
+// arrived.
+type probeResult struct {
+	URL       string `json:"url"`
+	OK        bool   `json:"ok"`
+	Status    int    `json:"status,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+	Body      string `json:"body,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// probeURL makes a single GET to target and passes only on a 2xx within
+// timeout. It is stricter than the deploy gate in waitForHealthy, which
+// accepts anything below 500, because an explicit probe asks "is this
+// endpoint answering correctly", not "is the app up".
+func probeURL(target string, timeout time.Duration) probeResult {
+	r := probeResult{URL: target}
+	client := httpx.New(httpx.Options{
+		Timeout: timeout,
+		// A redirect is the endpoint's answer; following it could leave
+		// the host.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	})
+	start := time.Now()
+	resp, err := client.Get(target)
+	if err != nil {
+		r.LatencyMs = time.Since(start).Milliseconds()
+		r.Error = err.Error()
+		return r
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, probeBodySnippet))
+	r.LatencyMs = time.Since(start).Milliseconds()
+	r.Status = resp.StatusCode
+	r.Body = string(body)
+	r.OK = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !r.OK {
+		r.Error = fmt.Sprintf("expected a 2xx response, got %d", resp.StatusCode)
+	}
+	return r
+}
+
+// checkProbeURL accepts http(s) URLs on this host only. The daemon runs as
+// root next to internal services; it must not become a way to reach them
+// from a socket client, or to reach anything off the box.
+func checkProbeURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid probe_url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("probe_url must be http or https, got %q", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("probe_url must point at this host (localhost or 127.0.0.1), got %q", host)
+}
+
+// handleProbe runs one HTTP probe and reports its status, latency and the
+// start of the body. The target is probe_url, or an app's health path
+// (overridable with path) on the port the app is running on.
+func (ch *CommandHandler) handleProbe(args map[string]any) types.Response {
+	timeout := defaultProbeTimeout
+	if raw, ok := StringArg(args, "timeout"); ok && raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 || d > maxProbeTimeout {
+			return types.Response{Success: false, Message: fmt.Sprintf("timeout must be a duration up to %s", maxProbeTimeout)}
+		}
+		timeout = d
+	}
+
+	target, _ := StringArg(args, "probe_url")
+	if target == "" {
+		appName, ok := StringArg(args, "appName")
+		if !ok || appName == "" {
+			return types.Response{Success: false, Message: "missing 'probe_url' or 'appName' argument"}
+		}
+		if err := validateAppName(appName); err != nil {
+			return types.Response{Success: false, Message: err.Error()}
+		}
+		port := ch.stateManager.GetPort(appName)
+		if port == 0 {
+			return types.Response{Success: false, Message: fmt.Sprintf("%s has no port assigned; is it deployed?", appName)}
+		}
+		path, _ := StringArg(args, "path")
+		if path == "" {
+			if meta, err := readMetadata(filepath.Join(appsDir, appName, "current")); err == nil {
+				path = meta.HealthPath
+			}
+		}
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		target = fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
+	}
+	if err := checkProbeURL(target); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+
+	r := probeURL(target, timeout)
+	msg := fmt.Sprintf("%s: %d in %dms", r.URL, r.Status, r.LatencyMs)
+	if r.Error != "" {
+		msg = fmt.Sprintf("%s: FAILED after %dms: %s", r.URL, r.LatencyMs, r.Error)
+	}
+	if r.Body != "" {
+		msg += "\n" + indent(strings.TrimRight(r.Body, "\n"), "  | ")
+	}
+	return types.Response{Success: r.OK, Message: msg, Data: map[string]any{"probe": r}}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -39,14 +40,14 @@ func NewProcessManager() *ProcessManager {
 	}
 }
 
-func (pm *ProcessManager) GenerateServiceFile(appName, projectDir, outputMode string, dopplerToken string, port int, packageManager string, releaseID string, limits *config.ResourceLimits) (string, bool, error) {
+func (pm *ProcessManager) GenerateServiceFile(appName, projectDir, outputMode string, dopplerToken string, port int, packageManager string, releaseID string, limits *config.ResourceLimits, start *config.StartCommand, mounts []bindMount, stop *config.StopPolicy, placement map[string]string, devices []deviceGrant) (string, bool, error) {
 	serviceName := fmt.Sprintf("nextdeploy-%s-%s.service", appName, releaseID)
 	servicePath := filepath.Join(pm.systemdDir, serviceName)
 
 	log.Printf("[process] Generating service file: %s (mode=%s, dir=%s, port=%d, pkg=%s)",
 		servicePath, outputMode, projectDir, port, packageManager)
 
-	execStart, err := pm.resolveExecStart(outputMode, packageManager, dopplerToken)
+	execStart, err := pm.resolveExecStart(outputMode, packageManager, dopplerToken, projectDir, start)
 	if err != nil {
 		return "", false, err
 	}
@@ -60,12 +61,16 @@ func (pm *ProcessManager) GenerateServiceFile(appName, projectDir, outputMode st
 	if err := limits.Validate(); err != nil {
 		return "", false, err
 	}
-	resourceBlock := renderResourceLimits(limits)
+	resourceBlock := renderResourceLimits(limits) + renderBindPaths(mounts) + renderDevices(devices)
+	if err := stop.Validate(); err != nil {
+		return "", false, err
+	}
+	stopTimeout, stopSignal := renderStopPolicy(stop)
 
 	serviceContent := fmt.Sprintf(`[Unit]
 Description=NextDeploy Next.js Application (%s)
 After=network.target
-
+%s
 [Service]
 Type=simple
 User=nextdeploy
@@ -78,9 +83,10 @@ RestartSec=5s
 # Lifecycle: guarantee fast, complete port release on rollout. A hung Node
 # process (unclosed pool, stuck async) is SIGKILLed after the timeout, and
 # KillMode=control-group reaps the whole cgroup so no child lingers on the port.
-TimeoutStopSec=10s
+# app.stop sets the timeout and first signal; the server must handle it.
+TimeoutStopSec=%s
 KillMode=control-group
-KillSignal=SIGTERM
+KillSignal=%s
 FinalKillSignal=SIGKILL
 OOMPolicy=stop
 Environment=NODE_ENV=production
@@ -103,7 +109,7 @@ ReadWritePaths=%s
 
 [Install]
 WantedBy=multi-user.target
-`, appName, projectDir, execStart, port, projectDir, resourceBlock, projectDir)
+`, appName, renderPlacement(placement), projectDir, execStart, stopTimeout, stopSignal, port, projectDir, resourceBlock, projectDir)
 
 	log.Printf("[process] Writing service file to %s", servicePath)
 	// #nosec G301
@@ -133,6 +139,14 @@ WantedBy=multi-user.target
 	return serviceName, true, nil
 }
 
+// renderStopPolicy returns the TimeoutStopSec= and KillSignal= values for
+// stop, in whole seconds. Without app.stop they are the 10s/SIGTERM units have
+// always had.
+func renderStopPolicy(stop *config.StopPolicy) (string, string) {
+	secs := int(math.Ceil(stop.TimeoutOrDefault().Seconds()))
+	return fmt.Sprintf("%ds", secs), stop.SignalOrDefault()
+}
+
 // renderResourceLimits emits the systemd cgroup directives for the opt-in
 // resource block. Returns "" when nothing is configured so the unit file is
 // byte-for-byte identical to the pre-feature output (limits off by default).
@@ -158,7 +172,7 @@ func renderResourceLimits(limits *config.ResourceLimits) string {
 	return "\n# --- Resource limits (cgroup, opt-in via nextdeploy.yml) ---\n" + b.String()
 }
 
-func (pm *ProcessManager) resolveExecStart(outputMode, packageManager, dopplerToken string) (string, error) {
+func (pm *ProcessManager) resolveExecStart(outputMode, packageManager, dopplerToken, projectDir string, start *config.StartCommand) (string, error) {
 	var cmd string
 	switch outputMode {
 	case "standalone":
@@ -186,12 +200,65 @@ func (pm *ProcessManager) resolveExecStart(outputMode, packageManager, dopplerTo
 		return "", fmt.Errorf("unknown output mode: %q", outputMode)
 	}
 
+	// A configured start command replaces the default for every mode that runs
+	// a server; export mode has returned above.
+	if start != nil {
+		var err error
+		if cmd, err = renderStartCommand(start, projectDir); err != nil {
+			return "", err
+		}
+	}
+
 	if dopplerToken != "" {
 		return fmt.Sprintf("%s run -- %s", resolveBinary("doppler"), cmd), nil
 	}
 	return cmd, nil
 }
 
+// renderStartCommand turns app.start into an ExecStart command line. Relative
+// entrypoints resolve against projectDir and must exist in the release; bare
+// names go through resolveBinary like the default commands. Every argument is
+// quoted with systemd's rules so spaces and "%" survive unit-file parsing.
+func renderStartCommand(start *config.StartCommand, projectDir string) (string, error) {
+	if err := start.Validate(); err != nil {
+		return "", err
+	}
+	argv := start.Command
+	exe := start.Entrypoint
+	if exe == "" {
+		exe, argv = argv[0], argv[1:]
+	}
+
+	switch {
+	case filepath.IsAbs(exe):
+	case strings.Contains(exe, "/"):
+		exe = filepath.Join(projectDir, exe)
+		if _, err := os.Stat(exe); err != nil {
+			return "", fmt.Errorf("start entrypoint %s not found in release: %w", exe, err)
+		}
+	default:
+		exe = resolveBinary(exe)
+	}
+
+	parts := make([]string, 0, len(argv)+1)
+	for _, arg := range append([]string{exe}, argv...) {
+		parts = append(parts, systemdQuote(arg))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// systemdQuote quotes one ExecStart word. "%" is doubled so it is not read as
+// a unit specifier; words with spaces, quotes or backslashes are wrapped in
+// double quotes with C-style escapes. "$VAR" is left alone so commands can use
+// the unit's environment (e.g. $PORT).
+func systemdQuote(word string) string {
+	word = strings.ReplaceAll(word, "%", "%%")
+	if word != "" && !strings.ContainsAny(word, " \t\"'\\;") {
+		return word
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(word) + `"`
+}
+
 func resolveBinary(name string) string {
 	candidates := map[string]string{
 		"node":    "/usr/local/bin/node",
@@ -249,6 +316,41 @@ func (pm *ProcessManager) StartService(serviceName string) error {
 	return nil
 }
 
+// StopServiceWith stops serviceName like StopService, but with stop's signal
+// and grace period instead of the ones the unit was written with. The
+// override is a drop-in that lives only for the duration of the stop.
+func (pm *ProcessManager) StopServiceWith(serviceName string, stop *config.StopPolicy) error {
+	if stop == nil {
+		return pm.StopService(serviceName)
+	}
+	if err := stop.Validate(); err != nil {
+		return err
+	}
+	dropInDir := filepath.Join(pm.systemdDir, serviceName+".d")
+	// #nosec G301 -- systemd drop-in directories are world-readable by convention
+	if err := os.MkdirAll(dropInDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create drop-in dir for %s: %w", serviceName, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dropInDir)
+		_ = pm.reloadDaemon()
+	}()
+	// #nosec G306
+	if err := os.WriteFile(filepath.Join(dropInDir, "50-nextdeploy-stop.conf"), []byte(renderStopDropIn(stop)), 0o644); err != nil {
+		return fmt.Errorf("failed to write stop override for %s: %w", serviceName, err)
+	}
+	if err := pm.reloadDaemon(); err != nil {
+		return err
+	}
+	return pm.StopService(serviceName)
+}
+
+// renderStopDropIn is the unit drop-in StopServiceWith installs.
+func renderStopDropIn(stop *config.StopPolicy) string {
+	timeout, signal := renderStopPolicy(stop)
+	return fmt.Sprintf("[Service]\nTimeoutStopSec=%s\nKillSignal=%s\n", timeout, signal)
+}
+
 func (pm *ProcessManager) StopService(serviceName string) error {
 	systemctl := resolveTool("systemctl")
 
@@ -307,6 +409,18 @@ func (pm *ProcessManager) RestartService(serviceName string) error {
 	return nil
 }
 
+// TailLogs returns the last lines entries of serviceName's journal, message
+// text only.
+func (pm *ProcessManager) TailLogs(serviceName string, lines int) (string, error) {
+	journalctl := resolveTool("journalctl")
+	// #nosec G204
+	out, err := exec.Command(journalctl, "-u", serviceName, "-n", strconv.Itoa(lines), "--no-pager", "-o", "cat").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("journalctl -u %s: %w - %s", serviceName, err, out)
+	}
+	return string(out), nil
+}
+
 func (pm *ProcessManager) RemoveService(serviceName string) error {
 	_ = pm.StopService(serviceName)
 	servicePath := filepath.Join(pm.systemdDir, serviceName)
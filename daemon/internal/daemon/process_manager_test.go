@@ -1,6 +1,9 @@
 package daemon
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -89,3 +92,445 @@ func TestResourceLimitsValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveExecStartCustomEntrypoint(t *testing.T) {
+	releaseDir := t.TempDir()
+	script := filepath.Join(releaseDir, "scripts", "start.sh")
+	if err := os.MkdirAll(filepath.Dir(script), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexec \"$@\"\n"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	pm := &ProcessManager{}
+
+	tests := []struct {
+		name  string
+		mode  string
+		start *config.StartCommand
+		want  string
+	}{
+		{
+			name:  "entrypoint with command args",
+			mode:  "standalone",
+			start: &config.StartCommand{Entrypoint: "./scripts/start.sh", Command: []string{"node", "server.js"}},
+			want:  script + " node server.js",
+		},
+		{
+			name:  "args needing quotes",
+			mode:  "default",
+			start: &config.StartCommand{Entrypoint: "/usr/bin/env", Command: []string{"--title=my app", "100%", "$PORT"}},
+			want:  `/usr/bin/env "--title=my app" 100%% $PORT`,
+		},
+		{
+			name:  "export mode ignores start",
+			mode:  "export",
+			start: &config.StartCommand{Entrypoint: "/usr/bin/env"},
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pm.resolveExecStart(tt.mode, "npm", "", releaseDir, tt.start)
+			if err != nil {
+				t.Fatalf("resolveExecStart: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExecStart = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := pm.resolveExecStart("standalone", "npm", "", releaseDir, &config.StartCommand{Entrypoint: "./missing.sh"}); err == nil {
+		t.Error("expected an error for an entrypoint missing from the release")
+	}
+}
+
+func TestStartCommandValidate(t *testing.T) {
+	valid := []*config.StartCommand{
+		nil,
+		{Entrypoint: "./start.sh"},
+		{Command: []string{"node", "--max-old-space-size=512", "server.js"}},
+		{Entrypoint: "/usr/bin/env", Command: []string{"two words"}},
+	}
+	for _, v := range valid {
+		if err := v.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", v, err)
+		}
+	}
+
+	invalid := []*config.StartCommand{
+		{},                            // nothing to run
+		{Entrypoint: "sh -c migrate"}, // not a single executable
+		{Entrypoint: "../outside.sh"}, // escapes the release dir
+		{Command: []string{""}},       // empty executable
+		{Entrypoint: "./start.sh", Command: []string{"a\nUser=root"}}, // directive injection
+	}
+	for _, v := range invalid {
+		if err := v.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected, but it passed validation", v)
+		}
+	}
+}
+
+func TestStopPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		stop        *config.StopPolicy
+		wantTimeout string
+		wantSignal  string
+	}{
+		{"default", nil, "10s", "SIGTERM"},
+		{"timeout only", &config.StopPolicy{Timeout: "45s"}, "45s", "SIGTERM"},
+		{"minutes and signal", &config.StopPolicy{Timeout: "2m", Signal: "SIGINT"}, "120s", "SIGINT"},
+		{"fractional rounds up", &config.StopPolicy{Timeout: "1.5s"}, "2s", "SIGTERM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.stop.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			timeout, signal := renderStopPolicy(tt.stop)
+			if timeout != tt.wantTimeout || signal != tt.wantSignal {
+				t.Errorf("renderStopPolicy = %s, %s; want %s, %s", timeout, signal, tt.wantTimeout, tt.wantSignal)
+			}
+			want := "[Service]\nTimeoutStopSec=" + tt.wantTimeout + "\nKillSignal=" + tt.wantSignal + "\n"
+			if got := renderStopDropIn(tt.stop); got != want {
+				t.Errorf("renderStopDropIn = %q, want %q", got, want)
+			}
+		})
+	}
+
+	invalid := []*config.StopPolicy{
+		{Timeout: "30"},                       // no unit
+		{Timeout: "500ms"},                    // below a second
+		{Timeout: "1h"},                       // longer than a rollout should wait
+		{Signal: "SIGKILL"},                   // cannot be handled
+		{Signal: "TERM"},                      // not a full signal name
+		{Signal: "SIGTERM\nUser=root"},        // directive injection
+		{Timeout: "30s\nExecStartPre=/bin/x"}, // directive injection
+	}
+	for _, v := range invalid {
+		if err := v.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected, but it passed validation", v)
+		}
+	}
+}
+
+func TestStopOverride(t *testing.T) {
+	stop, err := stopOverride(map[string]any{"appName": "web"})
+	if err != nil || stop != nil {
+		t.Errorf("no override args: got %+v, %v", stop, err)
+	}
+	stop, err = stopOverride(map[string]any{"stop_timeout": float64(90), "stop_signal": "SIGINT"})
+	if err != nil || stop == nil || stop.Timeout != "1m30s" || stop.Signal != "SIGINT" {
+		t.Errorf("override: got %+v, %v", stop, err)
+	}
+	for _, bad := range []map[string]any{
+		{"stop_timeout": "90"},
+		{"stop_timeout": float64(0)},
+		{"stop_signal": "SIGKILL"},
+	} {
+		if _, err := stopOverride(bad); err == nil {
+			t.Errorf("stopOverride(%v): expected an error", bad)
+		}
+	}
+}
+
+func TestCheckBindSource(t *testing.T) {
+	data := t.TempDir()
+	link := filepath.Join(t.TempDir(), "etc-link")
+	if err := os.Symlink("/etc", link); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		allowed []string
+		wantErr bool
+	}{
+		{"ordinary data dir", data, nil, false},
+		{"root", "/", nil, true},
+		{"etc", "/etc", nil, true},
+		{"under etc", "/etc/ssl", nil, true},
+		{"parent of docker socket", "/var", nil, true},
+		{"daemon state", "/opt/nextdeploy", nil, true},
+		{"symlink to etc", link, nil, true},
+		{"etc explicitly allowed", "/etc/ssl", []string{"/etc/ssl"}, false},
+		{"missing path", filepath.Join(data, "nope"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := os.Stat(tt.path); err != nil && !tt.wantErr {
+				t.Skipf("%s not present on this host", tt.path)
+			}
+			_, err := checkBindSource(tt.path, tt.allowed)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkBindSource(%q) err = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderBindPaths(t *testing.T) {
+	if got := renderBindPaths(nil); got != "" {
+		t.Errorf("no mounts should render nothing, got %q", got)
+	}
+	got := renderBindPaths([]bindMount{
+		{Source: "/opt/nextdeploy/apps/web/volumes/uploads", Target: "/rel/public/uploads"},
+		{Source: "/srv/data", Target: "/rel/data", ReadOnly: true},
+	})
+	for _, want := range []string{
+		"BindPaths=/opt/nextdeploy/apps/web/volumes/uploads:/rel/public/uploads\n",
+		"BindReadOnlyPaths=/srv/data:/rel/data\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestRenderDaemonUnit(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           DaemonUnitOptions
+		expectContains []string
+		expectAbsent   []string
+	}{
+		{
+			name: "defaults",
+			opts: DaemonUnitOptions{Executable: "/usr/local/bin/nextdeployd", ConfigPath: "/etc/nextdeployd/config.json"},
+			expectContains: []string{
+				"ExecStart=/usr/local/bin/nextdeployd --foreground=true --config=/etc/nextdeployd/config.json\n",
+				"After=network.target caddy.service",
+				"Restart=on-failure",
+				"RuntimeDirectory=nextdeployd",
+				"WantedBy=multi-user.target",
+			},
+			expectAbsent: []string{"--socket-path", "docker"},
+		},
+		{
+			name: "socket override and paths with spaces",
+			opts: DaemonUnitOptions{Executable: "/opt/next deploy/nextdeployd", ConfigPath: "/etc/nd/c.json", SocketPath: "/run/nd/d.sock"},
+			expectContains: []string{
+				`ExecStart="/opt/next deploy/nextdeployd" --foreground=true --config=/etc/nd/c.json --socket-path=/run/nd/d.sock`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unit := RenderDaemonUnit(tt.opts)
+			for _, want := range tt.expectContains {
+				if !strings.Contains(unit, want) {
+					t.Errorf("unit missing %q:\n%s", want, unit)
+				}
+			}
+			for _, absent := range tt.expectAbsent {
+				if strings.Contains(unit, absent) {
+					t.Errorf("unit should not contain %q:\n%s", absent, unit)
+				}
+			}
+		})
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     any
+		allowed []string
+		want    map[string]string
+		wantErr string
+	}{
+		{name: "none", raw: nil},
+		{name: "default keys", raw: map[string]any{"env": "prod", "zone": "eu-west-1"}, want: map[string]string{"env": "prod", "zone": "eu-west-1"}},
+		{name: "key not allowed", raw: map[string]any{"rack": "r1"}, wantErr: `"rack" is not allowed`},
+		{name: "configured keys", raw: map[string]any{"rack": "r1"}, allowed: []string{"rack"}, want: map[string]string{"rack": "r1"}},
+		{name: "newline cannot reach the unit", raw: map[string]any{"env": "prod\nExecStartPre=/bin/sh"}, wantErr: "invalid"},
+		{name: "value must be a string", raw: map[string]any{"env": 1.0}, wantErr: "invalid"},
+		{name: "not an object", raw: "env=prod", wantErr: "must be an object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePlacement(tt.raw, tt.allowed)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	p := map[string]string{"zone": "eu-west-1", "env": "prod"}
+	want := "X-NextDeploy-Label=nextdeploy.env=prod\nX-NextDeploy-Label=nextdeploy.zone=eu-west-1\n"
+	if got := renderPlacement(p); got != want {
+		t.Errorf("renderPlacement = %q, want %q", got, want)
+	}
+
+	appDir := t.TempDir()
+	for _, id := range []string{"1-aaa", "2-bbb"} {
+		if err := os.MkdirAll(filepath.Join(appDir, "releases", id), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writePlacement(appDir, "1-aaa", p); err != nil {
+		t.Fatal(err)
+	}
+	if got := readPlacement(appDir, "1-aaa"); !reflect.DeepEqual(got, p) {
+		t.Errorf("readPlacement = %v, want %v", got, p)
+	}
+	if got := readPlacement(appDir, "2-bbb"); got != nil {
+		t.Errorf("release without placement read as %v", got)
+	}
+
+	// A placement.json shipped in the release's tarball, or written by the
+	// app into its release directory, is never read.
+	shipped := `{"env":"x\nExecStartPre=+/bin/sh -c id"}`
+	if err := os.WriteFile(filepath.Join(appDir, "releases", "2-bbb", placementFile), []byte(shipped), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readPlacement(appDir, "2-bbb"); got != nil {
+		t.Errorf("placement read from the release directory: %v", got)
+	}
+
+	// A tampered record is checked like a ship's placement argument.
+	tampered := `{"1-aaa":{"env":"x\nExecStartPre=+/bin/sh -c id"}}`
+	if err := os.WriteFile(filepath.Join(appDir, placementFile), []byte(tampered), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readPlacement(appDir, "1-aaa"); got != nil {
+		t.Errorf("placement with a newline in a value read as %q", got)
+	}
+
+	// Records of pruned releases are dropped on the next write.
+	if err := writePlacement(appDir, "2-bbb", map[string]string{"env": "staging"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(appDir, "releases", "1-aaa")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePlacement(appDir, "2-bbb", p); err != nil {
+		t.Fatal(err)
+	}
+	if all := readPlacements(appDir); len(all) != 1 || !reflect.DeepEqual(all["2-bbb"], p) {
+		t.Errorf("placement records = %v, want only 2-bbb", all)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	tests := []struct {
+		name    string
+		gpus    any
+		devices any
+		allowed []string
+		want    []string
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "gpu indexes", gpus: "device=0,1", allowed: []string{"/dev/nvidia*"},
+			want: []string{"/dev/nvidiactl", "/dev/nvidia-uvm", "/dev/nvidia0", "/dev/nvidia1"}},
+		{name: "device list", devices: []any{"/dev/dri/renderD128", "/dev/dri/renderD128"}, allowed: []string{"/dev/dri/*"},
+			want: []string{"/dev/dri/renderD128"}},
+		{name: "disabled by default", devices: []any{"/dev/dri/renderD128"}, wantErr: "disabled"},
+		{name: "not allowed", devices: []any{"/dev/sda"}, allowed: []string{"/dev/nvidia*"}, wantErr: "not allowed"},
+		{name: "outside /dev", devices: []any{"/dev/../etc/shadow"}, allowed: []string{"/dev/*"}, wantErr: "invalid"},
+		{name: "newline cannot reach the unit", devices: []any{"/dev/null\nExecStartPre=/bin/sh"}, allowed: []string{"*"}, wantErr: "invalid"},
+		{name: "bad gpu index", gpus: "device=0;1", allowed: []string{"/dev/nvidia*"}, wantErr: "not a GPU index"},
+		{name: "bad gpus", gpus: "2", allowed: []string{"/dev/nvidia*"}, wantErr: "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDevices(tt.gpus, tt.devices, tt.allowed)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := os.Stat("/dev/null"); err != nil {
+		t.Skip("no /dev/null on this host")
+	}
+	notDevice := t.TempDir()
+	allowed := []string{"/dev/null", "/dev/zero", notDevice}
+	grants, err := resolveDevices([]string{"/dev/null", "/dev/zero"}, allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\n# --- Devices (opt-in via ship --gpus/--device) ---\nDeviceAllow=/dev/null rw\nDeviceAllow=/dev/zero rw\n"
+	if got := renderDevices(grants); got != want {
+		t.Errorf("renderDevices = %q, want %q", got, want)
+	}
+	if got := renderDevices(nil); got != "" {
+		t.Errorf("renderDevices(nil) = %q, want empty", got)
+	}
+	if _, err := resolveDevices([]string{notDevice}, allowed); err == nil || !strings.Contains(err.Error(), "not a device") {
+		t.Errorf("directory accepted as a device: %v", err)
+	}
+	if _, err := resolveDevices([]string{"/dev/null"}, []string{"/dev/zero"}); err == nil {
+		t.Error("device dropped from allowed_devices was still granted")
+	}
+
+	appDir := t.TempDir()
+	for _, id := range []string{"1-aaa", "2-bbb"} {
+		if err := os.MkdirAll(filepath.Join(appDir, "releases", id), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeDevices(appDir, "1-aaa", []string{"/dev/null"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDevices(appDir, "1-aaa"); !reflect.DeepEqual(got, []string{"/dev/null"}) {
+		t.Errorf("readDevices = %v", got)
+	}
+	if got := readDevices(appDir, "2-bbb"); got != nil {
+		t.Errorf("release without devices read as %v", got)
+	}
+
+	// A devices.json shipped in the release's tarball, or written by the
+	// app into its release directory, is never read.
+	if err := os.WriteFile(filepath.Join(appDir, "releases", "2-bbb", devicesFile), []byte(`["/dev/sda"]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDevices(appDir, "2-bbb"); got != nil {
+		t.Errorf("devices read from the release directory: %v", got)
+	}
+
+	// A tampered record is checked like a ship's devices argument.
+	tampered := `{"1-aaa":["/dev/null\nExecStartPre=+/bin/sh -c id"]}`
+	if err := os.WriteFile(filepath.Join(appDir, devicesFile), []byte(tampered), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDevices(appDir, "1-aaa"); got != nil {
+		t.Errorf("device with a newline read as %q", got)
+	}
+
+	// Records of pruned releases are dropped on the next write.
+	if err := writeDevices(appDir, "1-aaa", []string{"/dev/null"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(appDir, "releases", "1-aaa")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDevices(appDir, "2-bbb", []string{"/dev/zero"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDevices(appDir, "1-aaa"); got != nil {
+		t.Errorf("record of a pruned release kept: %v", got)
+	}
+}
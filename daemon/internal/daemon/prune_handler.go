@@ -0,0 +1,166 @@
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+)
+
+// staleUploadAge is how old an upload must be before prune treats it as
+// abandoned; younger ones may belong to a ship that is still in flight.
+const staleUploadAge = time.Hour
+
+// handlePrune reclaims disk on demand: releases beyond the newest `keep` of
+// each app (default 5, the same window activation prunes to) and uploads left
+// behind by failed ships. Unlike the automatic prune after activation it never
+// removes a release that something still needs — the one `current` points at
+// (after a rollback that is not the newest) or one a systemd unit still runs
+// from (e.g. the outgoing release during a rollout).
+func (ch *CommandHandler) handlePrune(args map[string]any) types.Response {
+	keep := 5
+	if v, ok := args["keep"].(float64); ok {
+		if v < 1 {
+			return types.Response{Success: false, Message: "--keep must be at least 1"}
+		}
+		keep = int(v)
+	}
+	dryRun, _ := args["dryRun"].(bool)
+
+	var apps []string
+	if appName, ok := StringArg(args, "appName"); ok && appName != "" {
+		if err := validateAppName(appName); err != nil {
+			return types.Response{Success: false, Message: err.Error()}
+		}
+		apps = []string{appName}
+	} else {
+		var err error
+		if apps, err = listApps(); err != nil {
+			return types.Response{Success: false, Message: fmt.Sprintf("failed to list apps: %v", err)}
+		}
+	}
+
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	var lines []string
+	var reclaimed int64
+	releasesRemoved := 0
+	for _, app := range apps {
+		release, ok := ch.deployLocks.tryAcquire(app)
+		if !ok {
+			lines = append(lines, fmt.Sprintf("%s: skipped, a deploy or rollback is in progress", app))
+			continue
+		}
+		services, err := ch.processManager.FindAppServices(app)
+		if err != nil {
+			release()
+			return types.Response{Success: false, Message: fmt.Sprintf("failed to list services of %s: %v", app, err)}
+		}
+		removed, size, err := pruneAppReleases(filepath.Join(appsDir, app), app, keep, releaseServices(app, services), dryRun)
+		release()
+		if err != nil {
+			return types.Response{Success: false, Message: fmt.Sprintf("failed to prune %s: %v", app, err)}
+		}
+		for _, id := range removed {
+			lines = append(lines, fmt.Sprintf("%s release %s/%s", verb, app, id))
+		}
+		releasesRemoved += len(removed)
+		reclaimed += size
+	}
+
+	uploads, size, err := pruneStaleUploads(uploadsDir, time.Now(), dryRun)
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to prune uploads: %v", err)}
+	}
+	for _, name := range uploads {
+		lines = append(lines, fmt.Sprintf("%s upload %s", verb, name))
+	}
+	reclaimed += size
+
+	lines = append(lines, fmt.Sprintf("%s %d releases and %d uploads, %.2fMB", verb, releasesRemoved, len(uploads), float64(reclaimed)/(1024*1024)))
+	return types.Response{
+		Success: true,
+		Message: strings.Join(lines, "\n"),
+		Data: map[string]any{
+			"releasesRemoved": releasesRemoved,
+			"uploadsRemoved":  len(uploads),
+			"reclaimedBytes":  reclaimed,
+			"dryRun":          dryRun,
+		},
+	}
+}
+
+// pruneAppReleases removes the releases of appDir outside the newest keep,
+// sparing the current one and any referenced by services. It returns the
+// removed release IDs and the bytes they held; with dryRun nothing is deleted.
+func pruneAppReleases(appDir, appName string, keep int, services []string, dryRun bool) ([]string, int64, error) {
+	current, releases, err := releaseHistory(appDir)
+	if err != nil {
+		return nil, 0, err
+	}
+	inUse := map[string]bool{current: true}
+	for _, s := range services {
+		inUse[strings.TrimSuffix(strings.TrimPrefix(s, "nextdeploy-"+appName+"-"), ".service")] = true
+	}
+
+	var removed []string
+	var reclaimed int64
+	for _, id := range releasesToPrune(releases, keep) {
+		if inUse[id] {
+			log.Printf("[prune] Keeping %s/%s: still in use", appName, id)
+			continue
+		}
+		path := filepath.Join(appDir, "releases", id)
+		size, err := dirSize(path)
+		if err != nil {
+			return removed, reclaimed, err
+		}
+		if !dryRun {
+			log.Printf("[prune] Removing old release: %s", path)
+			if err := os.RemoveAll(path); err != nil {
+				return removed, reclaimed, err
+			}
+		}
+		removed = append(removed, id)
+		reclaimed += size
+	}
+	return removed, reclaimed, nil
+}
+
+// pruneStaleUploads removes files in dir last modified more than
+// staleUploadAge before now: tarballs and env files of ships that failed
+// before the daemon consumed them.
+func pruneStaleUploads(dir string, now time.Time, dryRun bool) ([]string, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var removed []string
+	var reclaimed int64
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) < staleUploadAge {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return removed, reclaimed, err
+			}
+		}
+		removed = append(removed, e.Name())
+		reclaimed += info.Size()
+	}
+	return removed, reclaimed, nil
+}
@@ -0,0 +1,171 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+)
+
+// entryDiff is the size of one top-level entry of a release (.next,
+// node_modules, public, server.js, ...) in two releases. Status is "added",
+// "removed", "changed" or "same".
+type entryDiff struct {
+	Path   string `json:"path"`
+	From   int64  `json:"fromBytes"`
+	To     int64  `json:"toBytes"`
+	Delta  int64  `json:"deltaBytes"`
+	Status string `json:"status"`
+}
+
+// releaseDiff compares the on-disk size of two releases of an app, entry by
+// entry, largest change first.
+type releaseDiff struct {
+	From      string      `json:"fromRelease"`
+	To        string      `json:"toRelease"`
+	FromBytes int64       `json:"fromBytes"`
+	ToBytes   int64       `json:"toBytes"`
+	Delta     int64       `json:"deltaBytes"`
+	Entries   []entryDiff `json:"entries"`
+}
+
+// diffReleases compares releases from and to of the app in appDir. An empty
+// to is the live release, and an empty from the release before to.
+func diffReleases(appDir, from, to string) (*releaseDiff, error) {
+	current, releases, err := releaseHistory(appDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read releases: %v", err)
+	}
+	to = Coalesce(to, current)
+	if to == "" {
+		return nil, fmt.Errorf("no live release; name the releases to compare")
+	}
+	i := slices.Index(releases, to)
+	if i < 0 {
+		return nil, fmt.Errorf("release %q not found", to)
+	}
+	if from == "" {
+		if i == 0 {
+			return nil, fmt.Errorf("release %s is the oldest; there is nothing before it to compare with", to)
+		}
+		from = releases[i-1]
+	} else if !slices.Contains(releases, from) {
+		return nil, fmt.Errorf("release %q not found", from)
+	}
+
+	releasesDir := filepath.Join(appDir, "releases")
+	fromSizes, err := releaseEntrySizes(filepath.Join(releasesDir, from))
+	if err != nil {
+		return nil, fmt.Errorf("failed to size release %s: %v", from, err)
+	}
+	toSizes, err := releaseEntrySizes(filepath.Join(releasesDir, to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to size release %s: %v", to, err)
+	}
+
+	d := &releaseDiff{From: from, To: to}
+	for name, size := range fromSizes {
+		d.FromBytes += size
+		e := entryDiff{Path: name, From: size, Status: "removed"}
+		if toSize, ok := toSizes[name]; ok {
+			e.To, e.Status = toSize, "changed"
+			if toSize == size {
+				e.Status = "same"
+			}
+		}
+		e.Delta = e.To - e.From
+		d.Entries = append(d.Entries, e)
+	}
+	for name, size := range toSizes {
+		d.ToBytes += size
+		if _, ok := fromSizes[name]; !ok {
+			d.Entries = append(d.Entries, entryDiff{Path: name, To: size, Delta: size, Status: "added"})
+		}
+	}
+	d.Delta = d.ToBytes - d.FromBytes
+	sort.Slice(d.Entries, func(i, j int) bool {
+		ai, aj := abs64(d.Entries[i].Delta), abs64(d.Entries[j].Delta)
+		if ai != aj {
+			return ai > aj
+		}
+		return d.Entries[i].Path < d.Entries[j].Path
+	})
+	return d, nil
+}
+
+// releaseEntrySizes is the size of each top-level entry of releaseDir: the
+// file's size, or the total of the regular files in a directory.
+func releaseEntrySizes(releaseDir string) (map[string]int64, error) {
+	entries, err := os.ReadDir(releaseDir)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(entries))
+	for _, e := range entries {
+		path := filepath.Join(releaseDir, e.Name())
+		switch {
+		case e.IsDir():
+			size, err := dirSize(path)
+			if err != nil {
+				return nil, err
+			}
+			sizes[e.Name()] = size
+		case e.Type().IsRegular():
+			info, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			sizes[e.Name()] = info.Size()
+		}
+	}
+	return sizes, nil
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// formatDelta is a signed size in MB, e.g. "+12.40MB".
+func formatDelta(n int64) string {
+	return fmt.Sprintf("%+.2fMB", float64(n)/(1024*1024))
+}
+
+// handleDiff reports how two releases of an app differ in size, to find
+// what made a build balloon (a node_modules or large asset that slipped in).
+func (ch *CommandHandler) handleDiff(args map[string]any) types.Response {
+	appName, ok := StringArg(args, "appName")
+	if !ok {
+		return types.Response{Success: false, Message: "missing 'appName' argument"}
+	}
+	if err := validateAppName(appName); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	from, _ := StringArg(args, "from")
+	to, _ := StringArg(args, "to")
+
+	d, err := diffReleases(filepath.Join(appsDir, appName), from, to)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	lines := []string{fmt.Sprintf("%s: release %s -> %s: %.2fMB -> %.2fMB (%s)",
+		appName, d.From, d.To, float64(d.FromBytes)/(1024*1024), float64(d.ToBytes)/(1024*1024), formatDelta(d.Delta))}
+	same := 0
+	for _, e := range d.Entries {
+		if e.Status == "same" {
+			same++
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("  %-8s %s %s", e.Status, formatDelta(e.Delta), e.Path))
+	}
+	if same > 0 {
+		lines = append(lines, fmt.Sprintf("  %d entries unchanged", same))
+	}
+	return types.Response{Success: true, Message: strings.Join(lines, "\n"), Data: map[string]any{"diff": d}}
+}
@@ -0,0 +1,91 @@
+package daemon
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+	"github.com/aynaash/nextdeploy/shared/nextcore"
+)
+
+// rollbackPlan is what a rollback would do: the live release it replaces
+// and the release it restores, each with the commit it was built from.
+type rollbackPlan struct {
+	Current       string `json:"currentRelease"`
+	CurrentCommit string `json:"currentCommit"`
+	Target        string `json:"targetRelease"`
+	TargetCommit  string `json:"targetCommit"`
+	// TargetBuiltAt is when the target's metadata was generated, i.e. when
+	// it was built.
+	TargetBuiltAt string `json:"targetBuiltAt,omitempty"`
+	// PreRollback names the live release's pre_rollback hooks, which run
+	// before the switch.
+	PreRollback []string `json:"preRollbackHooks,omitempty"`
+
+	targetMeta *nextcore.NextCorePayload
+}
+
+// planRollback picks the release a rollback of the app in appDir restores,
+// steps back from the newest or by toCommit, without changing anything.
+func planRollback(appDir string, steps int, toCommit string) (*rollbackPlan, error) {
+	current, releases, err := releaseHistory(appDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read releases: %v", err)
+	}
+	if len(releases) < 2 {
+		return nil, fmt.Errorf("not enough releases to rollback")
+	}
+	releasesDir := filepath.Join(appDir, "releases")
+	target, err := resolveRollbackTarget(releasesDir, releases, steps, toCommit)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := readMetadata(filepath.Join(releasesDir, target))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata of previous release: %v", err)
+	}
+
+	plan := &rollbackPlan{
+		Current:       current,
+		CurrentCommit: "unknown",
+		Target:        target,
+		TargetCommit:  Coalesce(meta.GitCommit, "unknown"),
+		TargetBuiltAt: meta.GeneratedAt,
+		targetMeta:    meta,
+	}
+	if current != "" {
+		if live, err := readMetadata(filepath.Join(releasesDir, current)); err == nil {
+			plan.CurrentCommit = Coalesce(live.GitCommit, "unknown")
+			if live.Hooks != nil {
+				for _, h := range live.Hooks.PreRollback {
+					plan.PreRollback = append(plan.PreRollback, h.Label())
+				}
+			}
+		}
+	}
+	return plan, nil
+}
+
+// rollbackDryRun reports the rollback an app would get, or why it would be
+// refused, without taking the deploy lock or touching a release.
+func rollbackDryRun(appName string, steps int, toCommit string) types.Response {
+	if st, err := readCanary(appName); err != nil || st != nil {
+		return types.Response{Success: false, Message: canaryInProgress(appName, st, err)}
+	}
+	plan, err := planRollback(filepath.Join(appsDir, appName), steps, toCommit)
+	if err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+	msg := fmt.Sprintf("Dry run: rollback of %s would replace release %s (commit %s) with release %s (commit %s",
+		appName, Coalesce(plan.Current, "none"), plan.CurrentCommit, plan.Target, plan.TargetCommit)
+	if plan.TargetBuiltAt != "" {
+		msg += ", built " + plan.TargetBuiltAt
+	}
+	msg += ")"
+	if len(plan.PreRollback) > 0 {
+		msg += "\npre_rollback hooks that would run first: " + strings.Join(plan.PreRollback, ", ")
+	}
+	msg += "\nNothing was changed."
+	return types.Response{Success: true, Message: msg, Data: map[string]any{"plan": plan}}
+}
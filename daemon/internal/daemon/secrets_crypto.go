@@ -0,0 +1,210 @@
+package daemon
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The secrets store is encrypted at rest under a random data key. The data
+// key sits next to the store in secretsKeyFile, wrapped (AES-GCM) by a
+// key-encryption key derived from an operator passphrase the disk never
+// holds, so a copy of the disk or a backup yields no secrets. Changing the
+// passphrase only means re-wrapping the data key.
+const (
+	// secretsPassphraseEnv names the environment variable holding the
+	// passphrase when no systemd credential supplies it.
+	secretsPassphraseEnv = "NEXTDEPLOYD_SECRETS_PASSPHRASE"
+	// secretsCredential is the systemd credential (LoadCredential= or,
+	// sealed to the host's TPM, LoadCredentialEncrypted=) holding the
+	// passphrase.
+	secretsCredential = "secrets-passphrase"
+	secretsKeyFile    = ".datakey"
+	secretsKEKIter    = 600_000
+	// sealedSecretsPrefix marks an encrypted app store; anything else is a
+	// plaintext one written before a passphrase was set.
+	sealedSecretsPrefix = "nextdeploy-sealed:v1:"
+)
+
+// wrappedKey is secretsKeyFile: the data key sealed by the key-encryption
+// key derived from the passphrase and Salt.
+type wrappedKey struct {
+	Salt []byte `json:"salt"`
+	Key  []byte `json:"key"`
+}
+
+// secretsPassphrase returns the passphrase the store is encrypted under, or
+// "" when none is configured.
+func secretsPassphrase() (string, error) {
+	if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+		// #nosec G304 -- systemd's credentials directory for this service
+		data, err := os.ReadFile(filepath.Join(dir, secretsCredential))
+		if err == nil {
+			return strings.TrimRight(string(data), "\r\n"), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("read credential %s: %w", secretsCredential, err)
+		}
+	}
+	return os.Getenv(secretsPassphraseEnv), nil
+}
+
+// openSecretsKey returns the data key of the store in dir, unwrapped with
+// passphrase, creating and wrapping a new one on first use. It returns nil
+// when passphrase is empty: the store is then kept in plaintext.
+func openSecretsKey(dir, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, nil
+	}
+	path := filepath.Join(dir, secretsKeyFile)
+	// #nosec G304 -- fixed file name in the daemon's secrets dir
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newSecretsKey(path, passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var w wrappedKey
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	key, err := openSealed(kek(passphrase, w.Salt), w.Key, []byte(secretsKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap the secrets data key in %s: wrong passphrase?", path)
+	}
+	return key, nil
+}
+
+func newSecretsKey(path, passphrase string) ([]byte, error) {
+	key := make([]byte, 32)
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(kek(passphrase, salt), key, []byte(secretsKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(wrappedKey{Salt: salt, Key: wrapped})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return nil, err
+	}
+	return key, os.Rename(tmp, path)
+}
+
+// kek derives the key-encryption key from the passphrase.
+func kek(passphrase string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, secretsKEKIter, 32, sha256.New)
+}
+
+// sealSecrets encrypts an app's store under the data key. The app name is
+// authenticated with it, so one app's file cannot be swapped for another's.
+func sealSecrets(key []byte, appName string, plain []byte) ([]byte, error) {
+	sealed, err := seal(key, plain, []byte(appName))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(sealedSecretsPrefix), sealed...), nil
+}
+
+// openSecrets returns an app's store as JSON: decrypted when it is sealed,
+// as is when it predates the passphrase.
+func openSecrets(key []byte, appName string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(sealedSecretsPrefix)) {
+		return data, nil
+	}
+	if key == nil {
+		return nil, fmt.Errorf("the secrets store is encrypted; set the %s credential or %s", secretsCredential, secretsPassphraseEnv)
+	}
+	return openSealed(key, data[len(sealedSecretsPrefix):], []byte(appName))
+}
+
+func seal(key, plain, aad []byte) ([]byte, error) {
+	gcm, err := newSecretsGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, aad), nil
+}
+
+func openSealed(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newSecretsGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
+
+func newSecretsGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSecretsStore re-saves every plaintext app store under the data key,
+// so setting a passphrase protects secrets stored before it.
+func (ch *CommandHandler) sealSecretsStore() error {
+	if ch.secretsKey == nil {
+		return nil
+	}
+	entries, err := os.ReadDir(secretsDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		appName, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		// #nosec G304 -- entries of the daemon's secrets dir
+		data, err := os.ReadFile(filepath.Join(secretsDir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(data, []byte(sealedSecretsPrefix)) {
+			continue
+		}
+		secrets, err := ch.loadSecrets(appName)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		if err := ch.saveSecrets(appName, secrets); err != nil {
+			return fmt.Errorf("%s: %w", e.Name(), err)
+		}
+	}
+	return nil
+}
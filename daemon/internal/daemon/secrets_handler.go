@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/aynaash/nextdeploy/daemon/internal/types"
+	"github.com/aynaash/nextdeploy/shared/config"
 )
 
 const (
@@ -50,11 +51,56 @@ func (ch *CommandHandler) handleSecrets(args map[string]any) types.Response {
 	}
 }
 
+// shipEnvFile holds the dotenv files the CLI merged and shipped with a release.
+// It lives in the release dir so rollbacks and later secret changes re-render
+// each release with the env it was deployed with.
+const shipEnvFile = ".env.ship"
+
+// installShipEnv moves an uploaded env file into releaseDir as shipEnvFile.
+func installShipEnv(envFile, releaseDir string) error {
+	envFile = filepath.Clean(envFile)
+	if !withinDir(envFile, uploadsDir) {
+		return fmt.Errorf("security error: env file path must be within uploads directory")
+	}
+	defer removeUpload(envFile)
+
+	// #nosec G304 -- confined to uploadsDir above
+	data, err := os.ReadFile(envFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(releaseDir, shipEnvFile), data, 0o600)
+}
+
+// removeUpload deletes a file the CLI uploaded for ship. Paths outside the
+// uploads directory are left alone.
+func removeUpload(path string) {
+	if !withinDir(path, uploadsDir) {
+		return
+	}
+	if err := os.Remove(filepath.Clean(path)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[ship] Warning: failed to remove %s: %v", path, err)
+	}
+}
+
+// renderEnvFile writes the release's EnvironmentFile. Precedence, lowest first:
+// the env shipped with the release, the persisted secrets store (explicit
+// `secrets set` wins over files), then extra.
 func (ch *CommandHandler) renderEnvFile(appName, dir string, extra map[string]string) error {
-	secrets, err := ch.loadSecrets(appName)
+	stored, err := ch.loadSecrets(appName)
 	if err != nil {
 		return fmt.Errorf("load secrets for %s: %w", appName, err)
 	}
+	secrets := make(map[string]string)
+	// #nosec G304 -- fixed file name inside the release dir
+	if data, err := os.ReadFile(filepath.Join(dir, shipEnvFile)); err == nil {
+		secrets = config.ParseDotenv(string(data))
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("read %s: %w", shipEnvFile, err)
+	}
+	for k, v := range stored {
+		secrets[k] = v
+	}
 	for k, v := range extra {
 		if v != "" {
 			secrets[k] = v
@@ -101,7 +147,22 @@ func (ch *CommandHandler) syncAppSecrets(appName string) error {
 		return fmt.Errorf("no active service for %s: %w", appName, err)
 	}
 	log.Printf("[secrets] Updated %s/.env.nextdeploy, restarting %s...", releaseDir, serviceName)
-	return ch.processManager.RestartService(serviceName)
+	if err := ch.processManager.RestartService(serviceName); err != nil {
+		return err
+	}
+
+	// A canary reads the env file of its own release; it must not keep
+	// serving its share of requests with the old secrets.
+	canary, err := readCanary(appName)
+	if err != nil || canary == nil {
+		return err
+	}
+	canaryDir := filepath.Join(appsDir, appName, "releases", canary.ReleaseID)
+	if err := ch.renderEnvFile(appName, canaryDir, nil); err != nil {
+		return err
+	}
+	log.Printf("[secrets] Updated %s/.env.nextdeploy, restarting canary %s...", canaryDir, canary.Service)
+	return ch.processManager.RestartService(canary.Service)
 }
 
 func (ch *CommandHandler) setSecret(appName string, args map[string]any) types.Response {
@@ -209,6 +270,11 @@ func (ch *CommandHandler) loadSecrets(appName string) (map[string]string, error)
 		return nil, err
 	}
 
+	data, err = openSecrets(ch.secretsKey, appName, data)
+	if err != nil {
+		return nil, err
+	}
+
 	var secrets map[string]string
 	if err := json.Unmarshal(data, &secrets); err != nil {
 		return nil, err
@@ -227,6 +293,11 @@ func (ch *CommandHandler) saveSecrets(appName string, secrets map[string]string)
 	if err != nil {
 		return err
 	}
+	if ch.secretsKey != nil {
+		if data, err = sealSecrets(ch.secretsKey, appName, data); err != nil {
+			return err
+		}
+	}
 
 	return os.WriteFile(path, data, 0o600)
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // withTempSecretsDir points the package-level secrets store at a temp dir for
@@ -94,6 +95,34 @@ func TestRenderEnvFileEmptyExtraOnlyWritesNothing(t *testing.T) {
 	}
 }
 
+func TestRenderEnvFileShippedEnvIsOverriddenByStore(t *testing.T) {
+	withTempSecretsDir(t)
+	ch := &CommandHandler{}
+
+	if err := ch.saveSecrets("myapp", map[string]string{"API_KEY": "from-store"}); err != nil {
+		t.Fatalf("saveSecrets: %v", err)
+	}
+	releaseDir := t.TempDir()
+	shipped := "API_KEY=from-file\nPUBLIC_URL=https://example.com\n"
+	if err := os.WriteFile(filepath.Join(releaseDir, shipEnvFile), []byte(shipped), 0o600); err != nil {
+		t.Fatalf("seed shipped env: %v", err)
+	}
+
+	if err := ch.renderEnvFile("myapp", releaseDir, nil); err != nil {
+		t.Fatalf("renderEnvFile: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(releaseDir, ".env.nextdeploy"))
+	if err != nil {
+		t.Fatalf("read env file: %v", err)
+	}
+	want := `API_KEY="from-store"
+PUBLIC_URL="https://example.com"
+`
+	if got := string(data); got != want {
+		t.Errorf("env file content mismatch\n got: %q\nwant: %q", got, want)
+	}
+}
+
 func TestRenderEnvFileCorruptStoreFails(t *testing.T) {
 	dir := withTempSecretsDir(t)
 	ch := &CommandHandler{}
@@ -152,3 +181,90 @@ func TestQuoteEnvValueSystemdEscaping(t *testing.T) {
 		}
 	}
 }
+
+func TestFailedShipRemovesUploadedEnv(t *testing.T) {
+	orig := uploadsDir
+	uploadsDir = t.TempDir()
+	t.Cleanup(func() { uploadsDir = orig })
+
+	tarball := filepath.Join(uploadsDir, "nextdeploy_shop_1.tar.gz")
+	envFile := filepath.Join(uploadsDir, "nextdeploy_shop_1.env")
+	if err := os.WriteFile(tarball, []byte("not the artifact the CLI hashed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(envFile, []byte("DATABASE_URL=postgres://u:p@db/shop\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := &CommandHandler{}
+	resp := ch.handleShip(map[string]interface{}{
+		"tarball": tarball,
+		"sha256":  strings.Repeat("0", 64),
+		"envFile": envFile,
+	}, time.Time{})
+	if resp.Success {
+		t.Fatalf("ship with a mismatched sha256 succeeded: %+v", resp)
+	}
+	if _, err := os.Stat(envFile); !os.IsNotExist(err) {
+		t.Errorf("uploaded env file survived a failed ship (stat err = %v)", err)
+	}
+}
+
+func TestSecretsStoreEncryptedAtRest(t *testing.T) {
+	dir := withTempSecretsDir(t)
+	if key, err := openSecretsKey(dir, ""); err != nil || key != nil {
+		t.Fatalf("no passphrase: key %v, err %v; want a plaintext store", key, err)
+	}
+
+	// A store written before the passphrase was set.
+	plain := &CommandHandler{}
+	if err := plain.saveSecrets("shop", map[string]string{"DATABASE_URL": "postgres://u:hunter2@db/shop"}); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := openSecretsKey(dir, "correct horse")
+	if err != nil {
+		t.Fatalf("openSecretsKey: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, secretsKeyFile)); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("wrapped data key: %v, %v", info, err)
+	}
+	if again, err := openSecretsKey(dir, "correct horse"); err != nil || string(again) != string(key) {
+		t.Fatalf("reopening with the same passphrase: %v", err)
+	}
+	if _, err := openSecretsKey(dir, "wrong"); err == nil {
+		t.Fatal("unwrapped the data key with the wrong passphrase")
+	}
+
+	ch := &CommandHandler{secretsKey: key}
+	if err := ch.sealSecretsStore(); err != nil {
+		t.Fatalf("sealSecretsStore: %v", err)
+	}
+	if err := ch.saveSecrets("blog", map[string]string{"API_KEY": "sk-blog"}); err != nil {
+		t.Fatal(err)
+	}
+	for app, secret := range map[string]string{"shop": "hunter2", "blog": "sk-blog"} {
+		data, err := os.ReadFile(filepath.Join(dir, app+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), secret) || !strings.HasPrefix(string(data), sealedSecretsPrefix) {
+			t.Errorf("%s store is not sealed: %q", app, data)
+		}
+	}
+	if got, err := ch.loadSecrets("shop"); err != nil || got["DATABASE_URL"] != "postgres://u:hunter2@db/shop" {
+		t.Errorf("loadSecrets(shop) = %v, %v", got, err)
+	}
+
+	if _, err := plain.loadSecrets("shop"); err == nil || !strings.Contains(err.Error(), secretsPassphraseEnv) {
+		t.Errorf("loading a sealed store without the key: err = %v", err)
+	}
+	// A sealed file is bound to its app.
+	blog, _ := os.ReadFile(filepath.Join(dir, "blog.json"))
+	if err := os.WriteFile(filepath.Join(dir, "shop.json"), blog, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ch.loadSecrets("shop"); err == nil {
+		t.Error("blog's sealed store loaded as shop's")
+	}
+}
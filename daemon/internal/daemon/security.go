@@ -8,6 +8,8 @@ import (
 	"net"
 	"sync"
 	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
 )
 
 type RateLimiter struct {
@@ -67,6 +69,29 @@ func VerifySignature(payload []byte, signature, secret string) bool {
 	return hmac.Equal([]byte(signature), []byte(expected))
 }
 
+// acceptedSecrets returns the secrets a signature may be made with at now: the
+// current security secret first, then rotated-out ones still in their grace
+// window.
+func acceptedSecrets(cfg *types.DaemonConfig, now time.Time) []string {
+	secrets := []string{cfg.SecuritySecret}
+	for _, r := range cfg.PreviousSecrets {
+		if now.Before(r.ExpiresAt) {
+			secrets = append(secrets, r.Secret)
+		}
+	}
+	return secrets
+}
+
+// verifySignatureAny reports whether signature is valid under any of secrets.
+func verifySignatureAny(payload []byte, signature string, secrets []string) bool {
+	for _, secret := range secrets {
+		if VerifySignature(payload, signature, secret) {
+			return true
+		}
+	}
+	return false
+}
+
 // ReplayGuard rejects commands whose signed timestamp is outside an allowed
 // skew window, and commands whose nonce has already been seen within that
 // window. Combined with the HMAC signature (which covers the timestamp and
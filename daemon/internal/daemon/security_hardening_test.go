@@ -4,8 +4,14 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	daemonconfig "github.com/aynaash/nextdeploy/daemon/internal/config"
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
 )
 
 func sign(payload, secret string) string {
@@ -38,6 +44,177 @@ func TestVerifySignature_AcceptsValidRejectsInvalid(t *testing.T) {
 	}
 }
 
+func TestRotatedSecretGraceWindow(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := &types.DaemonConfig{SecuritySecret: "old-secret"}
+	now := time.Now()
+	if err := daemonconfig.RotateSecuritySecret(configPath, cfg, 10*time.Minute, now); err != nil {
+		t.Fatalf("RotateSecuritySecret: %v", err)
+	}
+	if cfg.SecuritySecret == "old-secret" || cfg.SecuritySecret == "" {
+		t.Fatal("rotation must install a new secret")
+	}
+
+	payload := `{"type":"status"}`
+	oldSig := sign(payload, "old-secret")
+	newSig := sign(payload, cfg.SecuritySecret)
+
+	within := acceptedSecrets(cfg, now.Add(5*time.Minute))
+	if !verifySignatureAny([]byte(payload), oldSig, within) {
+		t.Error("a client still signing with the retired secret must verify inside the grace window")
+	}
+	if !verifySignatureAny([]byte(payload), newSig, within) {
+		t.Error("the new secret must verify")
+	}
+
+	after := acceptedSecrets(cfg, now.Add(11*time.Minute))
+	if verifySignatureAny([]byte(payload), oldSig, after) {
+		t.Error("the retired secret must be rejected once the grace window has passed")
+	}
+
+	reloaded, err := daemonconfig.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if reloaded.SecuritySecret != cfg.SecuritySecret || len(reloaded.PreviousSecrets) != 1 {
+		t.Errorf("rotation was not persisted: %+v", reloaded)
+	}
+}
+
+func TestRotateSecuritySecretBoundsRetired(t *testing.T) {
+	cfg := &types.DaemonConfig{SecuritySecret: "s0"}
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := daemonconfig.RotateSecuritySecret("", cfg, time.Hour, now); err != nil {
+			t.Fatalf("RotateSecuritySecret: %v", err)
+		}
+	}
+	if len(cfg.PreviousSecrets) != 3 {
+		t.Errorf("kept %d retired secrets, want at most 3", len(cfg.PreviousSecrets))
+	}
+
+	// A zero grace retires the old secret immediately.
+	current := cfg.SecuritySecret
+	cfg.PreviousSecrets = nil
+	if err := daemonconfig.RotateSecuritySecret("", cfg, 0, now); err != nil {
+		t.Fatalf("RotateSecuritySecret: %v", err)
+	}
+	for _, s := range acceptedSecrets(cfg, now) {
+		if s == current {
+			t.Error("zero grace must not keep the previous secret")
+		}
+	}
+}
+
+func TestYAMLConfigRoundTrip(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	orig := `# nextdeployd on web-1; managed by hand, keep these notes.
+socket_mode: "0660" # group nextdeploy only
+rate_limit_rate: 5
+
+# Office and CI runners.
+ip_whitelist:
+  - 203.0.113.7
+security_secret: old-secret
+`
+	if err := os.WriteFile(configPath, []byte(orig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := daemonconfig.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.SocketMode != "0660" || cfg.RateLimitRate != 5 || cfg.RateLimitBurst != 20 || len(cfg.IPWhitelist) != 1 {
+		t.Fatalf("YAML config not loaded over the defaults: %+v", cfg)
+	}
+
+	cfg.RateLimitRate = 8
+	if err := daemonconfig.RotateSecuritySecret(configPath, cfg, time.Hour, time.Now()); err != nil {
+		t.Fatalf("RotateSecuritySecret: %v", err)
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := string(data)
+	for _, want := range []string{
+		"# nextdeployd on web-1; managed by hand, keep these notes.",
+		`socket_mode: "0660" # group nextdeploy only`,
+		"rate_limit_rate: 8",
+		"# Office and CI runners.",
+		"previous_secrets:",
+	} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved config lacks %q:\n%s", want, saved)
+		}
+	}
+	if strings.Contains(saved, "security_secret: old-secret") || strings.Contains(saved, "{") {
+		t.Errorf("saved config is not the merged block YAML it should be:\n%s", saved)
+	}
+
+	reloaded, err := daemonconfig.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig after save: %v", err)
+	}
+	if reloaded.SecuritySecret != cfg.SecuritySecret || reloaded.RateLimitRate != 8 || len(reloaded.PreviousSecrets) != 1 || reloaded.PreviousSecrets[0].Secret != "old-secret" {
+		t.Errorf("round trip lost values: %+v", reloaded)
+	}
+}
+
+func TestYAMLConfigSocketMode(t *testing.T) {
+	for line, want := range map[string]string{
+		`socket_mode: "0660"`: "0660",
+		"socket_mode: 0660":   "0660",
+		"socket_mode: 0o600":  "0600",
+		"socket_mode: 660":    "660",
+	} {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(configPath, []byte(line+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := daemonconfig.LoadConfig(configPath)
+		if err != nil {
+			t.Errorf("%s: %v", line, err)
+			continue
+		}
+		if cfg.SocketMode != want {
+			t.Errorf("%s: socket_mode = %q, want %q", line, cfg.SocketMode, want)
+		}
+	}
+}
+
+func TestCheckPrivate(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := daemonconfig.CheckPrivate(cfgPath); err == nil || !strings.Contains(err.Error(), "chmod 0600") {
+		t.Fatalf("CheckPrivate(0644 file) = %v; want an error naming the fix", err)
+	}
+	if info, _ := os.Stat(cfgPath); info.Mode().Perm() != 0o644 {
+		t.Errorf("config mode = %04o; CheckPrivate must not change it", info.Mode().Perm())
+	}
+
+	store := filepath.Join(dir, "secrets")
+	if err := os.Mkdir(store, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := daemonconfig.CheckPrivate(store); err == nil || !strings.Contains(err.Error(), "chmod 0700") {
+		t.Fatalf("CheckPrivate(0755 dir) = %v; want an error", err)
+	}
+
+	if err := os.Chmod(cfgPath, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := daemonconfig.CheckPrivate(cfgPath); err != nil {
+		t.Errorf("private path: %v", err)
+	}
+	if err := daemonconfig.CheckPrivate(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("missing path should be fine, got %v", err)
+	}
+}
+
 func TestReplayGuard(t *testing.T) {
 	rg := NewReplayGuard(5 * time.Minute)
 	now := time.Now().Unix()
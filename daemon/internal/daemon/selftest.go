@@ -0,0 +1,195 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+	"github.com/aynaash/nextdeploy/shared/httpx"
+)
+
+// selftestUnit runs the canary. The nextdeployd- prefix keeps it out of the
+// nextdeploy-<app>-* namespace app commands search.
+const selftestUnit = "nextdeployd-selftest.service"
+
+// CanaryBody is what the canary answers on every path.
+const CanaryBody = "nextdeploy selftest ok\n"
+
+// canaryExecutable is the binary the canary unit runs with "canary --port=N":
+// nextdeployd itself, so selftest needs nothing that is not already installed.
+var canaryExecutable = os.Executable
+
+// selftestStep is one timed step of a selftest.
+type selftestStep struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Took  string `json:"took"`
+	Error string `json:"error,omitempty"`
+}
+
+// runSteps runs steps in order until one fails, then cleanup regardless, and
+// records each with its timing. Steps after a failure are not run.
+func runSteps(steps []func() error, names []string, cleanup func() error) []selftestStep {
+	var report []selftestStep
+	run := func(name string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		step := selftestStep{Name: name, OK: err == nil, Took: time.Since(start).Round(time.Millisecond).String()}
+		if err != nil {
+			step.Error = err.Error()
+		}
+		report = append(report, step)
+		return err == nil
+	}
+	for i, fn := range steps {
+		if !run(names[i], fn) {
+			break
+		}
+	}
+	run("cleanup", cleanup)
+	return report
+}
+
+// handleSelftest checks the host end to end without touching real apps: it
+// runs a canary (nextdeployd itself, serving CanaryBody) as a systemd unit
+// with the same user and sandbox as a release, waits for it to pass the same
+// readiness probe, requests it, then stops and removes it. Cleanup runs even
+// when an earlier step fails.
+func (ch *CommandHandler) handleSelftest(args map[string]any) types.Response {
+	// The unit name is fixed, so two selftests must not overlap. Keyed by the
+	// unit name, which no app name can be.
+	release, ok := ch.deployLocks.tryAcquire(selftestUnit)
+	if !ok {
+		return types.Response{Success: false, Message: "a selftest is already running"}
+	}
+	defer release()
+
+	exe, err := canaryExecutable()
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("selftest: locate nextdeployd: %v", err)}
+	}
+	var port int
+	unitPath := filepath.Join(ch.processManager.systemdDir, selftestUnit)
+
+	report := runSteps([]func() error{
+		func() error {
+			p, closePort, err := findUnclaimedPort(func(p int) string { return ch.stateManager.PortOwner(p, "") })
+			if err != nil {
+				return err
+			}
+			port = p
+			_ = closePort()
+			// #nosec G306
+			if err := os.WriteFile(unitPath, []byte(renderCanaryUnit(exe, port)), 0o644); err != nil {
+				return err
+			}
+			return ch.processManager.reloadDaemon()
+		},
+		func() error {
+			// #nosec G204
+			if out, err := exec.Command(resolveTool("systemctl"), "start", selftestUnit).CombinedOutput(); err != nil {
+				return fmt.Errorf("systemctl start %s: %w - %s", selftestUnit, err, out)
+			}
+			return nil
+		},
+		func() error {
+			_, err := waitForHealthy(port, "/", 30*time.Second)
+			return err
+		},
+		func() error { return probeCanary(port) },
+	}, []string{"install", "start", "health", "request"}, func() error {
+		return ch.processManager.RemoveService(selftestUnit)
+	})
+
+	passed := true
+	lines := make([]string, 0, len(report))
+	for _, s := range report {
+		status := "ok"
+		if !s.OK {
+			passed = false
+			status = "FAILED: " + s.Error
+		}
+		lines = append(lines, fmt.Sprintf("  %-8s %-8s %s", s.Name, s.Took, status))
+	}
+	verdict := "PASS"
+	if !passed {
+		verdict = "FAIL"
+	}
+	log.Printf("[selftest] %s", verdict)
+	return types.Response{
+		Success: passed,
+		Message: fmt.Sprintf("Selftest: %s\n%s", verdict, strings.Join(lines, "\n")),
+		Data:    map[string]any{"passed": passed, "steps": report},
+	}
+}
+
+// renderCanaryUnit is a unit with a release's user and sandbox, so a host
+// that cannot run the canary cannot run an app either.
+func renderCanaryUnit(exe string, port int) string {
+	return fmt.Sprintf(`[Unit]
+Description=NextDeploy selftest canary
+
+[Service]
+Type=simple
+User=nextdeploy
+Group=nextdeploy
+ExecStart=%s canary --port=%d
+ProtectSystem=strict
+ProtectHome=yes
+PrivateTmp=yes
+NoNewPrivileges=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+`, systemdQuote(exe), port)
+}
+
+// probeCanary requests the canary and checks it answered as itself, not some
+// other process that happened to grab the port.
+func probeCanary(port int) error {
+	client := httpx.New(httpx.Options{Timeout: 5 * time.Second})
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != CanaryBody {
+		return fmt.Errorf("unexpected answer on port %d: %d %q", port, resp.StatusCode, body)
+	}
+	return nil
+}
+
+// ServeCanary is the canary process: it answers CanaryBody on 127.0.0.1:port
+// until ctx is done.
+func ServeCanary(ctx context.Context, port int) error {
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, CanaryBody)
+		}),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+//go:build integration
+
+// Selftest integration test.
+//
+// Run with: mage testIntegration
+//
+// Requires root on a systemd host with the nextdeploy user (as created by the
+// installer) and a Go toolchain to build nextdeployd for the canary. The
+// canary unit is removed whether or not the test passes.
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+)
+
+func TestSelftestIntegration(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("selftest installs a systemd unit; run as root")
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		t.Skip("systemctl not found")
+	}
+	if _, err := user.Lookup("nextdeploy"); err != nil {
+		t.Skip("nextdeploy user not found")
+	}
+
+	// The canary runs with PrivateTmp and ProtectHome, so the binary cannot
+	// live under t.TempDir or the module checkout.
+	binDir, err := os.MkdirTemp("/opt", "nextdeploy-selftest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(binDir)
+	if err := os.Chmod(binDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(binDir, "nextdeployd")
+	build := exec.Command("go", "build", "-o", bin, "github.com/aynaash/nextdeploy/daemon/cmd/nextdeployd")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build nextdeployd: %v\n%s", err, out)
+	}
+	canaryExecutable = func() (string, error) { return bin, nil }
+	defer func() { canaryExecutable = os.Executable }()
+
+	ch := NewCommandHandler(&types.DaemonConfig{LogDir: t.TempDir()})
+	resp := ch.handleSelftest(map[string]any{})
+	t.Log(resp.Message)
+	if !resp.Success {
+		t.Fatal("selftest failed")
+	}
+	steps := resp.Data.(map[string]any)["steps"].([]selftestStep)
+	if len(steps) != 5 || steps[len(steps)-1].Name != "cleanup" {
+		t.Errorf("unexpected steps: %+v", steps)
+	}
+	if _, err := os.Stat(filepath.Join(ch.processManager.systemdDir, selftestUnit)); !os.IsNotExist(err) {
+		t.Errorf("canary unit left behind: %v", err)
+	}
+}
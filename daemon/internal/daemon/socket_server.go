@@ -13,16 +13,33 @@ import (
 	"os/user"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/aynaash/nextdeploy/daemon/internal/types"
 )
 
+// connDeadline bounds one client connection, and so also how long a restart
+// waits for in-flight commands before handing off.
+const connDeadline = 10 * time.Minute
+
+// listenFDsEnv hands the listening sockets to the process restartDaemon
+// execs, as comma-separated name=fd pairs (e.g. "unix=7,tcp=8").
+const listenFDsEnv = "NEXTDEPLOYD_LISTEN_FDS"
+
 type SocketServer struct {
 	config         *types.DaemonConfig
 	unixListener   net.Listener
 	tcpListener    net.Listener
 	commandHandler *CommandHandler
+	// tcpRaw is the TCP listener under the TLS wrapper; its descriptor is
+	// what a restart hands over.
+	tcpRaw    net.Listener
+	tlsConfig *tls.Config
+	// conns counts connections still being served.
+	conns sync.WaitGroup
 }
 
 func NewSocketServer(config *types.DaemonConfig, commandHandler *CommandHandler) *SocketServer {
@@ -33,6 +50,9 @@ func NewSocketServer(config *types.DaemonConfig, commandHandler *CommandHandler)
 }
 
 func (ss *SocketServer) Start() error {
+	// Whatever happens, the descriptors must not leak into processes the
+	// daemon starts later.
+	defer func() { _ = os.Unsetenv(listenFDsEnv) }()
 	if err := ss.startUnixListener(); err != nil {
 		return err
 	}
@@ -43,6 +63,17 @@ func (ss *SocketServer) startUnixListener() error {
 	if ss.config.SocketPath == "" {
 		return nil
 	}
+	if l, err := inheritedListener("unix"); err != nil || l != nil {
+		if err != nil {
+			return fmt.Errorf("failed to resume unix socket: %w", err)
+		}
+		ss.unixListener = l
+		log.Printf("[socket] Resumed unix:%s from the previous process", ss.config.SocketPath)
+		return nil
+	}
+	if err := checkSocketDir(filepath.Dir(ss.config.SocketPath)); err != nil {
+		return err
+	}
 	ss.cleanupSocket()
 	ul, err := net.Listen("unix", ss.config.SocketPath)
 	if err != nil {
@@ -77,24 +108,109 @@ func (ss *SocketServer) startTCPListener() error {
 	if err != nil {
 		return fmt.Errorf("failed to load TLS config: %w", err)
 	}
-	tl, err := tls.Listen("tcp", ss.config.TCPListenAddr, tlsConfig)
+	raw, err := inheritedListener("tcp")
 	if err != nil {
-		return fmt.Errorf("failed to listen on tcp+tls: %w", err)
+		return fmt.Errorf("failed to resume tcp listener: %w", err)
 	}
-	log.Printf("[socket] Listening on tcp+tls:%s (mTLS enforced)", ss.config.TCPListenAddr)
-	ss.tcpListener = tl
+	if raw == nil {
+		if raw, err = net.Listen("tcp", ss.config.TCPListenAddr); err != nil {
+			return fmt.Errorf("failed to listen on tcp+tls: %w", err)
+		}
+	}
+	log.Printf("[socket] Listening on tcp+tls:%s (mTLS enforced; %s)", ss.config.TCPListenAddr, describeTLS(tlsConfig))
+	ss.tcpRaw, ss.tlsConfig = raw, tlsConfig
+	ss.tcpListener = tls.NewListener(raw, tlsConfig)
 	return nil
 }
 
+// inheritedListener returns the listener named name that a previous daemon
+// process passed through listenFDsEnv, or nil when there is none.
+func inheritedListener(name string) (net.Listener, error) {
+	for _, pair := range strings.Split(os.Getenv(listenFDsEnv), ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key != name {
+			continue
+		}
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 3 {
+			return nil, fmt.Errorf("bad %s entry %q", listenFDsEnv, pair)
+		}
+		f := os.NewFile(uintptr(fd), name)
+		defer f.Close()
+		return net.FileListener(f)
+	}
+	return nil, nil
+}
+
+// defaultCipherSuites are the TLS 1.2 suites the TCP listener offers unless
+// tls_cipher_suites says otherwise: ECDHE key exchange with AEAD ciphers only.
+var defaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// tlsPolicy resolves tls_min_version and tls_cipher_suites. Only suites Go
+// considers secure can be named; TLS 1.0 and 1.1 cannot be enabled.
+func tlsPolicy(cfg *types.DaemonConfig) (uint16, []uint16, error) {
+	var minVersion uint16
+	switch cfg.TLSMinVersion {
+	case "", "1.2":
+		minVersion = tls.VersionTLS12
+	case "1.3":
+		minVersion = tls.VersionTLS13
+	default:
+		return 0, nil, fmt.Errorf("tls_min_version %q: want \"1.2\" or \"1.3\"", cfg.TLSMinVersion)
+	}
+	if len(cfg.TLSCipherSuites) == 0 {
+		return minVersion, defaultCipherSuites, nil
+	}
+	secure := map[string]uint16{}
+	for _, s := range tls.CipherSuites() {
+		secure[s.Name] = s.ID
+	}
+	suites := make([]uint16, 0, len(cfg.TLSCipherSuites))
+	for _, name := range cfg.TLSCipherSuites {
+		id, ok := secure[name]
+		if !ok {
+			return 0, nil, fmt.Errorf("tls_cipher_suites: %q is not a supported secure cipher suite", name)
+		}
+		suites = append(suites, id)
+	}
+	return minVersion, suites, nil
+}
+
+// describeTLS is the startup log line for the effective TLS settings.
+func describeTLS(c *tls.Config) string {
+	names := make([]string, len(c.CipherSuites))
+	for i, id := range c.CipherSuites {
+		names[i] = tls.CipherSuiteName(id)
+	}
+	clientAuth := "none"
+	if c.ClientAuth == tls.RequireAndVerifyClientCert {
+		clientAuth = "required"
+	}
+	return fmt.Sprintf("min %s, client certs %s, TLS 1.2 suites %s", tls.VersionName(c.MinVersion), clientAuth, strings.Join(names, ","))
+}
+
 func (ss *SocketServer) loadTLSConfig() (*tls.Config, error) {
+	minVersion, suites, err := tlsPolicy(ss.config)
+	if err != nil {
+		return nil, err
+	}
 	cert, err := tls.LoadX509KeyPair(ss.config.TLSCertFile, ss.config.TLSKeyFile)
 	if err != nil {
 		return nil, err
 	}
 
+	// Go's TLS server never renegotiates, so there is nothing to disable.
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
+		MinVersion:   minVersion,
+		CipherSuites: suites,
 	}
 
 	if ss.config.TLSCAFile != "" {
@@ -112,8 +228,10 @@ func (ss *SocketServer) loadTLSConfig() (*tls.Config, error) {
 }
 
 func (ss *SocketServer) handleConnection(conn net.Conn) {
+	defer ss.conns.Done()
 	defer conn.Close()
-	_ = conn.SetDeadline(time.Now().Add(10 * time.Minute))
+	deadline := time.Now().Add(connDeadline)
+	_ = conn.SetDeadline(deadline)
 	decoder := json.NewDecoder(conn)
 	encoder := json.NewEncoder(conn)
 
@@ -133,6 +251,7 @@ func (ss *SocketServer) handleConnection(conn net.Conn) {
 		_ = encoder.Encode(resp)
 		return
 	}
+	cmd.Deadline = deadline
 	response := ss.commandHandler.HandleCommand(cmd, clientIdentity)
 	CommandsHandled.Add(2)
 	_ = encoder.Encode(response)
@@ -144,6 +263,39 @@ func (ss *SocketServer) cleanupSocket() {
 	}
 }
 
+// checkSocketDir refuses a socket directory that another user could write
+// to: anyone able to create entries there can plant their own socket at the
+// path, or swap it between our cleanup and bind, and take commands meant for
+// a root daemon. The directory must belong to us and be writable only by us
+// or by our own or root's group. A missing directory is left to Listen.
+func checkSocketDir(dir string) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("check socket directory %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("socket directory %s is not a directory", dir)
+	}
+	mode := info.Mode().Perm()
+	if mode&0o002 != 0 {
+		return fmt.Errorf("refusing to bind in %s: it is world-writable (%#o); point socket_path at a directory only root can write, such as /run/nextdeployd", dir, mode)
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if int(st.Uid) != os.Geteuid() {
+		return fmt.Errorf("refusing to bind in %s: it is owned by uid %d, not by the daemon (uid %d)", dir, st.Uid, os.Geteuid())
+	}
+	if mode&0o020 != 0 && st.Gid != 0 && int(st.Gid) != os.Getegid() {
+		return fmt.Errorf("refusing to bind in %s: it is writable by group %d (%#o)", dir, st.Gid, mode)
+	}
+	return nil
+}
+
 func (ss *SocketServer) setSocketPermissions() error {
 	// #nosec G302
 	if err := os.Chmod(ss.config.SocketPath, 0660); err != nil {
@@ -160,10 +312,12 @@ func (ss *SocketServer) setSocketPermissions() error {
 		log.Printf("[socket] Warning: nextdeploy group not found, socket group ownership not set: %v", err)
 	}
 
+	// The group only needs to reach the socket, not write the directory:
+	// checkSocketDir would refuse a directory the nextdeploy group can write.
 	socketDir := filepath.Dir(ss.config.SocketPath)
 	if socketDir != "/var/run" && socketDir != "/run" {
 		// #nosec G302
-		if err := os.Chmod(socketDir, 0770); err != nil {
+		if err := os.Chmod(socketDir, 0750); err != nil {
 			return fmt.Errorf("failed to set socket directory permissions: %w", err)
 		}
 		if g != nil {
@@ -186,6 +340,9 @@ func (ss *SocketServer) acceptOnListener(l net.Listener) {
 	for {
 		conn, err := l.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			var ne net.Error
 			if errors.As(err, &ne) {
 				time.Sleep(100 * time.Millisecond)
@@ -193,6 +350,7 @@ func (ss *SocketServer) acceptOnListener(l net.Listener) {
 			}
 			return
 		}
+		ss.conns.Add(1)
 		go ss.handleConnection(conn)
 	}
 }
@@ -215,3 +373,132 @@ func (ss *SocketServer) Close() error {
 	}
 	return nil
 }
+
+// Reexec replaces this process with execPath while keeping the sockets bound:
+// it stops accepting, waits for in-flight commands, and execs the binary with
+// the listening descriptors inherited (see listenFDsEnv). Clients that connect
+// in between wait in the listen backlog instead of being refused, and the PID
+// stays the same, so systemd keeps tracking the service. Exec only returns on
+// failure; the server then resumes on the same sockets.
+func (ss *SocketServer) Reexec(execPath string) error {
+	files, fds, err := ss.listenerFiles()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	// The duplicated descriptors keep both sockets open once the listeners
+	// are closed; the socket file must survive that close too.
+	if ul, ok := ss.unixListener.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	ss.closeListeners()
+	ss.drain(connDeadline)
+
+	for _, f := range files {
+		if err := clearCloseOnExec(f); err != nil {
+			return errors.Join(fmt.Errorf("restart: %w", err), ss.resume(files))
+		}
+	}
+	env := []string{listenFDsEnv + "=" + fds}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, listenFDsEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	log.Printf("[socket] Handing %s to %s", fds, execPath)
+	// #nosec G204 -- execPath is this daemon's own executable
+	err = syscall.Exec(execPath, os.Args, env)
+	return errors.Join(fmt.Errorf("exec %s: %w", execPath, err), ss.resume(files))
+}
+
+// listenerFiles duplicates the listening descriptors and describes them in
+// listenFDsEnv form.
+func (ss *SocketServer) listenerFiles() ([]*os.File, string, error) {
+	var files []*os.File
+	var pairs []string
+	for _, l := range []struct {
+		name     string
+		listener net.Listener
+	}{{"unix", ss.unixListener}, {"tcp", ss.tcpRaw}} {
+		fl, ok := l.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		f, err := fl.File()
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, "", fmt.Errorf("restart: duplicate %s listener: %w", l.name, err)
+		}
+		files = append(files, f)
+		pairs = append(pairs, fmt.Sprintf("%s=%d", l.name, rawFD(f)))
+	}
+	return files, strings.Join(pairs, ","), nil
+}
+
+// closeListeners stops accepting without touching the socket file.
+func (ss *SocketServer) closeListeners() {
+	if ss.unixListener != nil {
+		_ = ss.unixListener.Close()
+	}
+	if ss.tcpListener != nil {
+		_ = ss.tcpListener.Close()
+	}
+}
+
+// drain waits up to timeout for connections being served to finish.
+func (ss *SocketServer) drain(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		ss.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("[socket] Commands still running after %s; restarting anyway", timeout)
+	}
+}
+
+// resume serves again on the sockets a failed Reexec was handing over.
+func (ss *SocketServer) resume(files []*os.File) error {
+	for _, f := range files {
+		l, err := net.FileListener(f)
+		if err != nil {
+			return fmt.Errorf("resume %s: %w", f.Name(), err)
+		}
+		if _, ok := l.(*net.UnixListener); ok {
+			ss.unixListener = l
+		} else {
+			ss.tcpRaw = l
+			ss.tcpListener = tls.NewListener(l, ss.tlsConfig)
+		}
+	}
+	ss.AcceptConnections()
+	return nil
+}
+
+// rawFD returns f's descriptor number. Unlike f.Fd it leaves the descriptor
+// non-blocking, which matters because it shares its file description with
+// the live listener.
+func rawFD(f *os.File) int {
+	fd := -1
+	if rc, err := f.SyscallConn(); err == nil {
+		_ = rc.Control(func(d uintptr) { fd = int(d) })
+	}
+	return fd
+}
+
+// clearCloseOnExec lets f survive syscall.Exec.
+func clearCloseOnExec(f *os.File) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(rawFD(f)), syscall.F_SETFD, 0); errno != 0 {
+		return fmt.Errorf("fcntl %s: %w", f.Name(), errno)
+	}
+	return nil
+}
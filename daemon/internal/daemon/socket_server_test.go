@@ -0,0 +1,249 @@
+package daemon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aynaash/nextdeploy/daemon/internal/types"
+)
+
+// TestReexecHandoffKeepsSocket walks the restartDaemon handoff without the
+// exec: the old server hands its descriptors over and stops accepting, a
+// client connects in between, and the next server picks that connection up.
+func TestReexecHandoffKeepsSocket(t *testing.T) {
+	// Unix socket paths are length-limited; t.TempDir can be too deep.
+	dir, err := os.MkdirTemp("", "nd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	cfg := &types.DaemonConfig{SocketPath: filepath.Join(dir, "d.sock")}
+
+	old := NewSocketServer(cfg, nil)
+	if err := old.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	files, fds, err := old.listenerFiles()
+	if err != nil {
+		t.Fatalf("listenerFiles: %v", err)
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	old.unixListener.(*net.UnixListener).SetUnlinkOnClose(false)
+	old.closeListeners()
+
+	conn, err := net.Dial("unix", cfg.SocketPath)
+	if err != nil {
+		t.Fatalf("client connecting mid-restart was refused: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv(listenFDsEnv, fds)
+	next := NewSocketServer(cfg, nil)
+	if err := next.Start(); err != nil {
+		t.Fatalf("next Start: %v", err)
+	}
+	defer next.Close()
+	if v := os.Getenv(listenFDsEnv); v != "" {
+		t.Errorf("%s still set after Start: %q", listenFDsEnv, v)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		c, err := next.unixListener.Accept()
+		if err == nil {
+			_ = c.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("next server did not accept the queued client: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued client never reached the next server")
+	}
+}
+
+func TestInheritedListenerRejectsBadEntry(t *testing.T) {
+	t.Setenv(listenFDsEnv, "unix=abc")
+	if _, err := inheritedListener("unix"); err == nil {
+		t.Error("want error for a non-numeric descriptor")
+	}
+	t.Setenv(listenFDsEnv, "")
+	if l, err := inheritedListener("unix"); l != nil || err != nil {
+		t.Errorf("no entry should mean no listener, got %v %v", l, err)
+	}
+}
+
+// writeTestCert writes a self-signed ECDSA certificate usable as server
+// cert, client cert and CA at once, and returns the cert and key paths.
+func writeTestCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "nextdeployd-test"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestTLSPolicy(t *testing.T) {
+	certPath, keyPath := writeTestCert(t)
+	ss := &SocketServer{config: &types.DaemonConfig{TLSCertFile: certPath, TLSKeyFile: keyPath, TLSCAFile: certPath}}
+	serverCfg, err := ss.loadTLSConfig()
+	if err != nil {
+		t.Fatalf("loadTLSConfig: %v", err)
+	}
+	if serverCfg.MinVersion != tls.VersionTLS12 || len(serverCfg.CipherSuites) != len(defaultCipherSuites) {
+		t.Errorf("defaults: min %s, %d suites", tls.VersionName(serverCfg.MinVersion), len(serverCfg.CipherSuites))
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+	dial := func(maxVersion uint16) error {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			MinVersion:   tls.VersionTLS10,
+			MaxVersion:   maxVersion,
+		})
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	if err := dial(tls.VersionTLS10); err == nil {
+		t.Error("a TLS 1.0 client must be rejected")
+	}
+	if err := dial(tls.VersionTLS11); err == nil {
+		t.Error("a TLS 1.1 client must be rejected")
+	}
+	if err := dial(tls.VersionTLS12); err != nil {
+		t.Errorf("TLS 1.2 handshake: %v", err)
+	}
+
+	ss.config.TLSMinVersion = "1.3"
+	ss.config.TLSCipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+	if c, err := ss.loadTLSConfig(); err != nil || c.MinVersion != tls.VersionTLS13 || len(c.CipherSuites) != 1 {
+		t.Errorf("configured policy = %v, %v", c, err)
+	}
+	for _, bad := range []types.DaemonConfig{
+		{TLSMinVersion: "1.0"},
+		{TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{TLSCipherSuites: []string{"TLS_MADE_UP"}},
+	} {
+		if _, _, err := tlsPolicy(&bad); err == nil {
+			t.Errorf("tlsPolicy(%+v): expected an error", bad)
+		}
+	}
+}
+
+func TestSocketDirMustNotBeWorldWritable(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "run")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocketDir(dir); err != nil {
+		t.Fatalf("0755 directory owned by us refused: %v", err)
+	}
+	if err := checkSocketDir(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("missing directory should be left to Listen, got %v", err)
+	}
+
+	// Writable by a group other than ours or root's, however trusted (the
+	// nextdeploy group included). Changing a file's group to one we are not
+	// in needs root, so unprivileged runs skip this.
+	other := 1
+	if os.Getegid() == other {
+		other = 2
+	}
+	if err := os.Chmod(dir, 0o770); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(dir, -1, other); err == nil {
+		if err := checkSocketDir(dir); err == nil {
+			t.Errorf("directory writable by group %d accepted", other)
+		}
+	}
+
+	// Like /tmp: sticky, but anyone can still create the socket path first.
+	if err := os.Chmod(dir, 0o777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocketDir(dir); err == nil {
+		t.Fatal("world-writable directory accepted")
+	}
+
+	ss := &SocketServer{config: &types.DaemonConfig{SocketPath: filepath.Join(dir, "nextdeployd.sock")}}
+	if err := ss.startUnixListener(); err == nil {
+		_ = ss.unixListener.Close()
+		t.Fatal("bound a socket in a world-writable directory")
+	}
+	if _, err := os.Stat(ss.config.SocketPath); !os.IsNotExist(err) {
+		t.Errorf("socket file created despite refusal: %v", err)
+	}
+}
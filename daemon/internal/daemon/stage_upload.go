@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// withinDir reports whether the cleaned path lies inside dir.
+func withinDir(path, dir string) bool {
+	return strings.HasPrefix(filepath.Clean(path), filepath.Clean(dir)+string(filepath.Separator))
+}
+
+// StageTarball makes a release tarball anywhere on this host deployable by
+// copying it into the uploads directory, the only place ship reads from. It
+// returns the path to ship and whether it made a copy; a tarball already
+// there is used in place. This is how `nextdeployd ship` deploys an artifact
+// carried to an air-gapped host instead of uploaded by the CLI.
+func StageTarball(src string) (string, bool, error) {
+	return stageTarball(src, uploadsDir, time.Now())
+}
+
+var unsafeUploadChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+func stageTarball(src, dir string, now time.Time) (string, bool, error) {
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return "", false, err
+	}
+	if withinDir(abs, dir) {
+		return abs, false, nil
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", false, err
+	}
+	if !info.Mode().IsRegular() {
+		return "", false, fmt.Errorf("%s is not a regular file", abs)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", false, err
+	}
+
+	dst := filepath.Join(dir, fmt.Sprintf("staged_%d_%s", now.Unix(), unsafeUploadChars.ReplaceAllString(filepath.Base(abs), "_")))
+	// #nosec G304 -- the operator names the file on their own host
+	in, err := os.Open(abs)
+	if err != nil {
+		return "", false, err
+	}
+	defer in.Close()
+	// #nosec G304
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return "", false, fmt.Errorf("copy %s to %s: %w", abs, dst, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return "", false, err
+	}
+	return dst, true, nil
+}
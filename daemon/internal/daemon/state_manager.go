@@ -2,10 +2,14 @@ package daemon
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type State struct {
@@ -28,13 +32,19 @@ func NewStateManager(path string) *StateManager {
 			Ports: make(map[string]int),
 		},
 	}
-	if err := sm.load(); err != nil {
+	if err := sm.load(appsDir); err != nil {
 		log.Printf("[state] Warning: failed to load state: %v", err)
 	}
 	return sm
 }
 
-func (sm *StateManager) load() error {
+// load reads the state file. A file that does not parse — typically one
+// truncated by a crash mid-write — is moved aside and the port assignments
+// are rebuilt from the per-app port files under appsRoot, so the daemon comes
+// back up with every app keeping its port instead of refusing to start or
+// handing ports out twice. The host fingerprint cannot be recovered; the next
+// deploy records a fresh baseline.
+func (sm *StateManager) load(appsRoot string) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -47,7 +57,45 @@ func (sm *StateManager) load() error {
 		return err
 	}
 
-	return json.Unmarshal(data, &sm.state)
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		backup := fmt.Sprintf("%s.corrupt-%d", sm.path, time.Now().Unix())
+		if rerr := os.Rename(sm.path, backup); rerr != nil {
+			log.Printf("[state] Warning: failed to move corrupt state file aside: %v", rerr)
+		}
+		st = State{Ports: recoverPorts(appsRoot)}
+		log.Printf("[state] Warning: state file %s is corrupt (%v); saved it as %s and recovered %d port assignment(s) from %s",
+			sm.path, err, backup, len(st.Ports), appsRoot)
+	}
+	if st.Ports == nil {
+		st.Ports = make(map[string]int)
+	}
+	sm.state = st
+	return nil
+}
+
+// recoverPorts rebuilds app -> port from the port files activation writes to
+// <appsRoot>/<app>/port.
+func recoverPorts(appsRoot string) map[string]int {
+	ports := make(map[string]int)
+	entries, err := os.ReadDir(appsRoot)
+	if err != nil {
+		return ports
+	}
+	for _, e := range entries {
+		if !e.IsDir() || validateAppName(e.Name()) != nil {
+			continue
+		}
+		// #nosec G304 -- path is built from a directory entry under appsRoot
+		data, err := os.ReadFile(filepath.Join(appsRoot, e.Name(), "port"))
+		if err != nil {
+			continue
+		}
+		if port, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && port > 0 {
+			ports[e.Name()] = port
+		}
+	}
+	return ports
 }
 
 func (sm *StateManager) Save() error {
@@ -63,7 +111,13 @@ func (sm *StateManager) Save() error {
 		return err
 	}
 
-	return os.WriteFile(sm.path, data, 0600)
+	// Write-then-rename so a crash mid-write leaves the previous state, not a
+	// truncated file.
+	tmp := sm.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, sm.path)
 }
 
 func (sm *StateManager) GetPort(appName string) int {
@@ -78,6 +132,21 @@ func (sm *StateManager) SetPort(appName string, port int) {
 	sm.state.Ports[appName] = port
 }
 
+// PortOwner returns the app, other than except, that has port persisted in
+// state, or "" if no other app claims it. A claimed port can be momentarily
+// free (the owning app is stopped or mid-restart), so a bind probe alone is not
+// enough to hand it to a different app.
+func (sm *StateManager) PortOwner(port int, except string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	for app, p := range sm.state.Ports {
+		if p == port && app != except {
+			return app
+		}
+	}
+	return ""
+}
+
 // GetFingerprint returns the recorded host runtime baseline, or nil if none has
 // been captured yet.
 func (sm *StateManager) GetFingerprint() *EnvFingerprint {
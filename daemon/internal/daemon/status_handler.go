@@ -2,16 +2,32 @@ package daemon
 
 import (
 	"fmt"
+	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aynaash/nextdeploy/daemon/internal/types"
+	"github.com/aynaash/nextdeploy/shared/httpx"
+	"github.com/aynaash/nextdeploy/shared/nextcore"
 )
 
 func (ch *CommandHandler) handleStatus(args map[string]any) types.Response {
+	if all, _ := args["all"].(bool); all {
+		apps, err := listApps()
+		if err != nil {
+			return types.Response{Success: false, Message: fmt.Sprintf("failed to list apps: %v", err)}
+		}
+		return aggregateHealth(apps, ch.appHealth)
+	}
+
 	appName, ok := StringArg(args, "appName")
 	if !ok {
 		return types.Response{Success: false, Message: "missing 'appName' argument"}
@@ -62,36 +78,274 @@ func (ch *CommandHandler) handleStatus(args map[string]any) types.Response {
 	}
 
 	memory := props["MemoryCurrent"]
+	var memoryBytes int64
 	if memory == "[not set]" || memory == "0" || memory == "" {
 		memory = "0MB"
 	} else {
-		var bytes int64
-		_, _ = fmt.Sscanf(memory, "%d", &bytes) // #nosec G104
-		memory = fmt.Sprintf("%.2fMB", float64(bytes)/(1024*1024))
+		_, _ = fmt.Sscanf(memory, "%d", &memoryBytes) // #nosec G104
+		memory = fmt.Sprintf("%.2fMB", float64(memoryBytes)/(1024*1024))
 	}
 	msg := fmt.Sprintf("Status: %s\nPID: %s\nMemory: %s", status, pid, memory)
+
+	disk, err := appDiskUsage(filepath.Join(appsDir, appName))
+	if err != nil {
+		log.Printf("[status] Warning: failed to measure disk usage of %s: %v", appName, err)
+	} else {
+		msg += fmt.Sprintf("\nDisk: %d releases, %.2fMB (%.2fMB reclaimable)",
+			disk.Releases, float64(disk.TotalBytes)/(1024*1024), float64(disk.ReclaimableBytes)/(1024*1024))
+	}
+	current, _, _ := releaseHistory(filepath.Join(appsDir, appName))
+	placement := readPlacement(filepath.Join(appsDir, appName), current)
+	if len(placement) > 0 {
+		msg += "\nPlacement: " + formatPlacement(placement)
+	}
+	canary, err := readCanary(appName)
+	if err != nil {
+		log.Printf("[status] Warning: failed to read canary state of %s: %v", appName, err)
+	} else if canary != nil {
+		// #nosec G204
+		out, _ := exec.Command(systemctl, "is-active", canary.Service).CombinedOutput()
+		msg += fmt.Sprintf("\nCanary: release %s on port %d taking %d%% of requests (unit %s)", canary.ReleaseID, canary.Port, canary.Weight, strings.TrimSpace(string(out)))
+	}
+	maintenance := inMaintenance(appName)
+	if maintenance {
+		msg += "\nMaintenance: on; the site serves the maintenance page"
+	}
 	return types.Response{
 		Success: true,
 		Message: msg,
 		Data: map[string]any{
-			"status": status,
-			"pid":    pid,
-			"memory": memory,
+			"status":      status,
+			"pid":         pid,
+			"memory":      memory,
+			"memoryBytes": memoryBytes,
+			"disk":        disk,
+			"placement":   placement,
+			"canary":      canary,
+			"maintenance": maintenance,
+		},
+	}
+}
+
+// appHealthStatus is one app's entry in a status --all report.
+type appHealthStatus struct {
+	Healthy bool   `json:"healthy"`
+	State   string `json:"state"`           // the unit's ActiveState
+	Release string `json:"release"`         // the live release ID
+	Error   string `json:"error,omitempty"` // why the app is unhealthy
+	// Resource usage of the unit, 0 when systemd does not account it. CPU
+	// is cumulative; a watcher derives a rate from two samples.
+	MemoryBytes  uint64 `json:"memory_bytes,omitempty"`
+	CPUUsageNSec uint64 `json:"cpu_usage_nsec,omitempty"`
+	// Placement is the live release's labels, for filtering by env or zone.
+	Placement map[string]string `json:"placement,omitempty"`
+}
+
+// aggregateHealth checks every deployed app (those with a live release) and
+// reports each one plus an overall verdict, for dashboards and CI gates: the
+// response only succeeds when every app is healthy. Apps whose directory holds
+// no release yet are skipped, so a half-finished first ship does not fail it.
+func aggregateHealth(apps []string, check func(appName string) (appHealthStatus, bool)) types.Response {
+	results := map[string]appHealthStatus{}
+	var lines []string
+	unhealthy := 0
+	for _, app := range apps {
+		if validateAppName(app) != nil {
+			continue
+		}
+		h, deployed := check(app)
+		if !deployed {
+			continue
+		}
+		results[app] = h
+		line := fmt.Sprintf("%s: healthy (%s)", app, h.Release)
+		if !h.Healthy {
+			unhealthy++
+			line = fmt.Sprintf("%s: UNHEALTHY (%s)", app, h.Error)
+		}
+		if len(h.Placement) > 0 {
+			line += " [" + formatPlacement(h.Placement) + "]"
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+
+	overall := unhealthy == 0
+	msg := fmt.Sprintf("Health: %d/%d app(s) healthy", len(results)-unhealthy, len(results))
+	if len(lines) > 0 {
+		msg += "\n- " + strings.Join(lines, "\n- ")
+	}
+	return types.Response{
+		Success: overall,
+		Message: msg,
+		Data: map[string]any{
+			"apps":            results,
+			"overall_healthy": overall,
+			"unhealthy":       unhealthy,
 		},
 	}
 }
 
+// appHealth reports whether appName's live release is up: its unit is active
+// and its health path answers below 500 on the app's port — the same bar a
+// release had to clear at activation. The second result is false when the app
+// has no live release.
+func (ch *CommandHandler) appHealth(appName string) (appHealthStatus, bool) {
+	return ch.appHealthIn(filepath.Join(appsDir, appName), appName)
+}
+
+// appHealthIn is appHealth for the app whose directory is appDir. A static
+// export runs no unit and listens on no port; Caddy serves its files, so it
+// is healthy once it has a live release.
+func (ch *CommandHandler) appHealthIn(appDir, appName string) (appHealthStatus, bool) {
+	current, _, err := releaseHistory(appDir)
+	if err != nil || current == "" {
+		return appHealthStatus{}, false
+	}
+	releaseDir := filepath.Join(appDir, "releases", current)
+	h := appHealthStatus{Release: current, State: "unknown", Placement: readPlacement(appDir, current)}
+	meta, metaErr := readMetadata(releaseDir)
+	if metaErr == nil && meta.OutputMode == nextcore.OutputModeExport {
+		h.State, h.Healthy = "static", true
+		return h, true
+	}
+
+	service, err := ch.findActiveService(appName)
+	if err != nil {
+		h.Error = "no systemd unit"
+		return h, true
+	}
+	// #nosec G204
+	out, err := exec.Command(resolveTool("systemctl"), "show", service, "--property=ActiveState,MemoryCurrent,CPUUsageNSec").CombinedOutput()
+	if err != nil {
+		h.Error = fmt.Sprintf("systemctl show: %v", err)
+		return h, true
+	}
+	props := parseProps(string(out))
+	h.State = props["ActiveState"]
+	// With accounting off systemd prints "[not set]" or its unset sentinel
+	// (max uint64); both read as 0.
+	h.MemoryBytes, _ = strconv.ParseUint(props["MemoryCurrent"], 10, 64)
+	h.CPUUsageNSec, _ = strconv.ParseUint(props["CPUUsageNSec"], 10, 64)
+	if h.MemoryBytes == math.MaxUint64 {
+		h.MemoryBytes = 0
+	}
+	if h.CPUUsageNSec == math.MaxUint64 {
+		h.CPUUsageNSec = 0
+	}
+	if h.State != "active" {
+		h.Error = "unit is " + h.State
+		return h, true
+	}
+
+	healthPath := ""
+	if metaErr == nil {
+		healthPath = meta.HealthPath
+	}
+	if err := probeHealth(ch.stateManager.GetPort(appName), healthPath); err != nil {
+		h.Error = err.Error()
+		return h, true
+	}
+	h.Healthy = true
+	return h, true
+}
+
+// probeHealth makes a single request to healthPath on port; any response
+// below 500 counts as healthy, as in waitForHealthy.
+func probeHealth(port int, healthPath string) error {
+	if port == 0 {
+		return fmt.Errorf("no port assigned")
+	}
+	if !strings.HasPrefix(healthPath, "/") {
+		healthPath = "/" + healthPath
+	}
+	client := httpx.New(httpx.Options{Timeout: 3 * time.Second})
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, healthPath))
+	if err != nil {
+		return fmt.Errorf("health probe failed: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%s returned %d", healthPath, resp.StatusCode)
+	}
+	return nil
+}
+
+// diskUsage is an app's footprint under appsDir, in bytes.
+type diskUsage struct {
+	Releases         int   `json:"releases"`
+	CurrentBytes     int64 `json:"currentBytes"`
+	ReleasesBytes    int64 `json:"releasesBytes"`
+	SharedBytes      int64 `json:"sharedBytes"`
+	TotalBytes       int64 `json:"totalBytes"`
+	ReclaimableBytes int64 `json:"reclaimableBytes"`
+}
+
+// appDiskUsage measures appDir: every release, the live one, and the static
+// assets shared across releases. Releases other than the live one are
+// reclaimable — they only serve as rollback targets.
+func appDiskUsage(appDir string) (diskUsage, error) {
+	var u diskUsage
+	current, releases, err := releaseHistory(appDir)
+	if err != nil {
+		return u, err
+	}
+	for _, id := range releases {
+		size, err := dirSize(filepath.Join(appDir, "releases", id))
+		if err != nil {
+			return u, err
+		}
+		u.Releases++
+		u.ReleasesBytes += size
+		if id == current {
+			u.CurrentBytes = size
+		}
+	}
+	if u.SharedBytes, err = dirSize(filepath.Join(appDir, "shared_static")); err != nil && !os.IsNotExist(err) {
+		return u, err
+	}
+	u.TotalBytes = u.ReleasesBytes + u.SharedBytes
+	u.ReclaimableBytes = u.ReleasesBytes - u.CurrentBytes
+	return u, nil
+}
+
+// dirSize sums the sizes of the regular files under root without following
+// symlinks.
+func dirSize(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// findActiveService returns the unit of appName's live release. A canary's
+// unit runs next to it but is not the app until promoted, so it is never
+// returned.
 func (ch *CommandHandler) findActiveService(appName string) (string, error) {
 	services, err := ch.processManager.FindAppServices(appName)
 	if err != nil {
 		return "", err
 	}
+	if canary, _ := readCanary(appName); canary != nil {
+		services = slices.DeleteFunc(services, func(s string) bool { return s == canary.Service })
+	}
 	if len(services) == 0 {
 		return "", fmt.Errorf("no services found for app %s", appName)
 	}
 
 	// Sort to find the latest timestamped service
-	sort.Strings(services)
+	slices.SortFunc(services, compareReleaseIDs)
 
 	// Search for the first one that is active or activating (checking from latest to oldest)
 	for i := len(services) - 1; i >= 0; i-- {
@@ -111,6 +365,97 @@ func (ch *CommandHandler) findActiveService(appName string) (string, error) {
 	return services[len(services)-1], nil
 }
 
+// handlePlan reports what the next ship would replace, without changing
+// anything: the live release and its unit, the port it holds, and the release
+// a rollback would return to once the new one is active. Backs
+// `nextdeploy ship --plan`.
+func (ch *CommandHandler) handlePlan(args map[string]any) types.Response {
+	appName, ok := StringArg(args, "appName")
+	if !ok {
+		return types.Response{Success: false, Message: "missing 'appName' argument"}
+	}
+	if err := validateAppName(appName); err != nil {
+		return types.Response{Success: false, Message: err.Error()}
+	}
+
+	current, releases, err := releaseHistory(filepath.Join(appsDir, appName))
+	if err != nil {
+		return types.Response{Success: false, Message: fmt.Sprintf("failed to read releases: %v", err)}
+	}
+	if current == "" {
+		return types.Response{
+			Success: true,
+			Message: "Current release: none (first deploy)\nRollback target: none",
+			Data:    map[string]any{"currentRelease": "", "releases": len(releases)},
+		}
+	}
+
+	service := "none"
+	if s, err := ch.findActiveService(appName); err == nil {
+		service = s
+	}
+	commit := "unknown"
+	if meta, err := readMetadata(filepath.Join(appsDir, appName, "releases", current)); err == nil && meta.GitCommit != "" {
+		commit = meta.GitCommit
+	}
+	port := ch.stateManager.GetPort(appName)
+
+	msg := fmt.Sprintf("Current release: %s\nCurrent commit: %s\nActive unit: %s\nPort: %d\nReleases kept: %d\nRollback target: %s",
+		current, commit, service, port, len(releases), current)
+	return types.Response{
+		Success: true,
+		Message: msg,
+		Data: map[string]any{
+			"currentRelease": current,
+			"currentCommit":  commit,
+			"service":        service,
+			"port":           port,
+			"releases":       len(releases),
+		},
+	}
+}
+
+// releaseHistory returns the release the app's current symlink points at
+// ("" before the first deploy) and every release directory, oldest first.
+func releaseHistory(appDir string) (string, []string, error) {
+	entries, err := os.ReadDir(filepath.Join(appDir, "releases"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", nil, err
+	}
+	var releases []string
+	for _, e := range entries {
+		if e.IsDir() {
+			releases = append(releases, e.Name())
+		}
+	}
+	slices.SortFunc(releases, compareReleaseIDs)
+
+	target, err := os.Readlink(filepath.Join(appDir, "current"))
+	if os.IsNotExist(err) {
+		return "", releases, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Base(target), releases, nil
+}
+
+// logUnits is the unit whose journal a logs search or export reads: the
+// active release's, or with allReleases every release unit of the app.
+func (ch *CommandHandler) logUnits(appName string, args map[string]any) ([]string, error) {
+	if all, _ := args["allReleases"].(bool); all {
+		services, err := ch.processManager.FindAppServices(appName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list services: %w", err)
+		}
+		return releaseServices(appName, services), nil
+	}
+	if service, err := ch.findActiveService(appName); err == nil {
+		return []string{service}, nil
+	}
+	return nil, nil
+}
+
 func (ch *CommandHandler) handleLogs(args map[string]any) types.Response {
 	appName, ok := StringArg(args, "appName")
 	if !ok {
@@ -120,6 +465,60 @@ func (ch *CommandHandler) handleLogs(args map[string]any) types.Response {
 		return types.Response{Success: false, Message: err.Error()}
 	}
 
+	// export_path writes the journal to a file here, for archiving logs too
+	// big to send over the socket.
+	if raw, ok := StringArg(args, "export_path"); ok && raw != "" {
+		path, err := checkExportPath(raw, ch.config.LogExportDirs)
+		if err != nil {
+			return types.Response{Success: false, Message: err.Error()}
+		}
+		since, _ := StringArg(args, "since")
+		if since != "" && !journalSince.MatchString(since) {
+			return types.Response{Success: false, Message: fmt.Sprintf("invalid since %q: use a journalctl time like \"-1h\" or \"2024-05-01 10:00\"", since)}
+		}
+		units, err := ch.logUnits(appName, args)
+		if err != nil {
+			return types.Response{Success: false, Message: err.Error()}
+		}
+		if len(units) == 0 {
+			return types.Response{Success: true, Message: "APP_NOT_DEPLOYED"}
+		}
+		return exportLogs(units, since, path)
+	}
+
+	// grep searches the journal here and returns only the matching lines,
+	// instead of the unit names the CLI would stream from.
+	if _, ok := args["grep"]; ok {
+		search, err := parseLogSearch(args)
+		if err != nil {
+			return types.Response{Success: false, Message: err.Error()}
+		}
+		units, err := ch.logUnits(appName, args)
+		if err != nil {
+			return types.Response{Success: false, Message: err.Error()}
+		}
+		if len(units) == 0 {
+			return types.Response{Success: true, Message: "APP_NOT_DEPLOYED"}
+		}
+		return searchLogs(units, search)
+	}
+
+	// allReleases returns every release unit of the app (space-separated) so
+	// the CLI can interleave them in one journalctl stream — during a rollout
+	// the old and new release run side by side.
+	if all, _ := args["allReleases"].(bool); all {
+		services, err := ch.processManager.FindAppServices(appName)
+		if err != nil {
+			return types.Response{Success: false, Message: fmt.Sprintf("failed to list services: %v", err)}
+		}
+		services = releaseServices(appName, services)
+		if len(services) == 0 {
+			return types.Response{Success: true, Message: "APP_NOT_DEPLOYED"}
+		}
+		slices.SortFunc(services, compareReleaseIDs)
+		return types.Response{Success: true, Message: strings.Join(services, " "), Data: services}
+	}
+
 	serviceName, err := ch.findActiveService(appName)
 	if err != nil {
 		return types.Response{Success: true, Message: "APP_NOT_DEPLOYED"}
@@ -130,6 +529,23 @@ func (ch *CommandHandler) handleLogs(args map[string]any) types.Response {
 	}
 }
 
+var releaseIDPattern = regexp.MustCompile(`^[0-9]+-[0-9A-Za-z]+(\.[0-9]+)?$`)
+
+// releaseServices keeps the units that belong to appName itself. The
+// "nextdeploy-<app>-" prefix FindAppServices matches on would also pick up
+// releases of an app called "<app>-api", so the remainder must be a release ID.
+func releaseServices(appName string, services []string) []string {
+	prefix := fmt.Sprintf("nextdeploy-%s-", appName)
+	var out []string
+	for _, s := range services {
+		rest, ok := strings.CutPrefix(strings.TrimSuffix(s, ".service"), prefix)
+		if s == fmt.Sprintf("nextdeploy-%s.service", appName) || (ok && releaseIDPattern.MatchString(rest)) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 func parseProps(input string) map[string]string {
 	props := make(map[string]string)
 	lines := strings.SplitSeq(input, "\n")
@@ -0,0 +1,135 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+)
+
+// deniedBindPaths may not be bind-mounted into an app, and neither may any
+// directory above them (so "/" or "/var" are refused too): each would hand the
+// app the host — the docker socket, /etc, root's home, kernel interfaces — or
+// the daemon's own state and secrets. DaemonConfig.AllowedBindPaths overrides
+// this per path.
+var deniedBindPaths = []string{
+	"/etc",
+	"/root",
+	"/boot",
+	"/proc",
+	"/sys",
+	"/dev",
+	"/run/docker.sock",
+	"/var/run/docker.sock",
+	"/run/nextdeployd",
+	"/opt/nextdeploy",
+}
+
+// bindMount is one resolved volume: Source on the host appears at Target in
+// the unit's mount namespace.
+type bindMount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// resolveVolumes turns the release's volumes into bind mounts. Named volumes
+// live in <app>/volumes/<name> and are created on first use; host paths must
+// exist and pass checkBindSource.
+func (ch *CommandHandler) resolveVolumes(appName, releaseDir string, volumes []config.Volume) ([]bindMount, error) {
+	mounts := make([]bindMount, 0, len(volumes))
+	seen := map[string]bool{}
+	for _, v := range volumes {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+		target := filepath.Join(releaseDir, v.Target)
+		if seen[target] {
+			return nil, fmt.Errorf("volumes: target %q is mounted twice", v.Target)
+		}
+		seen[target] = true
+
+		source := v.Source
+		if v.Name != "" {
+			source = filepath.Join(appsDir, appName, "volumes", v.Name)
+			if err := ensureNamedVolume(source); err != nil {
+				return nil, fmt.Errorf("volumes: create %s: %w", v.Name, err)
+			}
+		} else {
+			resolved, err := checkBindSource(source, ch.config.AllowedBindPaths)
+			if err != nil {
+				return nil, err
+			}
+			source = resolved
+		}
+		// #nosec G301 -- mount point inside the release dir the daemon owns
+		if err := os.MkdirAll(target, 0o750); err != nil {
+			return nil, fmt.Errorf("volumes: create mount point %s: %w", v.Target, err)
+		}
+		mounts = append(mounts, bindMount{Source: source, Target: target, ReadOnly: v.ReadOnly})
+	}
+	return mounts, nil
+}
+
+// ensureNamedVolume creates a named volume's directory owned by the app user.
+// An existing volume is left as is: its data is the point.
+func ensureNamedVolume(dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	//nolint:gosec,noctx // fixed ownership + resolved system chown binary
+	return exec.Command(resolveTool("chown"), "nextdeploy:nextdeploy", dir).Run()
+}
+
+// checkBindSource resolves symlinks in a host path and refuses it when it is,
+// lies under, or contains a denied path, unless it is within one of allowed.
+// It returns the resolved path so a symlink cannot be swapped afterwards to
+// point somewhere denied.
+func checkBindSource(path string, allowed []string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("volumes: source %s: %w", path, err)
+	}
+	for _, a := range allowed {
+		if a != "" && pathWithin(resolved, filepath.Clean(a)) {
+			return resolved, nil
+		}
+	}
+	for _, denied := range deniedBindPaths {
+		if pathWithin(resolved, denied) || pathWithin(denied, resolved) {
+			return "", fmt.Errorf("volumes: bind mount of %s is denied (it exposes %s); add it to allowed_bind_paths in the daemon config to permit it", path, denied)
+		}
+	}
+	return resolved, nil
+}
+
+// pathWithin reports whether path is dir or lies under it.
+func pathWithin(path, dir string) bool {
+	if dir == "/" {
+		return true
+	}
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// renderBindPaths emits the unit directives for mounts; "" when there are
+// none, so units without volumes are unchanged.
+func renderBindPaths(mounts []bindMount) string {
+	var b strings.Builder
+	for _, m := range mounts {
+		key := "BindPaths"
+		if m.ReadOnly {
+			key = "BindReadOnlyPaths"
+		}
+		fmt.Fprintf(&b, "%s=%s:%s\n", key, m.Source, m.Target)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n# --- Volumes (opt-in via nextdeploy.yml) ---\n" + b.String()
+}
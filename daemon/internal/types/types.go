@@ -1,5 +1,11 @@
 package types
 
+import (
+	"time"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+)
+
 type Command struct {
 	Type      string         `json:"type"`
 	Args      map[string]any `json:"args"`
@@ -8,6 +14,9 @@ type Command struct {
 	// and used by the daemon's ReplayGuard to reject stale/replayed commands.
 	Timestamp int64  `json:"timestamp,omitempty"`
 	Nonce     string `json:"nonce,omitempty"`
+	// Deadline is when the connection that carried the command closes. The
+	// daemon sets it; clients cannot.
+	Deadline time.Time `json:"-"`
 }
 
 const (
@@ -40,6 +49,59 @@ type DaemonConfig struct {
 	TLSKeyFile      string   `json:"tls_key_file"`
 	TLSCAFile       string   `json:"tls_ca_file"`
 	TCPListenAddr   string   `json:"tcp_listen_addr"`
+
+	// TLSMinVersion is the oldest TLS version the TCP listener accepts:
+	// "1.2" (default) or "1.3".
+	TLSMinVersion string `json:"tls_min_version,omitempty"`
+	// TLSCipherSuites restricts the TLS 1.2 cipher suites, by Go name
+	// (e.g. "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"); empty means the
+	// daemon's forward-secret AEAD defaults. TLS 1.3 suites are fixed.
+	TLSCipherSuites []string `json:"tls_cipher_suites,omitempty"`
+
+	// MaxConcurrentDeploys is how many ships may run at once across all
+	// apps; later ones queue in arrival order. 0 means 2.
+	MaxConcurrentDeploys int `json:"max_concurrent_deploys,omitempty"`
+
+	// PlacementKeys are the label keys a ship's placement may set, e.g.
+	// ["env", "zone"] (the default).
+	PlacementKeys []string `json:"placement_keys,omitempty"`
+
+	// AllowedBindPaths are host paths (and everything under them) that app
+	// volumes may bind-mount even though they fall on the built-in denylist.
+	AllowedBindPaths []string `json:"allowed_bind_paths,omitempty"`
+
+	// AllowedDevices are the host device nodes, as paths or globs such as
+	// "/dev/nvidia*", that a ship's --gpus/--device may grant an app. Empty
+	// disables device passthrough.
+	AllowedDevices []string `json:"allowed_devices,omitempty"`
+
+	// MetadataStore is where ship looks up a release's metadata by git commit
+	// when the tarball was built elsewhere and does not carry metadata.json.
+	MetadataStore *config.MetadataStoreConfig `json:"metadata_store,omitempty"`
+
+	// ChannelManifest is an https URL or file path of a JSON object
+	// mapping release channels (stable, canary) to an uploaded tarball and
+	// its sha256; `ship --channel` deploys what a channel points at.
+	ChannelManifest string `json:"channel_manifest,omitempty"`
+
+	// LogExportDirs are the directories `logs --export` may write into;
+	// empty means /var/lib/nextdeployd/log-exports.
+	LogExportDirs []string `json:"log_export_dirs,omitempty"`
+
+	// IdempotencyTTL is how long a command's idempotency_key and response
+	// are remembered, as a Go duration ("24h", the default).
+	IdempotencyTTL string `json:"idempotency_ttl,omitempty"`
+
+	// PreviousSecrets are rotated-out security secrets that still verify
+	// signatures until they expire; signing always uses SecuritySecret.
+	PreviousSecrets []RetiredSecret `json:"previous_secrets,omitempty"`
+}
+
+// RetiredSecret is a previous security secret kept for a grace window after
+// rotation, so clients that loaded the old secret are not rejected mid-flight.
+type RetiredSecret struct {
+	Secret    string    `json:"secret"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type LoggerConfig struct {
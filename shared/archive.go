@@ -4,6 +4,8 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -145,6 +147,36 @@ func ExtractTarGz(src, dest string) error {
 	return nil
 }
 
+// FileSHA256 returns the hex-encoded SHA-256 digest of the file at path.
+func FileSHA256(path string) (string, error) {
+	// #nosec G304 -- callers pass their own artifact paths
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyFileSHA256 checks that the file at path hashes to want (hex, case
+// insensitive). A mismatch means the file is not the artifact the sender
+// built — truncated, replaced, or corrupted in transit — and must not be used.
+func VerifyFileSHA256(path, want string) error {
+	got, err := FileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, strings.TrimSpace(want)) {
+		return fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", filepath.Base(path), want, got)
+	}
+	return nil
+}
+
 // CreateTarGz packs srcDir into a gzipped tar at targetTar. Entries are
 // relative to srcDir (no leading dir component). Uses system `tar` when
 // available so behaviour matches `ExtractTarGz`; no pure-Go fallback yet
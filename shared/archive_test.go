@@ -5,6 +5,7 @@ import (
 	"compress/gzip"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -120,3 +121,26 @@ func TestExtractTarGz_AllowsNextCatchAllRoute(t *testing.T) {
 		t.Fatalf("expected extracted catch-all file: %v", err)
 	}
 }
+
+func TestVerifyFileSHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.tar.gz")
+	if err := os.WriteFile(path, []byte("release artifact"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := FileSHA256(path)
+	if err != nil {
+		t.Fatalf("FileSHA256: %v", err)
+	}
+	if err := VerifyFileSHA256(path, strings.ToUpper(sum)); err != nil {
+		t.Errorf("expected matching digest to verify, got: %v", err)
+	}
+
+	// Simulate the artifact being replaced after the CLI hashed it.
+	if err := os.WriteFile(path, []byte("something else"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyFileSHA256(path, sum)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got: %v", err)
+	}
+}
@@ -8,9 +8,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/aynaash/nextdeploy/shared/httpx"
 	"github.com/aynaash/nextdeploy/shared/nextcore"
 )
 
@@ -22,9 +25,7 @@ type CaddyManager struct {
 func New(adminAPI string) *CaddyManager {
 	return &CaddyManager{
 		adminAPI: strings.TrimSuffix(adminAPI, "/"),
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		client:   httpx.New(httpx.Options{Timeout: 10 * time.Second}),
 	}
 }
 
@@ -33,7 +34,37 @@ type Config struct {
 	Format  string
 }
 
-func GenerateCaddyfile(appName, domain, outputMode string, port int, appDir string, features *nextcore.DetectedFeatures, distDir, exportDir string) string {
+// Site is the set of hostnames an app answers on.
+type Site struct {
+	// Domain is the primary hostname. Its www/apex counterpart is always
+	// served too.
+	Domain string
+	// Aliases are further hostnames (e.g. api.example.com) served by the same
+	// app.
+	Aliases []string
+	// Redirect picks a canonical host between Domain's apex and www forms:
+	// "www" redirects the apex to www, "apex" redirects www to the apex, ""
+	// serves both.
+	Redirect string
+}
+
+// Upstream is one local backend of an app's site. Weight only matters when a
+// site has several, during a canary: requests are split in proportion to it.
+type Upstream struct {
+	Port   int
+	Weight int
+}
+
+// GenerateCaddyfile renders the site block for an app. extra holds the user's
+// own directives (caddy.extra_directives / caddy.snippet); they go after the
+// generated ones.
+func GenerateCaddyfile(appName string, site Site, outputMode string, port int, appDir string, features *nextcore.DetectedFeatures, distDir, exportDir, extra string) string {
+	return GenerateCaddyfileUpstreams(appName, site, outputMode, []Upstream{{Port: port, Weight: 1}}, appDir, features, distDir, exportDir, extra)
+}
+
+// GenerateCaddyfileUpstreams is GenerateCaddyfile for a site proxied to
+// several releases at once, such as the live one and a canary.
+func GenerateCaddyfileUpstreams(appName string, site Site, outputMode string, upstreams []Upstream, appDir string, features *nextcore.DetectedFeatures, distDir, exportDir, extra string) string {
 	if distDir == "" {
 		distDir = ".next"
 	}
@@ -64,31 +95,21 @@ func GenerateCaddyfile(appName, domain, outputMode string, port int, appDir stri
 			SecDebugLog /var/log/caddy/debug.log
 			SecDebugLogLevel 3
 		"
-	}`, csp)
-
-	sDomain := domain
-	sDomain = strings.TrimPrefix(sDomain, "https://")
-	sDomain = strings.TrimPrefix(sDomain, "http://")
-	sDomain = strings.TrimSuffix(sDomain, "/")
-
-	if sDomain == "" {
-		sDomain = "localhost"
-	}
-
-	domainList := sDomain
-	if after, ok := strings.CutPrefix(sDomain, "www."); ok {
-		root := after
-		domainList = fmt.Sprintf("%s, %s", sDomain, root)
-	} else if !strings.Contains(sDomain, "localhost") && !strings.Contains(sDomain, "127.0.0.1") && !strings.Contains(sDomain, "::1") {
-		domainList = fmt.Sprintf("%s, www.%s", sDomain, sDomain)
+	}`, csp) + routeDirectives(features)
+	if extra = strings.TrimSpace(extra); extra != "" {
+		commonHeaders += "\n\t# caddy.extra_directives / caddy.snippet"
+		for line := range strings.SplitSeq(extra, "\n") {
+			commonHeaders += "\n\t" + strings.TrimRight(line, " \t\r")
+		}
 	}
 
+	domainList, redirectBlock := siteAddresses(site)
 	if outputMode == "export" {
 		staticDir := filepath.Join(appDir, exportDir)
 		return fmt.Sprintf(`%s {%s
 	root * %s
 	file_server
-}`, domainList, commonHeaders, staticDir)
+}`, domainList, commonHeaders, staticDir) + redirectBlock
 	}
 
 	sharedStaticDir := filepath.Join(filepath.Dir(appDir), "shared_static")
@@ -102,11 +123,112 @@ func GenerateCaddyfile(appName, domain, outputMode string, port int, appDir stri
 		root * %s
 		header Cache-Control "public, max-age=31536000, immutable"
 		file_server
+	}%s
+	handle {
+		%s
+	}
+}`, domainList, commonHeaders, sharedStaticDir, serverActionBodyLimit(features), reverseProxy(upstreams)) + redirectBlock
+}
+
+// reverseProxy proxies to the single upstream, or splits requests across
+// several by weight. weighted_round_robin is per request, not per client, so
+// during a canary one visitor can be served by both releases; the static
+// assets of both are in shared_static, so their pages still load.
+func reverseProxy(upstreams []Upstream) string {
+	if len(upstreams) == 1 {
+		return fmt.Sprintf("reverse_proxy localhost:%d", upstreams[0].Port)
 	}
+	addrs := make([]string, len(upstreams))
+	weights := make([]string, len(upstreams))
+	for i, u := range upstreams {
+		addrs[i] = fmt.Sprintf("localhost:%d", u.Port)
+		weights[i] = strconv.Itoa(u.Weight)
+	}
+	return fmt.Sprintf("reverse_proxy %s {\n\t\t\tlb_policy weighted_round_robin %s\n\t\t}", strings.Join(addrs, " "), strings.Join(weights, " "))
+}
+
+// GenerateMaintenanceCaddyfile renders the site block an app has while it
+// is in maintenance: every request to its hosts gets pageDir/index.html as a
+// 503 with Retry-After, instead of a connection error from a stopped
+// upstream.
+func GenerateMaintenanceCaddyfile(site Site, pageDir string, retryAfter int) string {
+	domainList, redirectBlock := siteAddresses(site)
+	return fmt.Sprintf(`%s {
+	header Retry-After "%d"
+	header Cache-Control "no-store"
 	handle {
-		reverse_proxy localhost:%d
+		root * %s
+		rewrite * /index.html
+		file_server {
+			status 503
+		}
+	}
+}`, domainList, retryAfter, pageDir) + redirectBlock
+}
+
+// serverActionBodyLimit caps server action requests (POSTs carrying a
+// Next-Action header) at the bodySizeLimit next.config sets, so Caddy
+// answers an oversized action with 413 before it reaches Node. Nothing is
+// emitted when no limit was detected: the config may set it in a way the
+// build could not read, and a guessed cap would reject actions the app
+// allows. Other requests, such as uploads to route handlers, are not
+// limited here.
+func serverActionBodyLimit(features *nextcore.DetectedFeatures) string {
+	if features == nil || features.ServerActionsBodyLimit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(`
+	@nd_server_action header Next-Action *
+	request_body @nd_server_action {
+		max_size %d
+	}`, features.ServerActionsBodyLimit)
+}
+
+// siteAddresses returns the address list of the app's site block and, when
+// site.Redirect names a canonical host, a second block redirecting the other
+// form to it. Every host appears in one of the two blocks, so Caddy obtains a
+// certificate for each.
+func siteAddresses(site Site) (string, string) {
+	host := func(d string) string {
+		d = strings.TrimPrefix(d, "https://")
+		d = strings.TrimPrefix(d, "http://")
+		return strings.ToLower(strings.TrimSuffix(d, "/"))
+	}
+
+	primary := host(site.Domain)
+	if primary == "" {
+		primary = "localhost"
+	}
+	local := strings.Contains(primary, "localhost") || strings.Contains(primary, "127.0.0.1") || strings.Contains(primary, "::1")
+
+	apex := strings.TrimPrefix(primary, "www.")
+	www := "www." + apex
+	var hosts []string
+	var redirectFrom, canonical string
+	switch {
+	case local:
+		hosts = []string{primary}
+	case site.Redirect == "www":
+		hosts, redirectFrom, canonical = []string{www}, apex, www
+	case site.Redirect == "apex":
+		hosts, redirectFrom, canonical = []string{apex}, www, apex
+	case primary == www:
+		hosts = []string{www, apex}
+	default:
+		hosts = []string{apex, www}
+	}
+
+	for _, a := range site.Aliases {
+		if a = host(a); a != "" && a != redirectFrom && !slices.Contains(hosts, a) {
+			hosts = append(hosts, a)
+		}
+	}
+
+	var redirect string
+	if redirectFrom != "" {
+		redirect = fmt.Sprintf("\n\n%s {\n\tredir https://%s{uri} permanent\n}", redirectFrom, canonical)
 	}
-}`, domainList, commonHeaders, sharedStaticDir, port)
+	return strings.Join(hosts, ", "), redirect
 }
 
 func (cm *CaddyManager) GetConfig(ctx context.Context) (*Config, error) {
@@ -0,0 +1,203 @@
+package caddy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aynaash/nextdeploy/shared/nextcore"
+)
+
+// routeDirectives translates next.config headers/redirects/rewrites into
+// Caddy header, redir and rewrite directives. Caddy orders them itself
+// (header, redir, rewrite), which matches the order Next.js applies them.
+// Rules Caddy cannot express faithfully are skipped and left to the Next.js
+// server: has/missing conditions, unsupported path syntax, and rewrites to
+// external URLs. Only beforeFiles rewrites become Caddy rewrites: afterFiles
+// and fallback rewrites apply only when no file or route matches, which only
+// the Next.js server knows, so they stay there.
+func routeDirectives(features *nextcore.DetectedFeatures) string {
+	if features == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	n := 0
+	matcher := func(source string) (name string, params map[string]bool, ok bool) {
+		re, params, ok := pathToRegexp(source)
+		if !ok {
+			return "", nil, false
+		}
+		name = fmt.Sprintf("nd_route_%d", n)
+		n++
+		fmt.Fprintf(&b, "\n\t@%s path_regexp %s %s", name, name, re)
+		return name, params, true
+	}
+
+	for _, h := range features.Headers {
+		if h.Conditional || len(h.Headers) == 0 {
+			continue
+		}
+		name, _, ok := matcher(h.Source)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "\n\theader @%s {", name)
+		for _, kv := range h.Headers {
+			fmt.Fprintf(&b, "\n\t\t%s %s", kv.Key, quote(kv.Value))
+		}
+		b.WriteString("\n\t}")
+	}
+
+	for _, r := range features.Redirects {
+		if r.Conditional {
+			continue
+		}
+		name, params, ok := matcher(r.Source)
+		if !ok {
+			continue
+		}
+		code := r.StatusCode
+		if code == 0 {
+			code = 307
+			if r.Permanent {
+				code = 308
+			}
+		}
+		fmt.Fprintf(&b, "\n\tredir @%s %s %d", name, quote(destination(r.Destination, name, params)), code)
+	}
+
+	for _, r := range features.Rewrites {
+		if r.Phase != nextcore.RewriteBeforeFiles || r.Conditional || !strings.HasPrefix(r.Destination, "/") {
+			continue
+		}
+		name, params, ok := matcher(r.Source)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "\n\trewrite @%s %s", name, quote(destination(r.Destination, name, params)))
+	}
+
+	return b.String()
+}
+
+var paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+
+// pathToRegexp converts a Next.js (path-to-regexp) source pattern such as
+// "/blog/:slug", "/docs/:path*" or "/:lang(en|fr)/about" into an anchored Go
+// regular expression with one named group per parameter. ok is false for
+// syntax it does not understand.
+func pathToRegexp(source string) (re string, params map[string]bool, ok bool) {
+	if !strings.HasPrefix(source, "/") {
+		return "", nil, false
+	}
+	params = map[string]bool{}
+	var b strings.Builder
+	b.WriteString("^")
+
+	for i := 0; i < len(source); {
+		// A parameter always follows a slash: "/:name", "/:name(re)", "/:name*".
+		if source[i] == '/' && i+1 < len(source) && source[i+1] == ':' {
+			name := paramName.FindString(source[i+2:])
+			if name == "" {
+				return "", nil, false
+			}
+			i += 2 + len(name)
+
+			pattern := "[^/]+"
+			if i < len(source) && source[i] == '(' {
+				end := closingParen(source, i)
+				if end < 0 {
+					return "", nil, false
+				}
+				pattern = source[i+1 : end]
+				i = end + 1
+			}
+
+			modifier := byte(0)
+			if i < len(source) && strings.IndexByte("*+?", source[i]) >= 0 {
+				modifier = source[i]
+				i++
+			}
+
+			switch modifier {
+			case '*':
+				fmt.Fprintf(&b, "(?:/(?P<%s>.+))?", name)
+			case '+':
+				fmt.Fprintf(&b, "/(?P<%s>.+)", name)
+			case '?':
+				fmt.Fprintf(&b, "(?:/(?P<%s>%s))?", name, pattern)
+			default:
+				fmt.Fprintf(&b, "/(?P<%s>%s)", name, pattern)
+			}
+			params[name] = true
+			continue
+		}
+
+		switch c := source[i]; c {
+		case '(':
+			end := closingParen(source, i)
+			if end < 0 {
+				return "", nil, false
+			}
+			fmt.Fprintf(&b, "(?:%s)", source[i+1:end])
+			i = end + 1
+		case ':', '*', '+', '?', ')':
+			return "", nil, false
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+			i++
+		}
+	}
+
+	b.WriteString("$")
+	if _, err := regexp.Compile(b.String()); err != nil {
+		return "", nil, false
+	}
+	return b.String(), params, true
+}
+
+// closingParen returns the index of the ")" matching the "(" at open, or -1.
+func closingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// destination swaps ":name" references in a redirect/rewrite destination for
+// the regexp placeholders captured by the named matcher.
+func destination(dest, matcher string, params map[string]bool) string {
+	var b strings.Builder
+	for i := 0; i < len(dest); {
+		if dest[i] == ':' {
+			if name := paramName.FindString(dest[i+1:]); name != "" && params[name] {
+				fmt.Fprintf(&b, "{re.%s.%s}", matcher, name)
+				i += 1 + len(name)
+				if i < len(dest) && strings.IndexByte("*+?", dest[i]) >= 0 {
+					i++
+				}
+				continue
+			}
+		}
+		b.WriteByte(dest[i])
+		i++
+	}
+	return b.String()
+}
+
+// quote renders s as a double-quoted Caddyfile token.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
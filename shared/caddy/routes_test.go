@@ -0,0 +1,174 @@
+package caddy
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aynaash/nextdeploy/shared/nextcore"
+)
+
+func TestPathToRegexp(t *testing.T) {
+	tests := []struct {
+		source  string
+		match   []string
+		noMatch []string
+	}{
+		{source: "/about", match: []string{"/about"}, noMatch: []string{"/about/x", "/aboutx"}},
+		{source: "/blog/:slug", match: []string{"/blog/hello"}, noMatch: []string{"/blog", "/blog/a/b"}},
+		{source: "/docs/:path*", match: []string{"/docs", "/docs/a/b"}, noMatch: []string{"/doc"}},
+		{source: "/docs/:path+", match: []string{"/docs/a"}, noMatch: []string{"/docs"}},
+		{source: "/:lang(en|fr)/about", match: []string{"/en/about"}, noMatch: []string{"/de/about"}},
+		{source: "/(.*)", match: []string{"/", "/anything/here"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			re, _, ok := pathToRegexp(tt.source)
+			if !ok {
+				t.Fatalf("pathToRegexp(%q) not supported", tt.source)
+			}
+			compiled := regexp.MustCompile(re)
+			for _, p := range tt.match {
+				if !compiled.MatchString(p) {
+					t.Errorf("%s should match %q", re, p)
+				}
+			}
+			for _, p := range tt.noMatch {
+				if compiled.MatchString(p) {
+					t.Errorf("%s should not match %q", re, p)
+				}
+			}
+		})
+	}
+
+	if _, _, ok := pathToRegexp("relative"); ok {
+		t.Error("sources must be absolute paths")
+	}
+}
+
+func TestGenerateCaddyfileRouteRules(t *testing.T) {
+	features := &nextcore.DetectedFeatures{
+		Redirects: []nextcore.RedirectRule{
+			{Source: "/old-blog/:slug", Destination: "/blog/:slug", Permanent: true},
+			{Source: "/beta", Destination: "https://beta.example.com", Conditional: true},
+		},
+		Headers: []nextcore.HeaderRule{
+			{Source: "/api/:path*", Headers: []nextcore.RouteHeader{{Key: "X-Custom-Header", Value: `say "hi"`}}},
+		},
+		Rewrites: []nextcore.RewriteRule{
+			{Source: "/docs", Destination: "/documentation", Phase: nextcore.RewriteBeforeFiles},
+			{Source: "/proxy/:path*", Destination: "https://upstream.example.com/:path*", Phase: nextcore.RewriteBeforeFiles},
+			{Source: "/blog/:slug", Destination: "/news/:slug", Phase: nextcore.RewriteAfterFiles},
+			{Source: "/:path*", Destination: "/legacy/:path*", Phase: nextcore.RewriteFallback},
+		},
+	}
+
+	out := GenerateCaddyfile("shop", Site{Domain: "example.com"}, "standalone", 3000, "/opt/nextdeploy/apps/shop/current", features, "", "", "")
+
+	for _, want := range []string{
+		`@nd_route_0 path_regexp nd_route_0 ^/api(?:/(?P<path>.+))?$`,
+		`header @nd_route_0 {`,
+		`X-Custom-Header "say \"hi\""`,
+		`@nd_route_1 path_regexp nd_route_1 ^/old-blog/(?P<slug>[^/]+)$`,
+		`redir @nd_route_1 "/blog/{re.nd_route_1.slug}" 308`,
+		`rewrite @nd_route_2 "/documentation"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Caddyfile missing %q:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, "beta.example.com") {
+		t.Error("conditional redirect must be left to the Next.js server")
+	}
+	if strings.Contains(out, "upstream.example.com") {
+		t.Error("external rewrite cannot be expressed as a Caddy rewrite")
+	}
+	if strings.Contains(out, "/news/") || strings.Contains(out, "/legacy/") {
+		t.Errorf("afterFiles and fallback rewrites apply only after a file/route miss; they must be left to the Next.js server:\n%s", out)
+	}
+	if n := strings.Count(out, "\trewrite @"); n != 1 {
+		t.Errorf("got %d rewrite directives, want only the beforeFiles one:\n%s", n, out)
+	}
+}
+
+func TestGenerateCaddyfileExtraDirectives(t *testing.T) {
+	extra := "header X-Robots-Tag \"noindex\"\nbasic_auth /admin/* {\n\tadmin $2a$14$hash\n}"
+	out := GenerateCaddyfile("shop", Site{Domain: "example.com"}, "standalone", 3000, "/opt/nextdeploy/apps/shop/current", nil, "", "", extra)
+
+	for _, want := range []string{
+		"\n\theader X-Robots-Tag \"noindex\"",
+		"\n\tbasic_auth /admin/* {\n\t\tadmin $2a$14$hash\n\t}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Caddyfile missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "{") != strings.Count(out, "}") {
+		t.Errorf("injected directives unbalanced the site block:\n%s", out)
+	}
+}
+
+func TestGenerateCaddyfileMultipleHosts(t *testing.T) {
+	site := Site{Domain: "example.com", Aliases: []string{"api.example.com"}}
+	out := GenerateCaddyfile("shop", site, "standalone", 3000, "/opt/nextdeploy/apps/shop/current", nil, "", "", "")
+	if !strings.HasPrefix(out, "example.com, www.example.com, api.example.com {") {
+		t.Errorf("site block should serve apex, www and api:\n%s", out)
+	}
+
+	site.Redirect = "www"
+	out = GenerateCaddyfile("shop", site, "standalone", 3000, "/opt/nextdeploy/apps/shop/current", nil, "", "", "")
+	if !strings.HasPrefix(out, "www.example.com, api.example.com {") {
+		t.Errorf("canonical www site block missing:\n%s", out)
+	}
+	if !strings.Contains(out, "\nexample.com {\n\tredir https://www.example.com{uri} permanent\n}") {
+		t.Errorf("apex should redirect to www (and still get a certificate):\n%s", out)
+	}
+
+	site.Redirect = "apex"
+	out = GenerateCaddyfile("shop", site, "standalone", 3000, "/opt/nextdeploy/apps/shop/current", nil, "", "", "")
+	if !strings.Contains(out, "\nwww.example.com {\n\tredir https://example.com{uri} permanent\n}") {
+		t.Errorf("www should redirect to the apex:\n%s", out)
+	}
+}
+
+func TestGenerateCaddyfileServerActionBodyLimit(t *testing.T) {
+	// A next.config raising the server action body limit to 5mb.
+	features := nextcore.DetectFeatures(&nextcore.NextConfig{
+		Experimental: &nextcore.ExperimentalConfig{ServerActions: true, ServerActionsBodySizeLimit: 5 << 20},
+	})
+	out := GenerateCaddyfile("shop", Site{Domain: "example.com"}, "standalone", 3000, "/opt/nextdeploy/apps/shop/current", features, "", "", "")
+	for _, want := range []string{"@nd_server_action header Next-Action *", "request_body @nd_server_action {", "max_size 5242880"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Caddyfile missing %q:\n%s", want, out)
+		}
+	}
+
+	// Undetected, Caddy must not guess a cap the app may have raised.
+	for _, f := range []*nextcore.DetectedFeatures{nil, nextcore.DetectFeatures(&nextcore.NextConfig{})} {
+		out = GenerateCaddyfile("shop", Site{Domain: "example.com"}, "standalone", 3000, "/opt/nextdeploy/apps/shop/current", f, "", "", "")
+		if strings.Contains(out, "request_body") || strings.Contains(out, "max_size") {
+			t.Errorf("no detected limit should emit no request_body cap:\n%s", out)
+		}
+	}
+}
+
+func TestGenerateMaintenanceCaddyfile(t *testing.T) {
+	site := Site{Domain: "example.com", Redirect: "www"}
+	out := GenerateMaintenanceCaddyfile(site, "/opt/nextdeploy/apps/shop/maintenance", 30)
+	for _, want := range []string{
+		"www.example.com {",
+		`header Retry-After "30"`,
+		"root * /opt/nextdeploy/apps/shop/maintenance",
+		"rewrite * /index.html",
+		"status 503",
+		"\nexample.com {\n\tredir https://www.example.com{uri} permanent\n}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("maintenance site missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "reverse_proxy") {
+		t.Errorf("maintenance site must not proxy to the stopped app:\n%s", out)
+	}
+}
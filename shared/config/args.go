@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Args is an argument vector. In nextdeploy.yml it is either a YAML list,
+// taken verbatim, or a single string split like a POSIX shell would:
+//
+//	command: ["node", "server.js", "--title=my app"]
+//	command: node server.js --title="my app"
+//
+// Splitting honours single and double quotes and backslash escapes, but
+// performs no expansion ($VAR, globs, ~), so the result is the same on every
+// server.
+type Args []string
+
+// UnmarshalYAML accepts both the list and the string form.
+func (a *Args) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		var list []string
+		if err := node.Decode(&list); err != nil {
+			return err
+		}
+		*a = list
+		return nil
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			*a = nil
+			return nil
+		}
+		args, err := SplitArgs(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		*a = args
+		return nil
+	default:
+		return fmt.Errorf("line %d: want a string or a list of strings", node.Line)
+	}
+}
+
+// SplitArgs splits s into arguments with POSIX shell quoting rules: blanks
+// separate arguments; '...' is literal; "..." is literal except for \" \\ \$
+// and \`; a backslash outside quotes escapes the next character. Empty quotes
+// yield an empty argument. An unterminated quote or trailing backslash is an
+// error rather than being guessed at.
+func SplitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inArg   bool
+		runes   = []rune(s)
+		escaped = func(r rune) bool { return strings.ContainsRune("\"\\$`", r) }
+	)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("unterminated escape at end of %q", s)
+			}
+			i++
+			cur.WriteRune(runes[i])
+			inArg = true
+		case r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated single quote in %q", s)
+			}
+			cur.WriteString(string(runes[i+1 : end]))
+			i, inArg = end, true
+		case r == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && escaped(runes[i+1]) {
+					i++
+				}
+				cur.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated double quote in %q", s)
+			}
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"node server.js", []string{"node", "server.js"}},
+		{"  node   server.js\t--port 3000 ", []string{"node", "server.js", "--port", "3000"}},
+		{`node server.js --title="my app"`, []string{"node", "server.js", "--title=my app"}},
+		{`sh -c 'echo "$PORT" && exec node server.js'`, []string{"sh", "-c", `echo "$PORT" && exec node server.js`}},
+		{`echo "a \"quoted\" \$word" 'it'\''s'`, []string{"echo", `a "quoted" $word`, "it's"}},
+		{`printf "%s\n" a\ b`, []string{"printf", `%s\n`, "a b"}},
+		{`node "" x`, []string{"node", "", "x"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.in)
+		if err != nil {
+			t.Errorf("SplitArgs(%q): %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{`node "server.js`, `node 'server.js`, `node server.js\`} {
+		if _, err := SplitArgs(bad); err == nil {
+			t.Errorf("SplitArgs(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestStartCommandYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Args
+	}{
+		{"list", "command: [\"node\", \"server.js\", \"--title=my app\"]\n", Args{"node", "server.js", "--title=my app"}},
+		{"string", "command: node server.js --title=\"my app\"\n", Args{"node", "server.js", "--title=my app"}},
+		{"block string", "command: >-\n  node server.js\n  --port 3000\n", Args{"node", "server.js", "--port", "3000"}},
+		{"null", "entrypoint: ./start.sh\ncommand:\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s StartCommand
+			if err := yaml.Unmarshal([]byte(tt.in), &s); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !slices.Equal(s.Command, tt.want) {
+				t.Errorf("Command = %q, want %q", s.Command, tt.want)
+			}
+		})
+	}
+
+	var s StartCommand
+	if err := yaml.Unmarshal([]byte("command: node \"server.js\n"), &s); err == nil {
+		t.Error("expected an error for an unterminated quote")
+	}
+	if err := yaml.Unmarshal([]byte("command: {a: b}\n"), &s); err == nil {
+		t.Error("expected an error for a mapping")
+	}
+}
+
+func TestDeployHooksJSON(t *testing.T) {
+	hooks := DeployHooks{PreRollback: []Hook{{Name: "down", Run: Args{"npx", "prisma", "migrate", "reset"}, Timeout: "2m"}}}
+	// metadata.json from before the json tags used the Go field names.
+	legacy := `{"PreDeploy":null,"PostDeploy":null,"PreRollback":[{"Name":"down","Run":["npx","prisma","migrate","reset"],"Timeout":"2m"}]}`
+	data, err := json.Marshal(hooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"preRollback":[{"name":"down","run":["npx","prisma","migrate","reset"],"timeout":"2m"}]}`; string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+	for _, doc := range []string{string(data), legacy} {
+		var got DeployHooks
+		if err := json.Unmarshal([]byte(doc), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, hooks) {
+			t.Errorf("%s decoded as %+v, want %+v", doc, got, hooks)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCaddyConfigDirectives(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Caddyfile.snippet"), []byte("rate_limit {\n\tzone api 10r/s\n}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := (&CaddyConfig{ExtraDirectives: `header X-Robots-Tag "noindex"`, Snippet: "Caddyfile.snippet"}).Directives(dir)
+	if err != nil {
+		t.Fatalf("Directives: %v", err)
+	}
+	if want := "header X-Robots-Tag \"noindex\"\nrate_limit {\n\tzone api 10r/s\n}"; got != want {
+		t.Errorf("Directives = %q, want %q", got, want)
+	}
+
+	if got, err := (*CaddyConfig)(nil).Directives(dir); err != nil || got != "" {
+		t.Errorf("nil config: got %q, %v", got, err)
+	}
+
+	for name, c := range map[string]*CaddyConfig{
+		"escapes site block": {ExtraDirectives: "}\nevil.example.com {\n\treverse_proxy attacker:80"},
+		"unclosed block":     {ExtraDirectives: "handle /x {"},
+		"snippet outside":    {Snippet: "../Caddyfile"},
+		"missing snippet":    {Snippet: "nope.caddy"},
+	} {
+		if _, err := c.Directives(dir); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCheckCaddyDirectives(t *testing.T) {
+	ok := map[string]string{
+		"brace in a comment":       "# keep { for later\nheader X-Frame-Options DENY",
+		"brace in a quoted string": `respond "{ not a block" 200`,
+		"escaped quote":            `header X-Msg "say \"}\" twice"`,
+		"backtick string":          "respond `} {` 200",
+		"placeholder":              "header X-Host {http.request.host}",
+		"hash inside a token":      "rewrite /a#{ /b",
+		"escaped heredoc marker":   `respond \<<EOF`,
+		"nested blocks":            "handle /api/* {\n\theader {\n\t\t-Server\n\t}\n}",
+	}
+	for name, d := range ok {
+		if err := CheckCaddyDirectives(d); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	bad := map[string]string{
+		// A counter that saw the commented braces would find these balanced;
+		// Caddy closes the site block at the bare }.
+		"escape behind comments": "# {\n}\nevil.example.com {\n\treverse_proxy attacker:80\n}\nfoo {\n# }",
+		"escape behind a quote":  "respond \"{\"\n}\nevil.example.com {\n}",
+		"unterminated quote":     "respond \"}\n}",
+		"heredoc":                "respond <<EOF\n{\nEOF\n}",
+		"control character":      "header X \x1b[31m",
+		"stray close":            "}",
+		"unclosed":               "handle /x {",
+	}
+	for name, d := range bad {
+		if err := CheckCaddyDirectives(d); err == nil {
+			t.Errorf("%s: expected an error for %q", name, d)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// caddyToken is one token of Caddyfile text as Caddy's lexer splits it.
+type caddyToken struct {
+	text   string
+	quoted bool
+}
+
+// lexCaddyfile splits Caddyfile text into tokens the way Caddy's lexer does:
+// whitespace separates tokens, "..." and `...` quote one (a backslash
+// escapes inside "..."), and # starts a comment only at the start of a
+// token. Heredocs are refused rather than lexed.
+func lexCaddyfile(s string) ([]caddyToken, error) {
+	var (
+		tokens           []caddyToken
+		val              []rune
+		quote            rune
+		escaped, comment bool
+		// literalLT is set when the token opened with \<, which Caddy reads
+		// as a literal < rather than the start of a heredoc.
+		literalLT bool
+	)
+	emit := func(quoted bool) {
+		tokens = append(tokens, caddyToken{text: string(val), quoted: quoted})
+		val, literalLT = val[:0], false
+	}
+	for _, ch := range s {
+		if !escaped && quote != '`' && ch == '\\' {
+			escaped = true
+			continue
+		}
+		if quote != 0 {
+			if quote == '"' && escaped {
+				if ch != '"' {
+					val = append(val, '\\')
+				}
+				escaped = false
+			} else if ch == quote {
+				emit(true)
+				quote = 0
+				continue
+			}
+			val = append(val, ch)
+			continue
+		}
+		if unicode.IsSpace(ch) {
+			if ch == '\n' {
+				escaped, comment = false, false
+			}
+			if len(val) > 0 {
+				emit(false)
+			}
+			continue
+		}
+		if ch == '#' && len(val) == 0 {
+			comment = true
+		}
+		if comment {
+			continue
+		}
+		if len(val) == 0 && (ch == '"' || ch == '`') {
+			quote = ch
+			continue
+		}
+		if escaped {
+			if ch != '<' {
+				val = append(val, '\\')
+			} else if len(val) == 0 {
+				literalLT = true
+			}
+			escaped = false
+		}
+		val = append(val, ch)
+		if len(val) == 2 && string(val) == "<<" && !literalLT {
+			return nil, fmt.Errorf("caddy directives may not use heredocs")
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("caddy directives have an unterminated %c quote", quote)
+	}
+	if len(val) > 0 {
+		emit(false)
+	}
+	return tokens, nil
+}
+
+// CheckCaddyDirectives reports whether directives are safe to paste into a
+// generated site block: no control characters, and every block they open is
+// closed within them. Braces are counted per token as Caddy reads them, so a
+// brace in a comment, a quoted string or a placeholder does not count, and a
+// quoted lone brace, which Caddy versions disagree on, is refused.
+func CheckCaddyDirectives(directives string) error {
+	if strings.IndexFunc(directives, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r'
+	}) >= 0 {
+		return fmt.Errorf("caddy directives contain control characters")
+	}
+	tokens, err := lexCaddyfile(directives)
+	if err != nil {
+		return err
+	}
+	depth := 0
+	for _, tok := range tokens {
+		if tok.text != "{" && tok.text != "}" {
+			continue
+		}
+		if tok.quoted {
+			return fmt.Errorf("caddy directives may not quote a lone %q", tok.text)
+		}
+		if tok.text == "{" {
+			depth++
+		} else if depth--; depth < 0 {
+			return fmt.Errorf("caddy directives close a block they did not open")
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("caddy directives have an unclosed block")
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"reflect"
 	"testing"
 
 	"gopkg.in/yaml.v3"
@@ -34,7 +35,7 @@ domain:
 		t.Fatalf("unmarshal block domain: %v", err)
 	}
 	want := DomainConfig{Name: "example.com", Provider: "cloudflare", DNS: "auto", Zone: "example.com"}
-	if app.Domain != want {
+	if !reflect.DeepEqual(app.Domain, want) {
 		t.Errorf("got %+v, want %+v", app.Domain, want)
 	}
 }
@@ -46,6 +47,7 @@ func TestDomainConfigMarshalRoundTrip(t *testing.T) {
 	}{
 		{"scalar-only", DomainConfig{Name: "example.com"}},
 		{"full-block", DomainConfig{Name: "example.com", Provider: "namecheap", DNS: "manual", Zone: "example.com"}},
+		{"aliases", DomainConfig{Name: "example.com", Aliases: []string{"api.example.com"}, Redirect: "www"}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -57,7 +59,7 @@ func TestDomainConfigMarshalRoundTrip(t *testing.T) {
 			if err := yaml.Unmarshal(out, &got); err != nil {
 				t.Fatalf("unmarshal: %v", err)
 			}
-			if got != tt.in {
+			if !reflect.DeepEqual(got, tt.in) {
 				t.Errorf("round trip: got %+v, want %+v (yaml: %s)", got, tt.in, out)
 			}
 		})
@@ -75,3 +77,20 @@ func TestDomainConfigMarshalCompact(t *testing.T) {
 		t.Errorf("compact form = %q, want %q", got, "example.com\n")
 	}
 }
+
+func TestDomainConfigValidate(t *testing.T) {
+	valid := DomainConfig{Name: "example.com", Aliases: []string{"api.example.com"}, Redirect: "apex"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate(%+v) = %v", valid, err)
+	}
+	for _, d := range []DomainConfig{
+		{Name: "example.com", Redirect: "both"},
+		{Redirect: "www"},
+		{Name: "example.com", Aliases: []string{"api.example.com {"}},
+		{Name: "example.com", Aliases: []string{""}},
+	} {
+		if err := d.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", d)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EnvFileOrder returns the dotenv files Next.js loads for environment, lowest
+// precedence first: .env, .env.<environment>, .env.local,
+// .env.<environment>.local. Like Next.js, .env.local is skipped for the test
+// environment so test runs stay reproducible. An empty environment means
+// "production", which is what `next start` runs as.
+func EnvFileOrder(environment string) []string {
+	if environment == "" {
+		environment = "production"
+	}
+	files := []string{".env", ".env." + environment}
+	if environment != "test" {
+		files = append(files, ".env.local")
+	}
+	return append(files, ".env."+environment+".local")
+}
+
+// ResolveEnv merges the dotenv files in dir in EnvFileOrder, later files
+// overriding earlier ones, and returns the merged variables along with the
+// files that contributed. When FILE is missing but FILE.enc exists, decrypt is
+// called with the .enc path to obtain its plaintext; a nil decrypt skips
+// encrypted variants.
+func ResolveEnv(dir, environment string, decrypt func(encPath string) (string, error)) (map[string]string, []string, error) {
+	env := make(map[string]string)
+	var loaded []string
+
+	for _, name := range EnvFileOrder(environment) {
+		path := filepath.Join(dir, name)
+
+		// #nosec G304 -- fixed dotenv names inside the project directory
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+		case os.IsNotExist(err):
+			if decrypt == nil {
+				continue
+			}
+			if _, statErr := os.Stat(path + ".enc"); statErr != nil {
+				continue
+			}
+			plain, decErr := decrypt(path + ".enc")
+			if decErr != nil {
+				return nil, nil, fmt.Errorf("decrypt %s.enc: %w", name, decErr)
+			}
+			data = []byte(plain)
+			name += ".enc"
+		default:
+			return nil, nil, fmt.Errorf("read %s: %w", name, err)
+		}
+
+		for k, v := range ParseDotenv(string(data)) {
+			env[k] = v
+		}
+		loaded = append(loaded, name)
+	}
+	return env, loaded, nil
+}
+
+// ParseDotenv parses dotenv content: KEY=VALUE lines, optional "export "
+// prefixes, # comments, and single- or double-quoted values. A quoted value
+// may span lines, as a PEM key in double quotes does; one whose quote never
+// closes is taken as written on its line. Lines without a key are ignored.
+func ParseDotenv(content string) map[string]string {
+	env := make(map[string]string)
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			q := value[0]
+			body, j := value[1:], i
+			end := DotenvQuoteEnd(body, q)
+			for end < 0 && j+1 < len(lines) {
+				j++
+				body += "\n" + strings.TrimSuffix(lines[j], "\r")
+				end = DotenvQuoteEnd(body, q)
+			}
+			if end >= 0 {
+				value, i = body[:end], j
+				if q == '"' {
+					value = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\"`, `"`, `\\`, `\`).Replace(value)
+				}
+				env[key] = value
+				continue
+			}
+		}
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		env[key] = value
+	}
+	return env
+}
+
+// DotenvQuoteEnd returns the index in s of the quote q that ends a dotenv
+// value opened just before s, or -1 when s does not close it. Inside double
+// quotes a backslash escapes the next character.
+func DotenvQuoteEnd(s string, q byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+// FormatDotenv renders env as sorted KEY="value" lines that ParseDotenv reads
+// back unchanged.
+func FormatDotenv(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", k, r.Replace(env[k]))
+	}
+	return b.String()
+}
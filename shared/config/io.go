@@ -17,6 +17,9 @@ func LoadConfig() (*NextDeployConfig, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("%s Invalid config format: %w", EmojiWarning, err)
 	}
+	if err := CheckSchemaVersion(cfg.SchemaVersion); err != nil {
+		return nil, err
+	}
 
 	fmt.Printf("%s Configuration loaded successfully\n", EmojiSuccess)
 	return &cfg, nil
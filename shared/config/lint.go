@@ -0,0 +1,264 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity ranks a lint finding. Only SeverityHigh fails `config lint
+// --strict`.
+type Severity int
+
+const (
+	SeverityLow Severity = iota
+	SeverityMedium
+	SeverityHigh
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityHigh:
+		return "high"
+	case SeverityMedium:
+		return "medium"
+	}
+	return "low"
+}
+
+// LintFinding is one insecure setting. Line is 0 when the finding is not
+// about a line of File.
+type LintFinding struct {
+	Rule     string
+	Severity Severity
+	File     string
+	Field    string
+	Line     int
+	Message  string
+}
+
+func (f LintFinding) String() string {
+	loc := f.File
+	if f.Line > 0 {
+		loc += ":" + strconv.Itoa(f.Line)
+	}
+	if f.Field != "" {
+		loc += " " + f.Field
+	}
+	return fmt.Sprintf("[%s] %s: %s (%s)", f.Severity, loc, f.Message, f.Rule)
+}
+
+// LintInput is what Lint checks besides nextdeploy.yml itself.
+type LintInput struct {
+	// ProjectDir holds the project's .gitignore and .env files.
+	ProjectDir string
+	// PoweredByHeader is next.config's poweredByHeader, which Next.js
+	// defaults to true; nil when next.config could not be read.
+	PoweredByHeader *bool
+	// DaemonConfigFile and DaemonConfig are the path and contents of a
+	// nextdeployd config.json, when one is checked.
+	DaemonConfigFile string
+	DaemonConfig     []byte
+}
+
+// credentialKeys are the config keys that hold secrets when the schema types
+// them as strings (environment[].secret, a bool, only marks one). Their
+// values belong in the secrets store, referenced as ${secret:NAME}.
+var credentialKeys = []string{
+	"password", "secret", "access_key", "accessKey", "secret_key", "secretKey",
+	"token", "session_token", "webhookSecret", "key_passphrase",
+}
+
+// Lint reports the insecure settings in the nextdeploy.yml document data and
+// in the project around it, most severe first. Unlike Check it does not
+// look for invalid config, only valid config that is unsafe.
+func Lint(data []byte, in LintInput) ([]LintFinding, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", ConfigFile, err)
+	}
+	lines := make(map[string]int)
+	walkFields(&doc, func(path string, line int, _ bool) { lines[path] = line })
+	var cfg NextDeployConfig
+	// Type errors are Check's job; lint what did decode.
+	_ = doc.Decode(&cfg)
+
+	var findings []LintFinding
+	findings = append(findings, lintEnvIgnored(in.ProjectDir)...)
+	findings = append(findings, lintCredentials(&doc)...)
+	findings = append(findings, lintDockerSocket(cfg.App.Volumes, lines)...)
+	if in.PoweredByHeader != nil && *in.PoweredByHeader {
+		findings = append(findings, LintFinding{
+			Rule:     "powered-by-header",
+			Severity: SeverityMedium,
+			File:     "next.config",
+			Field:    "poweredByHeader",
+			Message:  "every response carries X-Powered-By: Next.js, telling scanners what to probe for; set poweredByHeader: false",
+		})
+	}
+	if in.DaemonConfig != nil {
+		findings = append(findings, lintDaemonConfig(in.DaemonConfigFile, in.DaemonConfig)...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Severity > findings[j].Severity })
+	return findings, nil
+}
+
+// lintEnvIgnored flags .env files git would commit: .env itself, whether or
+// not it exists yet, and any other .env.* file present except templates
+// such as .env.example.
+func lintEnvIgnored(projectDir string) []LintFinding {
+	names := []string{".env"}
+	if entries, err := os.ReadDir(projectDir); err == nil {
+		for _, e := range entries {
+			n := e.Name()
+			if e.IsDir() || !strings.HasPrefix(n, ".env.") || slices.Contains([]string{".example", ".sample", ".template"}, filepath.Ext(n)) {
+				continue
+			}
+			names = append(names, n)
+		}
+	}
+	// #nosec G304 -- the project's own .gitignore
+	gitignore, _ := os.ReadFile(filepath.Join(projectDir, ".gitignore"))
+
+	var findings []LintFinding
+	for _, name := range names {
+		if gitignoreMatches(string(gitignore), name) {
+			continue
+		}
+		f := LintFinding{Rule: "env-not-ignored", Severity: SeverityMedium, File: ".gitignore", Field: name,
+			Message: name + " is not ignored; once created, its secrets can be committed by accident"}
+		if _, err := os.Stat(filepath.Join(projectDir, name)); err == nil {
+			f.Severity = SeverityHigh
+			f.Message = name + " exists and is not ignored; its secrets will be committed with the next `git add`"
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// gitignoreMatches reports whether the .gitignore content ignores the file
+// name at the project root. It follows gitignore's rules for the patterns
+// that can match a root file: globs, a leading / or **/, and ! negation.
+func gitignoreMatches(content, name string) bool {
+	ignored := false
+	for line := range strings.SplitSeq(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(line, "!")
+		pattern := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(line, "!"), "/"), "**/")
+		if strings.Contains(pattern, "/") {
+			continue // a directory, or a path below the root
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			ignored = !negate
+		}
+	}
+	return ignored
+}
+
+// lintCredentials flags credentials written into the config in plain text
+// rather than as ${secret:NAME} references: string fields named in
+// credentialKeys, and the value of an environment variable marked secret.
+func lintCredentials(doc *yaml.Node) []LintFinding {
+	var findings []LintFinding
+	flag := func(p string, key, value *yaml.Node) {
+		if value.Kind != yaml.ScalarNode || value.Value == "" || secretRef.MatchString(value.Value) {
+			return
+		}
+		what := "a credential"
+		if strings.HasPrefix(p, "docker.") {
+			what = "a registry credential"
+		}
+		findings = append(findings, LintFinding{Rule: "plaintext-credential", Severity: SeverityHigh, File: ConfigFile, Field: p, Line: key.Line,
+			Message: what + " in plain text; move it to the secrets store and reference it as ${secret:NAME}"})
+	}
+	var walk func(n *yaml.Node, path string)
+	walk = func(n *yaml.Node, path string) {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+		case yaml.MappingNode:
+			secretEnv := false
+			if t, err := fieldType(path); err == nil && t == reflect.TypeOf(EnvVariable{}) {
+				var env EnvVariable
+				secretEnv = n.Decode(&env) == nil && env.Secret
+			}
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key, value := n.Content[i], n.Content[i+1]
+				p := joinPath(path, key.Value)
+				if secretEnv && key.Value == "value" {
+					flag(p, key, value)
+				} else if slices.Contains(credentialKeys, key.Value) {
+					if t, err := fieldType(p); err == nil && t.Kind() == reflect.String {
+						flag(p, key, value)
+					}
+				}
+				walk(value, p)
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				walk(c, joinPath(path, strconv.Itoa(i)))
+			}
+		}
+	}
+	walk(doc, "")
+	return findings
+}
+
+// dockerSockets are the host paths of the docker socket. A bind mount of
+// either, or of a directory above them, gives the app root on the host.
+var dockerSockets = []string{"/var/run/docker.sock", "/run/docker.sock"}
+
+func lintDockerSocket(volumes []Volume, lines map[string]int) []LintFinding {
+	var findings []LintFinding
+	for i, v := range volumes {
+		if v.Source == "" || !filepath.IsAbs(v.Source) {
+			continue
+		}
+		src := filepath.Clean(v.Source)
+		for _, sock := range dockerSockets {
+			if src == sock || strings.HasPrefix(sock, strings.TrimSuffix(src, "/")+"/") {
+				field := fmt.Sprintf("app.volumes[%d].source", i)
+				findings = append(findings, LintFinding{Rule: "docker-socket-mount", Severity: SeverityHigh, File: ConfigFile, Field: field, Line: lineOf(lines, field),
+					Message: fmt.Sprintf("%s exposes the docker socket to the app, which is root on the host", v.Source)})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// lintDaemonConfig flags a nextdeployd socket_mode that lets anyone outside
+// the nextdeploy group send commands to the daemon.
+func lintDaemonConfig(file string, data []byte) []LintFinding {
+	// A config.json is also YAML, so this reads either format.
+	var dc struct {
+		SocketMode string `yaml:"socket_mode"`
+	}
+	if err := yaml.Unmarshal(data, &dc); err != nil || dc.SocketMode == "" {
+		return nil
+	}
+	mode, err := strconv.ParseUint(dc.SocketMode, 8, 32)
+	if err != nil {
+		return []LintFinding{{Rule: "daemon-socket-mode", Severity: SeverityMedium, File: file, Field: "socket_mode",
+			Message: fmt.Sprintf("%q is not an octal file mode", dc.SocketMode)}}
+	}
+	if mode&^0o660 == 0 {
+		return nil
+	}
+	return []LintFinding{{Rule: "daemon-socket-mode", Severity: SeverityHigh, File: file, Field: "socket_mode",
+		Message: fmt.Sprintf("%04o is more permissive than 0660; any local user could drive the daemon", mode)}}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lintRules runs Lint and returns the rule and severity of each finding.
+func lintRules(t *testing.T, doc string, in LintInput) map[string]Severity {
+	t.Helper()
+	if in.ProjectDir == "" {
+		in.ProjectDir = t.TempDir()
+		if err := os.WriteFile(filepath.Join(in.ProjectDir, ".gitignore"), []byte(".env\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	findings, err := Lint([]byte(doc), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := map[string]Severity{}
+	for i, f := range findings {
+		if i > 0 && f.Severity > findings[i-1].Severity {
+			t.Errorf("findings not ranked by severity: %v", findings)
+		}
+		rules[f.Rule+" "+f.Field] = f.Severity
+	}
+	return rules
+}
+
+func TestLintEnvNotIgnored(t *testing.T) {
+	tests := []struct {
+		name      string
+		gitignore string
+		files     []string
+		want      map[string]Severity
+	}{
+		{"ignored", ".env\n", []string{".env"}, map[string]Severity{}},
+		{"glob", "node_modules/\n.env*\n!.env.example\n", []string{".env", ".env.local", ".env.example"}, map[string]Severity{}},
+		{"rooted", "/.env\n", nil, map[string]Severity{}},
+		{"no gitignore, no .env", "", nil, map[string]Severity{"env-not-ignored .env": SeverityMedium}},
+		{"present and committed", "node_modules/\n", []string{".env"}, map[string]Severity{"env-not-ignored .env": SeverityHigh}},
+		{"negated", ".env*\n!.env.production\n", []string{".env.production"}, map[string]Severity{"env-not-ignored .env.production": SeverityHigh}},
+		{"subdirectory pattern", "config/.env\n", nil, map[string]Severity{"env-not-ignored .env": SeverityMedium}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.gitignore != "" {
+				if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte(tt.gitignore), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, f := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, f), []byte("SECRET=1\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := lintRules(t, "app:\n  name: demo\n", LintInput{ProjectDir: dir})
+			if len(got) != len(tt.want) {
+				t.Fatalf("findings = %v, want %v", got, tt.want)
+			}
+			for k, sev := range tt.want {
+				if got[k] != sev {
+					t.Errorf("%s = %v, want %v (all: %v)", k, got[k], sev, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLintPoweredByHeader(t *testing.T) {
+	on, off := true, false
+	if got := lintRules(t, "app:\n  name: demo\n", LintInput{PoweredByHeader: &on}); got["powered-by-header poweredByHeader"] != SeverityMedium {
+		t.Errorf("poweredByHeader true not flagged: %v", got)
+	}
+	for _, in := range []LintInput{{PoweredByHeader: &off}, {}} {
+		if got := lintRules(t, "app:\n  name: demo\n", in); len(got) != 0 {
+			t.Errorf("unexpected findings: %v", got)
+		}
+	}
+}
+
+func TestLintDockerSocketMount(t *testing.T) {
+	doc := `app:
+  name: demo
+  volumes:
+    - source: /srv/uploads
+      target: uploads
+    - source: /var/run/docker.sock
+      target: docker.sock
+    - source: /run
+      target: run
+`
+	got := lintRules(t, doc, LintInput{})
+	want := map[string]Severity{
+		"docker-socket-mount app.volumes[1].source": SeverityHigh,
+		"docker-socket-mount app.volumes[2].source": SeverityHigh,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("findings = %v, want %v", got, want)
+	}
+	for k := range want {
+		if got[k] != SeverityHigh {
+			t.Errorf("%s not flagged high: %v", k, got)
+		}
+	}
+}
+
+func TestLintPlaintextCredentials(t *testing.T) {
+	doc := `app:
+  name: demo
+docker:
+  image: demo
+  username: ci
+  password: hunter2
+servers:
+  - host: 203.0.113.7
+    password: ${secret:ssh_pass}
+`
+	got := lintRules(t, doc, LintInput{})
+	if len(got) != 1 || got["plaintext-credential docker.password"] != SeverityHigh {
+		t.Errorf("findings = %v, want only docker.password, high", got)
+	}
+}
+
+func TestLintCredentialFields(t *testing.T) {
+	doc := `app:
+  name: demo
+repository:
+  webhookSecret: whsec_123
+CloudProvider:
+  name: aws
+  access_key: AKIAEXAMPLE
+  secret_key: ${secret:aws_secret}
+  session_token: FwoGZXIvYXdzEXAMPLE
+backup:
+  storage:
+    secretKey: minio-secret
+servers:
+  - host: 203.0.113.7
+    key_passphrase: correct horse
+environment:
+  - name: NODE_ENV
+    value: production
+  - name: STRIPE_KEY
+    value: sk_live_123
+    secret: true
+  - name: DATABASE_URL
+    value: ${secret:database_url}
+    secret: true
+`
+	got := lintRules(t, doc, LintInput{})
+	want := []string{
+		"plaintext-credential repository.webhookSecret",
+		"plaintext-credential CloudProvider.access_key",
+		"plaintext-credential CloudProvider.session_token",
+		"plaintext-credential backup.storage.secretKey",
+		"plaintext-credential servers.0.key_passphrase",
+		"plaintext-credential environment.1.value",
+	}
+	if len(got) != len(want) {
+		t.Errorf("findings = %v, want %v", got, want)
+	}
+	for _, k := range want {
+		if got[k] != SeverityHigh {
+			t.Errorf("%s not flagged high: %v", k, got)
+		}
+	}
+	// environment[].secret is a bool that marks a variable, not a credential.
+	for k := range got {
+		if strings.HasSuffix(k, ".secret") {
+			t.Errorf("flagged the secret marker: %s", k)
+		}
+	}
+}
+
+func TestLintDaemonSocketMode(t *testing.T) {
+	tests := []struct {
+		config string
+		want   map[string]Severity
+	}{
+		{`{"socket_mode": "0660"}`, map[string]Severity{}},
+		{`{"socket_mode": "0600"}`, map[string]Severity{}},
+		{`{}`, map[string]Severity{}},
+		{`{"socket_mode": "0666"}`, map[string]Severity{"daemon-socket-mode socket_mode": SeverityHigh}},
+		{`{"socket_mode": "0770"}`, map[string]Severity{"daemon-socket-mode socket_mode": SeverityHigh}},
+		{`{"socket_mode": "rw-rw----"}`, map[string]Severity{"daemon-socket-mode socket_mode": SeverityMedium}},
+		{"# config.yml\nsocket_mode: \"0666\"\n", map[string]Severity{"daemon-socket-mode socket_mode": SeverityHigh}},
+	}
+	for _, tt := range tests {
+		got := lintRules(t, "app:\n  name: demo\n", LintInput{DaemonConfigFile: "config.json", DaemonConfig: []byte(tt.config)})
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: findings = %v, want %v", tt.config, got, tt.want)
+			continue
+		}
+		for k, sev := range tt.want {
+			if got[k] != sev {
+				t.Errorf("%s: %s = %v, want %v", tt.config, k, got[k], sev)
+			}
+		}
+	}
+}
@@ -15,16 +15,38 @@ func Save(cfg *NextDeployConfig, path string) error {
 	return os.WriteFile(path, data, 0600)
 }
 func Load() (*NextDeployConfig, error) {
-	data, err := os.ReadFile(ConfigFile)
+	return LoadFrom(ConfigFile)
+}
+
+// LoadFrom is Load for a config file other than ./nextdeploy.yml. Values of
+// the form ${secret:NAME} are replaced with the secret from the resolver set
+// by SetSecretResolver, so callers only ever see resolved values.
+func LoadFrom(path string) (*NextDeployConfig, error) {
+	// #nosec G304 -- the caller picks its own project's config
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("%s Config file not found: %w", EmojiWarning, err)
 	}
 
-	var cfg NextDeployConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s Invalid config format: %w", EmojiWarning, err)
+	}
+	secretResolverMu.RLock()
+	resolve := secretResolver
+	secretResolverMu.RUnlock()
+	if err := resolveSecretRefs(&doc, resolve); err != nil {
+		return nil, fmt.Errorf("%s %w", EmojiWarning, err)
+	}
+
+	cfg, err := decodeConfig(&doc, path)
+	if err != nil {
 		return nil, fmt.Errorf("%s Invalid config format: %w", EmojiWarning, err)
 	}
+	if err := CheckSchemaVersion(cfg.SchemaVersion); err != nil {
+		return nil, err
+	}
 
 	fmt.Printf("%s Configuration loaded successfully\n", EmojiSuccess)
-	return &cfg, nil
+	return cfg, nil
 }
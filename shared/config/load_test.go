@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -159,3 +160,139 @@ func TestSaveConfig_ArgOrder(t *testing.T) {
 		t.Fatalf("SaveConfig round-trip wrong: %+v", got)
 	}
 }
+
+func TestLoadFromResolvesSecretRefs(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, ConfigFile)
+	doc := "app:\n  name: demo\nservers:\n  - host: ${secret:db_host}\n    password: ${secret:ssh_pass}\n    username: u-${secret:ssh_pass}\n"
+	if err := os.WriteFile(p, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := map[string]int{}
+	SetSecretResolver(func(name string) (string, error) {
+		calls[name]++
+		switch name {
+		case "ssh_pass":
+			return "0123", nil
+		case "db_host":
+			return "10.0.0.5", nil
+		}
+		return "", errors.New("not found")
+	})
+	defer SetSecretResolver(nil)
+
+	cfg, err := LoadFrom(p)
+	if err != nil {
+		t.Fatalf("LoadFrom: %v", err)
+	}
+	s := cfg.Servers[0]
+	if s.Host != "10.0.0.5" || s.Password != "0123" || s.Username != "u-0123" {
+		t.Errorf("server = %+v, want resolved secrets", s)
+	}
+	if calls["ssh_pass"] != 1 || calls["db_host"] != 1 {
+		t.Errorf("provider calls = %v, want one per secret", calls)
+	}
+
+	// An unknown secret fails the load, naming the secret.
+	if err := os.WriteFile(p, []byte("app:\n  name: ${secret:missing}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFrom(p); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("LoadFrom with unknown secret: err = %v", err)
+	}
+
+	// Without a resolver a reference is an error, not a literal value.
+	SetSecretResolver(nil)
+	if _, err := LoadFrom(p); err == nil || !strings.Contains(err.Error(), "no secret provider") {
+		t.Errorf("LoadFrom without resolver: err = %v", err)
+	}
+}
+
+func TestLoadFromRefusesSecretRefsInShippedFields(t *testing.T) {
+	p := filepath.Join(t.TempDir(), ConfigFile)
+	SetSecretResolver(func(string) (string, error) { return "hunter2", nil })
+	defer SetSecretResolver(nil)
+
+	// These sections are copied into the release's metadata.json.
+	for _, doc := range []string{
+		"app:\n  name: demo\n  start:\n    command: [node, server.js, --token, \"${secret:api_token}\"]\n",
+		"app:\n  name: demo\n  hooks:\n    pre_deploy:\n      - run: \"./migrate --password ${secret:db_pass}\"\n",
+		"app:\n  name: demo\ncaddy:\n  extra_directives: \"basic_auth { admin ${secret:admin_hash} }\"\n",
+	} {
+		if err := os.WriteFile(p, []byte(doc), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadFrom(p)
+		if err == nil || !strings.Contains(err.Error(), "shipped to the server") {
+			t.Errorf("LoadFrom(%q): err = %v, want a refused reference", doc, err)
+		} else if strings.Contains(err.Error(), "hunter2") {
+			t.Errorf("error leaks the secret: %v", err)
+		}
+	}
+}
+
+func TestLoadFromReportsFieldAndLine(t *testing.T) {
+	p := filepath.Join(t.TempDir(), ConfigFile)
+	doc := "app:\n  name: demo\n  port: abc\nservers:\n  - host: example.com\n    port: [22]\n"
+	if err := os.WriteFile(p, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadFrom(p)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("LoadFrom: want *ValidationError, got %v", err)
+	}
+	want := []FieldError{
+		{Field: "app.port", Line: 3, Message: "expected a whole number, got string \"abc\""},
+		{Field: "servers.0.port", Line: 6, Message: "expected a whole number, got list"},
+	}
+	if !reflect.DeepEqual(verr.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", verr.Errors, want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{"valid", "app:\n  name: demo\n  port: 3000\n", nil},
+		{"syntax", "app:\n  name: [demo\n", []string{"line "}},
+		{
+			"type and semantic together",
+			"app:\n  name: demo\n  port: abc\n  stop:\n    timeout: forever\n  domain:\n    name: example.com\n    redirect: sideways\n",
+			[]string{
+				`line 3: app.port: expected a whole number`,
+				`line 5: app.stop.timeout: "forever" invalid`,
+				`line 8: app.domain.redirect: "sideways" invalid`,
+			},
+		},
+		{
+			"hooks",
+			"app:\n  hooks:\n    post_deploy:\n      - run: npx prisma migrate deploy\n        timeout: 2h\n",
+			[]string{`app.hooks.post_deploy[0].timeout: "2h" invalid`},
+		},
+		{"semantic checks skipped for serverless", "target_type: serverless\napp:\n  stop:\n    timeout: forever\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check([]byte(tt.doc))
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Check: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Check: expected problems")
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("report missing %q:\n%v", w, err)
+				}
+			}
+		})
+	}
+}
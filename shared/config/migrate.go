@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentSchemaVersion is the nextdeploy.yml layout this build writes and
+// understands. Bump it together with a new entry in migrations.
+const CurrentSchemaVersion = 2
+
+// migrations[i] upgrades a document from schema version i+1 to i+2, editing
+// the top-level mapping in place.
+var migrations = []func(root *yaml.Node) error{
+	migrateV1ToV2,
+}
+
+// CheckSchemaVersion refuses a config written for a newer nextdeploy, whose
+// fields this build would silently ignore or misread.
+func CheckSchemaVersion(v int) error {
+	if v > CurrentSchemaVersion {
+		return fmt.Errorf("%s %s uses schema_version %d, but this nextdeploy only understands up to %d; upgrade nextdeploy", EmojiWarning, ConfigFile, v, CurrentSchemaVersion)
+	}
+	return nil
+}
+
+// Migrate upgrades a nextdeploy.yml document to CurrentSchemaVersion by
+// applying each pending migration in order, and returns the new document and
+// the version it started at. Comments and key order are kept. A document
+// already at the current version comes back unchanged.
+func Migrate(doc []byte) ([]byte, int, error) {
+	root, err := parseDocument(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+	from := 1
+	if node := child(root, "schema_version"); node != nil {
+		if from, err = strconv.Atoi(node.Value); err != nil || from < 1 {
+			return nil, 0, fmt.Errorf("%s Invalid config format: schema_version %q is not a positive number", EmojiWarning, node.Value)
+		}
+	}
+	if err := CheckSchemaVersion(from); err != nil {
+		return nil, from, err
+	}
+	if from == CurrentSchemaVersion {
+		return doc, from, nil
+	}
+
+	for v := from; v < CurrentSchemaVersion; v++ {
+		if err := migrations[v-1](root); err != nil {
+			return nil, from, fmt.Errorf("migrating schema_version %d to %d: %w", v, v+1, err)
+		}
+	}
+	setSchemaVersion(root, CurrentSchemaVersion)
+
+	out, err := encodeDocument(root)
+	if err != nil {
+		return nil, from, err
+	}
+	return out, from, nil
+}
+
+// migrateV1ToV2 normalizes the two spellings version 1 allowed:
+//   - a bare `app.domain: example.com` becomes a `domain:` block with name:,
+//     so domain.provider, aliases etc. can be added (or `config set`) under it;
+//   - docker.registry_region / docker.registryRegion become registryregion,
+//     the only key the loader actually reads.
+func migrateV1ToV2(root *yaml.Node) error {
+	if app := child(root, "app"); app != nil && app.Kind == yaml.MappingNode {
+		if domain := child(app, "domain"); domain != nil && domain.Kind == yaml.ScalarNode && domain.Value != "" {
+			name := *domain
+			*domain = yaml.Node{
+				Kind:    yaml.MappingNode,
+				Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "name"}, &name},
+			}
+		}
+	}
+	if docker := child(root, "docker"); docker != nil && docker.Kind == yaml.MappingNode {
+		for _, old := range []string{"registry_region", "registryRegion"} {
+			if err := renameKey(docker, old, "registryregion"); err != nil {
+				return fmt.Errorf("docker: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// renameKey renames key from to to in a mapping. When both are present with
+// different values the document is ambiguous and left to the user.
+func renameKey(mapping *yaml.Node, from, to string) error {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != from {
+			continue
+		}
+		if existing := child(mapping, to); existing != nil {
+			if existing.Value != mapping.Content[i+1].Value {
+				return fmt.Errorf("both %s and %s are set; remove one", from, to)
+			}
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return nil
+		}
+		mapping.Content[i].Value = to
+		return nil
+	}
+	return nil
+}
+
+// setSchemaVersion writes schema_version, placing a new key right after
+// version: so the two sit together at the top of the file.
+func setSchemaVersion(root *yaml.Node, v int) {
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(v)}
+	if node := child(root, "schema_version"); node != nil {
+		node.Value, node.Tag, node.Style = value.Value, value.Tag, 0
+		return
+	}
+	at := 0
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "version" {
+			at = i + 2
+		}
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Value: "schema_version"}
+	root.Content = append(root.Content[:at], append([]*yaml.Node{key, value}, root.Content[at:]...)...)
+}
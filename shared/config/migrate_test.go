@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrateV1ToV2(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "scalar domain becomes block",
+			in:   "version: \"1.0\"\napp:\n  name: web\n  domain: example.com # primary\n",
+			want: []string{"domain:\n    name: example.com # primary\n"},
+		},
+		{
+			name:    "registry_region renamed",
+			in:      "docker:\n  image: web\n  registry_region: eu-west-1\n",
+			want:    []string{"registryregion: eu-west-1"},
+			notWant: []string{"registry_region"},
+		},
+		{
+			name:    "registryRegion renamed",
+			in:      "docker:\n  registryRegion: eu-west-1\n",
+			want:    []string{"registryregion: eu-west-1"},
+			notWant: []string{"registryRegion"},
+		},
+		{
+			name:    "duplicate with same value dropped",
+			in:      "docker:\n  registryregion: eu-west-1\n  registry_region: eu-west-1\n",
+			want:    []string{"registryregion: eu-west-1"},
+			notWant: []string{"registry_region"},
+		},
+		{
+			name: "block domain untouched",
+			in:   "app:\n  domain:\n    name: example.com\n    provider: cloudflare\n",
+			want: []string{"domain:\n    name: example.com\n    provider: cloudflare\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, from, err := Migrate([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("Migrate: %v", err)
+			}
+			if from != 1 {
+				t.Errorf("from = %d, want 1", from)
+			}
+			got := string(out)
+			for _, w := range append(tt.want, "schema_version: 2") {
+				if !strings.Contains(got, w) {
+					t.Errorf("missing %q in:\n%s", w, got)
+				}
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(got, w) {
+					t.Errorf("unexpected %q in:\n%s", w, got)
+				}
+			}
+			var cfg NextDeployConfig
+			if err := yaml.Unmarshal(out, &cfg); err != nil {
+				t.Fatalf("migrated config does not parse: %v", err)
+			}
+			if cfg.SchemaVersion != CurrentSchemaVersion {
+				t.Errorf("SchemaVersion = %d, want %d", cfg.SchemaVersion, CurrentSchemaVersion)
+			}
+		})
+	}
+}
+
+func TestMigrateConflictingRename(t *testing.T) {
+	in := "docker:\n  registryregion: eu-west-1\n  registry_region: us-east-1\n"
+	if _, _, err := Migrate([]byte(in)); err == nil || !strings.Contains(err.Error(), "both registry_region and registryregion") {
+		t.Fatalf("want conflict error, got %v", err)
+	}
+}
+
+func TestMigrateSchemaVersionPlacement(t *testing.T) {
+	in := "# header\nversion: \"1.0\"\ntarget_type: vps\napp:\n  name: web\n"
+	out, _, err := Migrate([]byte(in))
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if !strings.Contains(string(out), "version: \"1.0\"\nschema_version: 2\ntarget_type: vps") {
+		t.Errorf("schema_version not placed after version:\n%s", out)
+	}
+	if !strings.HasPrefix(string(out), "# header") {
+		t.Errorf("header comment lost:\n%s", out)
+	}
+}
+
+func TestMigrateCurrentAndNewer(t *testing.T) {
+	current := "schema_version: 2\napp:\n  domain: example.com\n"
+	out, from, err := Migrate([]byte(current))
+	if err != nil || from != CurrentSchemaVersion || string(out) != current {
+		t.Errorf("current version should be a no-op: from=%d err=%v out=%q", from, err, out)
+	}
+
+	if _, _, err := Migrate([]byte("schema_version: 99\n")); err == nil || !strings.Contains(err.Error(), "upgrade nextdeploy") {
+		t.Errorf("newer schema should be refused, got %v", err)
+	}
+	if _, _, err := Migrate([]byte("schema_version: two\n")); err == nil {
+		t.Error("non-numeric schema_version should be rejected")
+	}
+}
+
+func TestLoadRefusesNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ConfigFile), []byte("schema_version: 99\napp:\n  name: demo\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	if cfg, err := Load(); err == nil || cfg != nil {
+		t.Fatalf("Load should refuse schema_version 99, got cfg=%v err=%v", cfg, err)
+	}
+}
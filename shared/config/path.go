@@ -0,0 +1,206 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GetField returns the value at a dotted path (e.g. "app.domain",
+// "docker.registry", "servers.0.host") in a nextdeploy.yml document. Scalars
+// come back as their plain value; blocks as YAML.
+func GetField(doc []byte, path string) (string, error) {
+	if _, err := fieldType(path); err != nil {
+		return "", err
+	}
+	root, err := parseDocument(doc)
+	if err != nil {
+		return "", err
+	}
+	node := root
+	for _, seg := range strings.Split(path, ".") {
+		if node = child(node, seg); node == nil {
+			return "", fmt.Errorf("%s is not set", path)
+		}
+	}
+	if node.Kind == yaml.ScalarNode {
+		return node.Value, nil
+	}
+	out, err := yaml.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// SetField sets the scalar at a dotted path and returns the updated document.
+// The path must name a scalar field of NextDeployConfig and value must decode
+// into that field's type, so a typo or a word in an int field is rejected
+// instead of written. Missing parent blocks are created; comments and the
+// order of existing keys are kept.
+func SetField(doc []byte, path, value string) ([]byte, error) {
+	typ, err := fieldType(path)
+	if err != nil {
+		return nil, err
+	}
+	if !scalarSettable(typ) {
+		return nil, fmt.Errorf("%s is a block, not a single value; set one of its fields instead", path)
+	}
+
+	leaf := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if typ.Kind() == reflect.String {
+		// Keep "8080" or "true" a string in the file, as the field expects.
+		leaf.Tag = "!!str"
+	}
+	if err := leaf.Decode(reflect.New(typ).Interface()); err != nil {
+		return nil, fmt.Errorf("invalid value %q for %s: want %s", value, path, typ.Kind())
+	}
+
+	root, err := parseDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	node := root
+	segs := strings.Split(path, ".")
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		next := child(node, seg)
+		switch {
+		case next == nil && node.Kind == yaml.MappingNode:
+			next = &yaml.Node{Kind: yaml.MappingNode}
+			if last {
+				next = leaf
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: seg}, next)
+		case next == nil:
+			return nil, fmt.Errorf("%s: %s does not exist", path, strings.Join(segs[:i+1], "."))
+		case last && next.Kind != yaml.ScalarNode:
+			return nil, fmt.Errorf("%s is written as a block; set one of its fields instead", path)
+		case last:
+			next.Value, next.Tag, next.Style = leaf.Value, leaf.Tag, 0
+		case next.Kind == yaml.ScalarNode:
+			return nil, fmt.Errorf("%s is a single value and has no field %q", strings.Join(segs[:i+1], "."), segs[i+1])
+		}
+		node = next
+	}
+
+	return encodeDocument(root)
+}
+
+// encodeDocument writes an edited mapping back out in the file's two-space
+// style and checks that the result still parses as a NextDeployConfig.
+func encodeDocument(root *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	var cfg NextDeployConfig
+	if err := yaml.Unmarshal(buf.Bytes(), &cfg); err != nil {
+		return nil, fmt.Errorf("updated config no longer parses: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func parseDocument(doc []byte) (*yaml.Node, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil {
+		return nil, fmt.Errorf("%s Invalid config format: %w", EmojiWarning, err)
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s Invalid config format: not a YAML mapping", EmojiWarning)
+	}
+	return root.Content[0], nil
+}
+
+// child returns the value under key seg of a mapping, or the element at index
+// seg of a sequence; nil when there is none.
+func child(node *yaml.Node, seg string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == seg {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(seg); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+// fieldType resolves a dotted path against NextDeployConfig's yaml tags and
+// returns the Go type it lands on.
+func fieldType(path string) (reflect.Type, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty config path")
+	}
+	t := reflect.TypeOf(NextDeployConfig{})
+	for i, seg := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		at := strings.Join(strings.Split(path, ".")[:i], ".")
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := fieldByYAMLName(t, seg)
+			if !ok {
+				if at == "" {
+					return nil, fmt.Errorf("unknown config field %q", seg)
+				}
+				return nil, fmt.Errorf("unknown config field %q under %s", seg, at)
+			}
+			t = f.Type
+		case reflect.Slice:
+			if _, err := strconv.Atoi(seg); err != nil {
+				return nil, fmt.Errorf("%s is a list; index it by number (e.g. %s.0)", at, at)
+			}
+			t = t.Elem()
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("%s is a single value and has no field %q", at, seg)
+		}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t, nil
+}
+
+func fieldByYAMLName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		if tag == "" {
+			tag = strings.ToLower(f.Name)
+		}
+		if tag == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// scalarSettable reports whether a single YAML scalar can set a field of type
+// t: basic kinds, plus types with their own scalar form (e.g. DomainConfig).
+func scalarSettable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map, reflect.Array, reflect.Interface:
+		return reflect.PointerTo(t).Implements(reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem())
+	}
+	return true
+}
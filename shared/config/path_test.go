@@ -0,0 +1,97 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const pathTestDoc = `# Deployment config
+version: "1.0"
+app:
+  name: shop # keep me
+  port: 3000
+  domain: shop.example.com
+docker:
+  image: shop
+  registry: ghcr.io/old
+servers:
+  - name: prod
+    host: 1.2.3.4
+`
+
+func TestGetField(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"app.name", "shop"},
+		{"app.port", "3000"},
+		{"app.domain", "shop.example.com"},
+		{"docker.registry", "ghcr.io/old"},
+		{"servers.0.host", "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := GetField([]byte(pathTestDoc), tt.path)
+			if err != nil {
+				t.Fatalf("GetField: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetField(%s) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := GetField([]byte(pathTestDoc), "docker.registryregion"); err == nil {
+		t.Error("an unset field should be reported")
+	}
+	if _, err := GetField([]byte(pathTestDoc), "docker.regsitry"); err == nil {
+		t.Error("a misspelled field should be rejected")
+	}
+}
+
+func TestSetField(t *testing.T) {
+	out, err := SetField([]byte(pathTestDoc), "docker.registry", "ghcr.io/new")
+	if err != nil {
+		t.Fatalf("SetField: %v", err)
+	}
+	if got, _ := GetField(out, "docker.registry"); got != "ghcr.io/new" {
+		t.Errorf("docker.registry = %q after set", got)
+	}
+	for _, keep := range []string{"# Deployment config", "name: shop # keep me", "image: shop"} {
+		if !strings.Contains(string(out), keep) {
+			t.Errorf("SetField lost %q:\n%s", keep, out)
+		}
+	}
+
+	// Missing parent blocks are created.
+	out, err = SetField(out, "app.resources.memory_max", "512M")
+	if err != nil {
+		t.Fatalf("SetField(new block): %v", err)
+	}
+	if got, _ := GetField(out, "app.resources.memory_max"); got != "512M" {
+		t.Errorf("app.resources.memory_max = %q after set", got)
+	}
+
+	// A numeric-looking value stays a string in a string field.
+	out, err = SetField(out, "docker.image", "1234")
+	if err != nil {
+		t.Fatalf("SetField(numeric string): %v", err)
+	}
+	if !strings.Contains(string(out), `image: "1234"`) {
+		t.Errorf("string field should be quoted:\n%s", out)
+	}
+
+	for _, tc := range []struct{ path, value string }{
+		{"app.port", "not-a-port"},
+		{"docker.push", "maybe"},
+		{"docker.regsitry", "x"},
+		{"docker", "x"},
+		{"servers", "x"},
+		{"app.domain.name", "x"}, // written as a scalar in this file
+	} {
+		if _, err := SetField([]byte(pathTestDoc), tc.path, tc.value); err == nil {
+			t.Errorf("SetField(%s, %q) should fail", tc.path, tc.value)
+		}
+	}
+}
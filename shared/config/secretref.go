@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SecretResolver returns the value of the named secret. secrets.SecretManager
+// provides one backed by its provider chain.
+type SecretResolver func(name string) (string, error)
+
+var (
+	secretResolverMu sync.RWMutex
+	secretResolver   SecretResolver
+)
+
+// SetSecretResolver installs the resolver Load uses for ${secret:NAME}
+// references; nil removes it.
+func SetSecretResolver(r SecretResolver) {
+	secretResolverMu.Lock()
+	defer secretResolverMu.Unlock()
+	secretResolver = r
+}
+
+// secretRef matches ${secret:NAME} anywhere in a scalar, so a reference can
+// also sit inside a longer value such as a URL.
+var secretRef = regexp.MustCompile(`\$\{secret:([A-Za-z0-9_.-]+)\}`)
+
+// shippedFields are the sections copied as written into a release's
+// metadata.json, which sits in the release directory on the server where the
+// app can read it. A secret reference there would put the resolved value on
+// disk in plain text, so it is refused; secrets reach the app through its
+// environment instead.
+var shippedFields = map[string]bool{
+	"app.start": true,
+	"app.hooks": true,
+	"caddy":     true,
+}
+
+// resolveSecretRefs replaces every ${secret:NAME} in the scalars under node
+// with the secret's value. Each name is fetched once per call. A reference
+// under one of the shippedFields is an error. Errors name the secret and the
+// line, never a value.
+func resolveSecretRefs(node *yaml.Node, resolve SecretResolver) error {
+	cache := make(map[string]string)
+	var walk func(n *yaml.Node, path string) error
+	walk = func(n *yaml.Node, path string) error {
+		if n.Kind == yaml.ScalarNode {
+			m := secretRef.FindStringSubmatch(n.Value)
+			if m == nil {
+				return nil
+			}
+			if field := shippedField(path); field != "" {
+				return fmt.Errorf("%s line %d references ${secret:%s} in %s, which is shipped to the server as is; pass the secret through the app's environment instead", ConfigFile, n.Line, m[1], field)
+			}
+			var err error
+			n.Value = secretRef.ReplaceAllStringFunc(n.Value, func(ref string) string {
+				name := secretRef.FindStringSubmatch(ref)[1]
+				if v, ok := cache[name]; ok {
+					return v
+				}
+				if err != nil {
+					return ref
+				}
+				if resolve == nil {
+					err = fmt.Errorf("%s line %d references ${secret:%s}, but no secret provider is configured", ConfigFile, n.Line, name)
+					return ref
+				}
+				v, resolveErr := resolve(name)
+				if resolveErr != nil {
+					err = fmt.Errorf("%s line %d: resolve ${secret:%s}: %w", ConfigFile, n.Line, name, resolveErr)
+					return ref
+				}
+				cache[name] = v
+				return v
+			})
+			// A resolved value is a string even if it looks like a number.
+			n.Tag = "!!str"
+			n.Style = 0
+			return err
+		}
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key := n.Content[i].Value
+				if path != "" {
+					key = path + "." + key
+				}
+				if err := walk(n.Content[i+1], key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, c := range n.Content {
+			if err := walk(c, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(node, "")
+}
+
+// shippedField returns the one of shippedFields that path is, or lies
+// under, or "".
+func shippedField(path string) string {
+	for p := path; p != ""; {
+		if shippedFields[p] {
+			return p
+		}
+		i := strings.LastIndexByte(p, '.')
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+	return ""
+}
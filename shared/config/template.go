@@ -14,6 +14,7 @@ const commonHeader = `
 
 # NOTE: DO NOT ADD YOUR SECRETS AS OF NOW WE WORKING ON SECRET MANAGEMENT THIS IS HOW WE INTENT TO USE
 version: "1.0" # Config file versioning for forward compatibility with future NextDeploy updates
+schema_version: 2 # Layout of this file; nextdeploy config migrate upgrades older ones
 `
 
 const commonFooter = `
@@ -84,8 +85,36 @@ app:
   #     provider: namecheap   # namecheap | cloudflare | other
   #     dns: manual           # auto (provider API) | manual (print records)
   #     zone: example.com
+  #     aliases: [api.example.com] # Extra hostnames served by the app
+  #     redirect: www         # www (apex → www) | apex (www → apex); omit to serve both
   domain: app.example.com # Public domain for your app
   port: 3000 # [REQUIRED] Internal port your app listens on
+  # health_path: /api/health # Path probed before a new release takes traffic (default: /)
+  # readiness_timeout: 90s # How long a new release may take to become ready (default: 5m)
+  # build_image: node:22-bookworm # Image for build --containerized-build (default: from .nvmrc, else node:lts-bookworm); private registries use docker.username/password
+  # package_manager: pnpm # npm | yarn | pnpm | bun; overrides detection from the lockfiles
+  # maintenance_page: public/maintenance.html # Served with a 503 during maintenance (default: built-in page)
+  # start: # Override the default start command (e.g. run migrations first)
+  #   entrypoint: ./scripts/start.sh # Single executable; relative to the release dir
+  #   command: ["node", "server.js"] # Arguments passed to the entrypoint (or a quoted string: node server.js --title="my app")
+  # stop: # How a release is shut down on rollout, rollback and stop; your server must handle the signal
+  #   timeout: 30s # Grace period before SIGKILL (default: 10s)
+  #   signal: SIGINT # First signal sent (default: SIGTERM)
+  # volumes: # Writable storage that survives deploys (the release dir is replaced each time)
+  #   - name: uploads # Named volume kept by the daemon for this app
+  #     target: public/uploads # Path inside the release dir
+  #   - source: /srv/shared-data # Existing host path; system paths are refused
+  #     target: data
+  #     read_only: true
+  # hooks: # Commands run in the release, as the app user with its env, around a deploy or rollback
+  #   pre_deploy: # Before the new release starts; a failure aborts the deploy
+  #     - run: ./scripts/check-env.sh
+  #   post_deploy: # Once the new release is live; a failure is reported, the release stays live
+  #     - name: migrate
+  #       run: npx prisma migrate deploy
+  #       timeout: 10m # Default: 5m
+  #   pre_rollback: # In the live release before rolling back from it; a failure aborts the rollback
+  #     - run: ./scripts/migrate-down.sh
 
 # -----
 # DEPLOYMENT SERVERS
@@ -96,6 +125,24 @@ servers:
     username: ubuntu # [REQUIRED] SSH user (e.g., ubuntu, debian, root)
     key_path: ~/.ssh/id_rsa  # [REQUIRED] Path to your private SSH key
     # password: "" # Optional: SSH password (key_path takes precedence)
+
+# -----
+# CADDY (optional) — extra directives appended to the generated site block
+# -----
+# caddy:
+#   extra_directives: |
+#     header X-Robots-Tag "noindex"
+#   snippet: deploy/Caddyfile.snippet # File in the project with more directives
+
+# -----
+# METADATA STORE (optional) — publish build metadata so a daemon on another host can deploy it
+# -----
+# metadata_store:
+#   backend: s3 # local | s3
+#   bucket: my-nextdeploy-builds # s3: bucket holding <prefix>/<commit>/metadata.json
+#   prefix: web # s3: optional key prefix
+#   region: eu-west-1 # s3: defaults to the AWS environment/profile
+#   # path: /mnt/builds # local: directory holding <commit>/metadata.json
 `
 
 const serverlessTemplate = `
@@ -128,6 +175,7 @@ CloudProvider:
   region: us-east-1
   # access_key: "YOUR_ACCESS_KEY" # Optional: overridden by profile if set
   # secret_key: "YOUR_SECRET_KEY" # Optional: overridden by profile if set
+  # session_token: "YOUR_SESSION_TOKEN" # Only with temporary (STS/SSO) keys
   profile: "default"            # Recommended: uses credentials from aws configure
 
 # -----
@@ -3,14 +3,20 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
 
 	"gopkg.in/yaml.v3"
 )
 
 type NextDeployConfig struct {
 	Version       string               `yaml:"version"`
-	TargetType    string               `yaml:"target_type"` // e.g., "vps", "serverless"
+	SchemaVersion int                  `yaml:"schema_version,omitempty"` // file layout; absent means 1, see Migrate
+	TargetType    string               `yaml:"target_type"`              // e.g., "vps", "serverless"
 	App           AppConfig            `yaml:"app"`
 	Repository    Repository           `yaml:"repository"`
 	Docker        *DockerConfig        `yaml:"docker,omitempty"`
@@ -26,6 +32,8 @@ type NextDeployConfig struct {
 	Servers       []ServerConfig       `yaml:"servers,omitempty"`
 	SSLConfig     *SSLConfig           `yaml:"ssl_config,omitempty"`
 	CloudProvider *CloudProviderStruct `yaml:"CloudProvider,omitempty"`
+	Caddy         *CaddyConfig         `yaml:"caddy,omitempty"`
+	MetadataStore *MetadataStoreConfig `yaml:"metadata_store,omitempty"`
 }
 
 type SafeConfig struct {
@@ -386,8 +394,10 @@ type CloudProviderStruct struct {
 	// #nosec G117
 	AccessKey string `yaml:"access_key,omitempty"`
 	SecretKey string `yaml:"secret_key,omitempty"`
-	Profile   string `yaml:"profile,omitempty"`    // AWS CLI profile name
-	AccountID string `yaml:"account_id,omitempty"` // Cloudflare Account ID
+	// SessionToken accompanies temporary (STS/SSO) keys.
+	SessionToken string `yaml:"session_token,omitempty"`
+	Profile      string `yaml:"profile,omitempty"`    // AWS CLI profile name
+	AccountID    string `yaml:"account_id,omitempty"` // Cloudflare Account ID
 }
 type ServerConfig struct {
 	WebServer *WebServer `yaml:"web_server,omitempty"`
@@ -414,6 +424,88 @@ type AppConfig struct {
 	// bucket / app data) unless explicitly overridden with --force. Off by
 	// default; set true for production apps.
 	DeletionProtection bool `yaml:"deletion_protection,omitempty"`
+	// HealthPath is probed on a new VPS release before traffic is cut over to
+	// it. Defaults to "/".
+	HealthPath string `yaml:"health_path,omitempty"`
+	// ReadinessTimeout is how long a new VPS release may take to pass the
+	// health probe (e.g. "90s"). The old release keeps serving until then and
+	// stays live if the new one never becomes ready. Defaults to 5m.
+	ReadinessTimeout string `yaml:"readiness_timeout,omitempty"`
+	// Start overrides how a VPS release is launched (e.g. a wrapper script that
+	// runs migrations before exec-ing the server). Nil keeps the default
+	// node server.js / <pm> start command.
+	Start *StartCommand `yaml:"start,omitempty"`
+	// BuildImage is the image `--containerized-build` runs `next build` in
+	// (e.g. "node:22-bookworm"). Empty picks node:<major>-bookworm from
+	// .nvmrc/.node-version, else node:lts-bookworm. An image on a private
+	// registry is pulled with docker.username/password when docker.registry
+	// names that registry, else with the host's own docker login.
+	BuildImage string `yaml:"build_image,omitempty"`
+	// PackageManager (npm, yarn, pnpm or bun) overrides detection from the
+	// lockfiles; needed when a repo carries lockfiles of several managers.
+	PackageManager string `yaml:"package_manager,omitempty"`
+	// MaintenancePage is an HTML file, relative to the project root, that a
+	// VPS app serves with a 503 while it is in maintenance mode (`stop
+	// --maintenance`, `nextdeployd maintenance --on`). Empty uses a built-in
+	// page.
+	MaintenancePage string `yaml:"maintenance_page,omitempty"`
+	// Volumes give a VPS release writable storage that outlives it; the unit
+	// otherwise runs with ProtectSystem=strict and can only write its own
+	// release directory, which the next deploy replaces.
+	Volumes []Volume `yaml:"volumes,omitempty"`
+	// Stop sets how long a VPS release gets to shut down, and with which
+	// signal, when a rollout, rollback or `stop` replaces it. Nil keeps
+	// SIGTERM with a 10s grace period.
+	Stop *StopPolicy `yaml:"stop,omitempty"`
+	// Hooks are commands run in a VPS release around a deploy or rollback,
+	// e.g. database migrations once the new release is live.
+	Hooks *DeployHooks `yaml:"hooks,omitempty"`
+}
+
+// Volume mounts storage into a VPS release at Target, a path inside the
+// release directory (e.g. "data" or "public/uploads"). Set exactly one source:
+//   - Name: a named volume the daemon keeps under the app's directory, created
+//     on first use and carried from release to release.
+//   - Source: an existing absolute path on the server (a bind mount). The
+//     daemon refuses system paths such as /etc or the docker socket unless
+//     its config explicitly allows them.
+//
+// In a release's metadata.json ReadOnly is "readOnly", not "read_only":
+// encoding/json matches names case-insensitively, so metadata written before
+// the field had a json tag, and daemons built before it, still agree on it.
+type Volume struct {
+	Name     string `yaml:"name,omitempty" json:"name,omitempty"`
+	Source   string `yaml:"source,omitempty" json:"source,omitempty"`
+	Target   string `yaml:"target" json:"target"`
+	ReadOnly bool   `yaml:"read_only,omitempty" json:"readOnly,omitempty"`
+}
+
+var volumeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Validate checks the shape of a volume. The paths end up in a systemd
+// BindPaths= line, where ':' separates source from target and whitespace
+// separates entries, so neither may appear in them.
+func (v Volume) Validate() error {
+	switch {
+	case v.Name == "" && v.Source == "":
+		return fmt.Errorf("volumes: set name (a named volume) or source (a host path)")
+	case v.Name != "" && v.Source != "":
+		return fmt.Errorf("volumes: %q sets both name and source; pick one", v.Target)
+	case v.Name != "" && !volumeNamePattern.MatchString(v.Name):
+		return fmt.Errorf("volumes: name %q invalid: want lowercase letters, digits, - and _", v.Name)
+	case v.Source != "" && (!filepath.IsAbs(v.Source) || filepath.Clean(v.Source) != v.Source):
+		return fmt.Errorf("volumes: source %q must be a clean absolute path", v.Source)
+	case v.Target == "":
+		return fmt.Errorf("volumes: target is required")
+	case filepath.IsAbs(v.Target) || slices.Contains(strings.Split(filepath.ToSlash(v.Target), "/"), ".."):
+		return fmt.Errorf("volumes: target %q must be a path inside the release directory", v.Target)
+	}
+	for _, p := range []string{v.Source, v.Target} {
+		if strings.ContainsRune(p, ':') || strings.ContainsFunc(p, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) {
+			return fmt.Errorf("volumes: %q must not contain ':', spaces or control characters", p)
+		}
+	}
+	return nil
 }
 
 // DomainConfig describes the app's custom domain and where its DNS lives. In
@@ -436,6 +528,33 @@ type DomainConfig struct {
 	Provider string `yaml:"provider,omitempty"`
 	DNS      string `yaml:"dns,omitempty"`
 	Zone     string `yaml:"zone,omitempty"`
+	// Aliases are extra hostnames served by the app on VPS deploys (e.g.
+	// api.example.com). Name's www/apex counterpart is always included.
+	Aliases []string `yaml:"aliases,omitempty"`
+	// Redirect makes one of Name's apex/www forms canonical: "www" redirects
+	// the apex to www, "apex" redirects www to the apex. Empty serves both.
+	Redirect string `yaml:"redirect,omitempty"`
+}
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]+(-[a-z0-9]+)*\.)+[a-z]{2,}$`)
+
+// Validate checks the aliases and redirect mode before they reach the
+// generated Caddyfile.
+func (d DomainConfig) Validate() error {
+	switch d.Redirect {
+	case "", "www", "apex":
+	default:
+		return fmt.Errorf("domain.redirect %q invalid: want \"www\" or \"apex\"", d.Redirect)
+	}
+	if d.Redirect != "" && d.Name == "" {
+		return fmt.Errorf("domain.redirect needs domain.name")
+	}
+	for _, a := range d.Aliases {
+		if !hostnamePattern.MatchString(strings.ToLower(a)) {
+			return fmt.Errorf("domain.aliases: %q is not a hostname", a)
+		}
+	}
+	return nil
 }
 
 // UnmarshalYAML accepts both the scalar form (`domain: example.com`) and the
@@ -456,7 +575,7 @@ func (d *DomainConfig) UnmarshalYAML(value *yaml.Node) error {
 // MarshalYAML emits the compact scalar form when only the name is set, so
 // simple configs round-trip cleanly instead of expanding into a block.
 func (d DomainConfig) MarshalYAML() (any, error) {
-	if d.Provider == "" && d.DNS == "" && d.Zone == "" {
+	if d.Provider == "" && d.DNS == "" && d.Zone == "" && len(d.Aliases) == 0 && d.Redirect == "" {
 		return d.Name, nil
 	}
 	type rawDomain DomainConfig
@@ -503,6 +622,283 @@ func (r *ResourceLimits) Validate() error {
 	return nil
 }
 
+// StartCommand replaces the default start command of a VPS release. The
+// semantics follow a container's entrypoint/command split:
+//   - Entrypoint: a single executable. Relative paths ("./scripts/start.sh")
+//     resolve against the release directory; bare names are looked up on the
+//     server's PATH.
+//   - Command: arguments passed to Entrypoint. With no Entrypoint, Command[0]
+//     is the executable and the rest are its arguments. It may be written as
+//     a list or as one shell-quoted string (see Args); either way each
+//     argument reaches the process as is, never re-split on spaces.
+type StartCommand struct {
+	Entrypoint string `yaml:"entrypoint,omitempty" json:"entrypoint,omitempty"`
+	Command    Args   `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+// Validate rejects start commands that cannot be written safely into a
+// systemd ExecStart line: an entrypoint that is not a single executable, a
+// path escaping the release directory, or control characters (newlines would
+// inject extra unit directives).
+func (s *StartCommand) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.Entrypoint == "" && len(s.Command) == 0 {
+		return fmt.Errorf("start: set entrypoint, command, or both")
+	}
+	exe := s.Entrypoint
+	field := "start.entrypoint"
+	if exe == "" {
+		exe, field = s.Command[0], "start.command[0]"
+	}
+	if exe == "" || strings.ContainsFunc(exe, unicode.IsSpace) {
+		return fmt.Errorf("%s %q invalid: want a single executable without spaces (pass arguments via start.command)", field, exe)
+	}
+	if slices.Contains(strings.Split(filepath.ToSlash(exe), "/"), "..") {
+		return fmt.Errorf("%s %q must not contain \"..\"", field, exe)
+	}
+	for i, arg := range append([]string{s.Entrypoint}, s.Command...) {
+		if strings.ContainsFunc(arg, unicode.IsControl) {
+			if i == 0 {
+				return fmt.Errorf("start.entrypoint contains control characters")
+			}
+			return fmt.Errorf("start.command[%d] contains control characters", i-1)
+		}
+	}
+	return nil
+}
+
+// MetadataStoreConfig selects where builds publish their metadata.json, keyed
+// by git commit, so a daemon deploying on another host can fetch it. Backend
+// is "local" (Path, a directory — typically shared storage) or "s3" (Bucket,
+// optional Prefix and Region; credentials come from the default AWS chain).
+// The daemon reads the same block from its config.json.
+type MetadataStoreConfig struct {
+	Backend string `yaml:"backend" json:"backend"`
+	Path    string `yaml:"path,omitempty" json:"path,omitempty"`
+	Bucket  string `yaml:"bucket,omitempty" json:"bucket,omitempty"`
+	Prefix  string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	Region  string `yaml:"region,omitempty" json:"region,omitempty"`
+}
+
+// StopPolicy controls how systemd stops a VPS release: Signal is sent first
+// and the process is SIGKILLed if it is still running Timeout later. The Node
+// server has to handle Signal itself — close the HTTP server, finish in-flight
+// requests, flush state — or the grace period buys nothing; Next.js's
+// standalone server exits on SIGTERM and SIGINT.
+type StopPolicy struct {
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"` // Go duration, e.g. "30s"; default 10s
+	Signal  string `yaml:"signal,omitempty" json:"signal,omitempty"`   // e.g. "SIGINT"; default SIGTERM
+}
+
+// Default stop behaviour, matching what units had before StopPolicy existed.
+const (
+	DefaultStopTimeout = 10 * time.Second
+	DefaultStopSignal  = "SIGTERM"
+)
+
+// maxStopTimeout bounds Timeout: a rollout, and the client that asked for
+// it, wait for the old release to stop.
+const maxStopTimeout = 5 * time.Minute
+
+// stopSignals are the signals a release may be stopped with. SIGKILL and
+// SIGSTOP are excluded: neither can be handled, which defeats the point.
+var stopSignals = []string{"SIGTERM", "SIGINT", "SIGQUIT", "SIGHUP", "SIGUSR1", "SIGUSR2", "SIGWINCH"}
+
+// Validate rejects timeouts and signals that are not safe to write into the
+// unit's TimeoutStopSec= and KillSignal= directives.
+func (s *StopPolicy) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.Timeout != "" {
+		d, err := time.ParseDuration(s.Timeout)
+		if err != nil || d < time.Second || d > maxStopTimeout {
+			return fmt.Errorf("stop.timeout %q invalid: want a duration between 1s and %s, like \"30s\"", s.Timeout, maxStopTimeout)
+		}
+	}
+	if s.Signal != "" && !slices.Contains(stopSignals, s.Signal) {
+		return fmt.Errorf("stop.signal %q invalid: want one of %s", s.Signal, strings.Join(stopSignals, ", "))
+	}
+	return nil
+}
+
+// TimeoutOrDefault returns the grace period, DefaultStopTimeout when unset.
+// Call Validate first; an unparsable Timeout also yields the default.
+func (s *StopPolicy) TimeoutOrDefault() time.Duration {
+	if s != nil && s.Timeout != "" {
+		if d, err := time.ParseDuration(s.Timeout); err == nil {
+			return d
+		}
+	}
+	return DefaultStopTimeout
+}
+
+// SignalOrDefault returns the stop signal, DefaultStopSignal when unset.
+func (s *StopPolicy) SignalOrDefault() string {
+	if s != nil && s.Signal != "" {
+		return s.Signal
+	}
+	return DefaultStopSignal
+}
+
+// DeployHooks are commands the daemon runs in a VPS release, as the app
+// user with the release's environment and sandbox:
+//   - PreDeploy in the new release before it starts; a failure aborts the
+//     deploy and the live release keeps serving.
+//   - PostDeploy in the new release once it is live; a failure is reported
+//     but the release stays live.
+//   - PreRollback in the live release before rolling back from it (e.g. to
+//     undo its migrations); a failure aborts the rollback.
+//
+// The json names are camelCase, unlike the yaml ones, for the reason given
+// on Volume: a rollback still finds the pre_rollback hooks of a release
+// shipped before the tags.
+type DeployHooks struct {
+	PreDeploy   []Hook `yaml:"pre_deploy,omitempty" json:"preDeploy,omitempty"`
+	PostDeploy  []Hook `yaml:"post_deploy,omitempty" json:"postDeploy,omitempty"`
+	PreRollback []Hook `yaml:"pre_rollback,omitempty" json:"preRollback,omitempty"`
+}
+
+// Hook is one command. Run takes the same forms as start.command; a relative
+// executable resolves in the release directory. Timeout defaults to 5m and
+// may be at most 8m.
+type Hook struct {
+	Name    string `yaml:"name,omitempty" json:"name,omitempty"`
+	Run     Args   `yaml:"run" json:"run"`
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// Hook timeouts: the client waits on the deploy, whose connection the daemon
+// closes after 10 minutes, so a hook must finish well inside that and leave
+// time for the release to start.
+const (
+	DefaultHookTimeout = 5 * time.Minute
+	maxHookTimeout     = 8 * time.Minute
+)
+
+// Validate checks every hook: a single executable first, no control
+// characters, and a sane timeout.
+func (h *DeployHooks) Validate() error {
+	if h == nil {
+		return nil
+	}
+	for _, set := range []struct {
+		field string
+		hooks []Hook
+	}{{"hooks.pre_deploy", h.PreDeploy}, {"hooks.post_deploy", h.PostDeploy}, {"hooks.pre_rollback", h.PreRollback}} {
+		for i, hook := range set.hooks {
+			if err := hook.validate(fmt.Sprintf("%s[%d]", set.field, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (h Hook) validate(field string) error {
+	if len(h.Run) == 0 {
+		return fmt.Errorf("%s.run is required", field)
+	}
+	if exe := h.Run[0]; exe == "" || strings.ContainsFunc(exe, unicode.IsSpace) || slices.Contains(strings.Split(filepath.ToSlash(exe), "/"), "..") {
+		return fmt.Errorf("%s.run[0] %q invalid: want a single executable without spaces or \"..\"", field, exe)
+	}
+	for i, arg := range h.Run {
+		if strings.ContainsFunc(arg, unicode.IsControl) {
+			return fmt.Errorf("%s.run[%d] contains control characters", field, i)
+		}
+	}
+	if h.Timeout != "" {
+		if d, err := time.ParseDuration(h.Timeout); err != nil || d < time.Second || d > maxHookTimeout {
+			return fmt.Errorf("%s.timeout %q invalid: want a duration between 1s and %s", field, h.Timeout, maxHookTimeout)
+		}
+	}
+	return nil
+}
+
+// TimeoutOrDefault returns the hook's timeout, DefaultHookTimeout when unset.
+// Call Validate first; an unparsable Timeout also yields the default.
+func (h Hook) TimeoutOrDefault() time.Duration {
+	if d, err := time.ParseDuration(h.Timeout); err == nil && h.Timeout != "" {
+		return d
+	}
+	return DefaultHookTimeout
+}
+
+// Label names the hook in output: its Name, else its executable.
+func (h Hook) Label() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	if len(h.Run) > 0 {
+		return filepath.Base(h.Run[0])
+	}
+	return "hook"
+}
+
+// CaddyConfig adds hand-written directives (extra headers, rate limits,
+// basic_auth, ...) to the site block generated for a VPS app. ExtraDirectives
+// is inline Caddyfile text; Snippet is a file in the project holding the
+// same. Both are appended after the generated directives, so they can add to
+// or override them.
+type CaddyConfig struct {
+	ExtraDirectives string `yaml:"extra_directives,omitempty"`
+	Snippet         string `yaml:"snippet,omitempty"`
+}
+
+// Directives returns the directives to inject: ExtraDirectives followed by the
+// contents of Snippet, read relative to projectDir. The result must keep its
+// braces balanced (see CheckCaddyDirectives) — anything else would close the
+// generated site block and let the text escape into the shared Caddy
+// configuration.
+func (c *CaddyConfig) Directives(projectDir string) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	parts := []string{strings.TrimSpace(c.ExtraDirectives)}
+	if c.Snippet != "" {
+		if filepath.IsAbs(c.Snippet) || slices.Contains(strings.Split(filepath.ToSlash(c.Snippet), "/"), "..") {
+			return "", fmt.Errorf("caddy.snippet %q must be a path inside the project", c.Snippet)
+		}
+		// #nosec G304 -- confined to the project directory above
+		data, err := os.ReadFile(filepath.Join(projectDir, c.Snippet))
+		if err != nil {
+			return "", fmt.Errorf("caddy.snippet: %w", err)
+		}
+		parts = append(parts, strings.TrimSpace(string(data)))
+	}
+	directives := strings.TrimSpace(strings.Join(parts, "\n"))
+	if err := CheckCaddyDirectives(directives); err != nil {
+		return "", err
+	}
+	return directives, nil
+}
+
+// maxMaintenancePageBytes bounds app.maintenance_page, which travels inside
+// the release metadata.
+const maxMaintenancePageBytes = 256 << 10
+
+// MaintenancePageHTML returns the contents of MaintenancePage, read relative
+// to projectDir, or "" when none is set.
+func (a AppConfig) MaintenancePageHTML(projectDir string) (string, error) {
+	if a.MaintenancePage == "" {
+		return "", nil
+	}
+	if !filepath.IsLocal(a.MaintenancePage) {
+		return "", fmt.Errorf("maintenance_page %q must be a path inside the project", a.MaintenancePage)
+	}
+	// #nosec G304 -- confined to the project directory above
+	data, err := os.ReadFile(filepath.Join(projectDir, a.MaintenancePage))
+	if err != nil {
+		return "", fmt.Errorf("maintenance_page: %w", err)
+	}
+	if len(data) > maxMaintenancePageBytes {
+		return "", fmt.Errorf("maintenance_page %s is %d bytes; the limit is %d", a.MaintenancePage, len(data), maxMaintenancePageBytes)
+	}
+	return string(data), nil
+}
+
 type Repository struct {
 	URL           string `yaml:"url"`
 	Branch        string `yaml:"branch"`
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FieldError is one problem with one field of nextdeploy.yml. Line is 0 when
+// the field is not in the file (a required value left out).
+type FieldError struct {
+	Field   string
+	Line    int
+	Message string
+}
+
+func (e FieldError) Error() string {
+	switch {
+	case e.Field == "":
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	case e.Line == 0:
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+}
+
+// ValidationError lists every problem found in a config file.
+type ValidationError struct {
+	File   string
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s has %d problem(s):", e.File, len(e.Errors))
+	for _, fe := range e.Errors {
+		b.WriteString("\n  " + fe.Error())
+	}
+	return b.String()
+}
+
+// yamlTypeError is one entry of a yaml.TypeError, e.g.
+// "line 4: cannot unmarshal !!str `abc` into int".
+var yamlTypeError = regexp.MustCompile("^line (\\d+): cannot unmarshal !!(\\w+)(?: `(.*)`)? into (.+)$")
+
+// decodeConfig decodes doc into a config. Type mismatches are reported
+// together as a *ValidationError naming each field, its line and the type
+// it wants, instead of yaml's first-error-wins message.
+func decodeConfig(doc *yaml.Node, file string) (*NextDeployConfig, error) {
+	var cfg NextDeployConfig
+	err := doc.Decode(&cfg)
+	var typeErr *yaml.TypeError
+	if err == nil || !errors.As(err, &typeErr) {
+		return &cfg, err
+	}
+
+	paths := fieldLines(doc)
+	verr := &ValidationError{File: file}
+	for _, msg := range typeErr.Errors {
+		m := yamlTypeError.FindStringSubmatch(msg)
+		if m == nil {
+			line, rest := splitYAMLLine(msg)
+			verr.Errors = append(verr.Errors, FieldError{Field: paths[line], Line: line, Message: rest})
+			continue
+		}
+		line, _ := strconv.Atoi(m[1])
+		got := yamlTagName(m[2])
+		if m[3] != "" {
+			got += fmt.Sprintf(" %q", m[3])
+		}
+		verr.Errors = append(verr.Errors, FieldError{
+			Field:   paths[line],
+			Line:    line,
+			Message: fmt.Sprintf("expected %s, got %s", goTypeName(m[4]), got),
+		})
+	}
+	return &cfg, verr
+}
+
+// splitYAMLLine takes the "line N: " prefix off a yaml error message.
+func splitYAMLLine(msg string) (int, string) {
+	rest, ok := strings.CutPrefix(msg, "line ")
+	if !ok {
+		return 0, msg
+	}
+	n, after, ok := strings.Cut(rest, ": ")
+	line, err := strconv.Atoi(n)
+	if !ok || err != nil {
+		return 0, msg
+	}
+	return line, after
+}
+
+// goTypeName turns the Go type in a yaml error into what a config author
+// would call it.
+func goTypeName(t string) string {
+	switch {
+	case strings.HasPrefix(t, "int"), strings.HasPrefix(t, "uint"):
+		return "a whole number"
+	case strings.HasPrefix(t, "float"):
+		return "a number"
+	case t == "bool":
+		return "true or false"
+	case t == "string":
+		return "a string"
+	case strings.HasPrefix(t, "[]"):
+		return "a list"
+	case strings.HasPrefix(t, "map["), strings.HasPrefix(t, "config."), strings.HasPrefix(t, "*config."):
+		return "a mapping"
+	}
+	return t
+}
+
+func yamlTagName(tag string) string {
+	switch tag {
+	case "str":
+		return "string"
+	case "seq":
+		return "list"
+	case "map":
+		return "mapping"
+	}
+	return tag
+}
+
+// walkFields calls fn with the dotted path (servers.0.port, the paths
+// GetField and SetField take) and line of every key and list item in doc,
+// parents before children.
+func walkFields(doc *yaml.Node, fn func(path string, line int, isKey bool)) {
+	var walk func(n *yaml.Node, path string)
+	walk = func(n *yaml.Node, path string) {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				p := joinPath(path, n.Content[i].Value)
+				fn(p, n.Content[i].Line, true)
+				walk(n.Content[i+1], p)
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				p := joinPath(path, strconv.Itoa(i))
+				fn(p, c.Line, false)
+				walk(c, p)
+			}
+		}
+	}
+	walk(doc, "")
+}
+
+// fieldLines maps each line of doc to the innermost key on it, or to the
+// list item that starts it when it has no key ("- abc"). Items of a flow
+// list ("port: [22]") belong to their key.
+func fieldLines(doc *yaml.Node) map[int]string {
+	lines := make(map[int]string)
+	walkFields(doc, func(path string, line int, isKey bool) {
+		if _, taken := lines[line]; isKey || !taken {
+			lines[line] = path
+		}
+	})
+	return lines
+}
+
+func joinPath(parent, seg string) string {
+	if parent == "" {
+		return seg
+	}
+	return parent + "." + seg
+}
+
+// ValidateApp runs the checks a VPS deploy applies to app and returns every
+// failure rather than the first. Messages name the field under app.
+func ValidateApp(app AppConfig) []error {
+	var errs []error
+	add := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	add(app.Start.Validate())
+	add(app.Domain.Validate())
+	for _, v := range app.Volumes {
+		add(v.Validate())
+	}
+	add(app.Stop.Validate())
+	add(app.Resources.Validate())
+	add(app.Hooks.Validate())
+	if pm := app.PackageManager; pm != "" && !slices.Contains([]string{"npm", "yarn", "pnpm", "bun"}, pm) {
+		add(fmt.Errorf("package_manager %q invalid: want npm, yarn, pnpm or bun", pm))
+	}
+	if p := app.MaintenancePage; p != "" && !filepath.IsLocal(p) {
+		add(fmt.Errorf("maintenance_page %q invalid: want a path inside the project", p))
+	}
+	return errs
+}
+
+// Check parses a nextdeploy.yml document and reports syntax errors, type
+// mismatches and failed semantic checks in one *ValidationError, each with
+// the line it refers to. It returns nil for a config with no problems.
+func Check(data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		line, msg := splitYAMLLine(strings.TrimPrefix(err.Error(), "yaml: "))
+		return &ValidationError{File: ConfigFile, Errors: []FieldError{{Line: line, Message: msg}}}
+	}
+	verr := &ValidationError{File: ConfigFile}
+	cfg, err := decodeConfig(&doc, ConfigFile)
+	var decodeErr *ValidationError
+	switch {
+	case errors.As(err, &decodeErr):
+		verr.Errors = append(verr.Errors, decodeErr.Errors...)
+	case err != nil:
+		verr.Errors = append(verr.Errors, FieldError{Message: err.Error()})
+	}
+	if err := CheckSchemaVersion(cfg.SchemaVersion); err != nil {
+		verr.Errors = append(verr.Errors, FieldError{Field: "schema_version", Message: err.Error()})
+	}
+
+	if cfg.TargetType == "" || cfg.TargetType == "vps" {
+		lines := make(map[string]int)
+		walkFields(&doc, func(path string, line int, _ bool) { lines[path] = line })
+		for _, e := range ValidateApp(cfg.App) {
+			field, msg := splitField(e.Error())
+			field = "app." + field
+			verr.Errors = append(verr.Errors, FieldError{Field: field, Line: lineOf(lines, field), Message: msg})
+		}
+	}
+
+	if len(verr.Errors) == 0 {
+		return nil
+	}
+	return verr
+}
+
+// splitField separates the leading field name of a validator message
+// ("stop.timeout \"x\" invalid", "volumes: target is required") from the rest.
+func splitField(msg string) (string, string) {
+	end := strings.IndexAny(msg, " :")
+	if end <= 0 {
+		return "", msg
+	}
+	return msg[:end], strings.TrimLeft(msg[end:], ": ")
+}
+
+// lineOf is the line of path, or of its nearest ancestor in the file.
+// Indexes may be written either way: start.command[1] or start.command.1.
+func lineOf(lines map[string]int, path string) int {
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	for path != "" {
+		if line, ok := lines[path]; ok {
+			return line
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return 0
+}
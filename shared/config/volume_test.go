@@ -0,0 +1,53 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVolumeValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       Volume
+		wantErr bool
+	}{
+		{"named", Volume{Name: "uploads", Target: "public/uploads"}, false},
+		{"bind", Volume{Source: "/srv/data", Target: "data", ReadOnly: true}, false},
+		{"no source", Volume{Target: "data"}, true},
+		{"both sources", Volume{Name: "x", Source: "/srv/x", Target: "data"}, true},
+		{"bad name", Volume{Name: "Up Loads", Target: "data"}, true},
+		{"relative source", Volume{Source: "srv/data", Target: "data"}, true},
+		{"unclean source", Volume{Source: "/srv/../etc", Target: "data"}, true},
+		{"no target", Volume{Name: "x"}, true},
+		{"absolute target", Volume{Name: "x", Target: "/data"}, true},
+		{"escaping target", Volume{Name: "x", Target: "../data"}, true},
+		{"colon injects a second mount", Volume{Source: "/srv/a:/etc", Target: "data"}, true},
+		{"newline injects a directive", Volume{Name: "x", Target: "data\nUser=root"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.v.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVolumeJSON(t *testing.T) {
+	// metadata.json from before the json tags spelled the field ReadOnly; a
+	// read-only volume must not come back writable on rollback.
+	var legacy Volume
+	if err := json.Unmarshal([]byte(`{"Name":"","Source":"/srv/geoip","Target":"data/geoip","ReadOnly":true}`), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Volume{Source: "/srv/geoip", Target: "data/geoip", ReadOnly: true}); legacy != want {
+		t.Errorf("legacy metadata decoded as %+v, want %+v", legacy, want)
+	}
+	data, err := json.Marshal(Volume{Name: "uploads", Target: "public/uploads", ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"uploads","target":"public/uploads","readOnly":true}`; string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+}
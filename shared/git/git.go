@@ -78,7 +78,14 @@ func GetSecondLatestCommitHashAlt() (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 func GetCommitHash() (string, error) {
+	return CommitHashIn("")
+}
+
+// CommitHashIn is GetCommitHash for the repository containing dir; "" is the
+// working directory.
+func CommitHashIn(dir string) (string, error) {
 	cmd := exec.Command("git", "rev-parse", "--short=7", "HEAD")
+	cmd.Dir = dir
 
 	var out bytes.Buffer
 	cmd.Stdout = &out
@@ -93,7 +100,13 @@ func GetCommitHash() (string, error) {
 }
 
 func IsDirty() bool {
+	return IsDirtyIn("")
+}
+
+// IsDirtyIn is IsDirty for the repository containing dir.
+func IsDirtyIn(dir string) bool {
 	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Dir = dir
 
 	var out bytes.Buffer
 
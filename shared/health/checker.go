@@ -4,12 +4,15 @@ import (
 	"context"
 	"net/http"
 	"time"
+
+	"github.com/aynaash/nextdeploy/shared/httpx"
 )
 
 func CheckWithTimeout(url string, timeout time.Duration) bool {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	client := httpx.New(httpx.Options{Timeout: timeout})
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
@@ -18,8 +21,16 @@ func CheckWithTimeout(url string, timeout time.Duration) bool {
 		case <-ctx.Done():
 			return false
 		case <-ticker.C:
-			resp, err := http.Get(url)
-			if err == nil && resp.StatusCode == 200 {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+			if err != nil {
+				return false
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				continue
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
 				return true
 			}
 		}
@@ -0,0 +1,93 @@
+// Package httpx builds the HTTP clients NextDeploy uses for outbound calls,
+// so every one of them has timeouts, honours HTTP(S)_PROXY/NO_PROXY and can
+// retry, instead of some falling back to http.DefaultClient, which has no
+// timeout and can hang the daemon on a server that never answers.
+package httpx
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds a whole request, body included, when
+	// Options.Timeout is unset.
+	DefaultTimeout        = 30 * time.Second
+	dialTimeout           = 10 * time.Second
+	tlsHandshakeTimeout   = 10 * time.Second
+	responseHeaderTimeout = 30 * time.Second
+	idleConnTimeout       = 90 * time.Second
+	defaultRetryBackoff   = 500 * time.Millisecond
+)
+
+// Options tune a client. The zero value is a client with DefaultTimeout and
+// no retries.
+type Options struct {
+	// Timeout bounds each attempt, from dial to the end of the body.
+	Timeout time.Duration
+	// Retries is how many more times a GET or HEAD is tried after a network
+	// error or a 429, 502, 503 or 504. Other methods are never retried.
+	Retries int
+	// RetryBackoff is the wait before the first retry, doubled after each;
+	// defaults to 500ms.
+	RetryBackoff time.Duration
+	// CheckRedirect is passed to the client, e.g. to refuse redirects.
+	CheckRedirect func(req *http.Request, via []*http.Request) error
+	// InsecureSkipVerify turns off TLS certificate verification. Only for an
+	// explicit user opt-out, such as a mirror with a self-signed cert.
+	InsecureSkipVerify bool
+}
+
+var (
+	sharedOnce      sync.Once
+	sharedTransport *http.Transport
+)
+
+// newTransport is http.DefaultTransport's setup with NextDeploy's timeouts.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// New returns a client configured by opts. Clients share one connection
+// pool, so callers may create one per call without leaking idle connections;
+// only InsecureSkipVerify gets a transport of its own.
+func New(opts Options) *http.Client {
+	sharedOnce.Do(func() { sharedTransport = newTransport() })
+	transport := sharedTransport
+	if opts.InsecureSkipVerify {
+		transport = newTransport()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 -- explicit, opt-in only
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	var rt http.RoundTripper = transport
+	if opts.Retries > 0 {
+		backoff := opts.RetryBackoff
+		if backoff <= 0 {
+			backoff = defaultRetryBackoff
+		}
+		rt = &retryTransport{base: transport, retries: opts.Retries, backoff: backoff, timeout: timeout}
+		// Each attempt gets its own timeout; the client-wide one would
+		// otherwise be spent by the first slow attempt.
+		timeout = 0
+	}
+	return &http.Client{Timeout: timeout, Transport: rt, CheckRedirect: opts.CheckRedirect}
+}
@@ -0,0 +1,82 @@
+package httpx
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSlowServerTripsTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	for _, opts := range []Options{
+		{Timeout: 100 * time.Millisecond},
+		{Timeout: 100 * time.Millisecond, Retries: 1, RetryBackoff: 10 * time.Millisecond},
+	} {
+		start := time.Now()
+		resp, err := New(opts).Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+			t.Fatalf("%+v: a server that never answers should time out", opts)
+		}
+		if took := time.Since(start); took > 2*time.Second {
+			t.Errorf("%+v: gave up after %s, want about %s per attempt", opts, took, opts.Timeout)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	client := New(Options{Timeout: time.Second, Retries: 2, RetryBackoff: time.Millisecond})
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" || calls.Load() != 3 {
+		t.Errorf("got %d %q after %d calls, want 200 \"ok\" after 3", resp.StatusCode, body, calls.Load())
+	}
+
+	// A POST is not known to be safe to repeat.
+	calls.Store(0)
+	resp, err = client.Post(srv.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Errorf("POST: got %d after %d calls, want one 503", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestNoRedirect(t *testing.T) {
+	srv := httptest.NewServer(http.RedirectHandler("http://example.invalid/", http.StatusFound))
+	defer srv.Close()
+	refuse := errors.New("redirect refused")
+	_, err := New(Options{CheckRedirect: func(*http.Request, []*http.Request) error { return refuse }}).Get(srv.URL)
+	if !errors.Is(err, refuse) {
+		t.Errorf("CheckRedirect not applied: %v", err)
+	}
+}
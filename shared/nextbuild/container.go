@@ -0,0 +1,97 @@
+package nextbuild
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aynaash/nextdeploy/shared"
+)
+
+// DefaultBuildImage is the image a containerized build uses when neither
+// app.build_image nor a .nvmrc/.node-version pins a Node version. The full
+// (not -slim) variant carries python/make/g++ for native modules.
+const DefaultBuildImage = "node:lts-bookworm"
+
+var nodeMajor = regexp.MustCompile(`^v?(\d+)`)
+
+// BuildImage picks the image for a containerized build of projectDir:
+// override when set, else node:<major>-bookworm from .nvmrc or .node-version,
+// else DefaultBuildImage. Bun projects build in the official Bun image.
+func BuildImage(projectDir, packageManager, override string) string {
+	if override != "" {
+		return override
+	}
+	if packageManager == "bun" {
+		return "oven/bun:1"
+	}
+	for _, name := range []string{".nvmrc", ".node-version"} {
+		// #nosec G304 -- fixed file names inside the project directory
+		data, err := os.ReadFile(filepath.Join(projectDir, name))
+		if err != nil {
+			continue
+		}
+		if m := nodeMajor.FindStringSubmatch(strings.TrimSpace(string(data))); m != nil {
+			return "node:" + m[1] + "-bookworm"
+		}
+	}
+	return DefaultBuildImage
+}
+
+// installCommands are the lockfile-exact installs run inside the container.
+var installCommands = map[string]string{
+	"npm":  "npm ci",
+	"yarn": "corepack yarn install --frozen-lockfile",
+	"pnpm": "corepack pnpm install --frozen-lockfile",
+	"bun":  "bun install --frozen-lockfile",
+}
+
+// ContainerCommand wraps buildCmd in a `docker run` that builds projectDir
+// inside image, for output that does not depend on the host toolchain (a
+// Mac building for a Linux server gets Linux native modules and SWC).
+//
+// The project is bind-mounted at /app and the build writes .next back to it.
+// node_modules is a named volume installed fresh from the lockfile, so the
+// host's (possibly darwin) modules are neither used nor overwritten; the
+// volume is kept between builds as a cache. Files the root container user
+// creates in .next are handed back to uid:gid when those are >= 0.
+func ContainerCommand(image, projectDir, appName, packageManager, buildCmd string, uid, gid int) (string, error) {
+	install, ok := installCommands[packageManager]
+	if !ok {
+		return "", fmt.Errorf("containerized build: unsupported package manager %q", packageManager)
+	}
+	abs, err := filepath.Abs(projectDir)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(buildCmd, "pnpm ") || strings.HasPrefix(buildCmd, "yarn ") {
+		buildCmd = "corepack " + buildCmd
+	}
+
+	script := "set -e; "
+	if uid >= 0 && gid >= 0 {
+		script += fmt.Sprintf("trap 'chown -R %d:%d /app/.next 2>/dev/null || true' EXIT; ", uid, gid)
+	}
+	script += install + "; " + buildCmd
+
+	volume := "nextdeploy-" + appName + "-node_modules"
+	if appName == "" {
+		volume = "nextdeploy-node_modules"
+	}
+	args := []string{
+		"docker", "run", "--rm",
+		"-v", abs + ":/app",
+		"-v", volume + ":/app/node_modules",
+		"-w", "/app",
+		"-e", "NEXT_TELEMETRY_DISABLED=1",
+		image,
+		"sh", "-c", script,
+	}
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shared.ShellQuote(a)
+	}
+	return strings.Join(quoted, " "), nil
+}
@@ -0,0 +1,106 @@
+package nextbuild
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+)
+
+func TestBuildImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		pm       string
+		override string
+		want     string
+	}{
+		{"default", nil, "npm", "", DefaultBuildImage},
+		{"override wins", map[string]string{".nvmrc": "20"}, "npm", "node:22-alpine", "node:22-alpine"},
+		{"nvmrc major", map[string]string{".nvmrc": "v20.11.1\n"}, "npm", "", "node:20-bookworm"},
+		{"node-version", map[string]string{".node-version": "22"}, "pnpm", "", "node:22-bookworm"},
+		{"alias ignored", map[string]string{".nvmrc": "lts/iron"}, "npm", "", DefaultBuildImage},
+		{"bun", nil, "bun", "", "oven/bun:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := BuildImage(dir, tt.pm, tt.override); got != tt.want {
+				t.Errorf("BuildImage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerCommand(t *testing.T) {
+	dir := t.TempDir()
+	cmd, err := ContainerCommand("node:20-bookworm", dir, "shop", "pnpm", "pnpm run build", 501, 20)
+	if err != nil {
+		t.Fatalf("ContainerCommand: %v", err)
+	}
+	// Read the command back the way the shell will.
+	argv, err := config.SplitArgs(cmd)
+	if err != nil {
+		t.Fatalf("command does not parse as shell words: %v\n%s", err, cmd)
+	}
+	want := []string{
+		"docker", "run", "--rm",
+		"-v", dir + ":/app",
+		"-v", "nextdeploy-shop-node_modules:/app/node_modules",
+		"-w", "/app",
+		"-e", "NEXT_TELEMETRY_DISABLED=1",
+		"node:20-bookworm",
+		"sh", "-c",
+	}
+	if len(argv) != len(want)+1 || !reflect.DeepEqual(argv[:len(want)], want) {
+		t.Fatalf("argv = %q, want %q followed by the script", argv, want)
+	}
+	script := argv[len(want)]
+	for _, want := range []string{
+		"corepack pnpm install --frozen-lockfile; corepack pnpm run build",
+		"chown -R 501:20 /app/.next",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+
+	cmd, err = ContainerCommand("node:lts-bookworm", dir, "shop", "npm", "npm run build", -1, -1)
+	if err != nil {
+		t.Fatalf("ContainerCommand: %v", err)
+	}
+	if strings.Contains(cmd, "chown") {
+		t.Errorf("no chown expected without a host uid:\n%s", cmd)
+	}
+	if !strings.Contains(cmd, "'set -e; npm ci; npm run build'") {
+		t.Errorf("npm build script not quoted as one argument:\n%s", cmd)
+	}
+
+	if _, err := ContainerCommand("node:20", dir, "shop", "deno", "deno task build", 0, 0); err == nil {
+		t.Error("unsupported package manager should be rejected")
+	}
+}
+
+func TestImageRegistry(t *testing.T) {
+	for image, want := range map[string]string{
+		"node:22-bookworm":              "",
+		"oven/bun:1":                    "",
+		"docker.io/library/node:22":     "",
+		"ghcr.io/acme/node:22":          "ghcr.io",
+		"registry.acme.internal:5000/n": "registry.acme.internal:5000",
+		"localhost/node:22":             "localhost",
+		"123.dkr.ecr.us-east-1.amazonaws.com/base@sha256:abc": "123.dkr.ecr.us-east-1.amazonaws.com",
+	} {
+		if got := ImageRegistry(image); got != want {
+			t.Errorf("ImageRegistry(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
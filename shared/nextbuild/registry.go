@@ -0,0 +1,44 @@
+package nextbuild
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ImageRegistry returns the registry host an image reference pulls from,
+// or "" for Docker Hub. As in docker, the first path component names a
+// registry only when it looks like a host: it has a dot or a port, or is
+// localhost. "node:22" and "acme/node:22" are Docker Hub;
+// "ghcr.io/acme/node:22" is ghcr.io.
+func ImageRegistry(image string) string {
+	first, _, ok := strings.Cut(image, "/")
+	if !ok || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		return ""
+	}
+	if first == "docker.io" || first == "index.docker.io" || first == "registry-1.docker.io" {
+		return ""
+	}
+	return first
+}
+
+// RegistryHost is the host part of a docker.registry setting, which may be
+// written as a URL or with a namespace ("https://ghcr.io", "ghcr.io/acme").
+func RegistryHost(registry string) string {
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	host, _, _ := strings.Cut(registry, "/")
+	return strings.ToLower(host)
+}
+
+// RegistryLogin logs docker into registry, so a containerized build can pull
+// a private build image from it. The password goes to docker on stdin,
+// never on the command line.
+func RegistryLogin(registry, username, password string) error {
+	// #nosec G204 -- fixed binary; registry and username are arguments, not a shell string
+	cmd := exec.Command("docker", "login", registry, "--username", username, "--password-stdin")
+	cmd.Stdin = strings.NewReader(password)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("docker login %s failed: %w - %s", registry, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
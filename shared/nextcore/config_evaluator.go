@@ -24,6 +24,14 @@ async function load() {
             cfg = await cfg;
         }
 
+        // headers/redirects/rewrites are async functions that JSON.stringify
+        // would drop; resolve them so the routing rules reach the proxy config.
+        for (const key of ['headers', 'redirects', 'rewrites']) {
+            if (typeof cfg[key] === 'function') {
+                cfg[key] = await cfg[key]();
+            }
+        }
+
         // Output JSON, stripping functions/regex which JSON.stringify does naturally
         console.log(JSON.stringify(cfg, null, 2));
     } catch(e) {
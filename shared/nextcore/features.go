@@ -13,11 +13,19 @@ type DetectedFeatures struct {
 	HasCloudinary      bool
 	HasExternalImages  []string
 	HasServerActions   bool
-	HasI18n            bool
-	UserDefinedCSP     bool
-	AllowedOrigins     []string
-	DistDir            string
-	ExportDir          string
+	// ServerActionsBodyLimit is next.config's server action body limit in
+	// bytes; 0 means Next's default.
+	ServerActionsBodyLimit int64
+	HasI18n                bool
+	UserDefinedCSP         bool
+	AllowedOrigins         []string
+	DistDir                string
+	ExportDir              string
+	// Headers, Redirects and Rewrites mirror next.config routing rules with
+	// basePath already applied, ready to translate into Caddy directives.
+	Headers   []HeaderRule
+	Redirects []RedirectRule
+	Rewrites  []RewriteRule
 }
 
 // DetectFeatures inspects a NextConfig and returns what external services
@@ -52,6 +60,7 @@ func DetectFeatures(config *NextConfig) *DetectedFeatures {
 		if config.Experimental.ServerActions {
 			f.HasServerActions = true
 		}
+		f.ServerActionsBodyLimit = config.Experimental.ServerActionsBodySizeLimit
 	}
 
 	// --- i18n ---
@@ -62,20 +71,33 @@ func DetectFeatures(config *NextConfig) *DetectedFeatures {
 	// --- check if user already set a CSP in headers ---
 	// if so, we should NOT override it in Caddy
 	for _, h := range config.Headers {
-		if hMap, ok := h.(map[string]any); ok {
-			if headers, ok := hMap["headers"].([]any); ok {
-				for _, header := range headers {
-					if hItem, ok := header.(map[string]any); ok {
-						key, _ := hItem["key"].(string)
-						if strings.EqualFold(key, "content-security-policy") {
-							f.UserDefinedCSP = true
-						}
-					}
-				}
+		for _, header := range h.Headers {
+			if strings.EqualFold(header.Key, "content-security-policy") {
+				f.UserDefinedCSP = true
 			}
 		}
 	}
 
+	// --- routing rules honoured at the proxy layer ---
+	for _, h := range config.Headers {
+		h.Source = withBasePath(config.BasePath, h.BasePath, h.Source)
+		f.Headers = append(f.Headers, h)
+	}
+	for _, r := range config.Redirects {
+		r.Source = withBasePath(config.BasePath, r.BasePath, r.Source)
+		if strings.HasPrefix(r.Destination, "/") {
+			r.Destination = withBasePath(config.BasePath, r.BasePath, r.Destination)
+		}
+		f.Redirects = append(f.Redirects, r)
+	}
+	for _, r := range config.Rewrites {
+		r.Source = withBasePath(config.BasePath, r.BasePath, r.Source)
+		if strings.HasPrefix(r.Destination, "/") {
+			r.Destination = withBasePath(config.BasePath, r.BasePath, r.Destination)
+		}
+		f.Rewrites = append(f.Rewrites, r)
+	}
+
 	// --- dynamic paths ---
 	f.DistDir = ".next"
 	if config.DistDir != "" {
@@ -196,3 +218,15 @@ func defaultCSP() string {
 func contains(slice []string, item string) bool {
 	return slices.Contains(slice, item)
 }
+
+// withBasePath prefixes a route path with the configured basePath unless the
+// rule opted out with basePath: false, matching how Next.js resolves it.
+func withBasePath(basePath string, ruleBasePath *bool, path string) string {
+	if basePath == "" || (ruleBasePath != nil && !*ruleBasePath) {
+		return path
+	}
+	if path == "/" {
+		return basePath
+	}
+	return basePath + path
+}
@@ -0,0 +1,188 @@
+package nextcore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+)
+
+// ErrMetadataNotFound is returned by MetadataStore.Get when nothing was
+// published for the commit.
+var ErrMetadataNotFound = errors.New("metadata not found for commit")
+
+// MetadataStore holds build metadata keyed by git commit, so the host that
+// builds and the daemon that deploys need not be the same machine.
+type MetadataStore interface {
+	Put(ctx context.Context, commit string, data []byte) error
+	Get(ctx context.Context, commit string) ([]byte, error)
+}
+
+// commitPattern keeps keys to what git prints: abbreviated or full hashes.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+
+func checkCommit(commit string) error {
+	if !commitPattern.MatchString(commit) {
+		return fmt.Errorf("metadata store: %q is not a git commit hash", commit)
+	}
+	return nil
+}
+
+// NewMetadataStore builds the backend selected by cfg.
+func NewMetadataStore(ctx context.Context, cfg *config.MetadataStoreConfig) (MetadataStore, error) {
+	if cfg == nil {
+		return nil, errors.New("metadata store: not configured")
+	}
+	switch cfg.Backend {
+	case "", "local":
+		if cfg.Path == "" {
+			return nil, errors.New("metadata store: local backend needs a path")
+		}
+		return &LocalMetadataStore{Dir: cfg.Path}, nil
+	case "s3":
+		if cfg.Bucket == "" {
+			return nil, errors.New("metadata store: s3 backend needs a bucket")
+		}
+		var opts []func(*awsconfig.LoadOptions) error
+		if cfg.Region != "" {
+			opts = append(opts, awsconfig.WithRegion(cfg.Region))
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("metadata store: load AWS config: %w", err)
+		}
+		return &S3MetadataStore{Client: s3.NewFromConfig(awsCfg), Bucket: cfg.Bucket, Prefix: cfg.Prefix}, nil
+	default:
+		return nil, fmt.Errorf("metadata store: unknown backend %q (want local or s3)", cfg.Backend)
+	}
+}
+
+// LocalMetadataStore keeps <Dir>/<commit>/metadata.json, for a directory the
+// build and deploy hosts share (NFS, a synced volume) or for a single host.
+type LocalMetadataStore struct {
+	Dir string
+}
+
+func (s *LocalMetadataStore) Put(_ context.Context, commit string, data []byte) error {
+	if err := checkCommit(commit); err != nil {
+		return err
+	}
+	dir := filepath.Join(s.Dir, commit)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("metadata store: %w", err)
+	}
+	// Write then rename so a concurrent Get never sees half a file.
+	tmp, err := os.CreateTemp(dir, ".metadata-*.json")
+	if err != nil {
+		return fmt.Errorf("metadata store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("metadata store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("metadata store: %w", err)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, "metadata.json"))
+}
+
+func (s *LocalMetadataStore) Get(_ context.Context, commit string) ([]byte, error) {
+	if err := checkCommit(commit); err != nil {
+		return nil, err
+	}
+	// #nosec G304 -- commit is validated as a hex hash
+	data, err := os.ReadFile(filepath.Join(s.Dir, commit, "metadata.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w %s", ErrMetadataNotFound, commit)
+	}
+	return data, err
+}
+
+// S3MetadataStore keeps s3://<Bucket>/<Prefix>/<commit>/metadata.json.
+type S3MetadataStore struct {
+	Client *s3.Client
+	Bucket string
+	Prefix string
+}
+
+func (s *S3MetadataStore) key(commit string) string {
+	return path.Join(s.Prefix, commit, "metadata.json")
+}
+
+func (s *S3MetadataStore) Put(ctx context.Context, commit string, data []byte) error {
+	if err := checkCommit(commit); err != nil {
+		return err
+	}
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.key(commit)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("metadata store: put s3://%s/%s: %w", s.Bucket, s.key(commit), err)
+	}
+	return nil
+}
+
+func (s *S3MetadataStore) Get(ctx context.Context, commit string) ([]byte, error) {
+	if err := checkCommit(commit); err != nil {
+		return nil, err
+	}
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(commit)),
+	})
+	if err != nil {
+		var noKey *s3types.NoSuchKey
+		if errors.As(err, &noKey) {
+			return nil, fmt.Errorf("%w %s", ErrMetadataNotFound, commit)
+		}
+		return nil, fmt.Errorf("metadata store: get s3://%s/%s: %w", s.Bucket, s.key(commit), err)
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// PublishMetadata stores metadata under its git commit. Dirty or git-less
+// builds are refused: their commit does not identify what was built.
+func PublishMetadata(ctx context.Context, store MetadataStore, metadata *NextCorePayload) error {
+	if metadata.GitCommit == "" {
+		return errors.New("metadata store: build has no git commit to key it by")
+	}
+	if metadata.GitDirty {
+		return fmt.Errorf("metadata store: working tree was dirty at %s; commit before publishing", metadata.GitCommit)
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, metadata.GitCommit, data)
+}
+
+// FetchMetadata loads the metadata published for commit.
+func FetchMetadata(ctx context.Context, store MetadataStore, commit string) (*NextCorePayload, error) {
+	data, err := store.Get(ctx, commit)
+	if err != nil {
+		return nil, err
+	}
+	var metadata NextCorePayload
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("metadata store: parse metadata for %s: %w", commit, err)
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,53 @@
+package nextcore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+)
+
+func TestLocalMetadataStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewMetadataStore(ctx, &config.MetadataStoreConfig{Backend: "local", Path: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewMetadataStore: %v", err)
+	}
+
+	const commit = "3f2a9c1d"
+	in := &NextCorePayload{AppName: "shop", GitCommit: commit, OutputMode: "standalone", PackageManager: "pnpm"}
+	if err := PublishMetadata(ctx, store, in); err != nil {
+		t.Fatalf("PublishMetadata: %v", err)
+	}
+	out, err := FetchMetadata(ctx, store, commit)
+	if err != nil {
+		t.Fatalf("FetchMetadata: %v", err)
+	}
+	if out.AppName != in.AppName || out.GitCommit != commit || out.OutputMode != in.OutputMode || out.PackageManager != in.PackageManager {
+		t.Errorf("round trip mismatch: got %+v", out)
+	}
+
+	if _, err := FetchMetadata(ctx, store, "deadbeef"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("unpublished commit: want ErrMetadataNotFound, got %v", err)
+	}
+	if _, err := store.Get(ctx, "../../etc"); err == nil {
+		t.Error("a non-hash key should be rejected")
+	}
+	if err := PublishMetadata(ctx, store, &NextCorePayload{GitCommit: commit, GitDirty: true}); err == nil {
+		t.Error("a dirty build should not be published")
+	}
+}
+
+func TestNewMetadataStoreConfig(t *testing.T) {
+	for _, cfg := range []*config.MetadataStoreConfig{
+		nil,
+		{Backend: "local"},
+		{Backend: "s3"},
+		{Backend: "gcs", Bucket: "b"},
+	} {
+		if _, err := NewMetadataStore(context.Background(), cfg); err == nil {
+			t.Errorf("NewMetadataStore(%+v): expected an error", cfg)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package nextcore
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,17 +10,14 @@ import (
 	"strings"
 )
 
-// CollectBuildMetadata runs the Next.js build and reads the manifests it
-// produces. It intentionally does NOT compute OutputMode — the canonical
-// source is NextConfig.Output, and the caller threads that into the payload.
-func CollectBuildMetadata(buildCmd string) (*NextBuildMetadata, error) {
-	projectDir, err := os.Getwd()
-	if err != nil {
-		return nil, err
-	}
+// CollectBuildMetadata runs the Next.js build in projectDir and reads the
+// manifests it produces. It intentionally does NOT compute OutputMode — the
+// canonical source is NextConfig.Output, and the caller threads that into the
+// payload.
+func CollectBuildMetadata(projectDir, buildCmd string) (*NextBuildMetadata, error) {
 	NextCoreLogger.Debug("Building Next.js app to generate build metadata")
 
-	if err := os.MkdirAll(".nextdeploy", 0750); err != nil {
+	if err := os.MkdirAll(filepath.Join(projectDir, ".nextdeploy"), 0750); err != nil {
 		return nil, fmt.Errorf("failed to create .nextdeploy directory: %w", err)
 	}
 
@@ -32,9 +30,22 @@ func CollectBuildMetadata(buildCmd string) (*NextBuildMetadata, error) {
 		return nil, fmt.Errorf("build failed: %w", err)
 	}
 
+	return ReadBuildMetadata(projectDir)
+}
+
+// ErrNoBuild is returned by ReadBuildMetadata when projectDir has not been
+// built.
+var ErrNoBuild = errors.New("no Next.js build found")
+
+// ReadBuildMetadata reads the manifests of an existing build of projectDir
+// without running one, for when the build is a separate step (CI).
+func ReadBuildMetadata(projectDir string) (*NextBuildMetadata, error) {
 	nextDir := filepath.Join(projectDir, ".next")
 	// #nosec G304
 	buildID, err := os.ReadFile(filepath.Join(nextDir, "BUILD_ID"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s is missing; run `next build` first", ErrNoBuild, filepath.Join(nextDir, "BUILD_ID"))
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read BUILD_ID: %w", err)
 	}
@@ -70,15 +81,9 @@ func CollectBuildMetadata(buildCmd string) (*NextBuildMetadata, error) {
 		}
 	}
 
-	hasAppRouter := appPathRoutesManifest != nil
-	if !hasAppRouter {
-		for _, rel := range []string{"app", filepath.Join("src", "app")} {
-			if _, err := os.Stat(filepath.Join(projectDir, rel)); err == nil {
-				hasAppRouter = true
-				break
-			}
-		}
-	}
+	pagesManifest, _ := readJSON(filepath.Join("server", "pages-manifest.json"))
+	hasAppRouter := appPathRoutesManifest != nil || appBuildManifest != nil || hasSourceDir(projectDir, "app")
+	hasPagesRouter := hasUserPages(pagesManifest) || hasSourceDir(projectDir, "pages")
 
 	return &NextBuildMetadata{
 		BuildID:               string(buildID),
@@ -91,9 +96,34 @@ func CollectBuildMetadata(buildCmd string) (*NextBuildMetadata, error) {
 		ReactLoadableManifest: reactLoadableManifest,
 		Diagnostics:           diagnostics,
 		HasAppRouter:          hasAppRouter,
+		HasPagesRouter:        hasPagesRouter,
 	}, nil
 }
 
+// hasSourceDir reports whether the project has a top-level or src/ router
+// directory named name.
+func hasSourceDir(projectDir, name string) bool {
+	for _, rel := range []string{name, filepath.Join("src", name)} {
+		if info, err := os.Stat(filepath.Join(projectDir, rel)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUserPages reports whether a pages-manifest.json lists any page of the
+// app's own. Next.js writes /_app, /_document and /_error into it even for
+// App Router-only builds, so those do not count.
+func hasUserPages(manifest any) bool {
+	pages, _ := manifest.(map[string]any)
+	for route := range pages {
+		if !strings.HasPrefix(route, "/_") {
+			return true
+		}
+	}
+	return false
+}
+
 // detectOutputMode resolves the Next.js output mode using the parsed config
 // first (the authoritative source) and falling back to filesystem / raw
 // config-file scanning when the config couldn't be evaluated.
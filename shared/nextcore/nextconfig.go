@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -81,7 +82,11 @@ func parseConfigObject(config map[string]interface{}) (*NextConfig, error) {
 	result.BasePath = getString("basePath")
 	result.Output = getString("output")
 	result.ReactStrictMode = getBool("reactStrictMode")
-	result.PoweredByHeader = getBool("poweredByHeader")
+	// Next.js sends X-Powered-By unless next.config turns it off.
+	result.PoweredByHeader = true
+	if v, ok := config["poweredByHeader"].(bool); ok {
+		result.PoweredByHeader = v
+	}
 	result.TrailingSlash = getBool("trailingSlash")
 	result.PageExtensions = getStringSlice("pageExtensions")
 	result.AssetPrefix = getString("assetPrefix")
@@ -136,8 +141,8 @@ func parseConfigObject(config map[string]interface{}) (*NextConfig, error) {
 			UseDeploymentIdServerActions:      getBoolFromMap(experimental, "useDeploymentIdServerActions"),
 			DeploymentId:                      getStringFromMap(experimental, "deploymentId"),
 			ServerComponents:                  getBoolFromMap(experimental, "serverComponents"),
-			ServerActions:                     getBoolFromMap(experimental, "serverActions"),
-			ServerActionsBodySizeLimit:        getIntFromMap(experimental, "serverActionsBodySizeLimit"),
+			ServerActions:                     serverActionsEnabled(experimental["serverActions"]),
+			ServerActionsBodySizeLimit:        serverActionsBodySizeLimit(experimental),
 			OptimizeCss:                       getBoolFromMap(experimental, "optimizeCss"),
 			OptimisticClientCache:             getBoolFromMap(experimental, "optimisticClientCache"),
 			ClientRouterFilter:                getBoolFromMap(experimental, "clientRouterFilter"),
@@ -196,15 +201,15 @@ func parseConfigObject(config map[string]interface{}) (*NextConfig, error) {
 	}
 
 	if headers, ok := config["headers"].([]interface{}); ok {
-		result.Headers = headers
+		result.Headers = parseHeaderRules(headers)
 	}
 
 	if redirects, ok := config["redirects"].([]interface{}); ok {
-		result.Redirects = redirects
+		result.Redirects = parseRedirectRules(redirects)
 	}
 
-	if rewrites, ok := config["rewrites"].([]interface{}); ok {
-		result.Rewrites = rewrites
+	if rewrites, ok := config["rewrites"]; ok {
+		result.Rewrites = parseRewriteRules(rewrites)
 	}
 
 	if publicRuntimeConfig, ok := config["publicRuntimeConfig"].(map[string]interface{}); ok {
@@ -227,6 +232,144 @@ func parseConfigObject(config map[string]interface{}) (*NextConfig, error) {
 	return result, nil
 }
 
+func parseHeaderRules(raw []interface{}) []HeaderRule {
+	var rules []HeaderRule
+	for _, item := range raw {
+		m, ok := item.(map[string]interface{})
+		if !ok || getStringFromMap(m, "source") == "" {
+			continue
+		}
+		rule := HeaderRule{
+			Source:      getStringFromMap(m, "source"),
+			BasePath:    getOptionalBoolFromMap(m, "basePath"),
+			Conditional: isConditionalRoute(m),
+		}
+		for _, h := range toSlice(m["headers"]) {
+			hm := toMap(h)
+			if key := getStringFromMap(hm, "key"); key != "" {
+				rule.Headers = append(rule.Headers, RouteHeader{Key: key, Value: getStringFromMap(hm, "value")})
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func parseRedirectRules(raw []interface{}) []RedirectRule {
+	var rules []RedirectRule
+	for _, item := range raw {
+		m, ok := item.(map[string]interface{})
+		if !ok || getStringFromMap(m, "source") == "" || getStringFromMap(m, "destination") == "" {
+			continue
+		}
+		rules = append(rules, RedirectRule{
+			Source:      getStringFromMap(m, "source"),
+			Destination: getStringFromMap(m, "destination"),
+			Permanent:   getBoolFromMap(m, "permanent"),
+			StatusCode:  getIntFromMap(m, "statusCode"),
+			BasePath:    getOptionalBoolFromMap(m, "basePath"),
+			Conditional: isConditionalRoute(m),
+		})
+	}
+	return rules
+}
+
+// parseRewriteRules accepts both shapes rewrites() may return: a plain array,
+// which Next.js applies as afterFiles, or an object with
+// beforeFiles/afterFiles/fallback arrays.
+func parseRewriteRules(raw interface{}) []RewriteRule {
+	var rules []RewriteRule
+	add := func(phase string, items []interface{}) {
+		for _, item := range items {
+			m, ok := item.(map[string]interface{})
+			if !ok || getStringFromMap(m, "source") == "" || getStringFromMap(m, "destination") == "" {
+				continue
+			}
+			rules = append(rules, RewriteRule{
+				Source:      getStringFromMap(m, "source"),
+				Destination: getStringFromMap(m, "destination"),
+				BasePath:    getOptionalBoolFromMap(m, "basePath"),
+				Conditional: isConditionalRoute(m),
+				Phase:       phase,
+			})
+		}
+	}
+	switch v := raw.(type) {
+	case []interface{}:
+		add(RewriteAfterFiles, v)
+	case map[string]interface{}:
+		for _, phase := range []string{RewriteBeforeFiles, RewriteAfterFiles, RewriteFallback} {
+			add(phase, toSlice(v[phase]))
+		}
+	}
+	return rules
+}
+
+func isConditionalRoute(m map[string]interface{}) bool {
+	return len(toSlice(m["has"])) > 0 || len(toSlice(m["missing"])) > 0
+}
+
+func getOptionalBoolFromMap(m map[string]interface{}, key string) *bool {
+	if val, ok := m[key].(bool); ok {
+		return &val
+	}
+	return nil
+}
+
+// serverActionsEnabled reads experimental.serverActions, a boolean before
+// Next.js 14 and an options object since.
+func serverActionsEnabled(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case map[string]interface{}:
+		return true
+	}
+	return false
+}
+
+// serverActionsBodySizeLimit reads the server action body limit in bytes from
+// experimental.serverActions.bodySizeLimit (Next.js 14+) or the older
+// experimental.serverActionsBodySizeLimit; 0 when unset or unreadable.
+func serverActionsBodySizeLimit(experimental map[string]interface{}) int64 {
+	raw := experimental["serverActionsBodySizeLimit"]
+	if opts, ok := experimental["serverActions"].(map[string]interface{}); ok && opts["bodySizeLimit"] != nil {
+		raw = opts["bodySizeLimit"]
+	}
+	n, err := parseByteSize(raw)
+	if err != nil {
+		NextCoreLogger.Warn("Ignoring server actions bodySizeLimit: %v", err)
+		return 0
+	}
+	return n
+}
+
+var byteUnits = map[string]int64{"": 1, "b": 1, "kb": 1 << 10, "mb": 1 << 20, "gb": 1 << 30}
+
+// parseByteSize reads a size the way Next.js does (the bytes package): a
+// number of bytes, or a string like "500kb" or "1.5mb" with 1024-based units.
+func parseByteSize(v any) (int64, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return int64(v), nil
+	case json.Number:
+		f, err := v.Float64()
+		return int64(f), err
+	case string:
+		s := strings.ToLower(strings.TrimSpace(v))
+		num := strings.TrimRight(s, "abcdefghijklmnopqrstuvwxyz ")
+		unit, ok := byteUnits[strings.TrimSpace(s[len(num):])]
+		f, err := strconv.ParseFloat(num, 64)
+		if !ok || err != nil || f < 0 {
+			return 0, fmt.Errorf("invalid size %q", v)
+		}
+		return int64(f * float64(unit)), nil
+	}
+	return 0, fmt.Errorf("invalid size %v", v)
+}
+
 func getStringFromMap(m map[string]interface{}, key string) string {
 	if val, ok := m[key].(string); ok {
 		return val
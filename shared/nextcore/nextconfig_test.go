@@ -0,0 +1,111 @@
+package nextcore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConfigObjectRoutes(t *testing.T) {
+	cfg, err := parseConfigObject(map[string]interface{}{
+		"basePath": "/shop",
+		"redirects": []interface{}{
+			map[string]interface{}{"source": "/old", "destination": "/new", "permanent": true},
+			map[string]interface{}{"source": "/ext", "destination": "https://example.com", "permanent": false, "basePath": false},
+			map[string]interface{}{"source": "/missing-destination"},
+		},
+		"headers": []interface{}{
+			map[string]interface{}{
+				"source":  "/(.*)",
+				"headers": []interface{}{map[string]interface{}{"key": "X-Frame-Options", "value": "DENY"}},
+				"has":     []interface{}{map[string]interface{}{"type": "header", "key": "x-preview"}},
+			},
+		},
+		"rewrites": map[string]interface{}{
+			"beforeFiles": []interface{}{map[string]interface{}{"source": "/a", "destination": "/b"}},
+			"fallback":    []interface{}{map[string]interface{}{"source": "/c", "destination": "/d"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("parseConfigObject: %v", err)
+	}
+
+	noBasePath := false
+	wantRedirects := []RedirectRule{
+		{Source: "/old", Destination: "/new", Permanent: true},
+		{Source: "/ext", Destination: "https://example.com", BasePath: &noBasePath},
+	}
+	if !reflect.DeepEqual(cfg.Redirects, wantRedirects) {
+		t.Errorf("Redirects = %+v, want %+v", cfg.Redirects, wantRedirects)
+	}
+
+	wantHeaders := []HeaderRule{{
+		Source:      "/(.*)",
+		Headers:     []RouteHeader{{Key: "X-Frame-Options", Value: "DENY"}},
+		Conditional: true,
+	}}
+	if !reflect.DeepEqual(cfg.Headers, wantHeaders) {
+		t.Errorf("Headers = %+v, want %+v", cfg.Headers, wantHeaders)
+	}
+
+	wantRewrites := []RewriteRule{{Source: "/a", Destination: "/b", Phase: RewriteBeforeFiles}, {Source: "/c", Destination: "/d", Phase: RewriteFallback}}
+	if !reflect.DeepEqual(cfg.Rewrites, wantRewrites) {
+		t.Errorf("Rewrites = %+v, want %+v", cfg.Rewrites, wantRewrites)
+	}
+
+	f := DetectFeatures(cfg)
+	if got := f.Redirects[0]; got.Source != "/shop/old" || got.Destination != "/shop/new" {
+		t.Errorf("basePath not applied to redirect: %+v", got)
+	}
+	if got := f.Redirects[1]; got.Source != "/ext" {
+		t.Errorf("basePath: false must be honoured: %+v", got)
+	}
+}
+
+func TestParseConfigObjectServerActionsBodySizeLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		experimental map[string]interface{}
+		want         int64
+	}{
+		{"options object", map[string]interface{}{"serverActions": map[string]interface{}{"bodySizeLimit": "5mb"}}, 5 << 20},
+		{"fractional", map[string]interface{}{"serverActions": map[string]interface{}{"bodySizeLimit": "1.5 MB"}}, 3 << 19},
+		{"bytes", map[string]interface{}{"serverActions": map[string]interface{}{"bodySizeLimit": float64(500000)}}, 500000},
+		{"legacy key", map[string]interface{}{"serverActions": true, "serverActionsBodySizeLimit": "200kb"}, 200 << 10},
+		{"unset", map[string]interface{}{"serverActions": map[string]interface{}{}}, 0},
+		{"invalid", map[string]interface{}{"serverActions": map[string]interface{}{"bodySizeLimit": "lots"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfigObject(map[string]interface{}{"experimental": tt.experimental})
+			if err != nil {
+				t.Fatalf("parseConfigObject: %v", err)
+			}
+			if !cfg.Experimental.ServerActions {
+				t.Error("serverActions should be enabled")
+			}
+			if got := DetectFeatures(cfg).ServerActionsBodyLimit; got != tt.want {
+				t.Errorf("ServerActionsBodyLimit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRewriteRulesPhases(t *testing.T) {
+	plain := parseRewriteRules([]interface{}{map[string]interface{}{"source": "/a", "destination": "/b"}})
+	if len(plain) != 1 || plain[0].Phase != RewriteAfterFiles {
+		t.Errorf("a plain rewrites array must be afterFiles: %+v", plain)
+	}
+	phased := parseRewriteRules(map[string]interface{}{
+		"fallback":    []interface{}{map[string]interface{}{"source": "/f", "destination": "/g"}},
+		"afterFiles":  []interface{}{map[string]interface{}{"source": "/c", "destination": "/d"}},
+		"beforeFiles": []interface{}{map[string]interface{}{"source": "/a", "destination": "/b"}},
+	})
+	var got []string
+	for _, r := range phased {
+		got = append(got, r.Source+" "+r.Phase)
+	}
+	want := []string{"/a beforeFiles", "/c afterFiles", "/f fallback"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("phases = %v, want %v", got, want)
+	}
+}
@@ -1,6 +1,7 @@
 package nextcore
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"github.com/aynaash/nextdeploy/shared"
 	"github.com/aynaash/nextdeploy/shared/config"
 	"github.com/aynaash/nextdeploy/shared/git"
+	"github.com/aynaash/nextdeploy/shared/nextbuild"
 )
 
 const (
@@ -27,16 +29,33 @@ var (
 	NextCoreLogger = shared.PackageLogger("nextcore", "📦 NEXTCORE")
 )
 
+// MetadataOpts adjusts how GenerateMetadataWith runs the build.
+type MetadataOpts struct {
+	// ProjectDir is the Next.js app to build; empty means the working
+	// directory. Its nextdeploy.yml is used and .nextdeploy/ is written there.
+	ProjectDir string
+	// Containerized runs the build in a Node container (see
+	// nextbuild.ContainerCommand) instead of on the host.
+	Containerized bool
+	// NoBuild reads the manifests of an existing .next instead of building,
+	// and fails with ErrNoBuild when there is none.
+	NoBuild bool
+}
+
 func GenerateMetadata() (metadata NextCorePayload, err error) {
-	cfg, err := config.Load()
+	return GenerateMetadataWith(MetadataOpts{})
+}
+
+func GenerateMetadataWith(opts MetadataOpts) (metadata NextCorePayload, err error) {
+	cwd, err := resolveProjectDir(opts.ProjectDir)
 	if err != nil {
-		NextCoreLogger.Error("Failed to load configuration: %v", err)
+		NextCoreLogger.Error("Error resolving project directory: %v", err)
 		return NextCorePayload{}, err
 	}
 
-	cwd, err := os.Getwd()
+	cfg, err := config.LoadFrom(filepath.Join(cwd, config.ConfigFile))
 	if err != nil {
-		NextCoreLogger.Error("Error getting current working directory")
+		NextCoreLogger.Error("Failed to load configuration: %v", err)
 		return NextCorePayload{}, err
 	}
 
@@ -46,26 +65,18 @@ func GenerateMetadata() (metadata NextCorePayload, err error) {
 	}
 	features := DetectFeatures(nextConfig)
 
-	packageManager, err := DetectPackageManager(cwd)
+	packageManager, err := ResolvePackageManager(cwd, cfg.App.PackageManager)
 	if err != nil {
 		NextCoreLogger.Error("Failed to detect package manager: %v", err)
 		return NextCorePayload{}, err
 	}
-	buildCmd, err := buildCommand(packageManager.String())
-	if err != nil {
-		NextCoreLogger.Error("Failed to get build command: %v", err)
-		return NextCorePayload{}, err
-	}
-
-	nextVersion, _ := GetNextJsVersion(filepath.Join(cwd, "package.json"))
-	buildCmd = MaybeInjectWebpackFlag(buildCmd, cwd, nextConfig, nextVersion, NextCoreLogger)
-
-	buildMeta, err := CollectBuildMetadata(buildCmd)
+	buildMeta, err := buildMetadata(cwd, cfg, nextConfig, packageManager.String(), opts)
 	if err != nil {
 		NextCoreLogger.Error("Failed to collect build metadata: %v", err)
 		return NextCorePayload{}, err
 	}
 	outputMode := detectOutputMode(cwd, nextConfig, features.DistDir)
+	warnPinnedStartPort(cfg, cwd, outputMode)
 
 	routeInfo, err := getRoutesFromManifests(buildMeta, features.DistDir)
 	if err != nil {
@@ -90,14 +101,26 @@ func GenerateMetadata() (metadata NextCorePayload, err error) {
 		return NextCorePayload{}, err
 	}
 
-	gitCommit, err := git.GetCommitHash()
+	gitCommit, err := git.CommitHashIn(cwd)
 	if err != nil {
 		NextCoreLogger.Error("Failed to get git commit hash: %v", err)
 		return NextCorePayload{}, err
 	}
 	NextCoreLogger.Debug("Git commit hash: %s", gitCommit)
 
-	if err := copyStaticAssets(); err != nil {
+	caddyDirectives, err := cfg.Caddy.Directives(cwd)
+	if err != nil {
+		NextCoreLogger.Error("Invalid caddy configuration: %v", err)
+		return NextCorePayload{}, err
+	}
+
+	maintenancePage, err := cfg.App.MaintenancePageHTML(cwd)
+	if err != nil {
+		NextCoreLogger.Error("Invalid maintenance page: %v", err)
+		return NextCorePayload{}, err
+	}
+
+	if err := copyStaticAssets(cwd); err != nil {
 		NextCoreLogger.Error("Failed to copy static assets: %v", err)
 		return NextCorePayload{}, fmt.Errorf("failed to copy static assets: %w", err)
 	}
@@ -105,10 +128,11 @@ func GenerateMetadata() (metadata NextCorePayload, err error) {
 	metadata = NextCorePayload{
 		AppName:           cfg.App.Name,
 		NextBuildMetadata: *buildMeta,
+		Router:            buildMeta.Router(),
 		Config: config.SafeConfig{
 			AppName:     cfg.App.Name,
 			Domain:      cfg.App.Domain.Name,
-			Port:        cfg.App.Port,
+			Port:        AppPort(cfg, cwd),
 			Environment: cfg.App.Environment,
 			TargetType:  cfg.ResolveTargetType(""),
 		},
@@ -121,12 +145,22 @@ func GenerateMetadata() (metadata NextCorePayload, err error) {
 		Middleware:       middlewareConfig,
 		StaticAssets:     staticAssets,
 		GitCommit:        gitCommit,
-		GitDirty:         git.IsDirty(),
+		GitDirty:         git.IsDirtyIn(cwd),
 		GeneratedAt:      time.Now().Format(time.RFC3339),
 		PackageManager:   packageManager.String(),
 		OutputMode:       outputMode,
 		ImageAssets:      *imagesAssets,
 		Resources:        cfg.App.Resources,
+		HealthPath:       cfg.App.HealthPath,
+		ReadinessTimeout: cfg.App.ReadinessTimeout,
+		Start:            cfg.App.Start,
+		Volumes:          cfg.App.Volumes,
+		Stop:             cfg.App.Stop,
+		Hooks:            cfg.App.Hooks,
+		CaddyDirectives:  caddyDirectives,
+		DomainAliases:    cfg.App.Domain.Aliases,
+		DomainRedirect:   cfg.App.Domain.Redirect,
+		MaintenancePage:  maintenancePage,
 	}
 
 	if len(metadata.RouteInfo.ISRDetail) > 0 {
@@ -138,14 +172,92 @@ func GenerateMetadata() (metadata NextCorePayload, err error) {
 		}
 	}
 
-	if err := createBuildLock(&metadata); err != nil {
+	if err := createBuildLock(cwd, &metadata); err != nil {
 		NextCoreLogger.Error("Failed to create build lock: %v", err)
 		return NextCorePayload{}, fmt.Errorf("failed to create build lock: %w", err)
 	}
 
+	if cfg.MetadataStore != nil {
+		// The build itself succeeded; a deploy from this host does not need
+		// the store, so an unreachable one must not fail it.
+		if err := publishMetadata(cfg.MetadataStore, &metadata); err != nil {
+			NextCoreLogger.Warn("%v; deploys from other hosts cannot look this build up by commit", err)
+		}
+	}
+
 	return metadata, nil
 }
 
+// buildMetadata builds projectDir as opts asks and reads the result, or with
+// opts.NoBuild only reads the existing build.
+func buildMetadata(projectDir string, cfg *config.NextDeployConfig, nextConfig *NextConfig, packageManager string, opts MetadataOpts) (*NextBuildMetadata, error) {
+	if opts.NoBuild {
+		NextCoreLogger.Info("Reading the existing build in %s (no build)", filepath.Join(projectDir, ".next"))
+		if err := os.MkdirAll(filepath.Join(projectDir, ".nextdeploy"), 0750); err != nil {
+			return nil, fmt.Errorf("failed to create .nextdeploy directory: %w", err)
+		}
+		return ReadBuildMetadata(projectDir)
+	}
+
+	buildCmd, err := buildCommand(packageManager)
+	if err != nil {
+		return nil, err
+	}
+	nextVersion, _ := GetNextJsVersion(filepath.Join(projectDir, "package.json"))
+	buildCmd = MaybeInjectWebpackFlag(buildCmd, projectDir, nextConfig, nextVersion, NextCoreLogger)
+	if opts.Containerized {
+		image := nextbuild.BuildImage(projectDir, packageManager, cfg.App.BuildImage)
+		if err := loginBuildRegistry(cfg, image); err != nil {
+			return nil, err
+		}
+		NextCoreLogger.Info("Building in container %s", image)
+		buildCmd, err = nextbuild.ContainerCommand(image, projectDir, cfg.App.Name, packageManager, buildCmd, os.Getuid(), os.Getgid())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return CollectBuildMetadata(projectDir, buildCmd)
+}
+
+// loginBuildRegistry logs docker into the registry of a private build
+// image with the docker.username/password of nextdeploy.yml, when
+// docker.registry names that registry. Public images need no login, and
+// without matching credentials docker uses whatever login the host already
+// has.
+func loginBuildRegistry(cfg *config.NextDeployConfig, image string) error {
+	registry := nextbuild.ImageRegistry(image)
+	if registry == "" {
+		return nil
+	}
+	d := cfg.Docker
+	if d == nil || d.Username == "" || d.Password == "" || nextbuild.RegistryHost(d.Registry) != strings.ToLower(registry) {
+		NextCoreLogger.Info("Build image %s is on %s; using the host's docker login for it", image, registry)
+		return nil
+	}
+	NextCoreLogger.Info("Logging in to %s as %s to pull the build image", registry, d.Username)
+	return nextbuild.RegistryLogin(registry, d.Username, d.Password)
+}
+
+// resolveProjectDir makes dir absolute, defaulting to the working directory,
+// so every step of a build reads and writes the same project.
+func resolveProjectDir(dir string) (string, error) {
+	if dir == "" {
+		return os.Getwd()
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("project dir %s is not a directory", abs)
+	}
+	return abs, nil
+}
+
 func LoadMetadata() (NextCorePayload, error) {
 	data, err := os.ReadFile(MetadataFileName)
 	if err != nil {
@@ -160,9 +272,9 @@ func LoadMetadata() (NextCorePayload, error) {
 	return metadata, nil
 }
 
-func copyStaticAssets() error {
-	srcDir := "public"
-	dstDir := filepath.Join(".nextdeploy", "assets")
+func copyStaticAssets(projectDir string) error {
+	srcDir := filepath.Join(projectDir, PublicDir)
+	dstDir := filepath.Join(projectDir, AssetsOutputDir)
 
 	// Create destination directory
 	if err := os.MkdirAll(dstDir, 0750); err != nil {
@@ -226,13 +338,13 @@ func copyFile(src, dst string) error {
 
 // createBuildLock writes the metadata payload and a build.lock using the git
 // state already captured on the payload.
-func createBuildLock(metadata *NextCorePayload) error {
+func createBuildLock(projectDir string, metadata *NextCorePayload) error {
 	payloadData, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		NextCoreLogger.Error("Failed to marshal metadata: %v", err)
 		return err
 	}
-	if err := os.WriteFile(MetadataFileName, payloadData, 0600); err != nil {
+	if err := os.WriteFile(filepath.Join(projectDir, MetadataFileName), payloadData, 0600); err != nil {
 		NextCoreLogger.Error("Failed to write metadata json: %v", err)
 		return err
 	}
@@ -247,12 +359,38 @@ func createBuildLock(metadata *NextCorePayload) error {
 		NextCoreLogger.Error("Failed to marshal build lock: %v", err)
 		return err
 	}
-	return os.WriteFile(BuildLockFileName, lockData, 0600)
+	return os.WriteFile(filepath.Join(projectDir, BuildLockFileName), lockData, 0600)
+}
+
+// publishMetadata pushes the build's metadata to the configured store. A
+// dirty or git-less build is built and kept locally but not published, since
+// no commit identifies it.
+func publishMetadata(storeCfg *config.MetadataStoreConfig, metadata *NextCorePayload) error {
+	if metadata.GitCommit == "" || metadata.GitDirty {
+		NextCoreLogger.Warn("Not publishing metadata: the build is not from a clean git commit")
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	store, err := NewMetadataStore(ctx, storeCfg)
+	if err != nil {
+		return err
+	}
+	if err := PublishMetadata(ctx, store, metadata); err != nil {
+		return fmt.Errorf("failed to publish metadata: %w", err)
+	}
+	NextCoreLogger.Info("Published metadata for commit %s", metadata.GitCommit)
+	return nil
 }
 
 // ValidateBuildState checks if the current git state matches the build lock.
 func ValidateBuildState() error {
-	lockPath := filepath.Join(".nextdeploy", "build.lock")
+	return ValidateBuildStateIn(".")
+}
+
+// ValidateBuildStateIn is ValidateBuildState for the project in dir.
+func ValidateBuildStateIn(dir string) error {
+	lockPath := filepath.Join(dir, ".nextdeploy", "build.lock")
 	// #nosec G304
 	data, err := os.ReadFile(lockPath)
 	if err != nil {
@@ -266,7 +404,7 @@ func ValidateBuildState() error {
 		return fmt.Errorf("failed to parse build lock: %w", err)
 	}
 
-	currentCommit, err := git.GetCommitHash()
+	currentCommit, err := git.CommitHashIn(dir)
 	if err != nil {
 		NextCoreLogger.Error("Failed to get current git commit: %v", err)
 		return fmt.Errorf("failed to get current git commit: %w", err)
@@ -277,7 +415,7 @@ func ValidateBuildState() error {
 		return fmt.Errorf("git commit mismatch: expected %s, got %s", lock.GitCommit, currentCommit)
 	}
 
-	if git.IsDirty() && !lock.GitDirty {
+	if git.IsDirtyIn(dir) && !lock.GitDirty {
 		return errors.New("working directory is dirty but build lock expects clean state")
 	}
 
@@ -0,0 +1,334 @@
+package nextcore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+)
+
+// TestProjectDirOutsideWorkingDir builds a fixture project from another
+// working directory: everything must be read from and written to the
+// project, nothing to the working directory.
+func TestProjectDirOutsideWorkingDir(t *testing.T) {
+	project := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(project, "public", "img"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "public", "img", "logo.svg"), []byte("<svg/>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	elsewhere := t.TempDir()
+	t.Chdir(elsewhere)
+
+	dir, err := resolveProjectDir(project)
+	if err != nil || dir != project {
+		t.Fatalf("resolveProjectDir(%q) = %q, %v", project, dir, err)
+	}
+
+	build := `mkdir -p .next && printf fixture-build > .next/BUILD_ID && echo '{"staticRoutes":[{"page":"/"}]}' > .next/routes-manifest.json`
+	meta, err := CollectBuildMetadata(project, build)
+	if err != nil {
+		t.Fatalf("CollectBuildMetadata: %v", err)
+	}
+	if meta.BuildID != "fixture-build" || meta.RoutesManifest == nil {
+		t.Errorf("got BuildID %q, RoutesManifest %v", meta.BuildID, meta.RoutesManifest)
+	}
+
+	if err := copyStaticAssets(project); err != nil {
+		t.Fatalf("copyStaticAssets: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(project, AssetsOutputDir, "img", "logo.svg")); err != nil {
+		t.Errorf("asset not copied into the project: %v", err)
+	}
+
+	if err := createBuildLock(project, &NextCorePayload{AppName: "fixture", GitCommit: "abc1234"}); err != nil {
+		t.Fatalf("createBuildLock: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(project, MetadataFileName))
+	if err != nil {
+		t.Fatalf("metadata not written into the project: %v", err)
+	}
+	var got NextCorePayload
+	if err := json.Unmarshal(data, &got); err != nil || got.AppName != "fixture" {
+		t.Errorf("metadata = %s, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(project, BuildLockFileName)); err != nil {
+		t.Errorf("build.lock not written into the project: %v", err)
+	}
+
+	if entries, _ := os.ReadDir(elsewhere); len(entries) != 0 {
+		t.Errorf("working directory was written to: %v", entries)
+	}
+}
+
+func TestResolveProjectDir(t *testing.T) {
+	wd, _ := os.Getwd()
+	if dir, err := resolveProjectDir(""); err != nil || dir != wd {
+		t.Errorf("empty dir = %q, %v; want the working directory", dir, err)
+	}
+	file := filepath.Join(t.TempDir(), "package.json")
+	if err := os.WriteFile(file, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveProjectDir(file); err == nil {
+		t.Error("a file is not a project dir")
+	}
+	if _, err := resolveProjectDir(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("a missing dir is not a project dir")
+	}
+}
+
+// TestGenerateMetadataNoBuild runs GenerateMetadataWith on a project that is
+// already built, with an npm on PATH that records being called.
+func TestGenerateMetadataNoBuild(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	project := t.TempDir()
+	files := map[string]string{
+		"nextdeploy.yml":    "app:\n  name: fixture\n",
+		"package.json":      `{"name":"fixture","scripts":{"build":"next build","start":"next start -p 4000"}}`,
+		"package-lock.json": "{}",
+		"public/robots.txt": "User-agent: *\n",
+		".next/BUILD_ID":    "prebuilt",
+		".gitignore":        ".next/\n.nextdeploy/\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(project, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-qm", "fixture"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = project
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	bin := t.TempDir()
+	marker := filepath.Join(bin, "npm-ran")
+	if err := os.WriteFile(filepath.Join(bin, "npm"), []byte("#!/bin/sh\ntouch "+marker+"\nexit 1\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	meta, err := GenerateMetadataWith(MetadataOpts{ProjectDir: project, NoBuild: true})
+	if err != nil {
+		t.Fatalf("GenerateMetadataWith: %v", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the build ran in no-build mode")
+	}
+	if meta.NextBuildMetadata.BuildID != "prebuilt" || meta.AppName != "fixture" || meta.GitCommit == "" {
+		t.Errorf("got BuildID %q, AppName %q, GitCommit %q", meta.NextBuildMetadata.BuildID, meta.AppName, meta.GitCommit)
+	}
+	if meta.Config.Port != 4000 {
+		t.Errorf("Config.Port = %d, want 4000 from the start script", meta.Config.Port)
+	}
+
+	if err := os.RemoveAll(filepath.Join(project, ".next")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateMetadataWith(MetadataOpts{ProjectDir: project, NoBuild: true}); !errors.Is(err, ErrNoBuild) {
+		t.Errorf("without .next: got %v, want ErrNoBuild", err)
+	}
+}
+
+func TestReadBuildMetadataDetectsRouter(t *testing.T) {
+	internalPages := `{"/_app":"pages/_app.js","/_document":"pages/_document.js","/_error":"pages/_error.js"}`
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "app router",
+			files: map[string]string{
+				"app/page.tsx":                     "",
+				".next/server/pages-manifest.json": internalPages,
+			},
+			want: "app",
+		},
+		{
+			name:  "app router from build output only",
+			files: map[string]string{".next/app-path-routes-manifest.json": `{"/page":"/"}`},
+			want:  "app",
+		},
+		{
+			name: "pages router",
+			files: map[string]string{
+				"pages/index.tsx":                  "",
+				".next/server/pages-manifest.json": `{"/":"pages/index.js","/_app":"pages/_app.js"}`,
+			},
+			want: "pages",
+		},
+		{
+			name: "pages router from build output only",
+			files: map[string]string{
+				".next/server/pages-manifest.json": `{"/about":"pages/about.html"}`,
+			},
+			want: "pages",
+		},
+		{
+			name: "hybrid under src",
+			files: map[string]string{
+				"src/app/page.tsx":           "",
+				"src/pages/old.tsx":          "",
+				".next/routes-manifest.json": `{}`,
+			},
+			want: "hybrid",
+		},
+		{
+			name:  "nothing detected",
+			files: map[string]string{".next/server/pages-manifest.json": internalPages},
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := t.TempDir()
+			tt.files[".next/BUILD_ID"] = "fixture"
+			for name, content := range tt.files {
+				path := filepath.Join(project, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			meta, err := ReadBuildMetadata(project)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := meta.Router(); got != tt.want {
+				t.Errorf("Router() = %q (app %v, pages %v), want %q", got, meta.HasAppRouter, meta.HasPagesRouter, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectPackageManagerAmbiguousLockfiles(t *testing.T) {
+	for _, env := range []string{"BUN_INSTALL", "PNPM_HOME", "YARN_VERSION"} {
+		t.Setenv(env, "")
+	}
+	project := func(files ...string) string {
+		dir := t.TempDir()
+		for _, f := range append(files, "package.json") {
+			if err := os.WriteFile(filepath.Join(dir, f), []byte("{}"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+
+	both := project("package-lock.json", "yarn.lock")
+	_, err := DetectPackageManager(both)
+	var ambiguous *AmbiguousLockfilesError
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("package-lock.json + yarn.lock: want *AmbiguousLockfilesError, got %v", err)
+	}
+	if want := []string{"package-lock.json", "yarn.lock"}; !slices.Equal(ambiguous.Lockfiles, want) {
+		t.Errorf("Lockfiles = %v, want %v", ambiguous.Lockfiles, want)
+	}
+
+	if pm, err := ResolvePackageManager(both, "yarn"); err != nil || pm != Yarn {
+		t.Errorf("app.package_manager should settle it: got %s, %v", pm, err)
+	}
+	if _, err := ResolvePackageManager(both, "deno"); err == nil {
+		t.Error("an unknown app.package_manager should be refused")
+	}
+
+	for _, files := range [][]string{{"pnpm-lock.yaml"}, {"bun.lock", "bun.lockb"}} {
+		if _, err := DetectPackageManager(project(files...)); err != nil {
+			t.Errorf("%v: %v", files, err)
+		}
+	}
+}
+
+// TestLoginBuildRegistry checks that a build image on a private registry
+// triggers a docker login with the configured credentials, and a public one
+// does not. A stub docker records what it was asked to do.
+func TestLoginBuildRegistry(t *testing.T) {
+	bin := t.TempDir()
+	record := filepath.Join(bin, "calls")
+	stub := "#!/bin/sh\necho \"$@\" >> " + record + "\ncat >> " + record + "\necho >> " + record + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(stub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cfg := &config.NextDeployConfig{Docker: &config.DockerConfig{Registry: "https://ghcr.io/acme", Username: "ci", Password: "s3cret"}}
+	for _, image := range []string{"node:22-bookworm", "acme/node:22", "quay.io/acme/node:22"} {
+		if err := loginBuildRegistry(cfg, image); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(record); !os.IsNotExist(err) {
+		t.Fatalf("docker was invoked for a public image or another registry")
+	}
+
+	if err := loginBuildRegistry(cfg, "ghcr.io/acme/node:22"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "login ghcr.io --username ci --password-stdin\ns3cret\n"; string(got) != want {
+		t.Errorf("docker got %q, want %q", got, want)
+	}
+}
+
+func TestStartScriptPort(t *testing.T) {
+	tests := []struct {
+		script string
+		want   int
+	}{
+		{"next start -p 4000", 4000},
+		{"next start --port 4001", 4001},
+		{"next start --port=4002 -H 0.0.0.0", 4002},
+		{"PORT=4003 next start", 4003},
+		{"next start", 0},
+		{"next start -H 0.0.0.0", 0},
+		{"node server.js -p 4000", 0},
+		{"next start -p 99999", 0},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		pkg, _ := json.Marshal(map[string]any{"scripts": map[string]string{"start": tt.script}})
+		if err := os.WriteFile(filepath.Join(dir, "package.json"), pkg, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if got := StartScriptPort(dir); got != tt.want {
+			t.Errorf("StartScriptPort(%q) = %d, want %d", tt.script, got, tt.want)
+		}
+		cfg := &config.NextDeployConfig{}
+		want := tt.want
+		if want == 0 {
+			want = DefaultAppPort
+		}
+		if got := AppPort(cfg, dir); got != want {
+			t.Errorf("AppPort(%q) = %d, want %d", tt.script, got, want)
+		}
+		cfg.App.Port = 8080
+		if got := AppPort(cfg, dir); got != 8080 {
+			t.Errorf("AppPort with app.port = %d, want 8080", got)
+		}
+	}
+}
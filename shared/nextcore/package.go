@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/aynaash/nextdeploy/shared"
+	"github.com/aynaash/nextdeploy/shared/config"
 )
 
 type PackageManager string
@@ -29,6 +31,63 @@ func (pm PackageManager) String() string {
 	return string(pm)
 }
 
+// lockfiles maps each lockfile to the package manager that writes it.
+var lockfiles = map[string]PackageManager{
+	"pnpm-lock.yaml":    PNPM,
+	"yarn.lock":         Yarn,
+	"package-lock.json": NPM,
+	"bun.lockb":         BUN,
+	"bun.lock":          BUN,
+}
+
+// AmbiguousLockfilesError reports lockfiles of more than one package manager
+// in a project, where detection would otherwise come down to a guess.
+type AmbiguousLockfilesError struct {
+	// Lockfiles are the lockfiles found, sorted.
+	Lockfiles []string
+}
+
+func (e *AmbiguousLockfilesError) Error() string {
+	return fmt.Sprintf("found lockfiles of different package managers (%s): remove the stray one, or set app.package_manager in %s",
+		strings.Join(e.Lockfiles, ", "), config.ConfigFile)
+}
+
+// ResolvePackageManager is the package manager to build and run the project
+// with: override (app.package_manager) when set, detected otherwise.
+func ResolvePackageManager(projectPath, override string) (PackageManager, error) {
+	if override != "" {
+		switch pm := PackageManager(override); pm {
+		case NPM, Yarn, PNPM, BUN:
+			plog.Debug("Using package manager %s from app.package_manager", pm)
+			return pm, nil
+		}
+		return Unknown, fmt.Errorf("app.package_manager %q invalid: want npm, yarn, pnpm or bun", override)
+	}
+	return DetectPackageManager(projectPath)
+}
+
+// checkLockfiles returns an *AmbiguousLockfilesError when projectPath holds
+// lockfiles of more than one package manager (bun.lock next to bun.lockb is
+// fine).
+func checkLockfiles(projectPath string) error {
+	var found []string
+	managers := map[PackageManager]bool{}
+	for name, pm := range lockfiles {
+		if _, err := os.Stat(filepath.Join(projectPath, name)); err == nil {
+			found = append(found, name)
+			managers[pm] = true
+		}
+	}
+	if len(managers) < 2 {
+		return nil
+	}
+	sort.Strings(found)
+	return &AmbiguousLockfilesError{Lockfiles: found}
+}
+
+// DetectPackageManager picks the project's package manager from its
+// lockfiles and other hints. When lockfiles of several managers are present
+// it still returns its best guess, with an *AmbiguousLockfilesError.
 func DetectPackageManager(projectPath string) (PackageManager, error) {
 	plog.Debug("Detecting package manager in %s", projectPath)
 
@@ -121,6 +180,10 @@ func DetectPackageManager(projectPath string) (PackageManager, error) {
 		return NPM, nil
 	}
 
+	if err := checkLockfiles(projectPath); err != nil {
+		plog.Warn("%v; guessing %s", err, result)
+		return result, err
+	}
 	plog.Info("Detected package manager: %s", result)
 	return result, nil
 }
@@ -0,0 +1,65 @@
+package nextcore
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+)
+
+// DefaultAppPort is the port `next start` listens on without -p or PORT.
+const DefaultAppPort = 3000
+
+var (
+	startPortFlag = regexp.MustCompile(`(?:^|\s)(?:-p|--port)(?:=|\s+)(\d{1,5})(?:\s|$)`)
+	startPortEnv  = regexp.MustCompile(`(?:^|\s)PORT=(\d{1,5})\s`)
+)
+
+// StartScriptPort returns the port package.json's start script pins for
+// `next start`, as in "next start -p 4000", "next start --port=4000" or
+// "PORT=4000 next start", or 0 when it pins none.
+func StartScriptPort(projectDir string) int {
+	pkg, err := readPackageJSON(projectDir)
+	if err != nil || pkg == nil {
+		return 0
+	}
+	script := pkg.Scripts["start"]
+	if !strings.Contains(script, "next start") {
+		return 0
+	}
+	for _, re := range []*regexp.Regexp{startPortFlag, startPortEnv} {
+		if m := re.FindStringSubmatch(script); m != nil {
+			if port, err := strconv.Atoi(m[1]); err == nil && port > 0 && port < 65536 {
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// AppPort is the port the app listens on when run by its own start
+// command: app.port, else the port its start script pins, else
+// DefaultAppPort.
+func AppPort(cfg *config.NextDeployConfig, projectDir string) int {
+	if cfg.App.Port != 0 {
+		return cfg.App.Port
+	}
+	if port := StartScriptPort(projectDir); port != 0 {
+		return port
+	}
+	return DefaultAppPort
+}
+
+// warnPinnedStartPort warns when the daemon would run a start script that
+// pins its port. The daemon gives each release its own PORT so the new one
+// can start next to the old; a release that ignores PORT fails readiness,
+// and two releases cannot share the pinned port.
+func warnPinnedStartPort(cfg *config.NextDeployConfig, projectDir string, mode OutputMode) {
+	if mode != OutputModeDefault || cfg.App.Start != nil {
+		return
+	}
+	if port := StartScriptPort(projectDir); port != 0 {
+		NextCoreLogger.Warn("package.json's start script pins port %d, but on a VPS nextdeployd assigns each release its own PORT; drop -p/--port (next start reads PORT) or set app.start", port)
+	}
+}
@@ -30,6 +30,8 @@ type NextCorePayload struct {
 	ExportDir         string            `json:"export_dir"`
 	OutputMode        OutputMode        `json:"output_mode"`
 	PackageManager    string            `json:"package_manager"`
+	// Router is the detected Next.js router: app, pages or hybrid.
+	Router string `json:"router,omitempty"`
 	// Resources carries the opt-in cgroup limits from nextdeploy.yml through to
 	// the daemon's systemd unit generator. Nil means "no limits" (the default).
 	Resources *config.ResourceLimits `json:"resources,omitempty"`
@@ -37,6 +39,29 @@ type NextCorePayload struct {
 	// release. Empty means "/". A release that binds its port but returns >=500
 	// on this path fails activation, so the old release stays live.
 	HealthPath string `json:"health_path,omitempty"`
+	// ReadinessTimeout is how long the daemon waits for HealthPath to pass
+	// before abandoning the release, as a Go duration. Empty means 5m.
+	ReadinessTimeout string `json:"readiness_timeout,omitempty"`
+	// Start overrides the daemon's default start command for the release's
+	// systemd unit. Nil means node server.js / <pm> start.
+	Start *config.StartCommand `json:"start,omitempty"`
+	// Volumes are the named volumes and bind mounts the release's unit gets.
+	Volumes []config.Volume `json:"volumes,omitempty"`
+	// Stop is the release's stop signal and grace period (nil: SIGTERM, 10s).
+	Stop *config.StopPolicy `json:"stop,omitempty"`
+	// Hooks are app.hooks: commands the daemon runs in the release around a
+	// deploy or rollback.
+	Hooks *config.DeployHooks `json:"hooks,omitempty"`
+	// CaddyDirectives is the user's caddy.extra_directives / caddy.snippet,
+	// appended to the generated site block.
+	CaddyDirectives string `json:"caddy_directives,omitempty"`
+	// DomainAliases and DomainRedirect mirror app.domain.aliases/redirect:
+	// extra hostnames for the site and the canonical apex/www form.
+	DomainAliases  []string `json:"domain_aliases,omitempty"`
+	DomainRedirect string   `json:"domain_redirect,omitempty"`
+	// MaintenancePage is the HTML of app.maintenance_page, served while the
+	// app is in maintenance mode. Empty means the daemon's built-in page.
+	MaintenancePage string `json:"maintenance_page,omitempty"`
 }
 
 type BuildLock struct {
@@ -100,9 +125,9 @@ type NextConfig struct {
 	GenerateBuildId            interface{}            `json:"generateBuildId,omitempty"`
 	OnDemandEntries            map[string]interface{} `json:"onDemandEntries,omitempty"`
 	CompileOptions             map[string]interface{} `json:"compileOptions,omitempty"`
-	Headers                    []interface{}          `json:"headers,omitempty"`
-	Redirects                  []interface{}          `json:"redirects,omitempty"`
-	Rewrites                   []interface{}          `json:"rewrites,omitempty"`
+	Headers                    []HeaderRule           `json:"headers,omitempty"`
+	Redirects                  []RedirectRule         `json:"redirects,omitempty"`
+	Rewrites                   []RewriteRule          `json:"rewrites,omitempty"`
 	SkipMiddlewareUrlNormalize bool                   `json:"skipMiddlewareUrlNormalize,omitempty"`
 	SkipTrailingSlashRedirect  bool                   `json:"skipTrailingSlashRedirect,omitempty"`
 	Env                        map[string]string      `json:"env,omitempty"`
@@ -136,7 +161,7 @@ type ExperimentalConfig struct {
 	DeploymentId                      string                 `json:"deploymentId,omitempty"`
 	ServerComponents                  bool                   `json:"serverComponents,omitempty"`
 	ServerActions                     bool                   `json:"serverActions,omitempty"`
-	ServerActionsBodySizeLimit        int                    `json:"serverActionsBodySizeLimit,omitempty"`
+	ServerActionsBodySizeLimit        int64                  `json:"serverActionsBodySizeLimit,omitempty"` // bytes
 	OptimizeCss                       bool                   `json:"optimizeCss,omitempty"`
 	OptimisticClientCache             bool                   `json:"optimisticClientCache,omitempty"`
 	ClientRouterFilter                bool                   `json:"clientRouterFilter,omitempty"`
@@ -164,6 +189,53 @@ type ExperimentalConfig struct {
 	InstrumentationHook               string                 `json:"instrumentationHook,omitempty"`
 }
 
+// HeaderRule is one entry returned by next.config headers().
+type HeaderRule struct {
+	Source  string        `json:"source"`
+	Headers []RouteHeader `json:"headers"`
+	// BasePath is false when the rule opts out of the configured basePath.
+	BasePath *bool `json:"basePath,omitempty"`
+	// Conditional is set when the rule has has/missing conditions, which
+	// only the Next.js server can evaluate.
+	Conditional bool `json:"conditional,omitempty"`
+}
+
+type RouteHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// RedirectRule is one entry returned by next.config redirects().
+type RedirectRule struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Permanent   bool   `json:"permanent,omitempty"`
+	StatusCode  int    `json:"statusCode,omitempty"`
+	BasePath    *bool  `json:"basePath,omitempty"`
+	Conditional bool   `json:"conditional,omitempty"`
+}
+
+// RewriteRule is one entry returned by next.config rewrites(). The
+// beforeFiles/afterFiles/fallback phases are flattened in that order, each
+// rule keeping its Phase.
+type RewriteRule struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	BasePath    *bool  `json:"basePath,omitempty"`
+	Conditional bool   `json:"conditional,omitempty"`
+	// Phase is when Next.js applies the rewrite: RewriteBeforeFiles before
+	// the filesystem and pages are checked, RewriteAfterFiles and
+	// RewriteFallback only when they miss. A plain array is afterFiles.
+	Phase string `json:"phase,omitempty"`
+}
+
+// Rewrite phases of next.config rewrites().
+const (
+	RewriteBeforeFiles = "beforeFiles"
+	RewriteAfterFiles  = "afterFiles"
+	RewriteFallback    = "fallback"
+)
+
 type ImageConfig struct {
 	Domains               []string             `json:"domains,omitempty"`
 	Formats               []string             `json:"formats,omitempty"`
@@ -238,4 +310,19 @@ type NextBuildMetadata struct {
 	ReactLoadableManifest interface{} `json:"reactLoadableManifest"`
 	Diagnostics           []string    `json:"diagnostics"`
 	HasAppRouter          bool        `json:"hasAppRouter"`
+	HasPagesRouter        bool        `json:"hasPagesRouter"`
+}
+
+// Router names the router the build uses: "app", "pages", "hybrid" for
+// both, or "" when neither was detected.
+func (m NextBuildMetadata) Router() string {
+	switch {
+	case m.HasAppRouter && m.HasPagesRouter:
+		return "hybrid"
+	case m.HasAppRouter:
+		return "app"
+	case m.HasPagesRouter:
+		return "pages"
+	}
+	return ""
 }
@@ -19,4 +19,6 @@ var (
 	ErrInvalidProvider       = errors.New("invalid secret provider")
 	ErrProviderNotConfigured = errors.New("provider not configured")
 	ErrConfigNotFound        = errors.New("configuration not found")
+	ErrMasterKeyExists       = errors.New("a different master key already exists")
+	ErrInvalidMasterKey      = errors.New("invalid master key")
 )
@@ -8,9 +8,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/aynaash/nextdeploy/shared/config"
 	"golang.org/x/crypto/pbkdf2"
+	"gopkg.in/yaml.v3"
 )
 
 // Encrypted file layout: salt(16) || nonce(12) || AES-256-GCM ciphertext.
@@ -70,7 +73,32 @@ func (sm *SecretManager) encryptToFile(inputPath, outputPath, password string) e
 	if err != nil {
 		return fmt.Errorf("read %s: %w", inputPath, err)
 	}
+	if err := encryptBytes(plaintext, outputPath, password); err != nil {
+		return err
+	}
+	SLogs.Info("Successfully encrypted file %s to %s", inputPath, outputPath)
+	return nil
+}
+
+// EncryptWithPlatformKey encrypts plaintext with this app's master key and
+// writes it to filename, the inverse of DecryptWithPlatformKey. It lets a
+// command edit an encrypted file in memory without a plaintext copy on disk.
+func (sm *SecretManager) EncryptWithPlatformKey(plaintext []byte, filename string) error {
+	if !strings.HasSuffix(filename, ".enc") {
+		return fmt.Errorf("file %s is not an encrypted file", filename)
+	}
+	key, err := sm.GeneratePlatformKey()
+	if err != nil {
+		return fmt.Errorf("load master key: %w", err)
+	}
+	if err := encryptBytes(plaintext, filename, key); err != nil {
+		return err
+	}
+	SLogs.Info("Successfully encrypted %s", filename)
+	return nil
+}
 
+func encryptBytes(plaintext []byte, outputPath, password string) error {
 	salt := make([]byte, encSaltLen)
 	if _, err := rand.Read(salt); err != nil {
 		return fmt.Errorf("generate salt: %w", err)
@@ -94,8 +122,6 @@ func (sm *SecretManager) encryptToFile(inputPath, outputPath, password string) e
 	if err := os.WriteFile(outputPath, out, 0600); err != nil {
 		return fmt.Errorf("failed to write encrypted file: %w", err)
 	}
-
-	SLogs.Info("Successfully encrypted file %s to %s", inputPath, outputPath)
 	return nil
 }
 
@@ -133,6 +159,66 @@ func (sm *SecretManager) DecryptFile(filename string, key []byte) (string, error
 	return string(plaintext), nil
 }
 
+// DecryptWithPlatformKey decrypts a .enc file with this app's master key, the
+// same key `nextdeploy secrets encrypt` uses. Its signature fits the decrypt
+// hook of config.ResolveEnv.
+func (sm *SecretManager) DecryptWithPlatformKey(filename string) (string, error) {
+	key, err := sm.GeneratePlatformKey()
+	if err != nil {
+		return "", fmt.Errorf("load master key: %w", err)
+	}
+	plain, err := sm.DecryptFile(filename, []byte(key))
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateDecrypted(strings.TrimSuffix(filename, ".enc"), plain); err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+var dotenvKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// ValidateDecrypted sanity-checks plaintext recovered from name.enc before it
+// is written to disk or used: a YAML config must parse as a NextDeployConfig
+// and a dotenv file must consist of KEY=VALUE lines, where a quoted value may
+// span lines (a PEM key in double quotes, say). It catches a truncated
+// file or a wrong-but-accepted key here instead of in whatever reads the file
+// later. Other file types pass through unchecked.
+func ValidateDecrypted(name, plaintext string) error {
+	base := filepath.Base(name)
+	switch {
+	case strings.HasSuffix(base, ".yml") || strings.HasSuffix(base, ".yaml"):
+		var cfg config.NextDeployConfig
+		if err := yaml.Unmarshal([]byte(plaintext), &cfg); err != nil {
+			return fmt.Errorf("%w: decrypted %s is not valid YAML: %w", ErrInvalidSecretFormat, base, err)
+		}
+	case base == ".env" || strings.HasPrefix(base, ".env.") || strings.HasSuffix(base, ".env"):
+		lines := strings.Split(plaintext, "\n")
+		for i := 0; i < len(lines); i++ {
+			line := strings.TrimSpace(lines[i])
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+			if !ok || !dotenvKey.MatchString(strings.TrimSpace(key)) {
+				return fmt.Errorf("%w: decrypted %s line %d is not KEY=VALUE", ErrInvalidSecretFormat, base, i+1)
+			}
+			value = strings.TrimSpace(value)
+			if value == "" || (value[0] != '"' && value[0] != '\'') || config.DotenvQuoteEnd(value[1:], value[0]) >= 0 {
+				continue
+			}
+			start := i
+			for i++; i < len(lines) && config.DotenvQuoteEnd(lines[i], value[0]) < 0; i++ {
+			}
+			if i == len(lines) {
+				return fmt.Errorf("%w: decrypted %s line %d opens a quoted value that is never closed", ErrInvalidSecretFormat, base, start+1)
+			}
+		}
+	}
+	return nil
+}
+
 // newGCM derives a 32-byte key from password+salt via PBKDF2-SHA256 and returns
 // an AES-256-GCM AEAD.
 func newGCM(password string, salt []byte) (cipher.AEAD, error) {
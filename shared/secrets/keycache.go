@@ -0,0 +1,96 @@
+package secrets
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultKeyCacheSize and defaultKeyCacheTTL bound how many derived keys
+	// a SecretManager holds and for how long.
+	defaultKeyCacheSize = 64
+	defaultKeyCacheTTL  = 10 * time.Minute
+)
+
+// keyCache is a size- and age-bounded LRU of derived keys. It has its own
+// lock because its callers already hold SecretManager.mu. Evicted and
+// expired keys are zeroed so key material does not linger until the next GC.
+type keyCache struct {
+	mu      sync.Mutex
+	max     int
+	ttl     time.Duration
+	now     func() time.Time
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type keyCacheEntry struct {
+	name    string
+	key     []byte
+	expires time.Time
+}
+
+func newKeyCache(max int, ttl time.Duration) *keyCache {
+	if max <= 0 {
+		max = defaultKeyCacheSize
+	}
+	if ttl <= 0 {
+		ttl = defaultKeyCacheTTL
+	}
+	return &keyCache{max: max, ttl: ttl, now: time.Now, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns a copy of the key cached for name, if it has not expired.
+func (c *keyCache) get(name string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*keyCacheEntry)
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return append([]byte(nil), e.key...), true
+}
+
+// put caches a copy of key for name, evicting the least recently used keys
+// beyond the size limit.
+func (c *keyCache) put(name string, key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[name]; ok {
+		c.remove(el)
+	}
+	e := &keyCacheEntry{name: name, key: append([]byte(nil), key...), expires: c.now().Add(c.ttl)}
+	c.entries[name] = c.order.PushFront(e)
+	for c.order.Len() > c.max {
+		c.remove(c.order.Back())
+	}
+}
+
+// clear drops every key, e.g. after the master key changes.
+func (c *keyCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *keyCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// remove drops el and zeroes its key. Callers hold c.mu.
+func (c *keyCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*keyCacheEntry)
+	clear(e.key)
+	delete(c.entries, e.name)
+}
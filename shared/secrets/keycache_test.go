@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyCacheEviction(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newKeyCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	a := []byte("key-a")
+	c.put("a", a)
+	c.put("b", []byte("key-b"))
+	if _, ok := c.get("a"); !ok { // a is now most recently used
+		t.Fatal("a missing")
+	}
+	c.put("c", []byte("key-c"))
+	if _, ok := c.get("b"); ok {
+		t.Error("b should have been evicted as least recently used")
+	}
+	if c.len() != 2 {
+		t.Errorf("len = %d, want 2", c.len())
+	}
+	if string(a) != "key-a" {
+		t.Error("cache modified the caller's slice")
+	}
+
+	got, _ := c.get("a")
+	got[0] = 'X'
+	if again, _ := c.get("a"); string(again) != "key-a" {
+		t.Errorf("get returned the cached slice itself: now %q", again)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.get("c"); ok {
+		t.Error("c should have expired")
+	}
+	c.clear()
+	if c.len() != 0 {
+		t.Errorf("len after clear = %d", c.len())
+	}
+}
+
+func TestGetCachedKeyConcurrent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("master key lives in the Windows keyring")
+	}
+	t.Setenv("HOME", t.TempDir())
+	sm := newTestSecretManager(t, "shop")
+	WithKeyCache(8, time.Minute)(sm)
+	want, err := sm.GeneratePlatformKey() // create the master key up front
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				key, err := sm.getCachedKey(fmt.Sprintf("SECRET_%d", (g*50+i)%20))
+				if err != nil || key != want {
+					t.Errorf("getCachedKey = %q, %v", key, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := sm.keyCache.len(); n > 8 {
+		t.Errorf("cache holds %d keys, cap is 8", n)
+	}
+}
@@ -1,6 +1,7 @@
 package secrets
 
 import (
+	"bytes"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -13,8 +14,10 @@ import (
 	"runtime"
 )
 
+// getCachedKey returns the key for name from the cache, deriving and caching
+// it on a miss. Safe for concurrent use.
 func (sm *SecretManager) getCachedKey(name string) (string, error) {
-	if key, exists := sm.keyCache[name]; exists {
+	if key, ok := sm.keyCache.get(name); ok {
 		return string(key), nil
 	}
 
@@ -23,7 +26,7 @@ func (sm *SecretManager) getCachedKey(name string) (string, error) {
 		return "", err
 	}
 
-	sm.keyCache[name] = []byte(key)
+	sm.keyCache.put(name, []byte(key))
 	return key, nil
 }
 func (sm *SecretManager) GenerateMasterKey() ([]byte, error) {
@@ -241,6 +244,89 @@ func (sm *SecretManager) loadWindowsKey() ([]byte, error) {
 	return []byte(encryptedKey), nil
 }
 
+// masterKeySize is the length of the keys GenerateMasterKey produces.
+const masterKeySize = 32
+
+// currentMasterKey returns the stored master key without creating one, unlike
+// loadMasterKey. A nil key means none is stored for this app yet.
+func (sm *SecretManager) currentMasterKey() ([]byte, error) {
+	switch runtime.GOOS {
+	case "linux", "darwin":
+		// #nosec G304 -- fixed path under the user's home directory
+		key, err := os.ReadFile(sm.GetKeyOsAgnosticPath())
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return key, err
+	case "windows":
+		key, err := keyring.Get(sm.GetAppName(), "master_key")
+		if errors.Is(err, keyring.ErrNotFound) {
+			return nil, nil
+		}
+		return []byte(key), err
+	default:
+		return nil, ErrUnsupportedPlatform
+	}
+}
+
+// ExportMasterKey writes the app's raw master key to path with 0600
+// permissions so it can be restored elsewhere with ImportMasterKey. Whoever
+// holds the file can decrypt every .enc file of the app, so callers must get
+// explicit confirmation first. An existing file at path is never overwritten.
+func (sm *SecretManager) ExportMasterKey(path string) error {
+	key, err := sm.currentMasterKey()
+	if err != nil {
+		return fmt.Errorf("failed to read master key: %w", err)
+	}
+	if key == nil {
+		return fmt.Errorf("no master key stored for app %q", sm.GetAppName())
+	}
+
+	// #nosec G304 -- path is chosen by the operator
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := f.Write(key); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to write master key: %w", err)
+	}
+	return f.Close()
+}
+
+// ImportMasterKey installs a key written by ExportMasterKey as the app's
+// master key. Importing the key that is already installed is a no-op. A
+// different existing key is only replaced when overwrite is set, since files
+// encrypted with it can no longer be decrypted afterwards.
+func (sm *SecretManager) ImportMasterKey(path string, overwrite bool) error {
+	// #nosec G304 -- path is chosen by the operator
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(key) != masterKeySize {
+		return fmt.Errorf("%w: %s is %d bytes, want %d", ErrInvalidMasterKey, path, len(key), masterKeySize)
+	}
+
+	current, err := sm.currentMasterKey()
+	if err != nil {
+		return fmt.Errorf("failed to read current master key: %w", err)
+	}
+	if bytes.Equal(current, key) {
+		return nil
+	}
+	if current != nil && !overwrite {
+		return fmt.Errorf("%w for app %q", ErrMasterKeyExists, sm.GetAppName())
+	}
+
+	if err := sm.storeMasterKey(key); err != nil {
+		return err
+	}
+	sm.keyCache.clear()
+	return nil
+}
+
 func (sm *SecretManager) GetKeyOsAgnosticPath() string {
 	home, _ := os.UserHomeDir()
 	appname := sm.GetAppName()
@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/aynaash/nextdeploy/shared/config"
+)
+
+func newTestSecretManager(t *testing.T, app string) *SecretManager {
+	t.Helper()
+	sm, err := NewSecretManager(WithConfig(&config.NextDeployConfig{App: config.AppConfig{Name: app}}))
+	if err != nil {
+		t.Fatalf("NewSecretManager: %v", err)
+	}
+	return sm
+}
+
+func TestExportImportMasterKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("master key lives in the Windows keyring")
+	}
+	t.Setenv("HOME", t.TempDir())
+
+	src := newTestSecretManager(t, "shop")
+	key, err := src.GeneratePlatformKey() // creates the master key
+	if err != nil {
+		t.Fatalf("GeneratePlatformKey: %v", err)
+	}
+
+	backup := filepath.Join(t.TempDir(), "shop.key")
+	if err := src.ExportMasterKey(backup); err != nil {
+		t.Fatalf("ExportMasterKey: %v", err)
+	}
+	info, err := os.Stat(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("backup mode = %o, want 0600", perm)
+	}
+	if err := src.ExportMasterKey(backup); err == nil {
+		t.Error("export must not overwrite an existing file")
+	}
+
+	// A fresh machine: a different app home, then restore the backup.
+	t.Setenv("HOME", t.TempDir())
+	dst := newTestSecretManager(t, "shop")
+	if err := dst.ImportMasterKey(backup, false); err != nil {
+		t.Fatalf("ImportMasterKey: %v", err)
+	}
+	restored, err := dst.GeneratePlatformKey()
+	if err != nil {
+		t.Fatalf("GeneratePlatformKey: %v", err)
+	}
+	if restored != key {
+		t.Error("restored platform key differs from the exported one")
+	}
+	if err := dst.ImportMasterKey(backup, false); err != nil {
+		t.Errorf("re-importing the installed key should be a no-op, got %v", err)
+	}
+}
+
+func TestImportMasterKeyGuards(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("master key lives in the Windows keyring")
+	}
+	t.Setenv("HOME", t.TempDir())
+	sm := newTestSecretManager(t, "shop")
+	if _, err := sm.GeneratePlatformKey(); err != nil {
+		t.Fatalf("GeneratePlatformKey: %v", err)
+	}
+
+	dir := t.TempDir()
+	short := filepath.Join(dir, "short.key")
+	if err := os.WriteFile(short, []byte("too short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.ImportMasterKey(short, true); !errors.Is(err, ErrInvalidMasterKey) {
+		t.Errorf("expected ErrInvalidMasterKey, got %v", err)
+	}
+
+	other := filepath.Join(dir, "other.key")
+	otherKey := bytes.Repeat([]byte{7}, masterKeySize)
+	if err := os.WriteFile(other, otherKey, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.ImportMasterKey(other, false); !errors.Is(err, ErrMasterKeyExists) {
+		t.Errorf("expected ErrMasterKeyExists without overwrite, got %v", err)
+	}
+	if err := sm.ImportMasterKey(other, true); err != nil {
+		t.Fatalf("ImportMasterKey with overwrite: %v", err)
+	}
+	current, err := sm.currentMasterKey()
+	if err != nil || !bytes.Equal(current, otherKey) {
+		t.Errorf("overwrite did not install the imported key (err=%v)", err)
+	}
+}
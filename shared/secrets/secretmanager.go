@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/aynaash/nextdeploy/shared"
 	"github.com/aynaash/nextdeploy/shared/config"
@@ -17,7 +18,7 @@ type SecretManager struct {
 	keyPath  string
 	cfg      *config.NextDeployConfig
 	secrets  map[string]*Secret
-	keyCache map[string][]byte
+	keyCache *keyCache
 	manager  *providerManager
 	mu       sync.RWMutex
 }
@@ -76,6 +77,14 @@ func WithKeyPath(path string) Option {
 	}
 }
 
+// WithKeyCache bounds the derived-key cache to size keys, each kept for at
+// most ttl. Zero values keep the defaults.
+func WithKeyCache(size int, ttl time.Duration) Option {
+	return func(sm *SecretManager) {
+		sm.keyCache = newKeyCache(size, ttl)
+	}
+}
+
 func WithProvider(name string, provider SecretProvider) Option {
 	return func(sm *SecretManager) {
 		sm.ensureProviderManager()
@@ -86,7 +95,7 @@ func WithProvider(name string, provider SecretProvider) Option {
 func NewSecretManager(opts ...Option) (*SecretManager, error) {
 	sm := &SecretManager{
 		secrets:  make(map[string]*Secret),
-		keyCache: make(map[string][]byte),
+		keyCache: newKeyCache(defaultKeyCacheSize, defaultKeyCacheTTL),
 	}
 
 	for _, opt := range opts {
@@ -112,3 +121,10 @@ func (sm *SecretManager) ensureProviderManager() {
 		}
 	}
 }
+
+// ConfigResolver resolves the ${secret:NAME} references in nextdeploy.yml
+// through this manager: its own secrets first, then each provider. Install
+// it with config.SetSecretResolver before loading the config.
+func (sm *SecretManager) ConfigResolver() config.SecretResolver {
+	return sm.GetSecret
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"time"
 )
 
@@ -57,7 +58,7 @@ func (sm *SecretManager) RotateSecrets() error {
 		secret.Value = string(encrypted)
 		secret.Version++
 		secret.ModifiedAt = time.Now().Unix()
-		sm.keyCache[name] = []byte(newKey)
+		sm.keyCache.put(name, []byte(newKey))
 	}
 
 	return nil
@@ -118,6 +119,19 @@ func (sm *SecretManager) SetSecret(name, value string, encrypt bool) error {
 	return nil
 }
 
+// names returns the provider names in the order they are consulted:
+// sorted, so a secret held by several providers always resolves the same way.
+func (pm *providerManager) names() []string {
+	names := make([]string, 0, len(pm.providers))
+	for name := range pm.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetSecret returns the manager's own secret name, or else the value of the
+// first provider, in name order, that holds it.
 func (sm *SecretManager) GetSecret(name string) (string, error) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
@@ -125,8 +139,8 @@ func (sm *SecretManager) GetSecret(name string) (string, error) {
 	secret, exists := sm.secrets[name]
 	if !exists {
 		if sm.manager != nil {
-			for _, provider := range sm.manager.providers {
-				if value, err := provider.GetSecret(name); err == nil {
+			for _, providerName := range sm.manager.names() {
+				if value, err := sm.manager.providers[providerName].GetSecret(name); err == nil {
 					return value, nil
 				}
 			}
@@ -218,3 +232,50 @@ func (sm *SecretManager) FlattenSecrets() map[string]string {
 
 	return result
 }
+
+// SecretInfo describes one available secret without its value.
+type SecretInfo struct {
+	Name string `json:"name"`
+	// Source is where the secret is read from: "local" for the manager's
+	// own secrets, otherwise the provider's name (doppler, vault).
+	Source    string `json:"source"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+// ListAllSecrets lists every secret the manager can resolve: its own, then
+// each provider's in name order. A name held by several sources is listed
+// once, under the one that wins (local secrets shadow providers). A provider
+// that cannot list is skipped and reported in the error, so the rest are
+// still returned.
+func (sm *SecretManager) ListAllSecrets() ([]SecretInfo, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	seen := make(map[string]bool, len(sm.secrets))
+	var out []SecretInfo
+	for name, secret := range sm.secrets {
+		seen[name] = true
+		out = append(out, SecretInfo{Name: name, Source: "local", Encrypted: secret.IsEncrypted})
+	}
+
+	var errs []error
+	if sm.manager != nil {
+		for _, providerName := range sm.manager.names() {
+			keys, err := sm.manager.providers[providerName].ListSecrets()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("list %s secrets: %w", providerName, err))
+				continue
+			}
+			for _, key := range keys {
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				out = append(out, SecretInfo{Name: key, Source: providerName})
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, errors.Join(errs...)
+}
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// stubProvider is a SecretProvider holding fixed names and values.
+type stubProvider struct {
+	SecretProvider
+	names  []string
+	values map[string]string
+	err    error
+}
+
+func (p stubProvider) ListSecrets() ([]string, error) { return p.names, p.err }
+
+func (p stubProvider) GetSecret(key string) (string, error) {
+	if v, ok := p.values[key]; ok {
+		return v, nil
+	}
+	return "", ErrSecretNotFound
+}
+
+func TestListAllSecrets(t *testing.T) {
+	sm := newTestSecretManager(t, "shop")
+	WithProvider("doppler", stubProvider{names: []string{"STRIPE_KEY", "DATABASE_URL"}})(sm)
+	WithProvider("vault", stubProvider{names: []string{"STRIPE_KEY", "SIGNING_KEY"}})(sm)
+	WithProvider("broken", stubProvider{err: errors.New("token expired")})(sm)
+	if err := sm.SetSecret("DATABASE_URL", "postgres://localhost/shop", false); err != nil {
+		t.Fatal(err)
+	}
+	sm.secrets["SESSION_KEY"] = &Secret{Value: "ciphertext", IsEncrypted: true}
+
+	got, err := sm.ListAllSecrets()
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("err = %v, want the broken provider reported", err)
+	}
+	want := []SecretInfo{
+		{Name: "DATABASE_URL", Source: "local"},
+		{Name: "SESSION_KEY", Source: "local", Encrypted: true},
+		{Name: "SIGNING_KEY", Source: "vault"},
+		{Name: "STRIPE_KEY", Source: "doppler"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListAllSecrets =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestGetSecretProviderOrder(t *testing.T) {
+	sm := newTestSecretManager(t, "shop")
+	WithProvider("vault", stubProvider{values: map[string]string{"STRIPE_KEY": "from-vault", "SIGNING_KEY": "signing"}})(sm)
+	WithProvider("doppler", stubProvider{values: map[string]string{"STRIPE_KEY": "from-doppler"}})(sm)
+	WithProvider("aws", stubProvider{})(sm)
+
+	// Map order is random; a few rounds would catch it leaking through.
+	for range 20 {
+		if got, err := sm.GetSecret("STRIPE_KEY"); err != nil || got != "from-doppler" {
+			t.Fatalf("GetSecret(STRIPE_KEY) = %q, %v; want doppler's value, the first provider by name", got, err)
+		}
+	}
+	if got, err := sm.GetSecret("SIGNING_KEY"); err != nil || got != "signing" {
+		t.Errorf("GetSecret(SIGNING_KEY) = %q, %v", got, err)
+	}
+	if _, err := sm.GetSecret("MISSING"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("GetSecret(MISSING) err = %v, want ErrSecretNotFound", err)
+	}
+}
@@ -0,0 +1,16 @@
+package shared
+
+import "strings"
+
+// ShellQuote returns s wrapped so it is a single, literal argument when the
+// string is interpreted by a POSIX shell (which is how the CLI runs remote
+// commands — via the login shell — and how a containerized build runs).
+// Every embedded single quote is rewritten as '\” and the whole value is
+// wrapped in single quotes, so shell metacharacters in user-supplied values
+// (secret keys/values, app names, commit refs) cannot break out and inject
+// commands.
+//
+//	ShellQuote(`a'b; rm -rf /`) => `'a'\''b; rm -rf /'`
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
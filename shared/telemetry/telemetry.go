@@ -28,6 +28,8 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/aynaash/nextdeploy/shared/httpx"
 )
 
 const (
@@ -253,7 +255,7 @@ func send(ev *Event) {
 	if sig := sign(ev); sig != "" {
 		req.Header.Set("X-NextDeploy-Signature", "ed25519="+sig)
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpx.New(httpx.Options{Timeout: sendTimeout}).Do(req)
 	if err != nil {
 		return
 	}
@@ -6,7 +6,6 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/sha256"
-	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -19,6 +18,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aynaash/nextdeploy/shared/httpx"
 	"github.com/aynaash/nextdeploy/shared/sensitive"
 
 	"github.com/aynaash/nextdeploy/shared"
@@ -98,12 +98,7 @@ func LatestRelease() (Release, error) {
 	var release Release
 	var lastErr error
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSHandshakeTimeout: 10 * time.Second,
-		},
-	}
+	client := httpx.New(httpx.Options{Timeout: 30 * time.Second})
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		req, err := http.NewRequest(http.MethodGet, apiURL, http.NoBody)
@@ -526,7 +521,7 @@ func downloadChecksums(url, destPath string) (map[string]string, error) {
 		return nil, err
 	}
 
-	client := &http.Client{Timeout: 2 * time.Minute}
+	client := httpx.New(httpx.Options{Timeout: 2 * time.Minute})
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -646,13 +641,10 @@ func attemptDownload(url, destPath, binaryName string, opts *UpdateOptions) erro
 	// Secure by default: the standard client verifies TLS. We only build an
 	// insecure transport when the caller has explicitly opted out (e.g. an
 	// air-gapped mirror with a self-signed cert), and we say so loudly.
-	client := &http.Client{Timeout: 10 * time.Minute}
 	if !opts.VerifySSL {
 		fmt.Println("⚠️  TLS certificate verification is DISABLED for this download (VerifySSL=false).")
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // #nosec G402 -- explicit, opt-in only
-		}
 	}
+	client := httpx.New(httpx.Options{Timeout: 10 * time.Minute, InsecureSkipVerify: !opts.VerifySSL})
 
 	resp, err := client.Do(req)
 	if err != nil {
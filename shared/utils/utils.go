@@ -9,8 +9,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -174,7 +176,7 @@ func CopyDir(src, dst string) error {
 	})
 }
 
-func writeTarEntry(tw *tar.Writer, r fileResult, log logger) error {
+func writeTarEntry(tw *tar.Writer, r fileResult, mtime time.Time, log logger) error {
 	if r.info == nil {
 		log.Info("[tarball]   skip (vanished): %s", r.job.relPath)
 		return nil
@@ -194,6 +196,7 @@ func writeTarEntry(tw *tar.Writer, r fileResult, log logger) error {
 		return fmt.Errorf("file info header %s: %w", r.job.relPath, err)
 	}
 	header.Name = r.job.relPath
+	normalizeHeader(header, mtime)
 
 	if err := tw.WriteHeader(header); err != nil {
 		return fmt.Errorf("write header %s: %w", r.job.relPath, err)
@@ -281,6 +284,36 @@ func readFile(job fileJob, pool *sync.Pool, workerID int, log logger) fileResult
 	return fileResult{job: job, info: info, data: data}
 }
 
+// archiveTime is the mtime stamped on every tarball entry so that the same
+// files always produce the same bytes: SOURCE_DATE_EPOCH when set, else the
+// HEAD commit time of the git checkout sourceDir is in, else now. Entries are
+// already written in WalkDir's lexical order.
+func archiveTime(sourceDir string) time.Time {
+	if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+		if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(sec, 0)
+		}
+	}
+	// #nosec G204 -- fixed git arguments; sourceDir is our own build output
+	out, err := exec.Command("git", "-C", sourceDir, "log", "-1", "--format=%ct").Output()
+	if err == nil {
+		if sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64); err == nil {
+			return time.Unix(sec, 0)
+		}
+	}
+	return time.Now().Truncate(time.Second)
+}
+
+// normalizeHeader drops the per-machine and per-run parts of a header (owner,
+// access/change times) and pins its mtime. The daemon chowns releases on
+// extract, so the archive's owner never mattered.
+func normalizeHeader(h *tar.Header, mtime time.Time) {
+	h.ModTime = mtime
+	h.AccessTime, h.ChangeTime = time.Time{}, time.Time{}
+	h.Uid, h.Gid = 0, 0
+	h.Uname, h.Gname = "", ""
+}
+
 func CreateTarball(sourceDir, targetTar, targetType string, payload *nextcore.NextCorePayload, log logger) error {
 	outputMode := payload.OutputMode
 	log.Info("[tarball] Starting — source=%s target=%s mode=%s workers=%d",
@@ -308,6 +341,8 @@ func CreateTarball(sourceDir, targetTar, targetType string, payload *nextcore.Ne
 		return fmt.Errorf("create gzip writer: %w", err)
 	}
 	tw := tar.NewWriter(gzw)
+	mtime := archiveTime(sourceDir)
+	log.Info("[tarball] Entry mtime: %s", mtime.UTC().Format(time.RFC3339))
 	log.Info("[tarball] Phase 1: Walking %s...", sourceDir)
 	walkStart := time.Now()
 
@@ -375,6 +410,7 @@ func CreateTarball(sourceDir, targetTar, targetType string, payload *nextcore.Ne
 				return nil
 			}
 			h.Name = filepath.ToSlash(relPath) + "/"
+			normalizeHeader(h, mtime)
 			dirHeaders = append(dirHeaders, *h)
 			return nil
 		}
@@ -477,7 +513,7 @@ func CreateTarball(sourceDir, targetTar, targetType string, payload *nextcore.Ne
 		for h.Len() > 0 && (*h)[0].job.index == nextExpected {
 			r := heap.Pop(h).(fileResult)
 
-			if err := writeTarEntry(tw, r, log); err != nil {
+			if err := writeTarEntry(tw, r, mtime, log); err != nil {
 				return err
 			}
 			// Release the look-ahead slot now this entry is on disk, letting
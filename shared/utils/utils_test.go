@@ -2,6 +2,7 @@ package utils
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"path/filepath"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/aynaash/nextdeploy/shared/nextcore"
 )
@@ -115,3 +117,44 @@ func TestCreateTarballRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+// TestCreateTarballReproducible builds the same sources twice, with their
+// on-disk mtimes changed in between, and expects byte-identical archives.
+func TestCreateTarballReproducible(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	src := t.TempDir()
+	files := map[string]string{"server.js": "console.log(1)\n", "nested/page.html": "<p>hi</p>\n"}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	payload := &nextcore.NextCorePayload{OutputMode: nextcore.OutputModeStandalone}
+
+	build := func(name string) []byte {
+		target := filepath.Join(t.TempDir(), name)
+		if err := CreateTarball(src, target, "vps", payload, silentLogger{}); err != nil {
+			t.Fatalf("CreateTarball: %v", err)
+		}
+		data, err := os.ReadFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := build("a.tar.gz")
+	later := time.Now().Add(time.Hour)
+	for name := range files {
+		if err := os.Chtimes(filepath.Join(src, name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if second := build("b.tar.gz"); !bytes.Equal(first, second) {
+		t.Fatal("same sources produced different tarballs")
+	}
+}